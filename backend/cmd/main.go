@@ -5,15 +5,29 @@ import (
 	"log"
 	"time"
 
+	"ejewel/internal/apikeys"
+	"ejewel/internal/catalog"
 	"ejewel/internal/config"
 	"ejewel/internal/database"
+	"ejewel/internal/events"
 	"ejewel/internal/handlers"
+	"ejewel/internal/ledger"
+	"ejewel/internal/mailer"
 	"ejewel/internal/middleware"
 	"ejewel/internal/models"
+	"ejewel/internal/payments"
+	"ejewel/internal/pricing"
+	"ejewel/internal/ratelimit"
+	"ejewel/internal/rbac"
+	"ejewel/internal/repository"
+	"ejewel/internal/repository/memory"
+	"ejewel/internal/repository/mongodb"
+	"ejewel/internal/revocation"
+	"ejewel/internal/search"
+	"ejewel/internal/shipping"
 	"ejewel/internal/utils"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -31,41 +45,170 @@ func main() {
 	}
 	defer database.Disconnect()
 
+	if err := database.EnsureIndexes(); err != nil {
+		log.Fatal("Failed to create indexes:", err)
+	}
+
+	repos := mongodb.NewRepositories()
+
 	// Seed initial data
-	seedData()
+	seedRoles(repos.Roles)
+	seedData(repos)
+	seedShippingZones(repos.Zones)
+
+	// Load metal rates for rate-based pricing
+	var rateFeed pricing.Feed
+	if cfg.RateFeedFile != "" {
+		rateFeed = pricing.NewFileFeed(cfg.RateFeedFile)
+	}
+	pricingEngine := pricing.NewEngine(rateFeed, repos.MetalRates, repos.Products)
+	loadRates(pricingEngine, rateFeed != nil)
+	pricingEngine.Start(context.Background(), cfg.RateSyncInterval)
+
+	// Payment gateway
+	var paymentProvider payments.Provider
+	switch cfg.PaymentProvider {
+	case "mock":
+		paymentProvider = payments.NewMockProvider(cfg.PaymentWebhookSecret, cfg.PaymentIntentTTL)
+	default:
+		log.Fatal("Unknown payment provider: ", cfg.PaymentProvider)
+	}
+
+	// Outgoing email
+	var mail mailer.Mailer
+	switch cfg.MailProvider {
+	case "smtp":
+		if mail, err = mailer.NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom); err != nil {
+			log.Fatal("Failed to configure SMTP mailer: ", err)
+		}
+	case "log":
+		mail = mailer.NewFileMailer(cfg.MailFile)
+	default:
+		log.Fatal("Unknown mail provider: ", cfg.MailProvider)
+	}
+
+	// Access token revocation
+	var revokedTokens repository.RevocationRepository
+	switch cfg.RevocationStore {
+	case "mongo":
+		revokedTokens = repos.Revocations
+	case "memory":
+		revokedTokens = memory.NewRevocationRepository()
+	default:
+		log.Fatal("Unknown revocation store: ", cfg.RevocationStore)
+	}
+	revocations := revocation.NewList(repos.Users, revokedTokens, cfg.RevocationCacheSize, cfg.RevocationCacheTTL)
+
+	// Staff permissions
+	roles := rbac.NewRoles(repos.Roles, cfg.RoleCacheTTL)
+
+	// Rate limiting
+	var limits ratelimit.Store
+	switch cfg.RateLimitStore {
+	case "memory":
+		limits = ratelimit.NewMemoryStore()
+	case "mongo":
+		limits = ratelimit.NewMongoStore(database.RateLimits())
+	default:
+		log.Fatal("Unknown rate limit store: ", cfg.RateLimitStore)
+	}
+	perAccount := middleware.LimitByAccount(limits, "api", cfg.APIRateLimits.Account)
+
+	// API keys for integrations
+	keys := apikeys.New(repos.APIKeys, repos.Users, limits, cfg.APIKeyRateLimit)
+
+	// Product search
+	synonyms := search.NewSynonyms(search.DefaultSynonyms)
+	if cfg.SearchSynonymsFile != "" {
+		if synonyms, err = search.LoadSynonyms(cfg.SearchSynonymsFile); err != nil {
+			log.Fatal("Failed to load search synonyms:", err)
+		}
+	}
+	searchIndex := search.NewIndex(repos.Products, synonyms)
+	loadSearchIndex(searchIndex)
+	searchIndex.Start(context.Background(), cfg.SearchReloadInterval)
+
+	// What sellers are owed
+	sellerLedger := ledger.New(repos.Ledger, repos.Commissions, repos.Payouts, repos.Sellers, repos.Products)
+
+	// Copies of names and images kept on other documents, and ledger
+	// postings, made in the background
+	bus := events.NewBus(repos.Events, cfg.EventMaxAttempts)
+	events.SyncCopies(bus, repos)
+	events.PostLedger(bus, repos, sellerLedger)
+	bus.Subscribe(models.EventCategoryRenamed, func(ctx context.Context, event *models.Event) error {
+		return searchIndex.Refresh(ctx, repository.ProductQuery{CategoryIDs: []primitive.ObjectID{event.SubjectID}})
+	})
+	bus.Start(context.Background(), cfg.EventPollInterval)
+
+	// Bulk product imports
+	importer := catalog.NewImporter(repos.Products, repos.Categories, repos.ImportJobs, pricingEngine, searchIndex, bus)
+	importer.Start(context.Background())
 
 	// Initialize Gin
 	router := gin.Default()
+	// Client IPs key the rate limits, so X-Forwarded-For is only believed
+	// from configured proxies
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatal("Invalid trusted proxies: ", err)
+	}
 	router.Use(middleware.CORSMiddleware())
 
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler()
-	productHandler := handlers.NewProductHandler()
-	categoryHandler := handlers.NewCategoryHandler()
-	cartHandler := handlers.NewCartHandler()
-	wishlistHandler := handlers.NewWishlistHandler()
-	orderHandler := handlers.NewOrderHandler()
-	reviewHandler := handlers.NewReviewHandler()
-	adminHandler := handlers.NewAdminHandler()
+	authHandler := handlers.NewAuthHandler(repos.Users, repos.Sessions, revocations, repos.Carts, repos.Products, pricingEngine, mail, bus)
+	productHandler := handlers.NewProductHandler(repos.Products, repos.Categories, pricingEngine, searchIndex, bus)
+	categoryHandler := handlers.NewCategoryHandler(repos.Categories, repos.Products, searchIndex, bus)
+	catalogHandler := handlers.NewCatalogHandler(importer, repos.ImportJobs, repos.Products, repos.Categories)
+	cartHandler := handlers.NewCartHandler(repos.Carts, repos.Products, repos.Coupons, repos.Zones, pricingEngine)
+	wishlistHandler := handlers.NewWishlistHandler(repos.Wishlists, repos.Products)
+	orderHandler := handlers.NewOrderHandler(repos.Orders, repos.Carts, repos.Products, repos.Users, repos.Sellers, repos.Coupons, repos.Zones, repos.Counters, pricingEngine, paymentProvider, bus)
+	reviewHandler := handlers.NewReviewHandler(repos.Reviews, repos.Products, repos.Users, repos.Orders, roles)
+	adminHandler := handlers.NewAdminHandler(repos.Users, repos.Products, repos.Orders, revocations, roles)
+	roleHandler := handlers.NewRoleHandler(repos.Roles, repos.Users, roles)
+	apiKeyHandler := handlers.NewAPIKeyHandler(keys, repos.APIKeys, roles)
+	sellerHandler := handlers.NewSellerHandler(repos.Sellers, repos.Users, repos.Products, repos.Orders, revocations, bus)
+	ledgerHandler := handlers.NewLedgerHandler(sellerLedger, repos.Ledger, repos.Commissions, repos.Payouts, repos.Sellers)
+	pricingHandler := handlers.NewPricingHandler(pricingEngine)
+	couponHandler := handlers.NewCouponHandler(repos.Coupons)
+	returnHandler := handlers.NewReturnHandler(repos.Returns, repos.Orders, repos.Products, paymentProvider, bus)
+	shippingHandler := handlers.NewShippingHandler(repos.Zones, repos.Carts, repos.Products, pricingEngine)
+	paymentHandler := handlers.NewPaymentHandler(repos.Orders, repos.Products, repos.Coupons, repos.Counters, paymentProvider, bus)
+	paymentHandler.StartExpiryWorker(context.Background(), time.Minute)
 
 	// API routes
 	api := router.Group("/api")
+	api.Use(middleware.LimitByIP(limits, "api", cfg.APIRateLimits.IP))
 	{
 		// Health check
 		api.GET("/health", func(c *gin.Context) {
 			c.JSON(200, gin.H{"status": "ok", "message": "eJewel API is running"})
 		})
 
-		// Auth routes
+		// Auth routes (those taking credentials or sending email have tighter
+		// limits per client IP and per email address or challenged user)
 		auth := api.Group("/auth")
+		authByIP := middleware.LimitByIP(limits, "auth", cfg.AuthRateLimits.IP)
+		authByAccount := middleware.LimitByAccount(limits, "auth", cfg.AuthRateLimits.Account)
 		{
-			auth.POST("/register", authHandler.Register)
-			auth.POST("/login", authHandler.Login)
+			auth.POST("/register", authByIP, authByAccount, authHandler.Register)
+			auth.POST("/login", authByIP, authByAccount, authHandler.Login)
+			auth.POST("/login/2fa", authByIP, authByAccount, authHandler.LoginTwoFactor)
 			auth.POST("/refresh", authHandler.RefreshToken)
-			auth.POST("/logout", middleware.AuthMiddleware(), authHandler.Logout)
-			auth.GET("/profile", middleware.AuthMiddleware(), authHandler.GetProfile)
-			auth.PUT("/profile", middleware.AuthMiddleware(), authHandler.UpdateProfile)
-			auth.PUT("/change-password", middleware.AuthMiddleware(), authHandler.ChangePassword)
+			auth.POST("/verify-email", authByIP, authByAccount, authHandler.VerifyEmail)
+			auth.POST("/resend-verification", middleware.AuthMiddleware(revocations), authHandler.ResendVerification)
+			auth.POST("/forgot-password", authByIP, authByAccount, authHandler.ForgotPassword)
+			auth.POST("/reset-password", authByIP, authByAccount, authHandler.ResetPassword)
+			auth.POST("/2fa/setup", middleware.AuthMiddleware(revocations), authHandler.SetupTwoFactor)
+			auth.POST("/2fa/confirm", middleware.AuthMiddleware(revocations), authHandler.ConfirmTwoFactor)
+			auth.POST("/2fa/disable", middleware.AuthMiddleware(revocations), authHandler.DisableTwoFactor)
+			auth.POST("/2fa/recovery-codes", middleware.AuthMiddleware(revocations), authHandler.RegenerateRecoveryCodes)
+			auth.POST("/logout", middleware.AuthMiddleware(revocations), authHandler.Logout)
+			auth.GET("/sessions", middleware.AuthMiddleware(revocations), authHandler.GetSessions)
+			auth.DELETE("/sessions", middleware.AuthMiddleware(revocations), authHandler.RevokeOtherSessions)
+			auth.DELETE("/sessions/:id", middleware.AuthMiddleware(revocations), authHandler.RevokeSession)
+			auth.GET("/profile", middleware.AuthMiddleware(revocations), authHandler.GetProfile)
+			auth.PUT("/profile", middleware.AuthMiddleware(revocations), authHandler.UpdateProfile)
+			auth.PUT("/change-password", middleware.AuthMiddleware(revocations), authHandler.ChangePassword)
 		}
 
 		// Product routes (public)
@@ -76,31 +219,42 @@ func main() {
 			products.GET("/new-arrivals", productHandler.GetNewArrivals)
 			products.GET("/best-sellers", productHandler.GetBestSellers)
 			products.GET("/search", productHandler.SearchProducts)
+			products.GET("/suggest", productHandler.SuggestProducts)
+			products.GET("/facets", productHandler.GetProductFacets)
 			products.GET("/:id", productHandler.GetProduct)
 			products.GET("/:id/reviews", reviewHandler.GetProductReviews)
 		}
 
+		// Metal rate routes (public)
+		api.GET("/rates", pricingHandler.GetRates)
+
 		// Category routes (public)
 		categories := api.Group("/categories")
 		{
 			categories.GET("", categoryHandler.GetCategories)
+			categories.GET("/tree", categoryHandler.GetCategoryTree)
 			categories.GET("/:id", categoryHandler.GetCategory)
 		}
 
-		// Cart routes (authenticated)
+		// Cart routes (guests identify their cart with the X-Cart-Token header)
 		cart := api.Group("/cart")
-		cart.Use(middleware.AuthMiddleware())
+		cart.Use(middleware.OptionalAuthMiddleware(revocations), perAccount)
 		{
 			cart.GET("", cartHandler.GetCart)
 			cart.POST("", cartHandler.AddToCart)
+			cart.POST("/acknowledge", cartHandler.AcknowledgeChanges)
+			cart.POST("/apply-coupon", middleware.AuthMiddleware(revocations), cartHandler.ApplyCoupon)
 			cart.PUT("/:productId", cartHandler.UpdateCartItem)
 			cart.DELETE("/:productId", cartHandler.RemoveFromCart)
 			cart.DELETE("", cartHandler.ClearCart)
 		}
 
+		// Shipping routes (quotes the user's or guest's cart)
+		api.GET("/shipping/quote", middleware.OptionalAuthMiddleware(revocations), perAccount, shippingHandler.Quote)
+
 		// Wishlist routes (authenticated)
 		wishlist := api.Group("/wishlist")
-		wishlist.Use(middleware.AuthMiddleware())
+		wishlist.Use(middleware.AuthMiddleware(revocations), perAccount)
 		{
 			wishlist.GET("", wishlistHandler.GetWishlist)
 			wishlist.POST("", wishlistHandler.AddToWishlist)
@@ -110,40 +264,127 @@ func main() {
 
 		// Order routes (authenticated)
 		orders := api.Group("/orders")
-		orders.Use(middleware.AuthMiddleware())
+		orders.Use(middleware.AuthMiddleware(revocations), perAccount)
 		{
 			orders.GET("", orderHandler.GetOrders)
 			orders.POST("", orderHandler.CreateOrder)
 			orders.GET("/:id", orderHandler.GetOrder)
+			orders.GET("/:id/timeline", orderHandler.GetOrderTimeline)
+			orders.GET("/:id/invoice", orderHandler.GetInvoice)
 			orders.POST("/:id/cancel", orderHandler.CancelOrder)
+			orders.POST("/:id/returns", returnHandler.CreateReturn)
+		}
+
+		// Return routes (authenticated)
+		returns := api.Group("/returns")
+		returns.Use(middleware.AuthMiddleware(revocations), perAccount)
+		{
+			returns.GET("", returnHandler.GetMyReturns)
+			returns.GET("/:id", returnHandler.GetMyReturn)
+		}
+
+		// Payment routes
+		payment := api.Group("/payments")
+		{
+			payment.POST("/webhook", paymentHandler.Webhook)
+			if cfg.PaymentProvider == "mock" && cfg.PaymentSimulation {
+				payment.POST("/mock/simulate", middleware.AuthMiddleware(revocations), paymentHandler.SimulatePayment)
+			}
 		}
 
 		// Review routes (authenticated)
 		reviews := api.Group("/reviews")
-		reviews.Use(middleware.AuthMiddleware())
+		reviews.Use(middleware.AuthMiddleware(revocations), perAccount)
 		{
 			reviews.POST("", reviewHandler.CreateReview)
 			reviews.PUT("/:id", reviewHandler.UpdateReview)
 			reviews.DELETE("/:id", reviewHandler.DeleteReview)
 		}
 
-		// Admin routes
+		// Seller routes (applying is open to any user; the rest needs an
+		// approved seller)
+		seller := api.Group("/seller")
+		seller.Use(middleware.AuthMiddleware(revocations), perAccount)
+		{
+			seller.POST("/apply", sellerHandler.Apply)
+			seller.GET("/profile", sellerHandler.GetProfile)
+
+			store := seller.Group("", middleware.SellerMiddleware())
+			store.GET("/products", sellerHandler.GetProducts)
+			store.POST("/products", productHandler.CreateProduct)
+			store.GET("/products/:id", sellerHandler.GetProduct)
+			store.PUT("/products/:id", sellerHandler.OwnProduct, productHandler.UpdateProduct)
+			store.DELETE("/products/:id", sellerHandler.OwnProduct, productHandler.DeleteProduct)
+			store.GET("/orders", sellerHandler.GetOrders)
+			store.GET("/orders/:id", sellerHandler.GetOrder)
+			store.PUT("/orders/:id/fulfilment", sellerHandler.UpdateFulfilment)
+		}
+
+		// Admin routes (staff, or API keys they issued; each route names the
+		// permission it needs)
 		admin := api.Group("/admin")
-		admin.Use(middleware.AuthMiddleware(), middleware.AdminMiddleware())
+		admin.Use(middleware.APIKeyOrAuthMiddleware(revocations, keys), middleware.AdminMiddleware(), perAccount)
 		{
-			admin.GET("/dashboard", adminHandler.GetDashboardStats)
-			admin.GET("/users", adminHandler.GetUsers)
-			admin.GET("/users/:id", adminHandler.GetUser)
-			admin.PUT("/users/:id", adminHandler.UpdateUser)
-			admin.GET("/products", adminHandler.GetAllProducts)
-			admin.POST("/products", productHandler.CreateProduct)
-			admin.PUT("/products/:id", productHandler.UpdateProduct)
-			admin.DELETE("/products/:id", productHandler.DeleteProduct)
-			admin.GET("/orders", orderHandler.GetAllOrders)
-			admin.PUT("/orders/:id/status", orderHandler.UpdateOrderStatus)
-			admin.POST("/categories", categoryHandler.CreateCategory)
-			admin.PUT("/categories/:id", categoryHandler.UpdateCategory)
-			admin.DELETE("/categories/:id", categoryHandler.DeleteCategory)
+			can := func(permission models.Permission) gin.HandlerFunc {
+				return middleware.RequirePermission(roles, permission)
+			}
+
+			admin.GET("/dashboard", can(models.PermDashboardRead), adminHandler.GetDashboardStats)
+			admin.GET("/users", can(models.PermUsersRead), adminHandler.GetUsers)
+			admin.GET("/users/:id", can(models.PermUsersRead), adminHandler.GetUser)
+			admin.PUT("/users/:id", can(models.PermUsersWrite), adminHandler.UpdateUser)
+			admin.GET("/roles", can(models.PermRolesManage), roleHandler.GetRoles)
+			admin.POST("/roles", can(models.PermRolesManage), roleHandler.CreateRole)
+			admin.PUT("/roles/:id", can(models.PermRolesManage), roleHandler.UpdateRole)
+			admin.DELETE("/roles/:id", can(models.PermRolesManage), roleHandler.DeleteRole)
+			admin.GET("/api-keys", middleware.SignedInMiddleware(), can(models.PermAPIKeysManage), apiKeyHandler.GetAPIKeys)
+			admin.POST("/api-keys", middleware.SignedInMiddleware(), can(models.PermAPIKeysManage), apiKeyHandler.CreateAPIKey)
+			admin.DELETE("/api-keys/:id", middleware.SignedInMiddleware(), can(models.PermAPIKeysManage), apiKeyHandler.RevokeAPIKey)
+			admin.GET("/products", can(models.PermProductsRead), adminHandler.GetAllProducts)
+			admin.POST("/products", can(models.PermProductsWrite), productHandler.CreateProduct)
+			admin.POST("/products/import", can(models.PermProductsWrite), catalogHandler.ImportProducts)
+			admin.GET("/products/import/:id", can(models.PermProductsRead), catalogHandler.GetImportJob)
+			admin.GET("/products/export", can(models.PermProductsRead), catalogHandler.ExportProducts)
+			admin.PUT("/products/:id", can(models.PermProductsWrite), productHandler.UpdateProduct)
+			admin.DELETE("/products/:id", can(models.PermProductsWrite), productHandler.DeleteProduct)
+			admin.GET("/orders", can(models.PermOrdersRead), orderHandler.GetAllOrders)
+			admin.PUT("/orders/:id/status", can(models.PermOrdersStatus), orderHandler.UpdateOrderStatus)
+			admin.GET("/shipping/zones", can(models.PermShippingRead), shippingHandler.GetZones)
+			admin.POST("/shipping/zones", can(models.PermShippingWrite), shippingHandler.CreateZone)
+			admin.PUT("/shipping/zones/:id", can(models.PermShippingWrite), shippingHandler.UpdateZone)
+			admin.DELETE("/shipping/zones/:id", can(models.PermShippingWrite), shippingHandler.DeleteZone)
+			admin.GET("/returns", can(models.PermReturnsRead), returnHandler.GetAllReturns)
+			admin.GET("/returns/:id", can(models.PermReturnsRead), returnHandler.GetReturn)
+			admin.POST("/returns/:id/approve", can(models.PermReturnsManage), returnHandler.ApproveReturn)
+			admin.POST("/returns/:id/reject", can(models.PermReturnsManage), returnHandler.RejectReturn)
+			admin.POST("/returns/:id/pickup", can(models.PermReturnsManage), returnHandler.ScheduleReturnPickup)
+			admin.POST("/returns/:id/inspect", can(models.PermReturnsManage), returnHandler.InspectReturn)
+			admin.POST("/returns/:id/refund", can(models.PermRefundsIssue), returnHandler.RefundReturn)
+			admin.POST("/categories", can(models.PermCategoriesWrite), categoryHandler.CreateCategory)
+			admin.PUT("/categories/:id", can(models.PermCategoriesWrite), categoryHandler.UpdateCategory)
+			admin.DELETE("/categories/:id", can(models.PermCategoriesWrite), categoryHandler.DeleteCategory)
+			admin.GET("/rates", can(models.PermRatesRead), pricingHandler.GetRates)
+			admin.PUT("/rates", can(models.PermRatesWrite), pricingHandler.UpdateRates)
+			admin.POST("/rates/sync", can(models.PermRatesWrite), pricingHandler.SyncRates)
+			admin.GET("/coupons", can(models.PermCouponsRead), couponHandler.GetCoupons)
+			admin.GET("/coupons/:id", can(models.PermCouponsRead), couponHandler.GetCoupon)
+			admin.POST("/coupons", can(models.PermCouponsWrite), couponHandler.CreateCoupon)
+			admin.PUT("/coupons/:id", can(models.PermCouponsWrite), couponHandler.UpdateCoupon)
+			admin.DELETE("/coupons/:id", can(models.PermCouponsWrite), couponHandler.DeleteCoupon)
+			admin.GET("/sellers", can(models.PermSellersRead), sellerHandler.GetSellers)
+			admin.GET("/sellers/:id", can(models.PermSellersRead), sellerHandler.GetSeller)
+			admin.POST("/sellers/:id/approve", can(models.PermSellersManage), sellerHandler.ApproveSeller)
+			admin.POST("/sellers/:id/reject", can(models.PermSellersManage), sellerHandler.RejectSeller)
+			admin.POST("/sellers/:id/suspend", can(models.PermSellersManage), sellerHandler.SuspendSeller)
+			admin.GET("/sellers/:id/statement", can(models.PermPayoutsRead), ledgerHandler.GetStatement)
+			admin.GET("/commissions", can(models.PermPayoutsRead), ledgerHandler.GetCommissionRules)
+			admin.POST("/commissions", can(models.PermPayoutsManage), ledgerHandler.CreateCommissionRule)
+			admin.PUT("/commissions/:id", can(models.PermPayoutsManage), ledgerHandler.UpdateCommissionRule)
+			admin.DELETE("/commissions/:id", can(models.PermPayoutsManage), ledgerHandler.DeleteCommissionRule)
+			admin.GET("/payouts", can(models.PermPayoutsRead), ledgerHandler.GetPayouts)
+			admin.POST("/payouts", can(models.PermPayoutsManage), ledgerHandler.CreatePayoutBatch)
+			admin.GET("/payouts/:id", can(models.PermPayoutsRead), ledgerHandler.GetPayout)
+			admin.POST("/payouts/:id/paid", can(models.PermPayoutsManage), ledgerHandler.MarkPayoutPaid)
 		}
 	}
 
@@ -151,14 +392,76 @@ func main() {
 	router.Run(":" + cfg.Port)
 }
 
-func seedData() {
+func loadRates(engine *pricing.Engine, syncFeed bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	if err := engine.Load(ctx); err != nil {
+		log.Println("Failed to load metal rates:", err)
+	}
+
+	if syncFeed {
+		if _, err := engine.SyncFeed(ctx); err != nil {
+			log.Println("Failed to sync metal rates:", err)
+		}
+	}
+}
+
+func loadSearchIndex(index *search.Index) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	if err := index.Load(ctx); err != nil {
+		log.Println("Failed to load search index:", err)
+	}
+}
+
+// seedShippingZones installs the default shipping zones when none exist, so
+// existing databases can take orders once shipping is zone based.
+func seedShippingZones(zones repository.ShippingZoneRepository) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	count, err := zones.Count(ctx)
+	if err != nil || count > 0 {
+		return
+	}
+
+	for _, zone := range shipping.DefaultZones() {
+		zone.ID = primitive.NewObjectID()
+		zones.Create(ctx, &zone)
+	}
+	log.Println("Default shipping zones created")
+}
+
+// seedRoles installs any default staff role that is missing. Roles that
+// exist are left as configured.
+func seedRoles(roles repository.RoleRepository) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, role := range models.DefaultRoles() {
+		if _, err := roles.FindByName(ctx, role.Name); err != repository.ErrNotFound {
+			continue
+		}
+		role.ID = primitive.NewObjectID()
+		role.CreatedAt = time.Now()
+		role.UpdatedAt = time.Now()
+		if err := roles.Create(ctx, &role); err != nil {
+			log.Println("Failed to create role", role.Name+":", err)
+			continue
+		}
+		log.Println("Role created:", role.Name)
+	}
+}
+
+func seedData(repos repository.Repositories) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	// Check if admin exists
-	var existingAdmin models.User
-	err := database.Users().FindOne(ctx, bson.M{"role": models.RoleAdmin}).Decode(&existingAdmin)
-	if err == nil {
+	admins, err := repos.Users.Count(ctx, repository.UserQuery{Role: models.RoleAdmin})
+	if err == nil && admins > 0 {
 		log.Println("Admin user already exists, skipping seed")
 		return
 	}
@@ -168,17 +471,18 @@ func seedData() {
 	// Create admin user
 	hashedPassword, _ := utils.HashPassword(config.AppConfig.AdminPassword)
 	admin := models.User{
-		ID:        primitive.NewObjectID(),
-		Email:     config.AppConfig.AdminEmail,
-		Password:  hashedPassword,
-		FirstName: "Admin",
-		LastName:  "User",
-		Role:      models.RoleAdmin,
-		IsActive:  true,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		ID:         primitive.NewObjectID(),
+		Email:      config.AppConfig.AdminEmail,
+		Password:   hashedPassword,
+		FirstName:  "Admin",
+		LastName:   "User",
+		Role:       models.RoleAdmin,
+		IsActive:   true,
+		IsVerified: true,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
 	}
-	database.Users().InsertOne(ctx, admin)
+	repos.Users.Create(ctx, &admin)
 	log.Println("Admin user created:", admin.Email)
 
 	// Create categories
@@ -191,8 +495,8 @@ func seedData() {
 		{ID: primitive.NewObjectID(), Name: "Anklets", Slug: "anklets", Description: "Traditional and modern anklets", Icon: "🦶", IsActive: true, SortOrder: 6, CreatedAt: time.Now(), UpdatedAt: time.Now()},
 	}
 
-	for _, cat := range categories {
-		database.Categories().InsertOne(ctx, cat)
+	for i := range categories {
+		repos.Categories.Create(ctx, &categories[i])
 	}
 	log.Println("Categories created")
 
@@ -417,11 +721,10 @@ func seedData() {
 		},
 	}
 
-	for _, prod := range products {
-		database.Products().InsertOne(ctx, prod)
+	for i := range products {
+		repos.Products.Create(ctx, &products[i])
 	}
 	log.Println("Sample products created")
 
 	log.Println("Seed data complete!")
 }
-
@@ -0,0 +1,113 @@
+// Package apikeys issues and checks the API keys that integrations use to
+// call the admin API. A key is shown once when it is issued; afterwards only
+// its SHA-256 hash is kept, so a leaked database does not leak usable keys.
+package apikeys
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"ejewel/internal/models"
+	"ejewel/internal/ratelimit"
+	"ejewel/internal/repository"
+	"ejewel/internal/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// keyPrefix starts every key, which makes keys easy to spot in logs and
+// secret scanners.
+const keyPrefix = "ejk_"
+
+// touchInterval is how often the last use of a key is written, so a busy
+// key does not cost a write per request.
+const touchInterval = time.Minute
+
+// ErrInvalidKey is returned for keys that are unknown, revoked or expired,
+// or whose issuer can no longer sign in.
+var ErrInvalidKey = errors.New("invalid API key")
+
+type Keys struct {
+	keys         repository.APIKeyRepository
+	users        repository.UserRepository
+	limits       ratelimit.Store
+	defaultLimit int
+}
+
+// New checks keys against repo and meters them in limits. Keys without a
+// rate limit of their own get defaultLimit requests a minute, or are not
+// limited when it is zero.
+func New(keys repository.APIKeyRepository, users repository.UserRepository, limits ratelimit.Store, defaultLimit int) *Keys {
+	return &Keys{keys: keys, users: users, limits: limits, defaultLimit: defaultLimit}
+}
+
+// Issue generates a key, stores the hash of it on key and returns the key
+// itself, which cannot be recovered later.
+func (k *Keys) Issue(ctx context.Context, key *models.APIKey) (string, error) {
+	secret, err := utils.GenerateRandomToken(24)
+	if err != nil {
+		return "", err
+	}
+	raw := keyPrefix + secret
+
+	key.ID = primitive.NewObjectID()
+	key.Prefix = raw[:len(keyPrefix)+8]
+	key.KeyHash = utils.HashToken(raw)
+	key.CreatedAt = time.Now()
+	if err := k.keys.Create(ctx, key); err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// Authenticate returns the key and the user it acts for, and records that
+// it was used from ip.
+func (k *Keys) Authenticate(ctx context.Context, raw, ip string) (*models.APIKey, *models.User, error) {
+	if !strings.HasPrefix(raw, keyPrefix) {
+		return nil, nil, ErrInvalidKey
+	}
+
+	now := time.Now()
+	key, err := k.keys.FindByHash(ctx, utils.HashToken(raw))
+	if err == repository.ErrNotFound {
+		return nil, nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if !key.IsActive(now) {
+		return nil, nil, ErrInvalidKey
+	}
+
+	user, err := k.users.FindByID(ctx, key.CreatedBy)
+	if err == repository.ErrNotFound {
+		return nil, nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if !user.IsActive {
+		return nil, nil, ErrInvalidKey
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= touchInterval || key.LastUsedIP != ip {
+		// Usage tracking is best effort and does not fail the request
+		k.keys.Update(ctx, key.ID, repository.Fields{"last_used_at": now, "last_used_ip": ip})
+	}
+	return key, user, nil
+}
+
+// Allow takes a request from the key's rate limit. When none is left it
+// returns false and how long until the next request is allowed.
+func (k *Keys) Allow(ctx context.Context, key *models.APIKey) (bool, time.Duration, error) {
+	perMinute := key.RateLimit
+	if perMinute <= 0 {
+		perMinute = k.defaultLimit
+	}
+	if perMinute <= 0 {
+		return true, 0, nil
+	}
+	return k.limits.Take(ctx, "apikey:"+key.ID.Hex(), ratelimit.PerMinute(perMinute))
+}
@@ -0,0 +1,36 @@
+package catalog
+
+import (
+	"context"
+	"io"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Export writes the products matching the query to w as it reads them,
+// oldest first, in a file that Importer takes back.
+func Export(ctx context.Context, w io.Writer, format Format, products repository.ProductRepository, categories repository.CategoryRepository, query repository.ProductQuery) error {
+	all, err := categories.FindAll(ctx)
+	if err != nil {
+		return err
+	}
+	slugs := map[primitive.ObjectID]string{}
+	for _, category := range all {
+		slugs[category.ID] = category.Slug
+	}
+
+	out, err := newWriter(format, w)
+	if err != nil {
+		return err
+	}
+	err = products.Each(ctx, query, func(product *models.Product) error {
+		return out.write(newRecord(product, slugs[product.CategoryID]))
+	})
+	if err != nil {
+		return err
+	}
+	return out.flush()
+}
@@ -0,0 +1,497 @@
+package catalog
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"ejewel/internal/events"
+	"ejewel/internal/models"
+	"ejewel/internal/pricing"
+	"ejewel/internal/repository"
+	"ejewel/internal/search"
+	"ejewel/internal/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MaxFileSize bounds the size of an import file.
+const MaxFileSize = 20 << 20
+
+const (
+	// maxRowErrors bounds how many errors a job lists, so that a file
+	// in the wrong layout does not make a huge report
+	maxRowErrors = 500
+	// progressEvery is how many products are checked between saves of
+	// the job's progress
+	progressEvery = 50
+
+	// Instances report the jobs they hold every heartbeatEvery. A queued
+	// or running job not reported for abandonedAfter was held by an
+	// instance that stopped, and will never finish.
+	heartbeatEvery = 30 * time.Second
+	abandonedAfter = 2 * time.Minute
+)
+
+var metalTypes = []models.MetalType{models.MetalGold, models.MetalSilver, models.MetalPlatinum, models.MetalRoseGold}
+
+var makingChargeTypes = []models.MakingChargeType{models.MakingPerGram, models.MakingPercent, models.MakingFlat}
+
+type Importer struct {
+	products   repository.ProductRepository
+	categories repository.CategoryRepository
+	jobs       repository.ImportJobRepository
+	pricing    *pricing.Engine
+	search     *search.Index
+	events     *events.Bus
+
+	// running lets one import at a time write to the catalogue, so that
+	// two files naming the same product cannot both create it
+	running sync.Mutex
+
+	// held is the jobs this instance has queued or is running
+	mu   sync.Mutex
+	held map[primitive.ObjectID]bool
+}
+
+func NewImporter(products repository.ProductRepository, categories repository.CategoryRepository, jobs repository.ImportJobRepository, pricingEngine *pricing.Engine, searchIndex *search.Index, bus *events.Bus) *Importer {
+	return &Importer{
+		products:   products,
+		categories: categories,
+		jobs:       jobs,
+		pricing:    pricingEngine,
+		search:     searchIndex,
+		events:     bus,
+		held:       map[primitive.ObjectID]bool{},
+	}
+}
+
+// Submit records the job and imports the file in the background. The job
+// is run by this instance, one at a time with its other jobs.
+func (i *Importer) Submit(ctx context.Context, job *models.ImportJob, data []byte) error {
+	job.Status = models.ImportQueued
+	job.RowErrors = []models.ImportRowError{}
+	job.CreatedAt = time.Now()
+	job.HeartbeatAt = job.CreatedAt
+	if err := i.jobs.Create(ctx, job); err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	i.held[job.ID] = true
+	i.mu.Unlock()
+
+	go i.run(*job, data)
+	return nil
+}
+
+// Start reports the jobs this instance holds, and marks failed the jobs
+// of instances that stopped, including this one before a restart, until
+// ctx is cancelled.
+func (i *Importer) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(heartbeatEvery)
+		defer ticker.Stop()
+
+		for {
+			i.heartbeat()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (i *Importer) heartbeat() {
+	now := time.Now()
+
+	i.mu.Lock()
+	held := make([]primitive.ObjectID, 0, len(i.held))
+	for id := range i.held {
+		held = append(held, id)
+	}
+	i.mu.Unlock()
+
+	for _, id := range held {
+		i.save(id, repository.Fields{"heartbeat_at": now})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	failed, err := i.jobs.FailAbandoned(ctx, now.Add(-abandonedAfter), "the import stopped when its server restarted; submit the file again")
+	if err != nil {
+		log.Println("Failed to look for abandoned import jobs:", err)
+	} else if failed > 0 {
+		log.Printf("Marked %d abandoned import jobs failed", failed)
+	}
+}
+
+func (i *Importer) run(job models.ImportJob, data []byte) {
+	i.running.Lock()
+	defer i.running.Unlock()
+	defer func() {
+		i.mu.Lock()
+		delete(i.held, job.ID)
+		i.mu.Unlock()
+	}()
+
+	started := time.Now()
+	i.save(job.ID, repository.Fields{"status": models.ImportRunning, "started_at": started})
+
+	rows, err := readRows(Format(job.Format), data)
+	if err != nil {
+		i.finish(&job, err)
+		return
+	}
+	job.Products = len(rows)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	categories, err := i.categories.FindAll(ctx)
+	cancel()
+	if err != nil {
+		i.finish(&job, fmt.Errorf("failed to fetch categories: %w", err))
+		return
+	}
+	bySlug := map[string]*models.Category{}
+	for j := range categories {
+		bySlug[categories[j].Slug] = &categories[j]
+		bySlug[categories[j].ID.Hex()] = &categories[j]
+	}
+
+	// claimed holds the line of the product each slug and SKU in the file
+	// was first given to
+	claimed := map[string]int{}
+	for n := range rows {
+		r := &rows[n]
+		created, errs := i.apply(&job, r, bySlug, claimed)
+		switch {
+		case len(errs) > 0:
+			job.Rejected++
+			for _, err := range errs {
+				if len(job.RowErrors) == maxRowErrors {
+					job.Truncated = true
+					break
+				}
+				job.RowErrors = append(job.RowErrors, models.ImportRowError{Row: r.line, Product: r.key(), Error: err})
+			}
+		case created:
+			job.Created++
+		default:
+			job.Updated++
+		}
+		job.Processed++
+
+		if job.Processed%progressEvery == 0 {
+			i.save(job.ID, progress(&job))
+		}
+	}
+	i.finish(&job, nil)
+}
+
+// apply checks a product of the file and, unless the job is a dry run,
+// saves it. It reports whether the product is new, or why it was skipped.
+func (i *Importer) apply(job *models.ImportJob, r *row, categories map[string]*models.Category, claimed map[string]int) (bool, []string) {
+	record := &r.record
+	errs := validate(record)
+	if len(r.errs) > 0 {
+		// What could not be read would only be reported again as missing
+		errs = r.errs
+	}
+
+	category := categories[record.Category]
+	if record.Category != "" && category == nil {
+		errs = append(errs, fmt.Sprintf("category %q does not exist", record.Category))
+	}
+
+	slug := record.Slug
+	if slug == "" {
+		slug = utils.GenerateSlug(record.Name)
+	}
+	claim := func(key, what string) {
+		if line, ok := claimed[key]; ok && line != r.line {
+			errs = append(errs, fmt.Sprintf("%s is also used by the product on line %d", what, line))
+			return
+		}
+		claimed[key] = r.line
+	}
+	if slug != "" {
+		claim("slug:"+slug, "slug "+slug)
+	}
+	for _, v := range record.Variants {
+		if v.SKU != "" {
+			claim("sku:"+v.SKU, "SKU "+v.SKU)
+		}
+	}
+	if len(errs) > 0 {
+		return false, errs
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// The product is the one with the slug or any of the SKUs, and they
+	// must not point at different products
+	existing, err := i.products.FindBySlug(ctx, slug)
+	if err != nil && err != repository.ErrNotFound {
+		return false, []string{"failed to look up product: " + err.Error()}
+	}
+	for _, v := range record.Variants {
+		if v.SKU == "" {
+			continue
+		}
+		owner, err := i.products.FindBySKU(ctx, v.SKU)
+		if err == repository.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return false, []string{"failed to look up product: " + err.Error()}
+		}
+		if existing == nil {
+			existing = owner
+		} else if owner.ID != existing.ID {
+			errs = append(errs, fmt.Sprintf("SKU %s belongs to product %s", v.SKU, owner.Slug))
+		}
+	}
+	if len(errs) > 0 {
+		return false, errs
+	}
+
+	// Rate-priced products take their price from the current metal rates
+	product := build(record, existing, slug, category, job.CreatedBy)
+	i.pricing.Apply(product)
+	if !pricing.Priced(product) {
+		return false, []string{"product has no price: give basePrice and variant prices, or set a metal rate for its metal and purity"}
+	}
+
+	if job.DryRun {
+		return existing == nil, nil
+	}
+
+	if existing == nil {
+		if err := i.products.Create(ctx, product); err != nil {
+			return false, []string{"failed to create product: " + err.Error()}
+		}
+		i.search.Put(product)
+		return true, nil
+	}
+
+	// Stock is only written where the file gives it, so an update does not
+	// undo reservations made since the product was read
+	set := repository.Fields{
+		"name":             product.Name,
+		"slug":             product.Slug,
+		"description":      product.Description,
+		"short_desc":       product.ShortDesc,
+		"metal_type":       product.MetalType,
+		"purity":           product.Purity,
+		"category_id":      product.CategoryID,
+		"category_name":    product.CategoryName,
+		"images":           product.Images,
+		"thumbnail":        product.Thumbnail,
+		"base_price":       product.BasePrice,
+		"discount_price":   product.DiscountPrice,
+		"discount_percent": product.DiscountPercent,
+		"net_weight":       product.NetWeight,
+		"making_charge":    product.MakingCharge,
+		"stone_value":      product.StoneValue,
+		"price_breakup":    product.PriceBreakup,
+		"tags":             product.Tags,
+		"features":         product.Features,
+		"is_featured":      product.IsFeatured,
+		"is_new_arrival":   product.IsNewArrival,
+		"is_best_seller":   product.IsBestSeller,
+		"is_active":        product.IsActive,
+		"updated_at":       product.UpdatedAt,
+	}
+	if record.Stock != nil {
+		set["stock"] = product.Stock
+	}
+	restock := []primitive.ObjectID{}
+	for j, v := range record.Variants {
+		if v.Stock != nil {
+			restock = append(restock, product.Variants[j].ID)
+		}
+	}
+
+	err = i.products.Import(ctx, product.ID, set, product.Variants, restock)
+	if err != nil {
+		return false, []string{"failed to update product: " + err.Error()}
+	}
+	i.search.Put(product)
+
+	// Cart lines carry the name and thumbnail
+	if product.Name != existing.Name || product.Thumbnail != existing.Thumbnail {
+		if err := i.events.Publish(ctx, models.EventProductChanged, product.ID); err != nil {
+			log.Printf("Failed to publish change of product %s: %v", product.ID.Hex(), err)
+		}
+	}
+	return false, nil
+}
+
+// validate checks a record has what CreateProduct requires.
+func validate(record *Record) []string {
+	var errs []string
+	check := func(ok bool, err string) {
+		if !ok {
+			errs = append(errs, err)
+		}
+	}
+
+	check(record.Name != "", "name is required")
+	check(record.Description != "", "description is required")
+	check(containsMetal(record.MetalType), "metalType must be gold, silver, platinum or rose_gold")
+	check(record.Purity != "", "purity is required")
+	check(record.Category != "", "category is required")
+	check(record.BasePrice > 0 || record.NetWeight > 0, "either basePrice or netWeight is required")
+	check(record.BasePrice >= 0 && record.NetWeight >= 0 && record.StoneValue >= 0, "prices and weights cannot be negative")
+	check(record.DiscountPercent >= 0 && record.DiscountPercent <= 100, "discountPercent must be between 0 and 100")
+	check(record.Stock == nil || *record.Stock >= 0, "stock cannot be negative")
+	check(record.MakingCharge.Type == "" || containsMakingCharge(record.MakingCharge.Type), "makingCharge type must be per_gram, percent or flat")
+
+	skus := map[string]bool{}
+	for _, v := range record.Variants {
+		name := v.SKU
+		if name == "" {
+			name = v.Size
+		}
+		if v.SKU != "" && skus[v.SKU] {
+			errs = append(errs, "SKU "+v.SKU+" is given to more than one variant")
+		}
+		skus[v.SKU] = true
+		check(v.Weight >= 0 && v.Price >= 0 && v.StoneValue >= 0, "variant "+name+": prices and weights cannot be negative")
+		check(v.Stock == nil || *v.Stock >= 0, "variant "+name+": stock cannot be negative")
+		check(v.MakingCharge == nil || containsMakingCharge(v.MakingCharge.Type), "variant "+name+": makingCharge type must be per_gram, percent or flat")
+	}
+	return errs
+}
+
+// build makes the product the record describes: a new one, or the
+// existing one with the record's fields. Variants keep their IDs when
+// their SKU is unchanged, so carts and orders still find them, and
+// their stock when the record gives none.
+func build(record *Record, existing *models.Product, slug string, category *models.Category, sellerID primitive.ObjectID) *models.Product {
+	now := time.Now()
+	product := &models.Product{ID: primitive.NewObjectID(), IsActive: true, SellerID: sellerID, CreatedAt: now}
+	if existing != nil {
+		copied := *existing
+		product = &copied
+	}
+
+	stored := map[string]models.ProductVariant{}
+	for _, v := range product.Variants {
+		if v.SKU != "" {
+			stored[v.SKU] = v
+		}
+	}
+
+	product.Name = record.Name
+	product.Slug = slug
+	product.Description = record.Description
+	product.ShortDesc = record.ShortDesc
+	product.MetalType = record.MetalType
+	product.Purity = record.Purity
+	product.CategoryID = category.ID
+	product.CategoryName = category.Name
+	product.Images = record.Images
+	product.Thumbnail = record.Thumbnail
+	product.BasePrice = record.BasePrice
+	product.DiscountPercent = record.DiscountPercent
+	product.DiscountPrice = utils.CalculateDiscountPrice(record.BasePrice, record.DiscountPercent)
+	product.NetWeight = record.NetWeight
+	product.MakingCharge = record.MakingCharge
+	product.StoneValue = record.StoneValue
+	product.PriceBreakup = nil
+	product.Tags = record.Tags
+	product.Features = record.Features
+	product.IsFeatured = record.IsFeatured
+	product.IsNewArrival = record.IsNewArrival
+	product.IsBestSeller = record.IsBestSeller
+	if record.IsActive != nil {
+		product.IsActive = *record.IsActive
+	}
+	if record.Stock != nil {
+		product.Stock = *record.Stock
+	}
+	product.UpdatedAt = now
+
+	product.Variants = nil
+	for _, v := range record.Variants {
+		variant, ok := stored[v.SKU]
+		if !ok {
+			variant.ID = primitive.NewObjectID()
+		}
+		if v.Stock != nil {
+			variant.Stock = *v.Stock
+		}
+		product.Variants = append(product.Variants, models.ProductVariant{
+			ID:           variant.ID,
+			Size:         v.Size,
+			Weight:       v.Weight,
+			Price:        v.Price,
+			MakingCharge: v.MakingCharge,
+			StoneValue:   v.StoneValue,
+			Stock:        variant.Stock,
+			SKU:          v.SKU,
+			IsDefault:    v.IsDefault,
+		})
+	}
+	return product
+}
+
+// finish records the outcome of the job, or why the file could not be
+// read.
+func (i *Importer) finish(job *models.ImportJob, err error) {
+	set := progress(job)
+	set["status"] = models.ImportDone
+	set["finished_at"] = time.Now()
+	if err != nil {
+		set["status"] = models.ImportFailed
+		set["error"] = err.Error()
+	}
+	i.save(job.ID, set)
+}
+
+func progress(job *models.ImportJob) repository.Fields {
+	return repository.Fields{
+		"products":   job.Products,
+		"processed":  job.Processed,
+		"created":    job.Created,
+		"updated":    job.Updated,
+		"rejected":   job.Rejected,
+		"row_errors": job.RowErrors,
+		"truncated":  job.Truncated,
+	}
+}
+
+func (i *Importer) save(id primitive.ObjectID, set repository.Fields) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := i.jobs.Update(ctx, id, set); err != nil {
+		log.Printf("Failed to save import job %s: %v", id.Hex(), err)
+	}
+}
+
+func containsMetal(metal models.MetalType) bool {
+	for _, m := range metalTypes {
+		if m == metal {
+			return true
+		}
+	}
+	return false
+}
+
+func containsMakingCharge(kind models.MakingChargeType) bool {
+	for _, k := range makingChargeTypes {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package catalog
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"ejewel/internal/events"
+	"ejewel/internal/models"
+	"ejewel/internal/pricing"
+	"ejewel/internal/repository"
+	"ejewel/internal/repository/memory"
+	"ejewel/internal/search"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newTestImporter(t *testing.T) (*Importer, repository.Repositories) {
+	t.Helper()
+	repos := memory.NewRepositories()
+	engine := pricing.NewEngine(nil, repos.MetalRates, repos.Products)
+	index := search.NewIndex(repos.Products, nil)
+	return NewImporter(repos.Products, repos.Categories, repos.ImportJobs, engine, index, events.NewBus(repos.Events, 3)), repos
+}
+
+// importCSV runs an import of the file to the end.
+func importCSV(t *testing.T, i *Importer, data string) *models.ImportJob {
+	t.Helper()
+	ctx := context.Background()
+	job := &models.ImportJob{Format: string(FormatCSV), Status: models.ImportQueued}
+	if err := i.jobs.Create(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	i.run(*job, []byte(data))
+
+	job, err := i.jobs.FindByID(ctx, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(job.RowErrors) > 0 {
+		t.Fatalf("import rejected the file: %+v", job.RowErrors)
+	}
+	return job
+}
+
+func TestImportKeepsStockUnlessGiven(t *testing.T) {
+	ctx := context.Background()
+	i, repos := newTestImporter(t)
+	if err := repos.Categories.Create(ctx, &models.Category{Name: "Rings", Slug: "rings", IsActive: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	header := "slug,name,description,metal_type,purity,category,base_price,stock,variant_sku,variant_size,variant_price,variant_stock\n"
+	importCSV(t, i, header+"rose-ring,Rose Ring,A ring,gold,22K,rings,5000,5,R-7,7,5000,5\n")
+
+	product, err := repos.Products.FindBySlug(ctx, "rose-ring")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := repos.Products.ReserveStock(ctx, product.ID, product.Variants[0].ID, 2); !ok || err != nil {
+		t.Fatalf("ReserveStock = %v, %v", ok, err)
+	}
+
+	// A file without stock leaves what is left after the reservation
+	importCSV(t, i, header+"rose-ring,Rose Ring II,A ring,gold,22K,rings,5000,,R-7,7,5000,\n")
+	product, err = repos.Products.FindBySlug(ctx, "rose-ring")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if product.Name != "Rose Ring II" {
+		t.Errorf("name = %q, want the imported one", product.Name)
+	}
+	if product.Stock != 3 || product.Variants[0].Stock != 3 {
+		t.Errorf("stock = %d, variant stock = %d, want 3 and 3", product.Stock, product.Variants[0].Stock)
+	}
+
+	// Stock given in the file is written
+	importCSV(t, i, header+"rose-ring,Rose Ring II,A ring,gold,22K,rings,5000,10,R-7,7,5000,10\n")
+	product, err = repos.Products.FindBySlug(ctx, "rose-ring")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if product.Stock != 10 || product.Variants[0].Stock != 10 {
+		t.Errorf("stock = %d, variant stock = %d, want 10 and 10", product.Stock, product.Variants[0].Stock)
+	}
+}
+
+func TestHeartbeatFailsAbandonedJobs(t *testing.T) {
+	ctx := context.Background()
+	i, repos := newTestImporter(t)
+
+	create := func(status models.ImportStatus, heartbeat time.Time) primitive.ObjectID {
+		job := &models.ImportJob{Status: status, HeartbeatAt: heartbeat}
+		if err := repos.ImportJobs.Create(ctx, job); err != nil {
+			t.Fatal(err)
+		}
+		return job.ID
+	}
+	// Left behind by an instance that stopped
+	abandoned := create(models.ImportRunning, time.Now().Add(-time.Hour))
+	// Held by this instance, whose last heartbeat was a while ago
+	held := create(models.ImportQueued, time.Now().Add(-time.Hour))
+	i.held[held] = true
+	// Held by another instance that is still running
+	elsewhere := create(models.ImportRunning, time.Now())
+
+	i.heartbeat()
+
+	for id, want := range map[primitive.ObjectID]models.ImportStatus{
+		abandoned: models.ImportFailed,
+		held:      models.ImportQueued,
+		elsewhere: models.ImportRunning,
+	} {
+		job, err := repos.ImportJobs.FindByID(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status != want {
+			t.Errorf("job %s status = %s, want %s", id.Hex(), job.Status, want)
+		}
+	}
+}
@@ -0,0 +1,480 @@
+// Package catalog moves products in and out of the catalogue in bulk, as
+// CSV for spreadsheets or JSON Lines for scripts.
+package catalog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"ejewel/internal/models"
+)
+
+type Format string
+
+const (
+	FormatCSV       Format = "csv"
+	FormatJSONLines Format = "jsonl"
+)
+
+// ParseFormat reads a format name or file extension.
+func ParseFormat(name string) (Format, bool) {
+	switch strings.ToLower(strings.TrimPrefix(name, ".")) {
+	case "csv":
+		return FormatCSV, true
+	case "jsonl", "ndjson":
+		return FormatJSONLines, true
+	}
+	return "", false
+}
+
+// ContentType is the media type files of the format are sent as.
+func (f Format) ContentType() string {
+	if f == FormatJSONLines {
+		return "application/x-ndjson"
+	}
+	return "text/csv"
+}
+
+// Record is a product as it is imported and exported. The category is
+// given by its slug, and variants are matched to the stored ones by SKU.
+type Record struct {
+	Slug            string              `json:"slug"` // Derived from the name when empty
+	Name            string              `json:"name"`
+	Description     string              `json:"description"`
+	ShortDesc       string              `json:"shortDesc"`
+	MetalType       models.MetalType    `json:"metalType"`
+	Purity          string              `json:"purity"`
+	Category        string              `json:"category"`
+	Images          []string            `json:"images"`
+	Thumbnail       string              `json:"thumbnail"`
+	BasePrice       float64             `json:"basePrice"`
+	DiscountPercent float64             `json:"discountPercent"`
+	NetWeight       float64             `json:"netWeight"`
+	MakingCharge    models.MakingCharge `json:"makingCharge"`
+	StoneValue      float64             `json:"stoneValue"`
+	Tags            []string            `json:"tags"`
+	Features        []string            `json:"features"`
+	IsFeatured      bool                `json:"isFeatured"`
+	IsNewArrival    bool                `json:"isNewArrival"`
+	IsBestSeller    bool                `json:"isBestSeller"`
+	IsActive        *bool               `json:"isActive"` // Unchanged, or active for new products, when not given
+	Stock           *int                `json:"stock"`    // Unchanged, or none for new products, when not given
+	Variants        []Variant           `json:"variants"`
+}
+
+type Variant struct {
+	SKU          string               `json:"sku"`
+	Size         string               `json:"size"`
+	Weight       float64              `json:"weight"`
+	Price        float64              `json:"price"`
+	MakingCharge *models.MakingCharge `json:"makingCharge,omitempty"`
+	StoneValue   float64              `json:"stoneValue"`
+	Stock        *int                 `json:"stock"` // Unchanged, or none for new variants, when not given
+	IsDefault    bool                 `json:"isDefault"`
+}
+
+func newRecord(product *models.Product, categorySlug string) *Record {
+	active := product.IsActive
+	stock := product.Stock
+	record := &Record{
+		Slug:            product.Slug,
+		Name:            product.Name,
+		Description:     product.Description,
+		ShortDesc:       product.ShortDesc,
+		MetalType:       product.MetalType,
+		Purity:          product.Purity,
+		Category:        categorySlug,
+		Images:          product.Images,
+		Thumbnail:       product.Thumbnail,
+		BasePrice:       product.BasePrice,
+		DiscountPercent: product.DiscountPercent,
+		NetWeight:       product.NetWeight,
+		MakingCharge:    product.MakingCharge,
+		StoneValue:      product.StoneValue,
+		Tags:            product.Tags,
+		Features:        product.Features,
+		IsFeatured:      product.IsFeatured,
+		IsNewArrival:    product.IsNewArrival,
+		IsBestSeller:    product.IsBestSeller,
+		IsActive:        &active,
+		Stock:           &stock,
+	}
+	for _, v := range product.Variants {
+		stock := v.Stock
+		record.Variants = append(record.Variants, Variant{
+			SKU:          v.SKU,
+			Size:         v.Size,
+			Weight:       v.Weight,
+			Price:        v.Price,
+			MakingCharge: v.MakingCharge,
+			StoneValue:   v.StoneValue,
+			Stock:        &stock,
+			IsDefault:    v.IsDefault,
+		})
+	}
+	return record
+}
+
+// row is a product read from a file, with the line it starts on and what
+// could not be read.
+type row struct {
+	line   int
+	record Record
+	errs   []string
+}
+
+// key names the product in the import report.
+func (r *row) key() string {
+	if r.record.Slug != "" {
+		return r.record.Slug
+	}
+	return r.record.Name
+}
+
+// maxLine bounds a JSON Lines record.
+const maxLine = 1 << 20
+
+// readRows reads the products of a file. It only fails when the file as a
+// whole cannot be read; problems with single products are left on their
+// rows.
+func readRows(format Format, data []byte) ([]row, error) {
+	// Spreadsheets often save with a byte order mark
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if format == FormatJSONLines {
+		return readJSONLines(data)
+	}
+	return readCSV(data)
+}
+
+func readJSONLines(data []byte) ([]row, error) {
+	var rows []row
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64<<10), maxLine)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		r := row{line: line}
+		decoder := json.NewDecoder(bytes.NewReader(text))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&r.record); err != nil {
+			r.errs = append(r.errs, "invalid JSON: "+err.Error())
+		}
+		rows = append(rows, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// The CSV columns, in the order they are exported. A product takes one
+// row, or one row per variant with the variant columns filled in; the
+// product columns are read from its first row. Lists are separated by |.
+var columns = []string{
+	"slug", "name", "description", "short_desc", "metal_type", "purity", "category",
+	"images", "thumbnail", "base_price", "discount_percent", "net_weight",
+	"making_charge_type", "making_charge_value", "stone_value", "tags", "features",
+	"is_featured", "is_new_arrival", "is_best_seller", "is_active", "stock",
+	"variant_sku", "variant_size", "variant_weight", "variant_price",
+	"variant_making_charge_type", "variant_making_charge_value", "variant_stone_value",
+	"variant_stock", "variant_is_default",
+}
+
+const listSeparator = "|"
+
+func readCSV(data []byte) ([]row, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	index := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !contains(columns, name) {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		index[name] = i
+	}
+	if _, ok := index["name"]; !ok {
+		return nil, errors.New("the name column is required")
+	}
+
+	var rows []row
+	for {
+		values, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line, _ := reader.FieldPos(0)
+		if err != nil && !errors.Is(err, csv.ErrFieldCount) {
+			return nil, err
+		}
+
+		f := &fields{values: values, index: index}
+		if err != nil {
+			f.errs = append(f.errs, fmt.Sprintf("expected %d columns, found %d", len(header), len(values)))
+		}
+
+		// A row for the same product as the last adds a variant to it
+		key := f.text("slug")
+		if key == "" {
+			key = f.text("name")
+		}
+		if n := len(rows); n > 0 && key != "" && key == rows[n-1].key() && f.hasVariant() {
+			last := &rows[n-1]
+			last.record.Variants = append(last.record.Variants, f.variant())
+			last.errs = append(last.errs, rowErrors(line, f.errs)...)
+			continue
+		}
+
+		r := row{line: line, record: f.record()}
+		if f.hasVariant() {
+			r.record.Variants = []Variant{f.variant()}
+		}
+		r.errs = f.errs
+		rows = append(rows, r)
+	}
+	return rows, nil
+}
+
+// rowErrors marks errors found on a later row of a product with its line.
+func rowErrors(line int, errs []string) []string {
+	marked := make([]string, len(errs))
+	for i, err := range errs {
+		marked[i] = fmt.Sprintf("line %d: %s", line, err)
+	}
+	return marked
+}
+
+// fields reads the columns of a CSV row, collecting the values that are
+// not of their column's type.
+type fields struct {
+	values []string
+	index  map[string]int
+	errs   []string
+}
+
+func (f *fields) text(column string) string {
+	i, ok := f.index[column]
+	if !ok || i >= len(f.values) {
+		return ""
+	}
+	return strings.TrimSpace(f.values[i])
+}
+
+func (f *fields) number(column string) float64 {
+	value := f.text(column)
+	if value == "" {
+		return 0
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		f.errs = append(f.errs, column+" is not a number")
+	}
+	return n
+}
+
+func (f *fields) integer(column string) *int {
+	value := f.text(column)
+	if value == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		f.errs = append(f.errs, column+" is not a whole number")
+	}
+	return &n
+}
+
+func (f *fields) flag(column string) *bool {
+	var value bool
+	switch strings.ToLower(f.text(column)) {
+	case "":
+		return nil
+	case "true", "yes", "y", "1":
+		value = true
+	case "false", "no", "n", "0":
+		value = false
+	default:
+		f.errs = append(f.errs, column+" must be true or false")
+	}
+	return &value
+}
+
+func (f *fields) isSet(column string) bool {
+	value := f.flag(column)
+	return value != nil && *value
+}
+
+func (f *fields) list(column string) []string {
+	var values []string
+	for _, value := range strings.Split(f.text(column), listSeparator) {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func (f *fields) hasVariant() bool {
+	for _, column := range columns {
+		if strings.HasPrefix(column, "variant_") && f.text(column) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fields) record() Record {
+	return Record{
+		Slug:            f.text("slug"),
+		Name:            f.text("name"),
+		Description:     f.text("description"),
+		ShortDesc:       f.text("short_desc"),
+		MetalType:       models.MetalType(f.text("metal_type")),
+		Purity:          f.text("purity"),
+		Category:        f.text("category"),
+		Images:          f.list("images"),
+		Thumbnail:       f.text("thumbnail"),
+		BasePrice:       f.number("base_price"),
+		DiscountPercent: f.number("discount_percent"),
+		NetWeight:       f.number("net_weight"),
+		MakingCharge: models.MakingCharge{
+			Type:  models.MakingChargeType(f.text("making_charge_type")),
+			Value: f.number("making_charge_value"),
+		},
+		StoneValue:   f.number("stone_value"),
+		Tags:         f.list("tags"),
+		Features:     f.list("features"),
+		IsFeatured:   f.isSet("is_featured"),
+		IsNewArrival: f.isSet("is_new_arrival"),
+		IsBestSeller: f.isSet("is_best_seller"),
+		IsActive:     f.flag("is_active"),
+		Stock:        f.integer("stock"),
+	}
+}
+
+func (f *fields) variant() Variant {
+	variant := Variant{
+		SKU:        f.text("variant_sku"),
+		Size:       f.text("variant_size"),
+		Weight:     f.number("variant_weight"),
+		Price:      f.number("variant_price"),
+		StoneValue: f.number("variant_stone_value"),
+		Stock:      f.integer("variant_stock"),
+		IsDefault:  f.isSet("variant_is_default"),
+	}
+	if kind := f.text("variant_making_charge_type"); kind != "" {
+		variant.MakingCharge = &models.MakingCharge{
+			Type:  models.MakingChargeType(kind),
+			Value: f.number("variant_making_charge_value"),
+		}
+	}
+	return variant
+}
+
+// writer writes records in one of the formats.
+type writer interface {
+	write(record *Record) error
+	flush() error
+}
+
+func newWriter(format Format, w io.Writer) (writer, error) {
+	if format == FormatJSONLines {
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		return &jsonLinesWriter{encoder: encoder}, nil
+	}
+
+	out := csv.NewWriter(w)
+	if err := out.Write(columns); err != nil {
+		return nil, err
+	}
+	return &csvWriter{out: out}, nil
+}
+
+type jsonLinesWriter struct {
+	encoder *json.Encoder
+}
+
+func (w *jsonLinesWriter) write(record *Record) error {
+	return w.encoder.Encode(record)
+}
+
+func (w *jsonLinesWriter) flush() error {
+	return nil
+}
+
+type csvWriter struct {
+	out *csv.Writer
+}
+
+func (w *csvWriter) write(record *Record) error {
+	number := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	count := func(v *int) string {
+		if v == nil {
+			return ""
+		}
+		return strconv.Itoa(*v)
+	}
+	active := record.IsActive == nil || *record.IsActive
+
+	product := []string{
+		record.Slug, record.Name, record.Description, record.ShortDesc,
+		string(record.MetalType), record.Purity, record.Category,
+		strings.Join(record.Images, listSeparator), record.Thumbnail,
+		number(record.BasePrice), number(record.DiscountPercent), number(record.NetWeight),
+		string(record.MakingCharge.Type), number(record.MakingCharge.Value), number(record.StoneValue),
+		strings.Join(record.Tags, listSeparator), strings.Join(record.Features, listSeparator),
+		strconv.FormatBool(record.IsFeatured), strconv.FormatBool(record.IsNewArrival),
+		strconv.FormatBool(record.IsBestSeller), strconv.FormatBool(active),
+		count(record.Stock),
+	}
+	if len(record.Variants) == 0 {
+		return w.out.Write(append(product, make([]string, len(columns)-len(product))...))
+	}
+
+	for _, v := range record.Variants {
+		making, makingValue := "", ""
+		if v.MakingCharge != nil {
+			making, makingValue = string(v.MakingCharge.Type), number(v.MakingCharge.Value)
+		}
+		variant := []string{
+			v.SKU, v.Size, number(v.Weight), number(v.Price), making, makingValue,
+			number(v.StoneValue), count(v.Stock), strconv.FormatBool(v.IsDefault),
+		}
+		if err := w.out.Write(append(append([]string{}, product...), variant...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *csvWriter) flush() error {
+	w.out.Flush()
+	return w.out.Error()
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -1,40 +1,289 @@
 package config
 
 import (
+	"errors"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"ejewel/internal/ratelimit"
+
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	MongoURI      string
-	MongoDB       string
-	JWTSecret     string
-	JWTExpiry     time.Duration
-	Port          string
-	AdminEmail    string
-	AdminPassword string
+	MongoURI  string
+	MongoDB   string
+	JWTSecret string
+	JWTExpiry time.Duration
+	// Sessions end when their refresh token goes unused this long
+	RefreshTokenTTL time.Duration
+	Port            string
+	// Addresses or CIDRs of the reverse proxies whose X-Forwarded-For
+	// header names the client; none are trusted by default
+	TrustedProxies []string
+	AdminEmail     string
+	AdminPassword  string
+
+	// Metal rate feed for rate-based pricing
+	RateFeedFile     string
+	RateSyncInterval time.Duration
+
+	// Payment gateway. PaymentSimulation exposes the mock provider's
+	// endpoint that lets a customer settle their own payment, for
+	// development only
+	PaymentProvider      string
+	PaymentWebhookSecret string
+	PaymentIntentTTL     time.Duration
+	PaymentSimulation    bool
+
+	// Guest carts not touched for this long are deleted
+	GuestCartTTL time.Duration
+
+	// Days after delivery during which a return can be requested
+	ReturnWindowDays int
+
+	// Seller details printed on GST invoices; the state decides between
+	// CGST/SGST and IGST
+	SellerName    string
+	SellerGSTIN   string
+	SellerAddress string
+	SellerState   string
+
+	// Outgoing email; "log" writes messages to MailFile, or the log when it
+	// is empty
+	MailProvider string
+	MailFrom     string
+	MailFile     string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+
+	// Storefront base URL used in links sent by email
+	AppURL string
+
+	// Lifetime of email verification and password reset links
+	VerifyTokenTTL time.Duration
+	ResetTokenTTL  time.Duration
+
+	// Refuse checkout until the account's email address is verified
+	RequireVerifiedEmail bool
+
+	// Issuer shown in authenticator apps, and whether staff must use
+	// two-factor authentication to reach the admin API
+	TwoFactorIssuer   string
+	RequireAdmin2FA   bool
+	ChallengeTokenTTL time.Duration
+
+	// Where revoked access tokens are recorded (mongo or memory), and how
+	// long each instance may cache revocation lookups
+	RevocationStore     string
+	RevocationCacheSize int
+	RevocationCacheTTL  time.Duration
+
+	// How long each instance may use its copy of the role definitions
+	RoleCacheTTL time.Duration
+
+	// Marketplace commission, in percent of the amount paid for a line,
+	// where no rule for the seller or category applies, and the tax
+	// collected at source from seller payouts, in percent of the taxable
+	// value
+	CommissionRate     float64
+	TaxWithholdingRate float64
+
+	// Requests a minute allowed to API keys issued without a limit of their
+	// own; zero leaves them unlimited
+	APIKeyRateLimit int
+
+	// Token bucket limits per client IP and per account for the whole API
+	// and, on top of those, for signing in, signing up and password resets.
+	// Buckets are kept in memory, or in mongo to share them between
+	// instances
+	RateLimitStore string
+	APIRateLimits  ratelimit.Limits
+	AuthRateLimits ratelimit.Limits
+
+	// Failed passwords after which an account is locked, for how long,
+	// and the longest lock as it doubles with each further failure
+	LoginLockoutThreshold int
+	LoginLockoutDuration  time.Duration
+	LoginLockoutMax       time.Duration
+
+	// How often each instance reloads its product search index, and an
+	// optional file of comma separated synonym groups, one per line
+	SearchReloadInterval time.Duration
+	SearchSynonymsFile   string
+
+	// Attempts at copying a change to the documents that denormalise it
+	// before the event is marked failed, and how often each instance looks
+	// for events to retry or published elsewhere
+	EventMaxAttempts  int
+	EventPollInterval time.Duration
 }
 
 var AppConfig *Config
 
+// defaultWebhookSecret is the secret older configurations fell back to. It
+// is public, so webhooks signed with it prove nothing.
+const defaultWebhookSecret = "default-webhook-secret"
+
 func LoadConfig() (*Config, error) {
 	godotenv.Load()
 
+	webhookSecret := getEnv("PAYMENT_WEBHOOK_SECRET", "")
+	if webhookSecret == "" || webhookSecret == defaultWebhookSecret {
+		return nil, errors.New("PAYMENT_WEBHOOK_SECRET must be set to a private value")
+	}
+
 	expiry, err := time.ParseDuration(getEnv("JWT_EXPIRY", "24h"))
 	if err != nil {
 		expiry = 24 * time.Hour
 	}
 
+	refreshTokenTTL, err := time.ParseDuration(getEnv("REFRESH_TOKEN_TTL", "168h"))
+	if err != nil {
+		refreshTokenTTL = 7 * 24 * time.Hour
+	}
+
+	rateSyncInterval, err := time.ParseDuration(getEnv("RATE_SYNC_INTERVAL", "1h"))
+	if err != nil {
+		rateSyncInterval = time.Hour
+	}
+
+	paymentIntentTTL, err := time.ParseDuration(getEnv("PAYMENT_INTENT_TTL", "30m"))
+	if err != nil {
+		paymentIntentTTL = 30 * time.Minute
+	}
+
+	guestCartTTL, err := time.ParseDuration(getEnv("GUEST_CART_TTL", "168h"))
+	if err != nil {
+		guestCartTTL = 7 * 24 * time.Hour
+	}
+
+	verifyTokenTTL, err := time.ParseDuration(getEnv("VERIFY_TOKEN_TTL", "48h"))
+	if err != nil {
+		verifyTokenTTL = 48 * time.Hour
+	}
+
+	resetTokenTTL, err := time.ParseDuration(getEnv("RESET_TOKEN_TTL", "1h"))
+	if err != nil {
+		resetTokenTTL = time.Hour
+	}
+
+	challengeTokenTTL, err := time.ParseDuration(getEnv("CHALLENGE_TOKEN_TTL", "5m"))
+	if err != nil {
+		challengeTokenTTL = 5 * time.Minute
+	}
+
+	revocationCacheTTL, err := time.ParseDuration(getEnv("REVOCATION_CACHE_TTL", "10s"))
+	if err != nil {
+		revocationCacheTTL = 10 * time.Second
+	}
+
+	roleCacheTTL, err := time.ParseDuration(getEnv("ROLE_CACHE_TTL", "30s"))
+	if err != nil {
+		roleCacheTTL = 30 * time.Second
+	}
+
+	loginLockoutDuration, err := time.ParseDuration(getEnv("LOGIN_LOCKOUT_DURATION", "1m"))
+	if err != nil {
+		loginLockoutDuration = time.Minute
+	}
+
+	loginLockoutMax, err := time.ParseDuration(getEnv("LOGIN_LOCKOUT_MAX", "1h"))
+	if err != nil {
+		loginLockoutMax = time.Hour
+	}
+
+	searchReloadInterval, err := time.ParseDuration(getEnv("SEARCH_RELOAD_INTERVAL", "5m"))
+	if err != nil {
+		searchReloadInterval = 5 * time.Minute
+	}
+
+	eventPollInterval, err := time.ParseDuration(getEnv("EVENT_POLL_INTERVAL", "5s"))
+	if err != nil {
+		eventPollInterval = 5 * time.Second
+	}
+
 	AppConfig = &Config{
-		MongoURI:      getEnv("MONGODB_URI", "mongodb://localhost:27017"),
-		MongoDB:       getEnv("MONGODB_DATABASE", "ejewel"),
-		JWTSecret:     getEnv("JWT_SECRET", "default-secret-key"),
-		JWTExpiry:     expiry,
-		Port:          getEnv("PORT", "8080"),
-		AdminEmail:    getEnv("ADMIN_EMAIL", "admin@ejewel.com"),
-		AdminPassword: getEnv("ADMIN_PASSWORD", "admin123"),
+		MongoURI:        getEnv("MONGODB_URI", "mongodb://localhost:27017"),
+		MongoDB:         getEnv("MONGODB_DATABASE", "ejewel"),
+		JWTSecret:       getEnv("JWT_SECRET", "default-secret-key"),
+		JWTExpiry:       expiry,
+		RefreshTokenTTL: refreshTokenTTL,
+		Port:            getEnv("PORT", "8080"),
+		TrustedProxies:  getEnvList("TRUSTED_PROXIES"),
+		AdminEmail:      getEnv("ADMIN_EMAIL", "admin@ejewel.com"),
+		AdminPassword:   getEnv("ADMIN_PASSWORD", "admin123"),
+
+		RateFeedFile:     getEnv("RATE_FEED_FILE", ""),
+		RateSyncInterval: rateSyncInterval,
+
+		PaymentProvider:      getEnv("PAYMENT_PROVIDER", "mock"),
+		PaymentWebhookSecret: webhookSecret,
+		PaymentIntentTTL:     paymentIntentTTL,
+		PaymentSimulation:    getEnvBool("PAYMENT_SIMULATION", false),
+
+		GuestCartTTL: guestCartTTL,
+
+		ReturnWindowDays: getEnvInt("RETURN_WINDOW_DAYS", 15),
+
+		SellerName:    getEnv("SELLER_NAME", "eJewel"),
+		SellerGSTIN:   getEnv("SELLER_GSTIN", ""),
+		SellerAddress: getEnv("SELLER_ADDRESS", ""),
+		SellerState:   getEnv("SELLER_STATE", "Maharashtra"),
+
+		MailProvider: getEnv("MAIL_PROVIDER", "log"),
+		MailFrom:     getEnv("MAIL_FROM", "eJewel <no-reply@ejewel.com>"),
+		MailFile:     getEnv("MAIL_FILE", ""),
+		SMTPHost:     getEnv("SMTP_HOST", "localhost"),
+		SMTPPort:     getEnvInt("SMTP_PORT", 587),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+
+		AppURL: getEnv("APP_URL", "http://localhost:3000"),
+
+		VerifyTokenTTL: verifyTokenTTL,
+		ResetTokenTTL:  resetTokenTTL,
+
+		RequireVerifiedEmail: getEnvBool("REQUIRE_VERIFIED_EMAIL", false),
+
+		TwoFactorIssuer:   getEnv("TWO_FACTOR_ISSUER", "eJewel"),
+		RequireAdmin2FA:   getEnvBool("REQUIRE_ADMIN_2FA", false),
+		ChallengeTokenTTL: challengeTokenTTL,
+
+		RevocationStore:     getEnv("REVOCATION_STORE", "mongo"),
+		RevocationCacheSize: getEnvInt("REVOCATION_CACHE_SIZE", 10000),
+		RevocationCacheTTL:  revocationCacheTTL,
+
+		RoleCacheTTL: roleCacheTTL,
+
+		CommissionRate:     getEnvFloat("COMMISSION_RATE", 10),
+		TaxWithholdingRate: getEnvFloat("TAX_WITHHOLDING_RATE", 1),
+
+		APIKeyRateLimit: getEnvInt("API_KEY_RATE_LIMIT", 60),
+
+		RateLimitStore: getEnv("RATE_LIMIT_STORE", "memory"),
+		APIRateLimits: ratelimit.Limits{
+			IP:      getEnvLimit("RATE_LIMIT_API_IP", "300/m"),
+			Account: getEnvLimit("RATE_LIMIT_API_ACCOUNT", "300/m"),
+		},
+		AuthRateLimits: ratelimit.Limits{
+			IP:      getEnvLimit("RATE_LIMIT_AUTH_IP", "20/m"),
+			Account: getEnvLimit("RATE_LIMIT_AUTH_ACCOUNT", "10/m"),
+		},
+
+		LoginLockoutThreshold: getEnvInt("LOGIN_LOCKOUT_THRESHOLD", 5),
+		LoginLockoutDuration:  loginLockoutDuration,
+		LoginLockoutMax:       loginLockoutMax,
+
+		SearchReloadInterval: searchReloadInterval,
+		SearchSynonymsFile:   getEnv("SEARCH_SYNONYMS_FILE", ""),
+
+		EventMaxAttempts:  getEnvInt("EVENT_MAX_ATTEMPTS", 10),
+		EventPollInterval: eventPollInterval,
 	}
 
 	return AppConfig, nil
@@ -47,3 +296,42 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvList splits a comma separated variable, dropping empty entries.
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvLimit(key, defaultValue string) ratelimit.Limit {
+	if limit, err := ratelimit.Parse(getEnv(key, defaultValue)); err == nil {
+		return limit
+	}
+	limit, _ := ratelimit.Parse(defaultValue)
+	return limit
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,261 @@
+package coupons
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RuleError is returned when a coupon cannot be used on a cart. Its message
+// is safe to show to the customer.
+type RuleError struct {
+	Message string
+}
+
+func (e *RuleError) Error() string {
+	return e.Message
+}
+
+func ruleErrorf(format string, args ...interface{}) error {
+	return &RuleError{Message: fmt.Sprintf(format, args...)}
+}
+
+var (
+	ErrNotFound      = &RuleError{"Invalid coupon code"}
+	ErrInactive      = &RuleError{"Coupon is no longer active"}
+	ErrNotStarted    = &RuleError{"Coupon is not valid yet"}
+	ErrExpired       = &RuleError{"Coupon has expired"}
+	ErrNotApplicable = &RuleError{"Coupon does not apply to any item in your cart"}
+	ErrUsageLimit    = &RuleError{"Coupon usage limit has been reached"}
+	ErrUserLimit     = &RuleError{"You have already used this coupon the maximum number of times"}
+)
+
+// IsRuleError reports whether err is a coupon rule violation rather than a
+// storage failure.
+func IsRuleError(err error) bool {
+	var ruleErr *RuleError
+	return errors.As(err, &ruleErr)
+}
+
+// Line is a cart or order line as seen by the coupon rules.
+type Line struct {
+	ProductID  primitive.ObjectID
+	MetalType  models.MetalType
+	CategoryID primitive.ObjectID
+	UnitPrice  float64
+	Quantity   int
+}
+
+// Result is the benefit a coupon gives on a set of lines.
+type Result struct {
+	Discount     float64
+	FreeShipping bool
+}
+
+// NormalizeCode returns the canonical form coupon codes are stored in.
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// FindByCode loads a coupon by its code.
+func FindByCode(ctx context.Context, store repository.CouponRepository, code string) (*models.Coupon, error) {
+	coupon, err := store.FindByCode(ctx, NormalizeCode(code))
+	if err == repository.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return coupon, nil
+}
+
+// Validate checks a coupon's activity window and usage limits for a user.
+func Validate(ctx context.Context, store repository.CouponRepository, coupon *models.Coupon, userID primitive.ObjectID, now time.Time) error {
+	if !coupon.IsActive {
+		return ErrInactive
+	}
+	if !coupon.StartsAt.IsZero() && now.Before(coupon.StartsAt) {
+		return ErrNotStarted
+	}
+	if !coupon.ExpiresAt.IsZero() && now.After(coupon.ExpiresAt) {
+		return ErrExpired
+	}
+	if coupon.UsageLimit > 0 && coupon.UsedCount >= coupon.UsageLimit {
+		return ErrUsageLimit
+	}
+
+	if coupon.PerUserLimit > 0 {
+		uses, err := store.UserUses(ctx, coupon.ID, userID)
+		if err != nil {
+			return err
+		}
+		if uses >= coupon.PerUserLimit {
+			return ErrUserLimit
+		}
+	}
+
+	return nil
+}
+
+// Evaluate computes the discount a coupon gives on the given lines. The
+// minimum cart value is checked against the whole cart, while the discount
+// itself only applies to lines matching the metal and category rules.
+func Evaluate(coupon *models.Coupon, lines []Line) (Result, error) {
+	subtotal := 0.0
+	for _, line := range lines {
+		subtotal += line.UnitPrice * float64(line.Quantity)
+	}
+
+	if coupon.MinCartValue > 0 && subtotal < coupon.MinCartValue {
+		return Result{}, ruleErrorf("Add items worth %.2f more to use this coupon", coupon.MinCartValue-subtotal)
+	}
+
+	var eligible []Line
+	eligibleSubtotal := 0.0
+	for _, line := range lines {
+		if appliesTo(coupon, line) {
+			eligible = append(eligible, line)
+			eligibleSubtotal += line.UnitPrice * float64(line.Quantity)
+		}
+	}
+	if len(eligible) == 0 {
+		return Result{}, ErrNotApplicable
+	}
+
+	var result Result
+	switch coupon.Type {
+	case models.CouponPercentage:
+		result.Discount = eligibleSubtotal * coupon.Value / 100
+	case models.CouponFlat:
+		result.Discount = math.Min(coupon.Value, eligibleSubtotal)
+	case models.CouponFreeShipping:
+		result.FreeShipping = true
+	case models.CouponBuyXGetY:
+		result.Discount = buyXGetYDiscount(eligible, coupon.BuyQuantity, coupon.GetQuantity)
+		if result.Discount == 0 {
+			return Result{}, ruleErrorf("Add %d eligible items to use this coupon", coupon.BuyQuantity+coupon.GetQuantity)
+		}
+	default:
+		return Result{}, ErrNotApplicable
+	}
+
+	if coupon.MaxDiscount > 0 && result.Discount > coupon.MaxDiscount {
+		result.Discount = coupon.MaxDiscount
+	}
+	result.Discount = math.Round(result.Discount*100) / 100
+
+	return result, nil
+}
+
+func appliesTo(coupon *models.Coupon, line Line) bool {
+	if len(coupon.MetalTypes) > 0 {
+		found := false
+		for _, metal := range coupon.MetalTypes {
+			if metal == line.MetalType {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(coupon.CategoryIDs) > 0 {
+		found := false
+		for _, categoryID := range coupon.CategoryIDs {
+			if categoryID == line.CategoryID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// buyXGetYDiscount makes the cheapest get units free in every group of
+// buy+get units, taking units from the most expensive down. Lines are
+// walked as runs of units rather than one unit at a time, so the work
+// does not grow with the quantities in the cart.
+func buyXGetYDiscount(lines []Line, buy, get int) float64 {
+	if buy <= 0 || get <= 0 {
+		return 0
+	}
+
+	sorted := make([]Line, 0, len(lines))
+	total := 0
+	for _, line := range lines {
+		if line.Quantity > 0 {
+			sorted = append(sorted, line)
+			total += line.Quantity
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].UnitPrice > sorted[j].UnitPrice })
+
+	group := buy + get
+	grouped := total / group * group
+	// free counts the free units among the first n units of the sorted cart
+	free := func(n int) int {
+		if n > grouped {
+			n = grouped
+		}
+		count := n / group * get
+		if rest := n%group - buy; rest > 0 {
+			count += rest
+		}
+		return count
+	}
+
+	discount := 0.0
+	start := 0
+	for _, line := range sorted {
+		end := start + line.Quantity
+		discount += float64(free(end)-free(start)) * line.UnitPrice
+		start = end
+	}
+
+	return discount
+}
+
+// Redeem records one use of a coupon by a user. Both the per-user and the
+// global counters are only incremented while below their limits, so
+// concurrent checkouts cannot exceed either.
+func Redeem(ctx context.Context, store repository.CouponRepository, coupon *models.Coupon, userID primitive.ObjectID) error {
+	reserved, err := store.ReserveUserUse(ctx, coupon.ID, userID, coupon.PerUserLimit)
+	if err != nil {
+		return err
+	}
+	if !reserved {
+		return ErrUserLimit
+	}
+
+	reserved, err = store.ReserveUse(ctx, coupon.ID, coupon.UsageLimit)
+	if err != nil || !reserved {
+		store.ReleaseUserUse(ctx, coupon.ID, userID)
+		if err != nil {
+			return err
+		}
+		return ErrUsageLimit
+	}
+
+	return nil
+}
+
+// Release gives back a use of a coupon, e.g. when the order is cancelled.
+func Release(ctx context.Context, store repository.CouponRepository, couponID, userID primitive.ObjectID) {
+	store.ReleaseUse(ctx, couponID)
+	store.ReleaseUserUse(ctx, couponID, userID)
+}
@@ -0,0 +1,24 @@
+package coupons
+
+import "testing"
+
+func TestBuyXGetYDiscount(t *testing.T) {
+	tests := []struct {
+		name     string
+		lines    []Line
+		buy, get int
+		want     float64
+	}{
+		{"not enough units", []Line{{UnitPrice: 100, Quantity: 2}}, 2, 1, 0},
+		{"cheapest unit of a group is free", []Line{{UnitPrice: 100, Quantity: 2}, {UnitPrice: 40, Quantity: 1}}, 2, 1, 40},
+		{"groups span lines", []Line{{UnitPrice: 10, Quantity: 3}, {UnitPrice: 50, Quantity: 4}}, 2, 1, 60},
+		{"leftover units are not free", []Line{{UnitPrice: 30, Quantity: 5}}, 1, 1, 60},
+		{"large quantities", []Line{{UnitPrice: 2, Quantity: 1 << 30}}, 1, 1, 1 << 30},
+		{"no rule", []Line{{UnitPrice: 30, Quantity: 5}}, 0, 1, 0},
+	}
+	for _, tt := range tests {
+		if got := buyXGetYDiscount(tt.lines, tt.buy, tt.get); got != tt.want {
+			t.Errorf("%s: discount = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 
 	"ejewel/internal/config"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -44,6 +45,94 @@ func Disconnect() {
 	}
 }
 
+// EnsureIndexes creates the indexes the application relies on for
+// uniqueness, atomic counters and expiry.
+func EnsureIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	indexes := map[*mongo.Collection][]mongo.IndexModel{
+		// Imports look products up by slug and variant SKU
+		Products(): {
+			{Keys: bson.D{{Key: "slug", Value: 1}}},
+			{Keys: bson.D{{Key: "variants.sku", Value: 1}}},
+			// Event reconciliation looks for recently changed documents
+			{Keys: bson.D{{Key: "updated_at", Value: 1}}},
+		},
+		Users(): {
+			{Keys: bson.D{{Key: "updated_at", Value: 1}}},
+		},
+		Coupons(): {
+			{Keys: bson.D{{Key: "code", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		CouponUsages(): {
+			{Keys: bson.D{{Key: "coupon_id", Value: 1}, {Key: "user_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		Carts(): {
+			{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true).SetSparse(true)},
+			// Only guest carts carry expires_at, so user carts never expire
+			{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+		Sessions(): {
+			{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "used_hashes", Value: 1}}},
+			{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "last_used_at", Value: -1}}},
+			// Expired sessions are kept a while so reuse of their tokens is
+			// still recognised
+			{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(30 * 24 * 60 * 60)},
+		},
+		Roles(): {
+			{Keys: bson.D{{Key: "name", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		Sellers(): {
+			{Keys: bson.D{{Key: "user_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		Orders(): {
+			{Keys: bson.D{{Key: "fulfilments.seller_id", Value: 1}, {Key: "created_at", Value: -1}}},
+			{Keys: bson.D{{Key: "updated_at", Value: 1}}},
+		},
+		Returns(): {
+			{Keys: bson.D{{Key: "status", Value: 1}, {Key: "updated_at", Value: 1}}},
+		},
+		LedgerEntries(): {
+			{Keys: bson.D{{Key: "key", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "seller_id", Value: 1}, {Key: "created_at", Value: 1}}},
+			{Keys: bson.D{{Key: "payout_id", Value: 1}}},
+		},
+		CommissionRules(): {
+			{Keys: bson.D{{Key: "seller_id", Value: 1}, {Key: "category_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		APIKeys(): {
+			{Keys: bson.D{{Key: "key_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		},
+		Events(): {
+			{Keys: bson.D{{Key: "status", Value: 1}, {Key: "run_at", Value: 1}}},
+			// Reconciliation looks up the latest event of each subject
+			{Keys: bson.D{{Key: "type", Value: 1}, {Key: "created_at", Value: 1}}},
+			// Handled events are kept a week for troubleshooting; failed
+			// ones until they are looked at
+			{Keys: bson.D{{Key: "done_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(7 * 24 * 60 * 60)},
+		},
+		ImportJobs(): {
+			{Keys: bson.D{{Key: "created_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(30 * 24 * 60 * 60)},
+		},
+		RateLimits(): {
+			{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+		RevokedTokens(): {
+			{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		},
+	}
+
+	for collection, models := range indexes {
+		if _, err := collection.Indexes().CreateMany(ctx, models); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // Collections
 func Users() *mongo.Collection {
 	return DB.Collection("users")
@@ -73,3 +162,70 @@ func Reviews() *mongo.Collection {
 	return DB.Collection("reviews")
 }
 
+func MetalRates() *mongo.Collection {
+	return DB.Collection("metal_rates")
+}
+
+func Coupons() *mongo.Collection {
+	return DB.Collection("coupons")
+}
+
+func CouponUsages() *mongo.Collection {
+	return DB.Collection("coupon_usages")
+}
+
+func Returns() *mongo.Collection {
+	return DB.Collection("returns")
+}
+
+func Counters() *mongo.Collection {
+	return DB.Collection("counters")
+}
+
+func ShippingZones() *mongo.Collection {
+	return DB.Collection("shipping_zones")
+}
+
+func Sessions() *mongo.Collection {
+	return DB.Collection("sessions")
+}
+
+func Roles() *mongo.Collection {
+	return DB.Collection("roles")
+}
+
+func RevokedTokens() *mongo.Collection {
+	return DB.Collection("revoked_tokens")
+}
+
+func Sellers() *mongo.Collection {
+	return DB.Collection("sellers")
+}
+
+func LedgerEntries() *mongo.Collection {
+	return DB.Collection("ledger_entries")
+}
+
+func CommissionRules() *mongo.Collection {
+	return DB.Collection("commission_rules")
+}
+
+func PayoutBatches() *mongo.Collection {
+	return DB.Collection("payout_batches")
+}
+
+func APIKeys() *mongo.Collection {
+	return DB.Collection("api_keys")
+}
+
+func RateLimits() *mongo.Collection {
+	return DB.Collection("rate_limits")
+}
+
+func Events() *mongo.Collection {
+	return DB.Collection("events")
+}
+
+func ImportJobs() *mongo.Collection {
+	return DB.Collection("import_jobs")
+}
@@ -0,0 +1,260 @@
+// Package events propagates changes to the documents that keep a copy of
+// the changed fields. Publishing stores an event in the outbox, and a
+// background worker hands it to the subscribed handlers, retrying with
+// backoff until they succeed. An event is published after the write it
+// records, so the worker also reconciles recent changes against the outbox
+// and publishes again any event that was lost in between.
+package events
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// lease holds a claimed event back from other workers while it is
+	// handled. Handling must finish well within it.
+	lease          = 2 * time.Minute
+	handlerTimeout = time.Minute
+
+	// Failed attempts are retried after 5s, 10s, 20s and so on, up to an
+	// hour apart.
+	firstRetry = 5 * time.Second
+	maxRetry   = time.Hour
+
+	// A change is reconciled once its event has had settle to be
+	// published. The first pass after startup looks back lookback.
+	settle   = 30 * time.Second
+	lookback = 24 * time.Hour
+)
+
+// Handler applies an event. It is given the event again when it fails or
+// another handler of the event fails, so it must be safe to repeat.
+type Handler func(ctx context.Context, event *models.Event) error
+
+// Source lists the subjects that changed since a time, with when each last
+// changed.
+type Source func(ctx context.Context, since time.Time) (map[primitive.ObjectID]time.Time, error)
+
+// watch is the source of an event type and how far it has been reconciled.
+type watch struct {
+	source Source
+	since  time.Time
+}
+
+type Bus struct {
+	events      repository.EventRepository
+	maxAttempts int
+
+	mu       sync.RWMutex
+	handlers map[models.EventType][]Handler
+	watches  map[models.EventType]*watch
+
+	// reconcile serialises reconciliation passes
+	reconcile sync.Mutex
+
+	// wake has the worker look for events as soon as one is published
+	wake chan struct{}
+}
+
+func NewBus(events repository.EventRepository, maxAttempts int) *Bus {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &Bus{
+		events:      events,
+		maxAttempts: maxAttempts,
+		handlers:    map[models.EventType][]Handler{},
+		watches:     map[models.EventType]*watch{},
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Subscribe adds a handler for events of the type. Handlers run in the
+// order they were subscribed.
+func (b *Bus) Subscribe(eventType models.EventType, handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.handlers[eventType] = append(b.handlers[eventType], handler)
+}
+
+// Watch has events of the type reconciled against the source, so a
+// subject that changed with no event published since is published again.
+func (b *Bus) Watch(eventType models.EventType, source Source) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.watches[eventType] = &watch{source: source, since: time.Now().Add(-lookback)}
+}
+
+// Publish records that the subject changed. The handlers run in the
+// background.
+func (b *Bus) Publish(ctx context.Context, eventType models.EventType, subjectID primitive.ObjectID) error {
+	now := time.Now()
+	event := &models.Event{
+		Type:      eventType,
+		SubjectID: subjectID,
+		Status:    models.EventPending,
+		RunAt:     now,
+		CreatedAt: now,
+	}
+	if err := b.events.Create(ctx, event); err != nil {
+		return err
+	}
+
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Start handles due events as they are published, and on the given
+// interval reconciles lost events and picks up retries and events
+// published by other instances, until ctx is cancelled.
+func (b *Bus) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		var tick <-chan time.Time
+		if interval > 0 {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+
+		// Events lost before a restart are reconciled on the first pass
+		reconcile := true
+		for {
+			if reconcile {
+				if err := b.Reconcile(ctx); err != nil {
+					log.Println("Failed to reconcile events:", err)
+				}
+			}
+			// Events left over from before a restart are picked up first
+			if err := b.RunDue(ctx); err != nil {
+				log.Println("Failed to claim events:", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-tick:
+				reconcile = true
+			case <-b.wake:
+				reconcile = false
+			}
+		}
+	}()
+}
+
+// Reconcile publishes an event for every watched subject that changed
+// after its latest event. Changes younger than settle are left for the
+// next pass, as their events may still be on the way. Handlers are safe to
+// repeat, so publishing an event that was not lost after all does no harm.
+func (b *Bus) Reconcile(ctx context.Context) error {
+	b.reconcile.Lock()
+	defer b.reconcile.Unlock()
+
+	b.mu.RLock()
+	watches := make(map[models.EventType]*watch, len(b.watches))
+	for eventType, w := range b.watches {
+		watches[eventType] = w
+	}
+	b.mu.RUnlock()
+
+	for eventType, w := range watches {
+		until := time.Now().Add(-settle)
+
+		changed, err := w.source(ctx, w.since)
+		if err != nil {
+			return err
+		}
+		published, err := b.events.Published(ctx, eventType, w.since)
+		if err != nil {
+			return err
+		}
+
+		for subjectID, changedAt := range changed {
+			if !changedAt.Before(until) {
+				continue
+			}
+			if latest, ok := published[subjectID]; ok && !latest.Before(changedAt) {
+				continue
+			}
+			if err := b.Publish(ctx, eventType, subjectID); err != nil {
+				return err
+			}
+		}
+		w.since = until
+	}
+	return nil
+}
+
+// RunDue handles the events that are due, one at a time, until none is
+// left.
+func (b *Bus) RunDue(ctx context.Context) error {
+	for ctx.Err() == nil {
+		event, err := b.events.Claim(ctx, time.Now(), lease)
+		if err == repository.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		b.handle(ctx, event)
+	}
+	return ctx.Err()
+}
+
+// handle runs the event's handlers and records the outcome: done, due
+// again after a backoff, or failed once its attempts are used up.
+func (b *Bus) handle(ctx context.Context, event *models.Event) {
+	b.mu.RLock()
+	handlers := b.handlers[event.Type]
+	b.mu.RUnlock()
+
+	handleCtx, cancel := context.WithTimeout(ctx, handlerTimeout)
+	var err error
+	for _, handler := range handlers {
+		if err = handler(handleCtx, event); err != nil {
+			break
+		}
+	}
+	cancel()
+
+	now := time.Now()
+	set := repository.Fields{"status": models.EventDone, "done_at": now, "last_error": ""}
+	if err != nil {
+		log.Printf("Failed to handle %s event for %s (attempt %d): %v", event.Type, event.SubjectID.Hex(), event.Attempts, err)
+		set = repository.Fields{"last_error": err.Error()}
+		if event.Attempts >= b.maxAttempts {
+			set["status"] = models.EventFailed
+		} else {
+			set["run_at"] = now.Add(retryAfter(event.Attempts))
+		}
+	}
+
+	// A cancelled ctx must not stop the outcome being recorded, or the
+	// event would only be retried once its lease ran out
+	saveCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := b.events.Update(saveCtx, event.ID, set); err != nil {
+		log.Println("Failed to record event outcome:", err)
+	}
+}
+
+// retryAfter is the backoff before the attempt after the given one.
+func retryAfter(attempts int) time.Duration {
+	wait := firstRetry
+	for i := 1; i < attempts && wait < maxRetry; i++ {
+		wait *= 2
+	}
+	return min(wait, maxRetry)
+}
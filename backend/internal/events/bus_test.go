@@ -0,0 +1,88 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+	"ejewel/internal/repository/memory"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestReconcilePublishesLostEvents(t *testing.T) {
+	ctx := context.Background()
+	repos := memory.NewRepositories()
+	bus := NewBus(repos.Events, 3)
+	SyncCopies(bus, repos)
+
+	product := func(name string, updatedAt time.Time) primitive.ObjectID {
+		p := &models.Product{ID: primitive.NewObjectID(), Name: name, UpdatedAt: updatedAt}
+		if err := repos.Products.Create(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+		return p.ID
+	}
+	// The rename was written but its event never made it to the outbox
+	lost := product("Rose Ring", time.Now().Add(-time.Minute))
+	// The event was published after the write
+	published := product("Lily Ring", time.Now().Add(-time.Minute))
+	if err := bus.Publish(ctx, models.EventProductChanged, published); err != nil {
+		t.Fatal(err)
+	}
+	// The event may still be on the way
+	recent := product("Iris Ring", time.Now())
+
+	userID := primitive.NewObjectID()
+	cart := &models.Cart{UserID: userID, Items: []models.CartItem{{ProductID: lost, ProductName: "Rose Band", Quantity: 1}}}
+	if err := repos.Carts.Save(ctx, repository.CartKey{UserID: userID}, cart); err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := repos.Events.Published(ctx, models.EventProductChanged, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Reconcile(ctx); err != nil {
+		t.Fatal(err)
+	}
+	after, err := repos.Events.Published(ctx, models.EventProductChanged, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := after[lost]; !ok {
+		t.Error("lost event was not published again")
+	}
+	if !after[published].Equal(before[published]) {
+		t.Error("published event was published again")
+	}
+	if _, ok := after[recent]; ok {
+		t.Error("recent change was reconciled before its event could arrive")
+	}
+
+	if err := bus.RunDue(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cart, err = repos.Carts.Find(ctx, repository.CartKey{UserID: userID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cart.Items[0].ProductName; got != "Rose Ring" {
+		t.Errorf("cart line name = %q, want %q", got, "Rose Ring")
+	}
+
+	// A second pass finds nothing left to reconcile
+	if err := bus.Reconcile(ctx); err != nil {
+		t.Fatal(err)
+	}
+	again, err := repos.Events.Published(ctx, models.EventProductChanged, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !again[lost].Equal(after[lost]) {
+		t.Error("reconciled event was published again")
+	}
+}
@@ -0,0 +1,87 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SyncCopies subscribes the handlers that copy a changed category name to
+// its products, a user's name and avatar to their reviews, and a product's
+// name and thumbnail to the carts holding it. Each reads the subject's
+// current state, so an event for a subject that has since been deleted is
+// a no-op. Every change to a subject is reconciled, as the fields copied
+// are the ones most changes touch.
+func SyncCopies(bus *Bus, repos repository.Repositories) {
+	bus.Subscribe(models.EventCategoryRenamed, func(ctx context.Context, event *models.Event) error {
+		category, err := repos.Categories.FindByID(ctx, event.SubjectID)
+		if err == repository.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return repos.Products.SetCategoryName(ctx, category.ID, category.Name)
+	})
+	bus.Watch(models.EventCategoryRenamed, func(ctx context.Context, since time.Time) (map[primitive.ObjectID]time.Time, error) {
+		categories, err := repos.Categories.FindAll(ctx)
+		if err != nil {
+			return nil, err
+		}
+		changed := map[primitive.ObjectID]time.Time{}
+		for _, category := range categories {
+			if !category.UpdatedAt.Before(since) {
+				changed[category.ID] = category.UpdatedAt
+			}
+		}
+		return changed, nil
+	})
+
+	bus.Subscribe(models.EventUserProfileChanged, func(ctx context.Context, event *models.Event) error {
+		user, err := repos.Users.FindByID(ctx, event.SubjectID)
+		if err == repository.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return repos.Reviews.SetAuthor(ctx, user.ID, user.FirstName+" "+user.LastName, user.Avatar)
+	})
+	bus.Watch(models.EventUserProfileChanged, func(ctx context.Context, since time.Time) (map[primitive.ObjectID]time.Time, error) {
+		users, err := repos.Users.Find(ctx, repository.UserQuery{UpdatedSince: since})
+		if err != nil {
+			return nil, err
+		}
+		changed := make(map[primitive.ObjectID]time.Time, len(users))
+		for _, user := range users {
+			changed[user.ID] = user.UpdatedAt
+		}
+		return changed, nil
+	})
+
+	bus.Subscribe(models.EventProductChanged, func(ctx context.Context, event *models.Event) error {
+		product, err := repos.Products.FindByID(ctx, event.SubjectID)
+		if err == repository.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return repos.Carts.SetProductDetails(ctx, product.ID, product.Name, product.Thumbnail)
+	})
+	bus.Watch(models.EventProductChanged, func(ctx context.Context, since time.Time) (map[primitive.ObjectID]time.Time, error) {
+		products, err := repos.Products.Find(ctx, repository.ProductQuery{UpdatedSince: since})
+		if err != nil {
+			return nil, err
+		}
+		changed := make(map[primitive.ObjectID]time.Time, len(products))
+		for _, product := range products {
+			changed[product.ID] = product.UpdatedAt
+		}
+		return changed, nil
+	})
+}
@@ -0,0 +1,112 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"ejewel/internal/ledger"
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PostLedger subscribes the handlers that post sellers' sales once their
+// part of an order is delivered and reverse them once a return or a
+// cancelled order is refunded. The ledger skips entries it already holds, so a retried or
+// reconciled event posts nothing twice.
+func PostLedger(bus *Bus, repos repository.Repositories, sellerLedger *ledger.Ledger) {
+	bus.Subscribe(models.EventOrderDelivered, func(ctx context.Context, event *models.Event) error {
+		order, err := repos.Orders.FindByID(ctx, event.SubjectID)
+		if err == repository.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return sellerLedger.RecordDelivery(ctx, order)
+	})
+	bus.Watch(models.EventOrderDelivered, func(ctx context.Context, since time.Time) (map[primitive.ObjectID]time.Time, error) {
+		orders, err := repos.Orders.Find(ctx, repository.OrderQuery{UpdatedSince: since})
+		if err != nil {
+			return nil, err
+		}
+		changed := map[primitive.ObjectID]time.Time{}
+		for _, order := range orders {
+			for _, part := range order.Fulfilments {
+				if part.Status == models.OrderDelivered {
+					changed[order.ID] = order.UpdatedAt
+					break
+				}
+			}
+		}
+		return changed, nil
+	})
+
+	bus.Subscribe(models.EventReturnRefunded, func(ctx context.Context, event *models.Event) error {
+		returnRequest, err := repos.Returns.FindByID(ctx, event.SubjectID)
+		if err == repository.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// A refund that failed and was reverted took nothing back
+		if returnRequest.Status != models.ReturnRefunded {
+			return nil
+		}
+		order, err := repos.Orders.FindByID(ctx, returnRequest.OrderID)
+		if err == repository.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return sellerLedger.RecordReturn(ctx, order, returnRequest)
+	})
+	bus.Watch(models.EventReturnRefunded, func(ctx context.Context, since time.Time) (map[primitive.ObjectID]time.Time, error) {
+		returns, err := repos.Returns.Find(ctx, repository.ReturnQuery{Status: models.ReturnRefunded, UpdatedSince: since})
+		if err != nil {
+			return nil, err
+		}
+		changed := make(map[primitive.ObjectID]time.Time, len(returns))
+		for _, returnRequest := range returns {
+			changed[returnRequest.ID] = returnRequest.UpdatedAt
+		}
+		return changed, nil
+	})
+
+	bus.Subscribe(models.EventOrderRefunded, func(ctx context.Context, event *models.Event) error {
+		order, err := repos.Orders.FindByID(ctx, event.SubjectID)
+		if err == repository.ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// Orders refunded through returns are reversed return by return
+		if !refundedOnCancellation(order) {
+			return nil
+		}
+		return sellerLedger.RecordRefund(ctx, order)
+	})
+	bus.Watch(models.EventOrderRefunded, func(ctx context.Context, since time.Time) (map[primitive.ObjectID]time.Time, error) {
+		orders, err := repos.Orders.Find(ctx, repository.OrderQuery{Statuses: []models.OrderStatus{models.OrderRefunded}, UpdatedSince: since})
+		if err != nil {
+			return nil, err
+		}
+		changed := map[primitive.ObjectID]time.Time{}
+		for _, order := range orders {
+			if refundedOnCancellation(&order) {
+				changed[order.ID] = order.UpdatedAt
+			}
+		}
+		return changed, nil
+	})
+}
+
+// refundedOnCancellation reports whether the order's payment was refunded
+// in full when it was cancelled.
+func refundedOnCancellation(order *models.Order) bool {
+	return order.Status == models.OrderRefunded && order.PaymentInfo.RefundID != ""
+}
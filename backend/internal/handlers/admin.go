@@ -5,20 +5,31 @@ import (
 	"net/http"
 	"time"
 
-	"ejewel/internal/database"
 	"ejewel/internal/models"
+	"ejewel/internal/rbac"
+	"ejewel/internal/repository"
+	"ejewel/internal/revocation"
 	"ejewel/internal/utils"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-type AdminHandler struct{}
+type AdminHandler struct {
+	users       repository.UserRepository
+	products    repository.ProductRepository
+	orders      repository.OrderRepository
+	revocations *revocation.List
+	roles       *rbac.Roles
+}
+
+func NewAdminHandler(users repository.UserRepository, products repository.ProductRepository, orders repository.OrderRepository, revocations *revocation.List, roles *rbac.Roles) *AdminHandler {
+	return &AdminHandler{users: users, products: products, orders: orders, revocations: revocations, roles: roles}
+}
 
-func NewAdminHandler() *AdminHandler {
-	return &AdminHandler{}
+// ordersWithStatus lists orders in any of the statuses.
+func ordersWithStatus(statuses ...models.OrderStatus) repository.OrderQuery {
+	return repository.OrderQuery{Statuses: statuses}
 }
 
 func (h *AdminHandler) GetDashboardStats(c *gin.Context) {
@@ -26,76 +37,35 @@ func (h *AdminHandler) GetDashboardStats(c *gin.Context) {
 	defer cancel()
 
 	// Get counts
-	totalProducts, _ := database.Products().CountDocuments(ctx, bson.M{})
-	activeProducts, _ := database.Products().CountDocuments(ctx, bson.M{"is_active": true})
-	totalUsers, _ := database.Users().CountDocuments(ctx, bson.M{})
-	totalOrders, _ := database.Orders().CountDocuments(ctx, bson.M{})
-	pendingOrders, _ := database.Orders().CountDocuments(ctx, bson.M{"status": models.OrderPending})
-	processingOrders, _ := database.Orders().CountDocuments(ctx, bson.M{"status": models.OrderProcessing})
-	deliveredOrders, _ := database.Orders().CountDocuments(ctx, bson.M{"status": models.OrderDelivered})
+	totalProducts, _ := h.products.Count(ctx, repository.ProductQuery{})
+	activeProducts, _ := h.products.Count(ctx, repository.ProductQuery{ActiveOnly: true})
+	totalUsers, _ := h.users.Count(ctx, repository.UserQuery{})
+	totalOrders, _ := h.orders.Count(ctx, repository.OrderQuery{})
+	pendingOrders, _ := h.orders.Count(ctx, ordersWithStatus(models.OrderPending))
+	processingOrders, _ := h.orders.Count(ctx, ordersWithStatus(models.OrderProcessing))
+	deliveredOrders, _ := h.orders.Count(ctx, ordersWithStatus(models.OrderDelivered))
 
 	// Get total revenue
-	pipeline := []bson.M{
-		{"$match": bson.M{"status": bson.M{"$in": []models.OrderStatus{models.OrderDelivered, models.OrderShipped}}}},
-		{"$group": bson.M{"_id": nil, "total": bson.M{"$sum": "$total"}}},
-	}
-	cursor, _ := database.Orders().Aggregate(ctx, pipeline)
-	var revenueResult []bson.M
-	cursor.All(ctx, &revenueResult)
-	totalRevenue := 0.0
-	if len(revenueResult) > 0 {
-		if val, ok := revenueResult[0]["total"].(float64); ok {
-			totalRevenue = val
-		}
-	}
+	totalRevenue, _ := h.orders.Revenue(ctx, ordersWithStatus(models.OrderDelivered, models.OrderShipped))
 
 	// Get today's stats
 	today := time.Now().Truncate(24 * time.Hour)
-	todayOrders, _ := database.Orders().CountDocuments(ctx, bson.M{"created_at": bson.M{"$gte": today}})
-	
-	todayPipeline := []bson.M{
-		{"$match": bson.M{"created_at": bson.M{"$gte": today}}},
-		{"$group": bson.M{"_id": nil, "total": bson.M{"$sum": "$total"}}},
-	}
-	cursor, _ = database.Orders().Aggregate(ctx, todayPipeline)
-	var todayRevenueResult []bson.M
-	cursor.All(ctx, &todayRevenueResult)
-	todayRevenue := 0.0
-	if len(todayRevenueResult) > 0 {
-		if val, ok := todayRevenueResult[0]["total"].(float64); ok {
-			todayRevenue = val
-		}
-	}
+	todayOrders, _ := h.orders.Count(ctx, repository.OrderQuery{CreatedSince: today})
+	todayRevenue, _ := h.orders.Revenue(ctx, repository.OrderQuery{CreatedSince: today})
 
 	// Get recent orders
-	recentOrdersOpts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(10)
-	recentOrdersCursor, _ := database.Orders().Find(ctx, bson.M{}, recentOrdersOpts)
-	var recentOrders []models.Order
-	recentOrdersCursor.All(ctx, &recentOrders)
+	recentOrders, _ := h.orders.Find(ctx, repository.OrderQuery{Page: repository.Page{Limit: 10}})
 
 	// Get low stock products
-	lowStockOpts := options.Find().SetLimit(10)
-	lowStockCursor, _ := database.Products().Find(ctx, bson.M{"stock": bson.M{"$lt": 10}, "is_active": true}, lowStockOpts)
-	var lowStockProducts []models.Product
-	lowStockCursor.All(ctx, &lowStockProducts)
+	lowStockProducts, _ := h.products.Find(ctx, repository.ProductQuery{
+		ActiveOnly: true,
+		StockBelow: 10,
+		Page:       repository.Page{Limit: 10},
+	})
 
 	// Get monthly revenue for chart
 	startOfMonth := time.Date(time.Now().Year(), time.Now().Month()-5, 1, 0, 0, 0, 0, time.UTC)
-	monthlyPipeline := []bson.M{
-		{"$match": bson.M{"created_at": bson.M{"$gte": startOfMonth}}},
-		{"$group": bson.M{
-			"_id": bson.M{
-				"year":  bson.M{"$year": "$created_at"},
-				"month": bson.M{"$month": "$created_at"},
-			},
-			"revenue": bson.M{"$sum": "$total"},
-			"orders":  bson.M{"$sum": 1},
-		}},
-		{"$sort": bson.M{"_id.year": 1, "_id.month": 1}},
-	}
-	monthlyCursor, _ := database.Orders().Aggregate(ctx, monthlyPipeline)
-	var monthlyStats []bson.M
-	monthlyCursor.All(ctx, &monthlyStats)
+	monthlyStats, _ := h.orders.MonthlyStats(ctx, startOfMonth)
 
 	utils.SuccessResponse(c, http.StatusOK, "", gin.H{
 		"overview": gin.H{
@@ -124,31 +94,18 @@ func (h *AdminHandler) GetUsers(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	filter := bson.M{}
-	if role != "" {
-		filter["role"] = role
+	query := repository.UserQuery{
+		Role: models.Role(role),
+		Page: repository.Page{Skip: int64((page - 1) * limit), Limit: int64(limit)},
 	}
 
-	skip := int64((page - 1) * limit)
-	opts := options.Find().
-		SetSort(bson.D{{Key: "created_at", Value: -1}}).
-		SetSkip(skip).
-		SetLimit(int64(limit))
-
-	cursor, err := database.Users().Find(ctx, filter, opts)
+	users, err := h.users.Find(ctx, query)
 	if err != nil {
 		utils.InternalError(c, "Failed to fetch users")
 		return
 	}
-	defer cursor.Close(ctx)
-
-	var users []models.User
-	if err := cursor.All(ctx, &users); err != nil {
-		utils.InternalError(c, "Failed to decode users")
-		return
-	}
 
-	total, _ := database.Users().CountDocuments(ctx, filter)
+	total, _ := h.users.Count(ctx, query)
 
 	utils.PaginatedSuccessResponse(c, users, page, limit, total)
 }
@@ -165,17 +122,14 @@ func (h *AdminHandler) GetUser(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	err = database.Users().FindOne(ctx, bson.M{"_id": objectID}).Decode(&user)
+	user, err := h.users.FindByID(ctx, objectID)
 	if err != nil {
 		utils.NotFoundError(c, "User not found")
 		return
 	}
 
 	// Get user's orders
-	ordersCursor, _ := database.Orders().Find(ctx, bson.M{"user_id": objectID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(10))
-	var orders []models.Order
-	ordersCursor.All(ctx, &orders)
+	orders, _ := h.orders.Find(ctx, repository.OrderQuery{UserID: objectID, Page: repository.Page{Limit: 10}})
 
 	utils.SuccessResponse(c, http.StatusOK, "", gin.H{
 		"user":   user,
@@ -187,7 +141,7 @@ func (h *AdminHandler) UpdateUser(c *gin.Context) {
 	id := c.Param("id")
 
 	var input struct {
-		Role     models.Role `json:"role"`
+		Role     models.Role `json:"role" binding:"required"`
 		IsActive bool        `json:"isActive"`
 	}
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -204,20 +158,59 @@ func (h *AdminHandler) UpdateUser(c *gin.Context) {
 		return
 	}
 
-	update := bson.M{
+	current, err := h.users.FindByID(ctx, objectID)
+	if err != nil {
+		utils.NotFoundError(c, "User not found")
+		return
+	}
+
+	if input.Role.IsStaff() {
+		if _, err := h.roles.Get(ctx, input.Role); err != nil {
+			utils.ValidationError(c, "Unknown role")
+			return
+		}
+	}
+
+	// Staff can only hand out, or take away, roles no stronger than their own
+	userRole, _ := c.Get("userRole")
+	holder, _ := userRole.(models.Role)
+	for _, role := range []models.Role{current.Role, input.Role} {
+		covered, err := h.roles.Covers(ctx, holder, role)
+		if err != nil {
+			utils.InternalError(c, "Failed to check permissions")
+			return
+		}
+		if !covered {
+			utils.ForbiddenError(c, "You cannot assign or change the role "+string(role))
+			return
+		}
+	}
+
+	update := repository.Fields{
 		"role":       input.Role,
 		"is_active":  input.IsActive,
 		"updated_at": time.Now(),
 	}
 
-	_, err = database.Users().UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{"$set": update})
+	err = h.users.Update(ctx, objectID, update)
+	if err == repository.ErrNotFound {
+		utils.NotFoundError(c, "User not found")
+		return
+	}
 	if err != nil {
 		utils.InternalError(c, "Failed to update user")
 		return
 	}
 
-	var user models.User
-	database.Users().FindOne(ctx, bson.M{"_id": objectID}).Decode(&user)
+	// Tokens carry the role, so they must not outlive a change to it
+	if current.Role != input.Role || current.IsActive != input.IsActive {
+		if err := h.revocations.RevokeUser(ctx, objectID); err != nil {
+			utils.InternalError(c, "User updated but existing tokens could not be revoked")
+			return
+		}
+	}
+
+	user, _ := h.users.FindByID(ctx, objectID)
 
 	utils.SuccessResponse(c, http.StatusOK, "User updated successfully", user)
 }
@@ -229,27 +222,17 @@ func (h *AdminHandler) GetAllProducts(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	skip := int64((page - 1) * limit)
-	opts := options.Find().
-		SetSort(bson.D{{Key: "created_at", Value: -1}}).
-		SetSkip(skip).
-		SetLimit(int64(limit))
-
-	cursor, err := database.Products().Find(ctx, bson.M{}, opts)
+	products, err := h.products.Find(ctx, repository.ProductQuery{
+		SortBy:   "created_at",
+		SortDesc: true,
+		Page:     repository.Page{Skip: int64((page - 1) * limit), Limit: int64(limit)},
+	})
 	if err != nil {
 		utils.InternalError(c, "Failed to fetch products")
 		return
 	}
-	defer cursor.Close(ctx)
 
-	var products []models.Product
-	if err := cursor.All(ctx, &products); err != nil {
-		utils.InternalError(c, "Failed to decode products")
-		return
-	}
-
-	total, _ := database.Products().CountDocuments(ctx, bson.M{})
+	total, _ := h.products.Count(ctx, repository.ProductQuery{})
 
 	utils.PaginatedSuccessResponse(c, products, page, limit, total)
 }
-
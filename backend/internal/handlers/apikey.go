@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"ejewel/internal/apikeys"
+	"ejewel/internal/models"
+	"ejewel/internal/rbac"
+	"ejewel/internal/repository"
+	"ejewel/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type APIKeyHandler struct {
+	keys    *apikeys.Keys
+	apiKeys repository.APIKeyRepository
+	rbac    *rbac.Roles
+}
+
+func NewAPIKeyHandler(keys *apikeys.Keys, apiKeys repository.APIKeyRepository, rbacRoles *rbac.Roles) *APIKeyHandler {
+	return &APIKeyHandler{keys: keys, apiKeys: apiKeys, rbac: rbacRoles}
+}
+
+func (h *APIKeyHandler) GetAPIKeys(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	keys, err := h.apiKeys.FindAll(ctx)
+	if err != nil {
+		utils.InternalError(c, "Failed to fetch API keys")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "", keys)
+}
+
+// CreateAPIKey issues a key acting for the caller. The key is only ever
+// returned in this response.
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	userID, _ := c.Get("userId")
+	objectID, _ := primitive.ObjectIDFromHex(userID.(string))
+
+	var input models.CreateAPIKeyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		utils.ValidationError(c, "expiresAt must be in the future")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// A key can never do more than the staff member it acts for, but
+	// scopes beyond their role would only mislead
+	if !holdsPermissions(ctx, c, h.rbac, input.Scopes, "You cannot issue keys with scope %q") {
+		return
+	}
+
+	key := models.APIKey{
+		Name:      input.Name,
+		Scopes:    input.Scopes,
+		RateLimit: input.RateLimit,
+		CreatedBy: objectID,
+		ExpiresAt: input.ExpiresAt,
+	}
+	raw, err := h.keys.Issue(ctx, &key)
+	if err != nil {
+		utils.InternalError(c, "Failed to create API key")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "API key created; store it now, it will not be shown again", gin.H{
+		"key":    raw,
+		"apiKey": key,
+	})
+}
+
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	userID, _ := c.Get("userId")
+	revokedBy, _ := primitive.ObjectIDFromHex(userID.(string))
+
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		utils.ValidationError(c, "Invalid API key ID")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	key, err := h.apiKeys.FindByID(ctx, objectID)
+	if err != nil {
+		utils.NotFoundError(c, "API key not found")
+		return
+	}
+	if key.RevokedAt != nil {
+		utils.ErrorResponse(c, http.StatusConflict, "API key has already been revoked")
+		return
+	}
+
+	err = h.apiKeys.Update(ctx, objectID, repository.Fields{"revoked_at": time.Now(), "revoked_by": revokedBy})
+	if err != nil {
+		utils.InternalError(c, "Failed to revoke API key")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "API key revoked successfully", nil)
+}
@@ -2,22 +2,41 @@ package handlers
 
 import (
 	"context"
+	"log"
 	"net/http"
 	"time"
 
-	"ejewel/internal/database"
+	"ejewel/internal/config"
+	"ejewel/internal/events"
+	"ejewel/internal/mailer"
 	"ejewel/internal/models"
+	"ejewel/internal/pricing"
+	"ejewel/internal/repository"
+	"ejewel/internal/revocation"
 	"ejewel/internal/utils"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-type AuthHandler struct{}
+type AuthHandler struct {
+	users       repository.UserRepository
+	sessions    repository.SessionRepository
+	revocations *revocation.List
+	carts       cartStore
+	mailer      mailer.Mailer
+	events      *events.Bus
+}
 
-func NewAuthHandler() *AuthHandler {
-	return &AuthHandler{}
+func NewAuthHandler(users repository.UserRepository, sessions repository.SessionRepository, revocations *revocation.List, carts repository.CartRepository, products repository.ProductRepository, pricingEngine *pricing.Engine, mail mailer.Mailer, bus *events.Bus) *AuthHandler {
+	return &AuthHandler{
+		users:       users,
+		sessions:    sessions,
+		revocations: revocations,
+		carts:       cartStore{carts: carts, products: products, pricing: pricingEngine},
+		mailer:      mail,
+		events:      bus,
+	}
 }
 
 func (h *AuthHandler) Register(c *gin.Context) {
@@ -31,8 +50,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	defer cancel()
 
 	// Check if user exists
-	var existingUser models.User
-	err := database.Users().FindOne(ctx, bson.M{"email": input.Email}).Decode(&existingUser)
+	_, err := h.users.FindByEmail(ctx, input.Email)
 	if err == nil {
 		utils.ErrorResponse(c, http.StatusConflict, "User with this email already exists")
 		return
@@ -60,27 +78,28 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		UpdatedAt: time.Now(),
 	}
 
-	_, err = database.Users().InsertOne(ctx, user)
+	err = h.users.Create(ctx, &user)
+	if err == repository.ErrDuplicate {
+		utils.ErrorResponse(c, http.StatusConflict, "User with this email already exists")
+		return
+	}
 	if err != nil {
 		utils.InternalError(c, "Failed to create user")
 		return
 	}
 
 	// Generate tokens
-	accessToken, err := utils.GenerateToken(&user)
+	accessToken, refreshToken, err := h.issueTokens(ctx, c, &user, false)
 	if err != nil {
-		utils.InternalError(c, "Failed to generate access token")
+		utils.InternalError(c, "Failed to generate tokens")
 		return
 	}
 
-	refreshToken, err := utils.GenerateRefreshToken(&user)
-	if err != nil {
-		utils.InternalError(c, "Failed to generate refresh token")
-		return
-	}
+	h.mergeGuestCart(ctx, c, user.ID)
 
-	// Update refresh token in database
-	database.Users().UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"refresh_token": refreshToken}})
+	if err := h.sendVerificationEmail(ctx, &user); err != nil {
+		log.Println("Failed to send verification email to", user.Email+":", err)
+	}
 
 	utils.SuccessResponse(c, http.StatusCreated, "User registered successfully", models.AuthResponse{
 		User:         &user,
@@ -99,8 +118,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	var user models.User
-	err := database.Users().FindOne(ctx, bson.M{"email": input.Email}).Decode(&user)
+	user, err := h.users.FindByEmail(ctx, input.Email)
 	if err != nil {
 		utils.ErrorResponse(c, http.StatusUnauthorized, "Invalid email or password")
 		return
@@ -111,32 +129,131 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
+	// A locked account is refused before the password is checked, so
+	// guessing cannot go on while it lasts
+	if user.LockedUntil != nil && time.Now().Before(*user.LockedUntil) {
+		utils.TooManyRequestsError(c, "Too many failed sign-in attempts, please try again later", time.Until(*user.LockedUntil))
+		return
+	}
+
 	if !utils.CheckPassword(input.Password, user.Password) {
+		h.recordFailedLogin(ctx, user)
 		utils.ErrorResponse(c, http.StatusUnauthorized, "Invalid email or password")
 		return
 	}
 
-	accessToken, err := utils.GenerateToken(&user)
+	// With two-factor on, the password only earns a challenge to be
+	// completed with a code at /login/2fa. Failures are kept until the code
+	// is accepted too, so wrong codes add up across challenges
+	if user.TwoFactor.Enabled {
+		challenge, err := utils.GenerateActionToken(user, utils.PurposeTwoFactorLogin, config.AppConfig.ChallengeTokenTTL)
+		if err != nil {
+			utils.InternalError(c, "Failed to start two-factor login")
+			return
+		}
+		utils.SuccessResponse(c, http.StatusOK, "Two-factor code required", models.TwoFactorChallenge{
+			TwoFactorRequired: true,
+			ChallengeToken:    challenge,
+		})
+		return
+	}
+
+	h.clearFailedLogins(ctx, user)
+	h.signIn(ctx, c, user, false)
+}
+
+// clearFailedLogins resets the failure count and lock once the user has
+// fully signed in.
+func (h *AuthHandler) clearFailedLogins(ctx context.Context, user *models.User) {
+	if user.FailedLogins == 0 {
+		return
+	}
+	if err := h.users.Update(ctx, user.ID, repository.Fields{"failed_logins": 0, "locked_until": nil}); err != nil {
+		log.Println("Failed to reset failed sign-ins:", err)
+	}
+}
+
+// recordFailedLogin counts a wrong password or two-factor code and locks
+// the account once the failures reach the threshold. Each further failure
+// doubles the lock, up to the configured maximum.
+func (h *AuthHandler) recordFailedLogin(ctx context.Context, user *models.User) {
+	failures, err := h.users.RecordFailedLogin(ctx, user.ID)
 	if err != nil {
-		utils.InternalError(c, "Failed to generate access token")
+		log.Println("Failed to record failed sign-in:", err)
+		return
+	}
+
+	threshold := config.AppConfig.LoginLockoutThreshold
+	if threshold <= 0 || failures < threshold {
 		return
 	}
+	lock := config.AppConfig.LoginLockoutDuration
+	for i := threshold; i < failures && lock < config.AppConfig.LoginLockoutMax; i++ {
+		lock *= 2
+	}
+	if lock > config.AppConfig.LoginLockoutMax {
+		lock = config.AppConfig.LoginLockoutMax
+	}
 
-	refreshToken, err := utils.GenerateRefreshToken(&user)
+	if err := h.users.Update(ctx, user.ID, repository.Fields{"locked_until": time.Now().Add(lock)}); err != nil {
+		log.Println("Failed to lock account:", err)
+	}
+}
+
+// signIn issues tokens for an authenticated user and writes the login
+// response.
+func (h *AuthHandler) signIn(ctx context.Context, c *gin.Context, user *models.User, mfa bool) {
+	accessToken, refreshToken, err := h.issueTokens(ctx, c, user, mfa)
 	if err != nil {
-		utils.InternalError(c, "Failed to generate refresh token")
+		utils.InternalError(c, "Failed to generate tokens")
 		return
 	}
 
-	database.Users().UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"refresh_token": refreshToken}})
+	h.mergeGuestCart(ctx, c, user.ID)
 
 	utils.SuccessResponse(c, http.StatusOK, "Login successful", models.AuthResponse{
-		User:         &user,
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
+		User:                   user,
+		AccessToken:            accessToken,
+		RefreshToken:           refreshToken,
+		TwoFactorSetupRequired: user.Role.IsStaff() && config.AppConfig.RequireAdmin2FA && !user.TwoFactor.Enabled,
 	})
 }
 
+// issueTokens opens a session for the requesting device and returns its
+// access and refresh tokens.
+func (h *AuthHandler) issueTokens(ctx context.Context, c *gin.Context, user *models.User, mfa bool) (string, string, error) {
+	refreshToken, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
+	session := models.Session{
+		ID:         primitive.NewObjectID(),
+		UserID:     user.ID,
+		UserAgent:  c.Request.UserAgent(),
+		IP:         c.ClientIP(),
+		TokenHash:  utils.HashToken(refreshToken),
+		UsedHashes: []string{},
+		MFA:        mfa,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(config.AppConfig.RefreshTokenTTL),
+	}
+	if err := h.sessions.Create(ctx, &session); err != nil {
+		return "", "", err
+	}
+
+	accessToken, err := utils.GenerateToken(user, session.ID.Hex(), mfa)
+	if err != nil {
+		return "", "", err
+	}
+	return accessToken, refreshToken, nil
+}
+
+// RefreshToken exchanges a refresh token for a new access and refresh
+// token. Each refresh token works once; presenting one that was already
+// rotated means it leaked, so the session is revoked on both devices.
 func (h *AuthHandler) RefreshToken(c *gin.Context) {
 	var input struct {
 		RefreshToken string `json:"refreshToken" binding:"required"`
@@ -146,36 +263,63 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	claims, err := utils.ValidateToken(input.RefreshToken)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	hash := utils.HashToken(input.RefreshToken)
+	session, err := h.sessions.FindByTokenHash(ctx, hash)
 	if err != nil {
 		utils.UnauthorizedError(c, "Invalid refresh token")
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	if session.TokenHash != hash {
+		h.revokeReusedSession(ctx, session)
+		utils.UnauthorizedError(c, "Refresh token has already been used, please sign in again")
+		return
+	}
 
-	userID, _ := primitive.ObjectIDFromHex(claims.UserID)
-	var user models.User
-	err = database.Users().FindOne(ctx, bson.M{"_id": userID, "refresh_token": input.RefreshToken}).Decode(&user)
-	if err != nil {
+	now := time.Now()
+	if !session.IsActive(now) {
+		utils.UnauthorizedError(c, "Session has expired or been revoked")
+		return
+	}
+
+	user, err := h.users.FindByID(ctx, session.UserID)
+	if err != nil || !user.IsActive {
+		h.endSession(ctx, session, "account unavailable")
 		utils.UnauthorizedError(c, "Invalid refresh token")
 		return
 	}
 
-	accessToken, err := utils.GenerateToken(&user)
+	newRefreshToken, err := utils.GenerateRandomToken(32)
 	if err != nil {
-		utils.InternalError(c, "Failed to generate access token")
+		utils.InternalError(c, "Failed to generate tokens")
 		return
 	}
 
-	newRefreshToken, err := utils.GenerateRefreshToken(&user)
+	err = h.sessions.Rotate(ctx, session.ID, hash, utils.HashToken(newRefreshToken), repository.Fields{
+		"user_agent":   c.Request.UserAgent(),
+		"ip":           c.ClientIP(),
+		"last_used_at": now,
+		"expires_at":   now.Add(config.AppConfig.RefreshTokenTTL),
+	})
+	if err == repository.ErrConflict {
+		// Another request rotated the same token first
+		h.revokeReusedSession(ctx, session)
+		utils.UnauthorizedError(c, "Refresh token has already been used, please sign in again")
+		return
+	}
 	if err != nil {
-		utils.InternalError(c, "Failed to generate refresh token")
+		utils.InternalError(c, "Failed to refresh session")
 		return
 	}
 
-	database.Users().UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"refresh_token": newRefreshToken}})
+	accessToken, err := utils.GenerateToken(user, session.ID.Hex(), session.MFA)
+	if err != nil {
+		utils.InternalError(c, "Failed to generate tokens")
+		return
+	}
 
 	utils.SuccessResponse(c, http.StatusOK, "Token refreshed successfully", gin.H{
 		"accessToken":  accessToken,
@@ -190,7 +334,12 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 	defer cancel()
 
 	objectID, _ := primitive.ObjectIDFromHex(userID.(string))
-	database.Users().UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{"$set": bson.M{"refresh_token": ""}})
+	if session, err := h.requestSession(ctx, c, objectID); err == nil {
+		h.endSession(ctx, session, "logged out")
+	}
+	if tokenID := c.GetString("tokenId"); tokenID != "" {
+		h.revocations.Revoke(ctx, tokenID, time.Now().Add(config.AppConfig.JWTExpiry))
+	}
 
 	utils.SuccessResponse(c, http.StatusOK, "Logged out successfully", nil)
 }
@@ -202,8 +351,7 @@ func (h *AuthHandler) GetProfile(c *gin.Context) {
 	defer cancel()
 
 	objectID, _ := primitive.ObjectIDFromHex(userID.(string))
-	var user models.User
-	err := database.Users().FindOne(ctx, bson.M{"_id": objectID}).Decode(&user)
+	user, err := h.users.FindByID(ctx, objectID)
 	if err != nil {
 		utils.NotFoundError(c, "User not found")
 		return
@@ -226,7 +374,7 @@ func (h *AuthHandler) UpdateProfile(c *gin.Context) {
 
 	objectID, _ := primitive.ObjectIDFromHex(userID.(string))
 
-	update := bson.M{
+	update := repository.Fields{
 		"updated_at": time.Now(),
 	}
 
@@ -251,14 +399,21 @@ func (h *AuthHandler) UpdateProfile(c *gin.Context) {
 		update["addresses"] = input.Addresses
 	}
 
-	_, err := database.Users().UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{"$set": update})
+	err := h.users.Update(ctx, objectID, update)
 	if err != nil {
 		utils.InternalError(c, "Failed to update profile")
 		return
 	}
 
-	var user models.User
-	database.Users().FindOne(ctx, bson.M{"_id": objectID}).Decode(&user)
+	// Reviews carry the name and avatar, and are brought up to date in the
+	// background
+	if input.FirstName != "" || input.LastName != "" || input.Avatar != "" {
+		if err := h.events.Publish(ctx, models.EventUserProfileChanged, objectID); err != nil {
+			log.Printf("Failed to publish profile change of user %s: %v", objectID.Hex(), err)
+		}
+	}
+
+	user, _ := h.users.FindByID(ctx, objectID)
 
 	utils.SuccessResponse(c, http.StatusOK, "Profile updated successfully", user)
 }
@@ -279,8 +434,7 @@ func (h *AuthHandler) ChangePassword(c *gin.Context) {
 	defer cancel()
 
 	objectID, _ := primitive.ObjectIDFromHex(userID.(string))
-	var user models.User
-	err := database.Users().FindOne(ctx, bson.M{"_id": objectID}).Decode(&user)
+	user, err := h.users.FindByID(ctx, objectID)
 	if err != nil {
 		utils.NotFoundError(c, "User not found")
 		return
@@ -297,12 +451,46 @@ func (h *AuthHandler) ChangePassword(c *gin.Context) {
 		return
 	}
 
-	_, err = database.Users().UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{"$set": bson.M{"password": hashedPassword, "updated_at": time.Now()}})
+	err = h.users.Update(ctx, objectID, repository.Fields{"password": hashedPassword, "updated_at": time.Now()})
 	if err != nil {
 		utils.InternalError(c, "Failed to change password")
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Password changed successfully", nil)
+	// Sign out every other device and invalidate outstanding access
+	// tokens; this device carries on with a fresh one
+	current, _ := h.requestSession(ctx, c, objectID)
+	if err := h.endOtherSessions(ctx, objectID, current, "password changed"); err != nil {
+		log.Println("Failed to revoke sessions after password change:", err)
+	}
+	if err := h.revocations.RevokeUser(ctx, objectID); err != nil {
+		utils.InternalError(c, "Failed to revoke existing tokens")
+		return
+	}
+
+	data := gin.H{}
+	if current != nil {
+		user.TokenVersion++
+		accessToken, err := utils.GenerateToken(user, current.ID.Hex(), current.MFA)
+		if err != nil {
+			utils.InternalError(c, "Failed to generate tokens")
+			return
+		}
+		data["accessToken"] = accessToken
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Password changed successfully", data)
 }
 
+// mergeGuestCart folds the guest cart named by the request's cart token
+// into the user's cart. A failed merge must not block signing in, so it is
+// only logged.
+func (h *AuthHandler) mergeGuestCart(ctx context.Context, c *gin.Context, userID primitive.ObjectID) {
+	token := c.GetHeader(CartTokenHeader)
+	if token == "" {
+		return
+	}
+	if err := h.carts.merge(ctx, token, userID); err != nil {
+		log.Println("Failed to merge guest cart:", err)
+	}
+}
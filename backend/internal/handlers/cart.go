@@ -2,49 +2,133 @@ package handlers
 
 import (
 	"context"
+	"math"
 	"net/http"
 	"time"
 
-	"ejewel/internal/database"
+	"ejewel/internal/config"
+	"ejewel/internal/coupons"
 	"ejewel/internal/models"
+	"ejewel/internal/pricing"
+	"ejewel/internal/repository"
+	"ejewel/internal/shipping"
 	"ejewel/internal/utils"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-type CartHandler struct{}
+type CartHandler struct {
+	pricing  *pricing.Engine
+	products repository.ProductRepository
+	coupons  repository.CouponRepository
+	zones    repository.ShippingZoneRepository
+	carts    cartStore
+}
+
+func NewCartHandler(carts repository.CartRepository, products repository.ProductRepository, couponStore repository.CouponRepository, zones repository.ShippingZoneRepository, pricingEngine *pricing.Engine) *CartHandler {
+	return &CartHandler{
+		pricing:  pricingEngine,
+		products: products,
+		coupons:  couponStore,
+		zones:    zones,
+		carts:    cartStore{carts: carts, products: products, pricing: pricingEngine},
+	}
+}
+
+// cartStore loads, reprices and stores carts for the cart, checkout,
+// shipping and sign in handlers.
+type cartStore struct {
+	carts    repository.CartRepository
+	products repository.ProductRepository
+	pricing  *pricing.Engine
+}
+
+// CartTokenHeader carries the opaque token identifying a guest cart.
+const CartTokenHeader = "X-Cart-Token"
+
+// cartOwner identifies whose cart a request works on: the signed in user,
+// or a guest holding a cart token.
+type cartOwner struct {
+	userID primitive.ObjectID
+	token  string
+}
+
+func requestCartOwner(c *gin.Context) cartOwner {
+	if userID, ok := c.Get("userId"); ok {
+		objectID, _ := primitive.ObjectIDFromHex(userID.(string))
+		return cartOwner{userID: objectID}
+	}
+	return cartOwner{token: c.GetHeader(CartTokenHeader)}
+}
+
+func (o cartOwner) isGuest() bool {
+	return o.userID.IsZero()
+}
 
-func NewCartHandler() *CartHandler {
-	return &CartHandler{}
+func (o cartOwner) key() repository.CartKey {
+	if !o.isGuest() {
+		return repository.CartKey{UserID: o.userID}
+	}
+	return repository.CartKey{TokenHash: utils.HashToken(o.token)}
 }
 
 func (h *CartHandler) GetCart(c *gin.Context) {
-	userID, _ := c.Get("userId")
+	owner := requestCartOwner(c)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	objectID, _ := primitive.ObjectIDFromHex(userID.(string))
-
-	var cart models.Cart
-	err := database.Carts().FindOne(ctx, bson.M{"user_id": objectID}).Decode(&cart)
+	cart, err := h.carts.find(ctx, owner)
 	if err != nil {
 		// Return empty cart if not found
 		cart = models.Cart{
-			UserID: objectID,
+			UserID: owner.userID,
 			Items:  []models.CartItem{},
 			Total:  0,
 		}
 	}
 
+	// Show current prices and stock, flagging what changed
+	if _, err := h.carts.revalidate(ctx, &cart); err != nil {
+		utils.InternalError(c, "Failed to fetch products")
+		return
+	}
+
 	utils.SuccessResponse(c, http.StatusOK, "", cart)
 }
 
+// AcknowledgeChanges accepts the changes found by revalidation: lines take
+// their current price, quantities are capped at the stock on hand and lines
+// that can no longer be bought are removed.
+func (h *CartHandler) AcknowledgeChanges(c *gin.Context) {
+	owner := requestCartOwner(c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cart, err := h.carts.find(ctx, owner)
+	if err != nil {
+		utils.NotFoundError(c, "Cart not found")
+		return
+	}
+
+	if _, err := h.carts.revalidate(ctx, &cart); err != nil {
+		utils.InternalError(c, "Failed to fetch products")
+		return
+	}
+	acceptCartChanges(&cart)
+
+	if err := h.carts.save(ctx, owner, &cart); err != nil {
+		utils.InternalError(c, "Failed to update cart")
+		return
+	}
+
+	respondWithCart(c, owner, &cart, "Cart updated")
+}
+
 func (h *CartHandler) AddToCart(c *gin.Context) {
-	userID, _ := c.Get("userId")
+	owner := requestCartOwner(c)
 
 	var input models.AddToCartInput
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -55,7 +139,6 @@ func (h *CartHandler) AddToCart(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	objectID, _ := primitive.ObjectIDFromHex(userID.(string))
 	productID, err := primitive.ObjectIDFromHex(input.ProductID)
 	if err != nil {
 		utils.ValidationError(c, "Invalid product ID")
@@ -63,43 +146,47 @@ func (h *CartHandler) AddToCart(c *gin.Context) {
 	}
 
 	// Get product details
-	var product models.Product
-	err = database.Products().FindOne(ctx, bson.M{"_id": productID, "is_active": true}).Decode(&product)
-	if err != nil {
+	product, err := h.products.FindByID(ctx, productID)
+	if err != nil || !product.IsActive {
 		utils.NotFoundError(c, "Product not found")
 		return
 	}
 
+	// Guests without a cart get a new token
+	if owner.isGuest() && owner.token == "" {
+		owner.token, err = utils.GenerateRandomToken(32)
+		if err != nil {
+			utils.InternalError(c, "Failed to create cart")
+			return
+		}
+	}
+
 	// Get or create cart
-	var cart models.Cart
-	err = database.Carts().FindOne(ctx, bson.M{"user_id": objectID}).Decode(&cart)
+	cart, err := h.carts.find(ctx, owner)
 	if err != nil {
 		cart = models.Cart{
 			ID:        primitive.NewObjectID(),
-			UserID:    objectID,
 			Items:     []models.CartItem{},
 			UpdatedAt: time.Now(),
 		}
 	}
 
-	// Calculate price
-	price := product.DiscountPrice
-	if price == 0 {
-		price = product.BasePrice
-	}
+	// Calculate price from the current metal rates
+	h.pricing.Apply(product)
 
-	// Check if variant is specified
 	var variantID primitive.ObjectID
-	var size string
 	if input.VariantID != "" {
 		variantID, _ = primitive.ObjectIDFromHex(input.VariantID)
-		for _, v := range product.Variants {
-			if v.ID == variantID {
-				price = v.Price
-				size = v.Size
-				break
-			}
-		}
+	}
+
+	var size string
+	price, variant := pricing.UnitPrice(product, variantID)
+	if price <= 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "This product cannot be bought until it is priced")
+		return
+	}
+	if variant != nil {
+		size = variant.Size
 	}
 
 	// Check if item already in cart
@@ -126,26 +213,16 @@ func (h *CartHandler) AddToCart(c *gin.Context) {
 		cart.Items = append(cart.Items, cartItem)
 	}
 
-	// Calculate total
-	cart.Total = 0
-	for _, item := range cart.Items {
-		cart.Total += item.Price * float64(item.Quantity)
-	}
-	cart.UpdatedAt = time.Now()
-
-	// Upsert cart
-	opts := options.Update().SetUpsert(true)
-	_, err = database.Carts().UpdateOne(ctx, bson.M{"user_id": objectID}, bson.M{"$set": cart}, opts)
-	if err != nil {
+	if err := h.carts.save(ctx, owner, &cart); err != nil {
 		utils.InternalError(c, "Failed to update cart")
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Item added to cart", cart)
+	respondWithCart(c, owner, &cart, "Item added to cart")
 }
 
 func (h *CartHandler) UpdateCartItem(c *gin.Context) {
-	userID, _ := c.Get("userId")
+	owner := requestCartOwner(c)
 	productIDParam := c.Param("productId")
 
 	var input models.UpdateCartItemInput
@@ -157,15 +234,13 @@ func (h *CartHandler) UpdateCartItem(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	objectID, _ := primitive.ObjectIDFromHex(userID.(string))
 	productID, err := primitive.ObjectIDFromHex(productIDParam)
 	if err != nil {
 		utils.ValidationError(c, "Invalid product ID")
 		return
 	}
 
-	var cart models.Cart
-	err = database.Carts().FindOne(ctx, bson.M{"user_id": objectID}).Decode(&cart)
+	cart, err := h.carts.find(ctx, owner)
 	if err != nil {
 		utils.NotFoundError(c, "Cart not found")
 		return
@@ -187,38 +262,28 @@ func (h *CartHandler) UpdateCartItem(c *gin.Context) {
 
 	cart.Items = newItems
 
-	// Calculate total
-	cart.Total = 0
-	for _, item := range cart.Items {
-		cart.Total += item.Price * float64(item.Quantity)
-	}
-	cart.UpdatedAt = time.Now()
-
-	_, err = database.Carts().UpdateOne(ctx, bson.M{"user_id": objectID}, bson.M{"$set": cart})
-	if err != nil {
+	if err := h.carts.save(ctx, owner, &cart); err != nil {
 		utils.InternalError(c, "Failed to update cart")
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Cart updated", cart)
+	respondWithCart(c, owner, &cart, "Cart updated")
 }
 
 func (h *CartHandler) RemoveFromCart(c *gin.Context) {
-	userID, _ := c.Get("userId")
+	owner := requestCartOwner(c)
 	productIDParam := c.Param("productId")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	objectID, _ := primitive.ObjectIDFromHex(userID.(string))
 	productID, err := primitive.ObjectIDFromHex(productIDParam)
 	if err != nil {
 		utils.ValidationError(c, "Invalid product ID")
 		return
 	}
 
-	var cart models.Cart
-	err = database.Carts().FindOne(ctx, bson.M{"user_id": objectID}).Decode(&cart)
+	cart, err := h.carts.find(ctx, owner)
 	if err != nil {
 		utils.NotFoundError(c, "Cart not found")
 		return
@@ -233,36 +298,356 @@ func (h *CartHandler) RemoveFromCart(c *gin.Context) {
 
 	cart.Items = newItems
 
-	// Calculate total
-	cart.Total = 0
-	for _, item := range cart.Items {
-		cart.Total += item.Price * float64(item.Quantity)
+	if err := h.carts.save(ctx, owner, &cart); err != nil {
+		utils.InternalError(c, "Failed to update cart")
+		return
 	}
-	cart.UpdatedAt = time.Now()
 
-	_, err = database.Carts().UpdateOne(ctx, bson.M{"user_id": objectID}, bson.M{"$set": cart})
+	respondWithCart(c, owner, &cart, "Item removed from cart")
+}
+
+func (h *CartHandler) ClearCart(c *gin.Context) {
+	owner := requestCartOwner(c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if owner.isGuest() && owner.token == "" {
+		utils.SuccessResponse(c, http.StatusOK, "Cart cleared", nil)
+		return
+	}
+
+	err := h.carts.carts.Delete(ctx, owner.key())
 	if err != nil {
-		utils.InternalError(c, "Failed to update cart")
+		utils.InternalError(c, "Failed to clear cart")
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "Item removed from cart", cart)
+	utils.SuccessResponse(c, http.StatusOK, "Cart cleared", nil)
 }
 
-func (h *CartHandler) ClearCart(c *gin.Context) {
+func (h *CartHandler) ApplyCoupon(c *gin.Context) {
 	userID, _ := c.Get("userId")
 
+	var input models.ApplyCouponInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	objectID, _ := primitive.ObjectIDFromHex(userID.(string))
 
-	_, err := database.Carts().DeleteOne(ctx, bson.M{"user_id": objectID})
+	cart, err := h.carts.find(ctx, cartOwner{userID: objectID})
+	if err != nil || len(cart.Items) == 0 {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Cart is empty")
+		return
+	}
+
+	products, err := h.carts.loadProducts(ctx, cart.Items)
 	if err != nil {
-		utils.InternalError(c, "Failed to clear cart")
+		utils.InternalError(c, "Failed to fetch products")
 		return
 	}
+	items := priceCartItems(cart.Items, products)
+	subtotal := itemsSubtotal(items)
 
-	utils.SuccessResponse(c, http.StatusOK, "Cart cleared", nil)
+	coupon, result, err := evaluateCoupon(ctx, h.coupons, input.Code, objectID, items, products)
+	if err != nil {
+		if coupons.IsRuleError(err) {
+			utils.ValidationError(c, err.Error())
+			return
+		}
+		utils.InternalError(c, "Failed to apply coupon")
+		return
+	}
+
+	// Shipping can only be priced once the customer gives a pincode
+	shippingCost := 0.0
+	if input.Pincode != "" && !result.FreeShipping {
+		zone, err := shipping.FindZone(ctx, h.zones, input.Pincode)
+		if err != nil {
+			if shipping.IsRuleError(err) {
+				utils.ValidationError(c, err.Error())
+				return
+			}
+			utils.InternalError(c, "Failed to fetch shipping zones")
+			return
+		}
+		parcel := cartParcel(items, products, subtotal-result.Discount)
+		option, err := shipping.Select(shipping.Options(zone, parcel, time.Now()), input.ShippingMethod)
+		if err != nil {
+			utils.ValidationError(c, err.Error())
+			return
+		}
+		shippingCost = option.Cost
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Coupon applied", models.CouponPreview{
+		Code:         coupon.Code,
+		Type:         coupon.Type,
+		Description:  coupon.Description,
+		Subtotal:     subtotal,
+		Discount:     result.Discount,
+		FreeShipping: result.FreeShipping,
+		ShippingCost: shippingCost,
+	})
+}
+
+// find loads the cart of the owner. Guests without a token have no cart.
+func (s cartStore) find(ctx context.Context, owner cartOwner) (models.Cart, error) {
+	if owner.isGuest() && owner.token == "" {
+		return models.Cart{}, repository.ErrNotFound
+	}
+	cart, err := s.carts.Find(ctx, owner.key())
+	if err != nil {
+		return models.Cart{}, err
+	}
+	return *cart, nil
+}
+
+// save recomputes the cart total and stores it. Every write pushes back the
+// expiry of a guest cart.
+func (s cartStore) save(ctx context.Context, owner cartOwner, cart *models.Cart) error {
+	cart.Total = 0
+	for _, item := range cart.Items {
+		cart.Total += item.Price * float64(item.Quantity)
+	}
+	cart.UpdatedAt = time.Now()
+	cart.UserID = owner.userID
+	if owner.isGuest() {
+		cart.TokenHash = utils.HashToken(owner.token)
+		cart.ExpiresAt = cart.UpdatedAt.Add(config.AppConfig.GuestCartTTL)
+	}
+
+	return s.carts.Save(ctx, owner.key(), cart)
+}
+
+// respondWithCart returns the cart, handing guests their cart token.
+func respondWithCart(c *gin.Context, owner cartOwner, cart *models.Cart, message string) {
+	if owner.isGuest() {
+		cart.Token = owner.token
+		c.Header(CartTokenHeader, owner.token)
+	}
+	utils.SuccessResponse(c, http.StatusOK, message, cart)
+}
+
+// merge moves a guest cart into the user's cart after sign in. Quantities
+// of lines in both carts are added up and capped at the stock on hand,
+// prices are refreshed and lines that can no longer be bought are dropped.
+func (s cartStore) merge(ctx context.Context, token string, userID primitive.ObjectID) error {
+	guestOwner := cartOwner{token: token}
+	guest, err := s.find(ctx, guestOwner)
+	if err == repository.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	userOwner := cartOwner{userID: userID}
+	cart, err := s.find(ctx, userOwner)
+	if err == repository.ErrNotFound {
+		cart = models.Cart{ID: primitive.NewObjectID(), Items: []models.CartItem{}}
+	} else if err != nil {
+		return err
+	}
+
+	for _, item := range guest.Items {
+		found := false
+		for i := range cart.Items {
+			if cart.Items[i].ProductID == item.ProductID && cart.Items[i].VariantID == item.VariantID {
+				cart.Items[i].Quantity += item.Quantity
+				found = true
+				break
+			}
+		}
+		if !found {
+			cart.Items = append(cart.Items, item)
+		}
+	}
+
+	if _, err := s.revalidate(ctx, &cart); err != nil {
+		return err
+	}
+	acceptCartChanges(&cart)
+
+	if err := s.save(ctx, userOwner, &cart); err != nil {
+		return err
+	}
+
+	return s.carts.Delete(ctx, guestOwner.key())
+}
+
+// revalidate reprices every line from the current product or variant
+// and checks it can still be bought in the requested quantity. Lines are
+// flagged where the customer would see a difference and the total is
+// recomputed at current prices. Nothing is stored.
+func (s cartStore) revalidate(ctx context.Context, cart *models.Cart) (map[primitive.ObjectID]*models.Product, error) {
+	products, err := s.loadProducts(ctx, cart.Items)
+	if err != nil {
+		return nil, err
+	}
+
+	cart.Total = 0
+	cart.HasChanges = false
+	for i := range cart.Items {
+		item := &cart.Items[i]
+
+		product, ok := products[item.ProductID]
+		if !ok || !product.IsActive {
+			item.Unavailable = true
+			cart.HasChanges = true
+			continue
+		}
+		price, variant := pricing.UnitPrice(product, item.VariantID)
+		if (!item.VariantID.IsZero() && variant == nil) || price <= 0 {
+			item.Unavailable = true
+			cart.HasChanges = true
+			continue
+		}
+
+		item.ProductName = product.Name
+		item.Thumbnail = product.Thumbnail
+
+		if math.Abs(price-item.Price) >= 0.01 {
+			item.PriceChanged = true
+			item.PreviousPrice = item.Price
+			item.Price = price
+			cart.HasChanges = true
+		}
+
+		item.AvailableQuantity = product.Stock
+		if variant != nil {
+			item.AvailableQuantity = variant.Stock
+		}
+		if item.AvailableQuantity < item.Quantity {
+			item.OutOfStock = true
+			cart.HasChanges = true
+		}
+
+		cart.Total += item.Price * float64(item.Quantity)
+	}
+
+	return products, nil
 }
 
+// acceptCartChanges applies the outcome of revalidate to the stored
+// lines and clears the flags.
+func acceptCartChanges(cart *models.Cart) {
+	items := make([]models.CartItem, 0, len(cart.Items))
+	for _, item := range cart.Items {
+		if item.Unavailable || item.AvailableQuantity <= 0 {
+			continue
+		}
+		if item.Quantity > item.AvailableQuantity {
+			item.Quantity = item.AvailableQuantity
+		}
+		item.PriceChanged = false
+		item.PreviousPrice = 0
+		item.OutOfStock = false
+		items = append(items, item)
+	}
+	cart.Items = items
+	cart.HasChanges = false
+}
+
+// loadProducts fetches the products behind the cart lines, priced with the
+// latest metal rates.
+func (s cartStore) loadProducts(ctx context.Context, items []models.CartItem) (map[primitive.ObjectID]*models.Product, error) {
+	products := make(map[primitive.ObjectID]*models.Product)
+	if len(items) == 0 {
+		return products, nil
+	}
+
+	productIDs := make([]primitive.ObjectID, 0, len(items))
+	for _, item := range items {
+		productIDs = append(productIDs, item.ProductID)
+	}
+
+	found, err := s.products.Find(ctx, repository.ProductQuery{IDs: productIDs})
+	if err != nil {
+		return nil, err
+	}
+	for i := range found {
+		product := &found[i]
+		s.pricing.Apply(product)
+		products[product.ID] = product
+	}
+
+	return products, nil
+}
+
+// priceCartItems turns cart lines into order lines at current prices. Lines
+// whose product no longer exists keep the price they were added at.
+func priceCartItems(items []models.CartItem, products map[primitive.ObjectID]*models.Product) []models.OrderItem {
+	orderItems := make([]models.OrderItem, 0, len(items))
+	for _, item := range items {
+		price := item.Price
+		making := 0.0
+		if product, ok := products[item.ProductID]; ok {
+			price, _ = pricing.UnitPrice(product, item.VariantID)
+			making = math.Min(pricing.UnitMakingCharges(product, item.VariantID), price)
+		}
+
+		orderItems = append(orderItems, models.OrderItem{
+			ProductID:   item.ProductID,
+			ProductName: item.ProductName,
+			Thumbnail:   item.Thumbnail,
+			VariantID:   item.VariantID,
+			Size:        item.Size,
+			Quantity:    item.Quantity,
+			Price:       price,
+			TotalPrice:  price * float64(item.Quantity),
+
+			MakingCharges: making,
+		})
+	}
+	return orderItems
+}
+
+func itemsSubtotal(items []models.OrderItem) float64 {
+	subtotal := 0.0
+	for _, item := range items {
+		subtotal += item.TotalPrice
+	}
+	return subtotal
+}
+
+// evaluateCoupon checks that a coupon can be used by the user and computes
+// its benefit on the given lines.
+func evaluateCoupon(ctx context.Context, store repository.CouponRepository, code string, userID primitive.ObjectID, items []models.OrderItem, products map[primitive.ObjectID]*models.Product) (*models.Coupon, coupons.Result, error) {
+	coupon, err := coupons.FindByCode(ctx, store, code)
+	if err != nil {
+		return nil, coupons.Result{}, err
+	}
+	if err := coupons.Validate(ctx, store, coupon, userID, time.Now()); err != nil {
+		return nil, coupons.Result{}, err
+	}
+
+	result, err := coupons.Evaluate(coupon, couponLines(items, products))
+	if err != nil {
+		return nil, coupons.Result{}, err
+	}
+	return coupon, result, nil
+}
+
+// couponLines describes order lines to the coupon rules.
+func couponLines(items []models.OrderItem, products map[primitive.ObjectID]*models.Product) []coupons.Line {
+	lines := make([]coupons.Line, 0, len(items))
+	for _, item := range items {
+		line := coupons.Line{
+			ProductID: item.ProductID,
+			UnitPrice: item.Price,
+			Quantity:  item.Quantity,
+		}
+		if product, ok := products[item.ProductID]; ok {
+			line.MetalType = product.MetalType
+			line.CategoryID = product.CategoryID
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"ejewel/internal/catalog"
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+	"ejewel/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type CatalogHandler struct {
+	importer   *catalog.Importer
+	jobs       repository.ImportJobRepository
+	products   repository.ProductRepository
+	categories repository.CategoryRepository
+}
+
+func NewCatalogHandler(importer *catalog.Importer, jobs repository.ImportJobRepository, products repository.ProductRepository, categories repository.CategoryRepository) *CatalogHandler {
+	return &CatalogHandler{importer: importer, jobs: jobs, products: products, categories: categories}
+}
+
+// ImportProducts starts importing a CSV or JSON Lines file, sent as the
+// file field of a form or as the request body, and returns the job to
+// follow it by. With dryRun=true the file is only checked.
+func (h *CatalogHandler) ImportProducts(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, catalog.MaxFileSize+1<<20)
+
+	var file io.Reader = c.Request.Body
+	fileName := ""
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		upload, header, err := c.Request.FormFile("file")
+		if err != nil {
+			utils.ValidationError(c, "Upload the products as the file field, of at most 20 MB")
+			return
+		}
+		defer upload.Close()
+		file, fileName = upload, header.Filename
+	}
+
+	format, ok := importFormat(c.Query("format"), fileName, c.ContentType())
+	if !ok {
+		utils.ValidationError(c, "format must be csv or jsonl")
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, catalog.MaxFileSize+1))
+	var tooLarge *http.MaxBytesError
+	if err != nil && !errors.As(err, &tooLarge) {
+		utils.ValidationError(c, "Failed to read the file")
+		return
+	}
+	if tooLarge != nil || len(data) > catalog.MaxFileSize {
+		utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, "The file must be at most 20 MB")
+		return
+	}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		utils.ValidationError(c, "The file is empty")
+		return
+	}
+
+	userID, _ := c.Get("userId")
+	createdBy, _ := primitive.ObjectIDFromHex(userID.(string))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	job := models.ImportJob{
+		FileName:  fileName,
+		Format:    string(format),
+		DryRun:    c.Query("dryRun") == "true",
+		CreatedBy: createdBy,
+	}
+	if err := h.importer.Submit(ctx, &job, data); err != nil {
+		utils.InternalError(c, "Failed to start import")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusAccepted, "Import started", job)
+}
+
+// importFormat picks the format named in the query, or else the one of the
+// file's extension or content type.
+func importFormat(query, fileName, contentType string) (catalog.Format, bool) {
+	if query != "" {
+		return catalog.ParseFormat(query)
+	}
+	if format, ok := catalog.ParseFormat(filepath.Ext(fileName)); ok {
+		return format, true
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/csv":
+		return catalog.FormatCSV, true
+	case "application/x-ndjson", "application/jsonl", "application/x-jsonlines":
+		return catalog.FormatJSONLines, true
+	}
+	return "", false
+}
+
+// GetImportJob returns the progress of an import and, once it is done,
+// the errors of the products it skipped.
+func (h *CatalogHandler) GetImportJob(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		utils.ValidationError(c, "Invalid import ID")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	job, err := h.jobs.FindByID(ctx, objectID)
+	if err == repository.ErrNotFound {
+		utils.NotFoundError(c, "Import not found")
+		return
+	}
+	if err != nil {
+		utils.InternalError(c, "Failed to fetch import")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "", job)
+}
+
+// ExportProducts streams the whole catalogue, active or not, as CSV or
+// with format=jsonl as JSON Lines, in the layout the import takes.
+func (h *CatalogHandler) ExportProducts(c *gin.Context) {
+	format, ok := catalog.ParseFormat(c.DefaultQuery("format", "csv"))
+	if !ok {
+		utils.ValidationError(c, "format must be csv or jsonl")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	filename := fmt.Sprintf("products-%s.%s", time.Now().Format("20060102"), format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Header("Content-Type", format.ContentType())
+	c.Status(http.StatusOK)
+
+	// Once the download has started a failure can only cut it short
+	if err := catalog.Export(ctx, c.Writer, format, h.products, h.categories, repository.ProductQuery{}); err != nil {
+		log.Println("Failed to export products:", err)
+	}
+}
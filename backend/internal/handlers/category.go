@@ -2,59 +2,72 @@ package handlers
 
 import (
 	"context"
+	"log"
 	"net/http"
 	"time"
 
-	"ejewel/internal/database"
+	"ejewel/internal/events"
 	"ejewel/internal/models"
+	"ejewel/internal/repository"
+	"ejewel/internal/search"
 	"ejewel/internal/utils"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-type CategoryHandler struct{}
+type CategoryHandler struct {
+	categories repository.CategoryRepository
+	products   repository.ProductRepository
+	search     *search.Index
+	events     *events.Bus
+}
 
-func NewCategoryHandler() *CategoryHandler {
-	return &CategoryHandler{}
+func NewCategoryHandler(categories repository.CategoryRepository, products repository.ProductRepository, searchIndex *search.Index, bus *events.Bus) *CategoryHandler {
+	return &CategoryHandler{categories: categories, products: products, search: searchIndex, events: bus}
 }
 
 func (h *CategoryHandler) GetCategories(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	opts := options.Find().SetSort(bson.D{{Key: "sort_order", Value: 1}})
-	cursor, err := database.Categories().Find(ctx, bson.M{"is_active": true}, opts)
+	categories, err := h.categories.FindActive(ctx)
 	if err != nil {
 		utils.InternalError(c, "Failed to fetch categories")
 		return
 	}
-	defer cursor.Close(ctx)
 
-	var categories []models.Category
-	if err := cursor.All(ctx, &categories); err != nil {
-		utils.InternalError(c, "Failed to decode categories")
+	utils.SuccessResponse(c, http.StatusOK, "", categories)
+}
+
+// GetCategoryTree returns the active categories nested under their parents.
+func (h *CategoryHandler) GetCategoryTree(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	categories, err := h.categories.FindAll(ctx)
+	if err != nil {
+		utils.InternalError(c, "Failed to fetch categories")
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "", categories)
+	utils.SuccessResponse(c, http.StatusOK, "", models.NewCategoryTree(categories).Nodes(true))
 }
 
+// GetCategory returns a category with the breadcrumbs leading to it.
 func (h *CategoryHandler) GetCategory(c *gin.Context) {
 	idParam := c.Param("id")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	var category models.Category
+	var category *models.Category
 
 	objectID, err := primitive.ObjectIDFromHex(idParam)
 	if err == nil {
-		err = database.Categories().FindOne(ctx, bson.M{"_id": objectID}).Decode(&category)
+		category, err = h.categories.FindByID(ctx, objectID)
 	} else {
-		err = database.Categories().FindOne(ctx, bson.M{"slug": idParam}).Decode(&category)
+		category, err = h.categories.FindBySlug(ctx, idParam)
 	}
 
 	if err != nil {
@@ -62,7 +75,16 @@ func (h *CategoryHandler) GetCategory(c *gin.Context) {
 		return
 	}
 
-	utils.SuccessResponse(c, http.StatusOK, "", category)
+	categories, err := h.categories.FindAll(ctx)
+	if err != nil {
+		utils.InternalError(c, "Failed to fetch category")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "", models.CategoryDetail{
+		Category:    *category,
+		Breadcrumbs: models.NewCategoryTree(categories).Breadcrumbs(category.ID),
+	})
 }
 
 func (h *CategoryHandler) CreateCategory(c *gin.Context) {
@@ -89,11 +111,19 @@ func (h *CategoryHandler) CreateCategory(c *gin.Context) {
 	}
 
 	if input.ParentID != "" {
-		parentID, _ := primitive.ObjectIDFromHex(input.ParentID)
+		parentID, err := primitive.ObjectIDFromHex(input.ParentID)
+		if err != nil {
+			utils.ValidationError(c, "Invalid parent category ID")
+			return
+		}
+		if _, err := h.categories.FindByID(ctx, parentID); err != nil {
+			utils.ValidationError(c, "Parent category not found")
+			return
+		}
 		category.ParentID = parentID
 	}
 
-	_, err := database.Categories().InsertOne(ctx, category)
+	err := h.categories.Create(ctx, &category)
 	if err != nil {
 		utils.InternalError(c, "Failed to create category")
 		return
@@ -119,7 +149,17 @@ func (h *CategoryHandler) UpdateCategory(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	update := bson.M{"updated_at": time.Now()}
+	current, err := h.categories.FindByID(ctx, objectID)
+	if err == repository.ErrNotFound {
+		utils.NotFoundError(c, "Category not found")
+		return
+	}
+	if err != nil {
+		utils.InternalError(c, "Failed to fetch category")
+		return
+	}
+
+	update := repository.Fields{"updated_at": time.Now()}
 
 	if input.Name != "" {
 		update["name"] = input.Name
@@ -134,25 +174,79 @@ func (h *CategoryHandler) UpdateCategory(c *gin.Context) {
 	if input.Icon != "" {
 		update["icon"] = input.Icon
 	}
-	if input.ParentID != "" {
-		parentID, _ := primitive.ObjectIDFromHex(input.ParentID)
+	if input.ParentID != nil {
+		parentID, ok := h.newParent(ctx, c, objectID, *input.ParentID)
+		if !ok {
+			return
+		}
 		update["parent_id"] = parentID
 	}
 	update["is_active"] = input.IsActive
 	update["sort_order"] = input.SortOrder
 
-	_, err = database.Categories().UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{"$set": update})
+	err = h.categories.Update(ctx, objectID, update)
+	if err == repository.ErrNotFound {
+		utils.NotFoundError(c, "Category not found")
+		return
+	}
 	if err != nil {
 		utils.InternalError(c, "Failed to update category")
 		return
 	}
 
-	var category models.Category
-	database.Categories().FindOne(ctx, bson.M{"_id": objectID}).Decode(&category)
+	// Products carry the category name, and are brought up to date in the
+	// background
+	if input.Name != "" && input.Name != current.Name {
+		if err := h.events.Publish(ctx, models.EventCategoryRenamed, objectID); err != nil {
+			log.Printf("Failed to publish rename of category %s: %v", objectID.Hex(), err)
+		}
+	}
+
+	category, _ := h.categories.FindByID(ctx, objectID)
 
 	utils.SuccessResponse(c, http.StatusOK, "Category updated successfully", category)
 }
 
+// newParent checks the parent a category is being moved to. The category
+// cannot go below itself or one of its subcategories, which would cut the
+// branch off from the tree. It writes the error response and returns false
+// when the move is not allowed.
+func (h *CategoryHandler) newParent(ctx context.Context, c *gin.Context, id primitive.ObjectID, parent string) (primitive.ObjectID, bool) {
+	if parent == "" {
+		return primitive.NilObjectID, true
+	}
+
+	parentID, err := primitive.ObjectIDFromHex(parent)
+	if err != nil {
+		utils.ValidationError(c, "Invalid parent category ID")
+		return parentID, false
+	}
+
+	categories, err := h.categories.FindAll(ctx)
+	if err != nil {
+		utils.InternalError(c, "Failed to update category")
+		return parentID, false
+	}
+	tree := models.NewCategoryTree(categories)
+
+	if len(tree.Breadcrumbs(parentID)) == 0 {
+		utils.ValidationError(c, "Parent category not found")
+		return parentID, false
+	}
+	for _, subID := range tree.Subtree(id) {
+		if subID == parentID {
+			utils.ValidationError(c, "A category cannot be moved below itself or one of its subcategories")
+			return parentID, false
+		}
+	}
+	return parentID, true
+}
+
+// DeleteCategory deletes a category. What happens to what is below it
+// depends on cascade:
+//   - none (the default) refuses while it has subcategories or products
+//   - reparent moves its subcategories and products up to its parent
+//   - delete deletes its subcategories too, as long as none has products
 func (h *CategoryHandler) DeleteCategory(c *gin.Context) {
 	id := c.Param("id")
 	objectID, err := primitive.ObjectIDFromHex(id)
@@ -161,22 +255,133 @@ func (h *CategoryHandler) DeleteCategory(c *gin.Context) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	cascade := c.DefaultQuery("cascade", "none")
+	if cascade != "none" && cascade != "reparent" && cascade != "delete" {
+		utils.ValidationError(c, "cascade must be none, reparent or delete")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	// Check if any products are using this category
-	count, _ := database.Products().CountDocuments(ctx, bson.M{"category_id": objectID})
-	if count > 0 {
-		utils.ErrorResponse(c, http.StatusConflict, "Cannot delete category with existing products")
+	if _, err := h.categories.FindByID(ctx, objectID); err != nil {
+		utils.NotFoundError(c, "Category not found")
 		return
 	}
 
-	_, err = database.Categories().DeleteOne(ctx, bson.M{"_id": objectID})
+	categories, err := h.categories.FindAll(ctx)
 	if err != nil {
 		utils.InternalError(c, "Failed to delete category")
 		return
 	}
+	tree := models.NewCategoryTree(categories)
+	children := tree.Children(objectID)
 
-	utils.SuccessResponse(c, http.StatusOK, "Category deleted successfully", nil)
+	// Check if any products are using this category
+	count, err := h.products.Count(ctx, repository.ProductQuery{CategoryIDs: []primitive.ObjectID{objectID}})
+	if err != nil {
+		utils.InternalError(c, "Failed to delete category")
+		return
+	}
+
+	deleted := []primitive.ObjectID{objectID}
+	switch cascade {
+	case "none":
+		if len(children) > 0 {
+			utils.ErrorResponse(c, http.StatusConflict, "Cannot delete category with subcategories")
+			return
+		}
+		if count > 0 {
+			utils.ErrorResponse(c, http.StatusConflict, "Cannot delete category with existing products")
+			return
+		}
+
+	case "reparent":
+		var parent *models.Category
+		if crumbs := tree.Breadcrumbs(objectID); len(crumbs) > 1 {
+			parent, err = h.categories.FindByID(ctx, crumbs[len(crumbs)-2].ID)
+			if err != nil {
+				utils.InternalError(c, "Failed to delete category")
+				return
+			}
+		}
+		if count > 0 && parent == nil {
+			utils.ErrorResponse(c, http.StatusConflict, "Cannot move products up from a top level category")
+			return
+		}
+		if err := h.moveUp(ctx, objectID, children, parent); err != nil {
+			utils.InternalError(c, "Failed to move subcategories and products to the parent category")
+			return
+		}
+
+	case "delete":
+		deleted = tree.Subtree(objectID)
+		count, err = h.products.Count(ctx, repository.ProductQuery{CategoryIDs: deleted})
+		if err != nil {
+			utils.InternalError(c, "Failed to delete category")
+			return
+		}
+		if count > 0 {
+			utils.ErrorResponse(c, http.StatusConflict, "Cannot delete categories with existing products")
+			return
+		}
+	}
+
+	// Deepest first, so that a failure part way leaves no category without
+	// its parent
+	for i := len(deleted) - 1; i >= 0; i-- {
+		err = h.categories.Delete(ctx, deleted[i])
+		if err != nil && err != repository.ErrNotFound {
+			utils.InternalError(c, "Failed to delete category")
+			return
+		}
+	}
+	if err == repository.ErrNotFound {
+		utils.NotFoundError(c, "Category not found")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Category deleted successfully", gin.H{"deleted": len(deleted)})
 }
 
+// moveUp gives the subcategories and products of a category to its parent,
+// or makes the subcategories top level when it has none.
+func (h *CategoryHandler) moveUp(ctx context.Context, id primitive.ObjectID, children []models.Category, parent *models.Category) error {
+	parentID := primitive.NilObjectID
+	if parent != nil {
+		parentID = parent.ID
+
+		products, err := h.products.Find(ctx, repository.ProductQuery{CategoryIDs: []primitive.ObjectID{id}})
+		if err != nil {
+			return err
+		}
+		for i := range products {
+			product := &products[i]
+			product.CategoryID = parent.ID
+			product.CategoryName = parent.Name
+			product.UpdatedAt = time.Now()
+
+			err := h.products.Update(ctx, product.ID, repository.Fields{
+				"category_id":   product.CategoryID,
+				"category_name": product.CategoryName,
+				"updated_at":    product.UpdatedAt,
+			})
+			if err == repository.ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			// Storefront searches filter and match on the category
+			h.search.Put(product)
+		}
+	}
+
+	for _, child := range children {
+		err := h.categories.Update(ctx, child.ID, repository.Fields{"parent_id": parentID, "updated_at": time.Now()})
+		if err != nil && err != repository.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
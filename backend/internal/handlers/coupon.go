@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"ejewel/internal/coupons"
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+	"ejewel/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type CouponHandler struct {
+	coupons repository.CouponRepository
+}
+
+func NewCouponHandler(couponStore repository.CouponRepository) *CouponHandler {
+	return &CouponHandler{coupons: couponStore}
+}
+
+// Admin handlers
+
+func (h *CouponHandler) GetCoupons(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var query repository.CouponQuery
+	if active := c.Query("active"); active != "" {
+		isActive := active == "true"
+		query.Active = &isActive
+	}
+
+	list, err := h.coupons.Find(ctx, query)
+	if err != nil {
+		utils.InternalError(c, "Failed to fetch coupons")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "", list)
+}
+
+func (h *CouponHandler) GetCoupon(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		utils.ValidationError(c, "Invalid coupon ID")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	coupon, err := h.coupons.FindByID(ctx, objectID)
+	if err != nil {
+		utils.NotFoundError(c, "Coupon not found")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "", coupon)
+}
+
+func (h *CouponHandler) CreateCoupon(c *gin.Context) {
+	var input models.CreateCouponInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	categoryIDs, err := parseObjectIDs(input.CategoryIDs)
+	if err != nil {
+		utils.ValidationError(c, "Invalid category ID")
+		return
+	}
+
+	coupon := models.Coupon{
+		ID:           primitive.NewObjectID(),
+		Code:         coupons.NormalizeCode(input.Code),
+		Description:  input.Description,
+		Type:         input.Type,
+		Value:        input.Value,
+		MaxDiscount:  input.MaxDiscount,
+		BuyQuantity:  input.BuyQuantity,
+		GetQuantity:  input.GetQuantity,
+		MinCartValue: input.MinCartValue,
+		MetalTypes:   input.MetalTypes,
+		CategoryIDs:  categoryIDs,
+		UsageLimit:   input.UsageLimit,
+		PerUserLimit: input.PerUserLimit,
+		StartsAt:     input.StartsAt,
+		ExpiresAt:    input.ExpiresAt,
+		IsActive:     true,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+
+	if msg := validateCoupon(&coupon); msg != "" {
+		utils.ValidationError(c, msg)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err = h.coupons.Create(ctx, &coupon)
+	if err == repository.ErrDuplicate {
+		utils.ErrorResponse(c, http.StatusConflict, "Coupon with this code already exists")
+		return
+	}
+	if err != nil {
+		utils.InternalError(c, "Failed to create coupon")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Coupon created successfully", coupon)
+}
+
+func (h *CouponHandler) UpdateCoupon(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		utils.ValidationError(c, "Invalid coupon ID")
+		return
+	}
+
+	var input models.UpdateCouponInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	coupon, err := h.coupons.FindByID(ctx, objectID)
+	if err != nil {
+		utils.NotFoundError(c, "Coupon not found")
+		return
+	}
+
+	// Only the fields sent are changed; used_count is maintained by
+	// checkout and is never overwritten here
+	coupon.UpdatedAt = time.Now()
+	update := repository.Fields{"updated_at": coupon.UpdatedAt}
+	if input.Description != nil {
+		coupon.Description = *input.Description
+		update["description"] = coupon.Description
+	}
+	if input.Value != nil {
+		coupon.Value = *input.Value
+		update["value"] = coupon.Value
+	}
+	if input.MaxDiscount != nil {
+		coupon.MaxDiscount = *input.MaxDiscount
+		update["max_discount"] = coupon.MaxDiscount
+	}
+	if input.BuyQuantity != nil {
+		coupon.BuyQuantity = *input.BuyQuantity
+		update["buy_quantity"] = coupon.BuyQuantity
+	}
+	if input.GetQuantity != nil {
+		coupon.GetQuantity = *input.GetQuantity
+		update["get_quantity"] = coupon.GetQuantity
+	}
+	if input.MinCartValue != nil {
+		coupon.MinCartValue = *input.MinCartValue
+		update["min_cart_value"] = coupon.MinCartValue
+	}
+	if input.MetalTypes != nil {
+		coupon.MetalTypes = input.MetalTypes
+		update["metal_types"] = coupon.MetalTypes
+	}
+	if input.CategoryIDs != nil {
+		categoryIDs, err := parseObjectIDs(input.CategoryIDs)
+		if err != nil {
+			utils.ValidationError(c, "Invalid category ID")
+			return
+		}
+		coupon.CategoryIDs = categoryIDs
+		update["category_ids"] = coupon.CategoryIDs
+	}
+	if input.UsageLimit != nil {
+		coupon.UsageLimit = *input.UsageLimit
+		update["usage_limit"] = coupon.UsageLimit
+	}
+	if input.PerUserLimit != nil {
+		coupon.PerUserLimit = *input.PerUserLimit
+		update["per_user_limit"] = coupon.PerUserLimit
+	}
+	if input.StartsAt != nil {
+		coupon.StartsAt = *input.StartsAt
+		update["starts_at"] = coupon.StartsAt
+	}
+	if input.ExpiresAt != nil {
+		coupon.ExpiresAt = *input.ExpiresAt
+		update["expires_at"] = coupon.ExpiresAt
+	}
+	if input.IsActive != nil {
+		coupon.IsActive = *input.IsActive
+		update["is_active"] = coupon.IsActive
+	}
+
+	if msg := validateCoupon(coupon); msg != "" {
+		utils.ValidationError(c, msg)
+		return
+	}
+
+	if err := h.coupons.Update(ctx, objectID, update); err != nil {
+		utils.InternalError(c, "Failed to update coupon")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Coupon updated successfully", coupon)
+}
+
+func (h *CouponHandler) DeleteCoupon(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		utils.ValidationError(c, "Invalid coupon ID")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err = h.coupons.Delete(ctx, objectID)
+	if err == repository.ErrNotFound {
+		utils.NotFoundError(c, "Coupon not found")
+		return
+	}
+	if err != nil {
+		utils.InternalError(c, "Failed to delete coupon")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Coupon deleted successfully", nil)
+}
+
+// validateCoupon returns a message describing the first invalid rule, or an
+// empty string when the coupon is valid.
+func validateCoupon(coupon *models.Coupon) string {
+	if coupon.Code == "" {
+		return "Coupon code is required"
+	}
+
+	switch coupon.Type {
+	case models.CouponPercentage:
+		if coupon.Value <= 0 || coupon.Value > 100 {
+			return "Percentage must be between 0 and 100"
+		}
+	case models.CouponFlat:
+		if coupon.Value <= 0 {
+			return "Flat discount must be positive"
+		}
+	case models.CouponFreeShipping:
+	case models.CouponBuyXGetY:
+		if coupon.BuyQuantity <= 0 || coupon.GetQuantity <= 0 {
+			return "Buy and get quantities must be positive"
+		}
+	default:
+		return "Invalid coupon type"
+	}
+
+	if coupon.MaxDiscount < 0 || coupon.MinCartValue < 0 || coupon.UsageLimit < 0 || coupon.PerUserLimit < 0 {
+		return "Limits cannot be negative"
+	}
+	if !coupon.StartsAt.IsZero() && !coupon.ExpiresAt.IsZero() && !coupon.ExpiresAt.After(coupon.StartsAt) {
+		return "Expiry must be after the start date"
+	}
+
+	return ""
+}
+
+func parseObjectIDs(hexIDs []string) ([]primitive.ObjectID, error) {
+	ids := make([]primitive.ObjectID, 0, len(hexIDs))
+	for _, hex := range hexIDs {
+		id, err := primitive.ObjectIDFromHex(hex)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
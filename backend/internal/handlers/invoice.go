@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"ejewel/internal/invoice"
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+	"ejewel/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetInvoice returns the GST invoice of an order as JSON, or as a PDF
+// download with ?format=pdf or an Accept: application/pdf header.
+func (h *OrderHandler) GetInvoice(c *gin.Context) {
+	userID, _ := c.Get("userId")
+	orderID := c.Param("id")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	objectID, _ := primitive.ObjectIDFromHex(userID.(string))
+	orderObjectID, err := primitive.ObjectIDFromHex(orderID)
+	if err != nil {
+		utils.ValidationError(c, "Invalid order ID")
+		return
+	}
+
+	order, err := h.orders.FindByID(ctx, orderObjectID)
+	if err != nil || order.UserID != objectID {
+		utils.NotFoundError(c, "Order not found")
+		return
+	}
+
+	inv := order.Invoice
+	if inv == nil || inv.Number == "" {
+		// Orders confirmed before invoicing existed are invoiced on demand
+		if order.Status == models.OrderPending || order.Status == models.OrderCancelled {
+			utils.ErrorResponse(c, http.StatusBadRequest, "Invoice is available once the order is confirmed")
+			return
+		}
+		inv, err = issueInvoice(ctx, h.orders, h.counters, order)
+		if errors.Is(err, errInvoicePending) {
+			utils.ErrorResponse(c, http.StatusConflict, "Invoice is being issued, please retry")
+			return
+		}
+		if err != nil {
+			utils.InternalError(c, "Failed to generate invoice")
+			return
+		}
+	}
+
+	if c.Query("format") == "pdf" || strings.Contains(c.GetHeader("Accept"), "application/pdf") {
+		filename := fmt.Sprintf("invoice-%s.pdf", order.OrderNumber)
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		c.Data(http.StatusOK, "application/pdf", invoice.RenderPDF(inv))
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "", inv)
+}
+
+// invoiceClaimTimeout is how long an invoice claimed for numbering is left
+// to the request that claimed it before another one takes over.
+const invoiceClaimTimeout = time.Minute
+
+var errInvoicePending = errors.New("invoice is being issued")
+
+// issueInvoice numbers and stores the invoice of an order. An order is only
+// ever invoiced once: the invoice is stored unnumbered first, and only the
+// request that stored it draws a number, so no number is drawn and left
+// unused. Other requests get the numbered invoice, or errInvoicePending
+// while it is being numbered.
+func issueInvoice(ctx context.Context, orders repository.OrderRepository, counters repository.CounterRepository, order *models.Order) (*models.Invoice, error) {
+	if order.Invoice != nil && order.Invoice.Number != "" {
+		return order.Invoice, nil
+	}
+
+	// Mongo stores times to the millisecond, and the claim is matched on it
+	now := time.Now().Truncate(time.Millisecond)
+	match := repository.Fields{"invoice": nil}
+	if order.Invoice != nil {
+		// Take over a claim whose request stopped before numbering it
+		if now.Sub(order.Invoice.IssuedAt) < invoiceClaimTimeout {
+			return nil, errInvoicePending
+		}
+		match = repository.Fields{"invoice.number": "", "invoice.issued_at": order.Invoice.IssuedAt}
+	}
+
+	inv := invoice.Build(order, "", invoice.Seller(), now)
+	err := orders.Update(ctx, order.ID, match, repository.Fields{"invoice": inv})
+	if errors.Is(err, repository.ErrConflict) {
+		existing, err := orders.FindByID(ctx, order.ID)
+		if err != nil {
+			return nil, err
+		}
+		if existing.Invoice == nil || existing.Invoice.Number == "" {
+			return nil, errInvoicePending
+		}
+		return existing.Invoice, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	number, err := invoice.NextNumber(ctx, counters, now)
+	if err != nil {
+		return nil, err
+	}
+	err = orders.Update(
+		ctx,
+		order.ID,
+		repository.Fields{"invoice.number": "", "invoice.issued_at": now},
+		repository.Fields{"invoice.number": number},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	inv.Number = number
+	return inv, nil
+}
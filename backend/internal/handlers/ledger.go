@@ -0,0 +1,368 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"ejewel/internal/ledger"
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+	"ejewel/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type LedgerHandler struct {
+	ledger      *ledger.Ledger
+	entries     repository.LedgerRepository
+	commissions repository.CommissionRepository
+	payouts     repository.PayoutRepository
+	sellers     repository.SellerRepository
+}
+
+func NewLedgerHandler(sellerLedger *ledger.Ledger, entries repository.LedgerRepository, commissions repository.CommissionRepository, payouts repository.PayoutRepository, sellers repository.SellerRepository) *LedgerHandler {
+	return &LedgerHandler{
+		ledger:      sellerLedger,
+		entries:     entries,
+		commissions: commissions,
+		payouts:     payouts,
+		sellers:     sellers,
+	}
+}
+
+// Commission rules
+
+func (h *LedgerHandler) GetCommissionRules(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rules, err := h.commissions.FindAll(ctx)
+	if err != nil {
+		utils.InternalError(c, "Failed to fetch commission rules")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "", rules)
+}
+
+func (h *LedgerHandler) CreateCommissionRule(c *gin.Context) {
+	var input models.SetCommissionRuleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	rule := models.CommissionRule{
+		ID:        primitive.NewObjectID(),
+		Rate:      input.Rate,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	var err error
+	if input.SellerID != "" {
+		if rule.SellerID, err = primitive.ObjectIDFromHex(input.SellerID); err != nil {
+			utils.ValidationError(c, "Invalid seller ID")
+			return
+		}
+	}
+	if input.CategoryID != "" {
+		if rule.CategoryID, err = primitive.ObjectIDFromHex(input.CategoryID); err != nil {
+			utils.ValidationError(c, "Invalid category ID")
+			return
+		}
+	}
+	if rule.SellerID.IsZero() && rule.CategoryID.IsZero() {
+		utils.ValidationError(c, "A rule needs a seller, a category or both; set COMMISSION_RATE to change the default")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err = h.commissions.Create(ctx, &rule)
+	if err == repository.ErrDuplicate {
+		utils.ErrorResponse(c, http.StatusConflict, "A rule for this seller and category already exists")
+		return
+	}
+	if err != nil {
+		utils.InternalError(c, "Failed to create commission rule")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Commission rule created successfully", rule)
+}
+
+func (h *LedgerHandler) UpdateCommissionRule(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		utils.ValidationError(c, "Invalid rule ID")
+		return
+	}
+
+	var input struct {
+		Rate float64 `json:"rate" binding:"min=0,max=100"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err = h.commissions.Update(ctx, objectID, repository.Fields{"rate": input.Rate, "updated_at": time.Now()})
+	if err == repository.ErrNotFound {
+		utils.NotFoundError(c, "Commission rule not found")
+		return
+	}
+	if err != nil {
+		utils.InternalError(c, "Failed to update commission rule")
+		return
+	}
+
+	rule, _ := h.commissions.FindByID(ctx, objectID)
+
+	utils.SuccessResponse(c, http.StatusOK, "Commission rule updated successfully", rule)
+}
+
+func (h *LedgerHandler) DeleteCommissionRule(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		utils.ValidationError(c, "Invalid rule ID")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err = h.commissions.Delete(ctx, objectID)
+	if err == repository.ErrNotFound {
+		utils.NotFoundError(c, "Commission rule not found")
+		return
+	}
+	if err != nil {
+		utils.InternalError(c, "Failed to delete commission rule")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Commission rule deleted successfully", nil)
+}
+
+// Payout batches
+
+func (h *LedgerHandler) GetPayouts(c *gin.Context) {
+	page, limit := pageParams(c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	batches, err := h.payouts.Find(ctx, repository.Page{Skip: int64((page - 1) * limit), Limit: int64(limit)})
+	if err != nil {
+		utils.InternalError(c, "Failed to fetch payouts")
+		return
+	}
+
+	total, _ := h.payouts.Count(ctx)
+
+	utils.PaginatedSuccessResponse(c, batches, page, limit, total)
+}
+
+// GetPayout returns a batch with the ledger entries it settles.
+func (h *LedgerHandler) GetPayout(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		utils.ValidationError(c, "Invalid payout ID")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	batch, err := h.payouts.FindByID(ctx, objectID)
+	if err != nil {
+		utils.NotFoundError(c, "Payout not found")
+		return
+	}
+
+	entries, err := h.entries.Find(ctx, repository.LedgerQuery{PayoutID: objectID})
+	if err != nil {
+		utils.InternalError(c, "Failed to fetch ledger entries")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "", gin.H{
+		"batch":   batch,
+		"entries": entries,
+	})
+}
+
+// CreatePayoutBatch settles what sellers are owed up to the end of a
+// period.
+func (h *LedgerHandler) CreatePayoutBatch(c *gin.Context) {
+	userID, _ := c.Get("userId")
+	objectID, _ := primitive.ObjectIDFromHex(userID.(string))
+
+	var input models.CreatePayoutBatchInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+	if !input.From.Before(input.To) {
+		utils.ValidationError(c, "from must be before to")
+		return
+	}
+	if input.To.After(time.Now()) {
+		utils.ValidationError(c, "Payouts can only be made for periods that have ended")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	batch, err := h.ledger.CreateBatch(ctx, input.From, input.To, objectID)
+	if err == ledger.ErrNothingToPay {
+		utils.ErrorResponse(c, http.StatusUnprocessableEntity, "No seller is owed a payout for this period")
+		return
+	}
+	if err != nil {
+		utils.InternalError(c, "Failed to create payout batch")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Payout batch created", batch)
+}
+
+func (h *LedgerHandler) MarkPayoutPaid(c *gin.Context) {
+	userID, _ := c.Get("userId")
+	paidBy, _ := primitive.ObjectIDFromHex(userID.(string))
+
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		utils.ValidationError(c, "Invalid payout ID")
+		return
+	}
+
+	var input models.MarkPayoutPaidInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err = h.ledger.MarkPaid(ctx, objectID, input.Reference, paidBy)
+	if err == repository.ErrConflict {
+		if _, err := h.payouts.FindByID(ctx, objectID); err != nil {
+			utils.NotFoundError(c, "Payout not found")
+			return
+		}
+		utils.ErrorResponse(c, http.StatusConflict, "Payout has already been paid")
+		return
+	}
+	if err != nil {
+		utils.InternalError(c, "Failed to update payout")
+		return
+	}
+
+	batch, _ := h.payouts.FindByID(ctx, objectID)
+
+	utils.SuccessResponse(c, http.StatusOK, "Payout marked as paid", batch)
+}
+
+// GetStatement exports a seller's ledger entries for a period as CSV. The
+// period defaults to the current month.
+func (h *LedgerHandler) GetStatement(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		utils.ValidationError(c, "Invalid seller ID")
+		return
+	}
+
+	now := time.Now()
+	from, err := parseDateParam(c.Query("from"), time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()))
+	if err != nil {
+		utils.ValidationError(c, "from must be a date such as 2024-01-31")
+		return
+	}
+	to, err := parseDateParam(c.Query("to"), now)
+	if err != nil {
+		utils.ValidationError(c, "to must be a date such as 2024-01-31")
+		return
+	}
+
+	// Entries are fetched from before end, so a date on its own covers the
+	// whole of that day
+	end := to
+	if _, err := time.Parse("2006-01-02", c.Query("to")); err == nil {
+		end = to.AddDate(0, 0, 1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	seller, err := h.sellers.FindByID(ctx, objectID)
+	if err != nil {
+		utils.NotFoundError(c, "Seller not found")
+		return
+	}
+
+	entries, err := h.entries.Find(ctx, repository.LedgerQuery{SellerID: seller.UserID, From: from, To: end})
+	if err != nil {
+		utils.InternalError(c, "Failed to fetch ledger entries")
+		return
+	}
+
+	filename := fmt.Sprintf("statement-%s-%s-%s.csv", utils.GenerateSlug(seller.StoreName), from.Format("20060102"), to.Format("20060102"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Header("Content-Type", "text/csv")
+	c.Status(http.StatusOK)
+
+	amount := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+	var totals models.Payout
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"Date", "Type", "Order", "Product", "Quantity", "Gross", "Commission Rate", "Commission", "Tax Withheld", "Net", "Payout"})
+	for _, entry := range entries {
+		payout := ""
+		if !entry.PayoutID.IsZero() {
+			payout = entry.PayoutID.Hex()
+		}
+		w.Write([]string{
+			entry.CreatedAt.Format(time.RFC3339),
+			string(entry.Type),
+			entry.OrderNumber,
+			entry.ProductName,
+			strconv.Itoa(entry.Quantity),
+			amount(entry.Gross),
+			amount(entry.CommissionRate),
+			amount(entry.Commission),
+			amount(entry.TaxWithheld),
+			amount(entry.Net),
+			payout,
+		})
+		totals.Gross += entry.Gross
+		totals.Commission += entry.Commission
+		totals.TaxWithheld += entry.TaxWithheld
+		totals.Net += entry.Net
+	}
+	w.Write([]string{"Total", "", "", "", "", amount(totals.Gross), "", amount(totals.Commission), amount(totals.TaxWithheld), amount(totals.Net), ""})
+	w.Flush()
+}
+
+// parseDateParam reads a date or RFC 3339 timestamp, or returns fallback
+// when value is empty.
+func parseDateParam(value string, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
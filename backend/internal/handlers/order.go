@@ -2,23 +2,53 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"time"
 
-	"ejewel/internal/database"
+	"ejewel/internal/config"
+	"ejewel/internal/coupons"
+	"ejewel/internal/events"
 	"ejewel/internal/models"
+	"ejewel/internal/payments"
+	"ejewel/internal/pricing"
+	"ejewel/internal/repository"
+	"ejewel/internal/shipping"
+	"ejewel/internal/tax"
 	"ejewel/internal/utils"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-type OrderHandler struct{}
+type OrderHandler struct {
+	orders   repository.OrderRepository
+	products repository.ProductRepository
+	users    repository.UserRepository
+	sellers  repository.SellerRepository
+	coupons  repository.CouponRepository
+	zones    repository.ShippingZoneRepository
+	counters repository.CounterRepository
+	carts    cartStore
+	payments payments.Provider
+	events   *events.Bus
+}
 
-func NewOrderHandler() *OrderHandler {
-	return &OrderHandler{}
+func NewOrderHandler(orders repository.OrderRepository, carts repository.CartRepository, products repository.ProductRepository, users repository.UserRepository, sellers repository.SellerRepository, couponStore repository.CouponRepository, zones repository.ShippingZoneRepository, counters repository.CounterRepository, pricingEngine *pricing.Engine, paymentProvider payments.Provider, bus *events.Bus) *OrderHandler {
+	return &OrderHandler{
+		orders:   orders,
+		products: products,
+		users:    users,
+		sellers:  sellers,
+		coupons:  couponStore,
+		zones:    zones,
+		counters: counters,
+		carts:    cartStore{carts: carts, products: products, pricing: pricingEngine},
+		payments: paymentProvider,
+		events:   bus,
+	}
 }
 
 func (h *OrderHandler) CreateOrder(c *gin.Context) {
@@ -30,19 +60,30 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 		return
 	}
 
+	switch input.PaymentMethod {
+	case models.PaymentCOD, models.PaymentCard, models.PaymentUPI, models.PaymentWallet:
+	default:
+		utils.ValidationError(c, "Invalid payment method")
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	objectID, _ := primitive.ObjectIDFromHex(userID.(string))
 
 	// Get user details
-	var user models.User
-	err := database.Users().FindOne(ctx, bson.M{"_id": objectID}).Decode(&user)
+	user, err := h.users.FindByID(ctx, objectID)
 	if err != nil {
 		utils.NotFoundError(c, "User not found")
 		return
 	}
 
+	if config.AppConfig.RequireVerifiedEmail && !user.IsVerified {
+		utils.ForbiddenError(c, "Please verify your email address before placing an order")
+		return
+	}
+
 	// Find the address
 	var shippingAddress models.Address
 	addressID, _ := primitive.ObjectIDFromHex(input.AddressID)
@@ -59,36 +100,89 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 	}
 
 	// Get cart
-	var cart models.Cart
-	err = database.Carts().FindOne(ctx, bson.M{"user_id": objectID}).Decode(&cart)
+	owner := cartOwner{userID: objectID}
+	cart, err := h.carts.find(ctx, owner)
 	if err != nil || len(cart.Items) == 0 {
 		utils.ErrorResponse(c, http.StatusBadRequest, "Cart is empty")
 		return
 	}
 
-	// Convert cart items to order items
-	var orderItems []models.OrderItem
-	for _, item := range cart.Items {
-		orderItems = append(orderItems, models.OrderItem{
-			ProductID:   item.ProductID,
-			ProductName: item.ProductName,
-			Thumbnail:   item.Thumbnail,
-			VariantID:   item.VariantID,
-			Size:        item.Size,
-			Quantity:    item.Quantity,
-			Price:       item.Price,
-			TotalPrice:  item.Price * float64(item.Quantity),
-		})
+	// Charge every line at today's price, but only once the customer has
+	// seen any change in price or availability
+	products, err := h.carts.revalidate(ctx, &cart)
+	if err != nil {
+		utils.InternalError(c, "Failed to fetch products")
+		return
+	}
+	if cart.HasChanges {
+		utils.ErrorResponseWithData(c, http.StatusConflict, "Your cart has changed. Please review and acknowledge the updated items", cart)
+		return
+	}
+	orderItems := priceCartItems(cart.Items, products)
+	subtotal := itemsSubtotal(orderItems)
+
+	// Lines from marketplace sellers are fulfilled by each seller
+	fulfilments, err := splitBySeller(ctx, h.sellers, orderItems, products)
+	if err != nil {
+		utils.InternalError(c, "Failed to fetch sellers")
+		return
+	}
+
+	// Validate the coupon against the final cart
+	var coupon *models.Coupon
+	discount := 0.0
+	freeShipping := false
+	if input.CouponCode != "" {
+		var result coupons.Result
+		coupon, result, err = evaluateCoupon(ctx, h.coupons, input.CouponCode, objectID, orderItems, products)
+		if err != nil {
+			if coupons.IsRuleError(err) {
+				utils.ValidationError(c, err.Error())
+				return
+			}
+			utils.InternalError(c, "Failed to apply coupon")
+			return
+		}
+
+		discount = result.Discount
+		freeShipping = result.FreeShipping
+	}
+
+	// Price the chosen shipping method for the delivery pincode
+	zone, err := shipping.FindZone(ctx, h.zones, shippingAddress.ZipCode)
+	if err != nil {
+		if shipping.IsRuleError(err) {
+			utils.ValidationError(c, err.Error())
+			return
+		}
+		utils.InternalError(c, "Failed to fetch shipping zones")
+		return
+	}
+	parcel := cartParcel(orderItems, products, subtotal-discount)
+	shippingOption, err := shipping.Select(shipping.Options(zone, parcel, time.Now()), input.ShippingMethod)
+	if err != nil {
+		utils.ValidationError(c, err.Error())
+		return
 	}
+	shippingCost := shippingOption.Cost
+	if freeShipping {
+		shippingCost = 0
+	}
+
+	// GST at 3% on goods and 5% on making charges, split by place of supply
+	interstate := tax.IsInterstate(shippingAddress.State, config.AppConfig.SellerState)
+	taxBreakup, _ := tax.Compute(orderItems, discount, interstate)
 
 	// Calculate totals
-	subtotal := cart.Total
-	tax := subtotal * 0.18 // 18% GST
-	shippingCost := 0.0
-	if subtotal < 5000 {
-		shippingCost = 199
+	taxable := subtotal - discount
+	total := taxable + taxBreakup.Total + shippingCost
+
+	if input.PaymentMethod == models.PaymentCOD {
+		if err := shipping.CheckCOD(zone, total); err != nil {
+			utils.ValidationError(c, err.Error())
+			return
+		}
 	}
-	total := subtotal + tax + shippingCost
 
 	order := models.Order{
 		ID:          primitive.NewObjectID(),
@@ -98,46 +192,114 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 		UserName:    user.FirstName + " " + user.LastName,
 		Items:       orderItems,
 		Subtotal:    subtotal,
-		Tax:         tax,
-		Discount:    0,
-		CouponCode:  input.CouponCode,
+		Tax:         taxBreakup.Total,
+		TaxBreakup:  &taxBreakup,
+		Discount:    discount,
 		ShippingInfo: models.ShippingInfo{
-			Address: shippingAddress,
-			Method:  input.ShippingMethod,
-			Cost:    shippingCost,
+			Address:       shippingAddress,
+			Method:        string(shippingOption.Method),
+			Cost:          shippingCost,
+			EstimatedDate: shippingOption.EstimatedDate,
 		},
 		PaymentInfo: models.PaymentInfo{
 			Method: input.PaymentMethod,
 			Status: models.PaymentPending,
 		},
-		Total:     total,
-		Status:    models.OrderPending,
-		Notes:     input.Notes,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		Fulfilments: fulfilments,
+		Total:       total,
+		Status:      models.OrderPending,
+		Notes:       input.Notes,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
 	}
 
+	userRole, _ := c.Get("userRole")
+	placed := actorEntry(userID, userRole, "Order placed")
+	placed.Status = models.OrderPending
+	placed.Timestamp = order.CreatedAt
+	order.StatusHistory = []models.StatusHistoryEntry{placed}
+
 	// If COD, mark as confirmed
 	if input.PaymentMethod == models.PaymentCOD {
 		order.Status = models.OrderConfirmed
+		confirmed := systemEntry("Cash on delivery order confirmed")
+		confirmed.Status = models.OrderConfirmed
+		confirmed.Timestamp = order.CreatedAt
+		order.StatusHistory = append(order.StatusHistory, confirmed)
+	}
+
+	// Reserve stock before the order exists so oversold lines are rejected
+	itemErrors, err := reserveStock(ctx, h.products, orderItems)
+	if err != nil {
+		utils.InternalError(c, "Failed to reserve stock")
+		return
+	}
+	if len(itemErrors) > 0 {
+		utils.ErrorResponseWithData(c, http.StatusConflict, "Some items are not available in the requested quantity", itemErrors)
+		return
+	}
+
+	// Record coupon usage only once stock is secured
+	if coupon != nil {
+		if err := coupons.Redeem(ctx, h.coupons, coupon, objectID); err != nil {
+			releaseStock(ctx, h.products, orderItems)
+			if coupons.IsRuleError(err) {
+				utils.ErrorResponse(c, http.StatusConflict, err.Error())
+				return
+			}
+			utils.InternalError(c, "Failed to apply coupon")
+			return
+		}
+		order.CouponCode = coupon.Code
+		order.CouponID = coupon.ID
+	}
+
+	// Prepaid orders stay pending until the gateway confirms the payment
+	if order.PaymentInfo.Method != models.PaymentCOD {
+		intent, err := h.payments.CreateIntent(ctx, payments.IntentRequest{
+			OrderID:     order.ID.Hex(),
+			OrderNumber: order.OrderNumber,
+			Amount:      order.Total,
+			Currency:    "INR",
+			Method:      string(order.PaymentInfo.Method),
+			Email:       order.UserEmail,
+		})
+		if err != nil {
+			releaseStock(ctx, h.products, orderItems)
+			if coupon != nil {
+				coupons.Release(ctx, h.coupons, coupon.ID, objectID)
+			}
+			utils.ErrorResponse(c, http.StatusBadGateway, "Failed to start payment")
+			return
+		}
+
+		order.PaymentInfo.Provider = h.payments.Name()
+		order.PaymentInfo.IntentID = intent.ID
+		order.PaymentInfo.ClientSecret = intent.ClientSecret
+		order.PaymentInfo.ExpiresAt = intent.ExpiresAt
 	}
 
-	_, err = database.Orders().InsertOne(ctx, order)
+	err = h.orders.Create(ctx, &order)
 	if err != nil {
+		releaseStock(ctx, h.products, orderItems)
+		if coupon != nil {
+			coupons.Release(ctx, h.coupons, coupon.ID, objectID)
+		}
 		utils.InternalError(c, "Failed to create order")
 		return
 	}
 
 	// Clear cart
-	database.Carts().DeleteOne(ctx, bson.M{"user_id": objectID})
-
-	// Update product stock
-	for _, item := range cart.Items {
-		database.Products().UpdateOne(
-			ctx,
-			bson.M{"_id": item.ProductID},
-			bson.M{"$inc": bson.M{"stock": -item.Quantity}},
-		)
+	h.carts.carts.Delete(ctx, owner.key())
+
+	// Confirmed orders are invoiced straight away; prepaid orders are
+	// invoiced once the payment is captured
+	if order.Status == models.OrderConfirmed {
+		if invoice, err := issueInvoice(ctx, h.orders, h.counters, &order); err == nil {
+			order.Invoice = invoice
+		} else {
+			log.Println("Failed to issue invoice for order", order.OrderNumber, err)
+		}
 	}
 
 	utils.SuccessResponse(c, http.StatusCreated, "Order placed successfully", order)
@@ -151,19 +313,11 @@ func (h *OrderHandler) GetOrders(c *gin.Context) {
 
 	objectID, _ := primitive.ObjectIDFromHex(userID.(string))
 
-	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
-	cursor, err := database.Orders().Find(ctx, bson.M{"user_id": objectID}, opts)
+	orders, err := h.orders.Find(ctx, repository.OrderQuery{UserID: objectID})
 	if err != nil {
 		utils.InternalError(c, "Failed to fetch orders")
 		return
 	}
-	defer cursor.Close(ctx)
-
-	var orders []models.Order
-	if err := cursor.All(ctx, &orders); err != nil {
-		utils.InternalError(c, "Failed to decode orders")
-		return
-	}
 
 	utils.SuccessResponse(c, http.StatusOK, "", orders)
 }
@@ -182,9 +336,8 @@ func (h *OrderHandler) GetOrder(c *gin.Context) {
 		return
 	}
 
-	var order models.Order
-	err = database.Orders().FindOne(ctx, bson.M{"_id": orderObjectID, "user_id": objectID}).Decode(&order)
-	if err != nil {
+	order, err := h.orders.FindByID(ctx, orderObjectID)
+	if err != nil || order.UserID != objectID {
 		utils.NotFoundError(c, "Order not found")
 		return
 	}
@@ -192,6 +345,59 @@ func (h *OrderHandler) GetOrder(c *gin.Context) {
 	utils.SuccessResponse(c, http.StatusOK, "", order)
 }
 
+func (h *OrderHandler) GetOrderTimeline(c *gin.Context) {
+	userID, _ := c.Get("userId")
+	orderID := c.Param("id")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	objectID, _ := primitive.ObjectIDFromHex(userID.(string))
+	orderObjectID, err := primitive.ObjectIDFromHex(orderID)
+	if err != nil {
+		utils.ValidationError(c, "Invalid order ID")
+		return
+	}
+
+	order, err := h.orders.FindByID(ctx, orderObjectID)
+	if err != nil || order.UserID != objectID {
+		utils.NotFoundError(c, "Order not found")
+		return
+	}
+
+	entries := make([]models.StatusHistoryEntry, 0, len(order.StatusHistory))
+	for _, entry := range order.StatusHistory {
+		// Staff identities are not shown to customers
+		entry.ActorID = primitive.NilObjectID
+		entries = append(entries, entry)
+	}
+
+	// Orders placed before status history was kept only know their
+	// creation and current status
+	if len(entries) == 0 {
+		entries = append(entries, models.StatusHistoryEntry{
+			Status:    models.OrderPending,
+			Note:      "Order placed",
+			Timestamp: order.CreatedAt,
+		})
+		if order.Status != models.OrderPending {
+			entries = append(entries, models.StatusHistoryEntry{
+				Status:    order.Status,
+				Timestamp: order.UpdatedAt,
+			})
+		}
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "", models.OrderTimeline{
+		OrderID:     order.ID,
+		OrderNumber: order.OrderNumber,
+		Status:      order.Status,
+		TrackingID:  order.ShippingInfo.TrackingID,
+		Carrier:     order.ShippingInfo.Carrier,
+		Entries:     entries,
+	})
+}
+
 func (h *OrderHandler) CancelOrder(c *gin.Context) {
 	userID, _ := c.Get("userId")
 	orderID := c.Param("id")
@@ -211,40 +417,48 @@ func (h *OrderHandler) CancelOrder(c *gin.Context) {
 		return
 	}
 
-	var order models.Order
-	err = database.Orders().FindOne(ctx, bson.M{"_id": orderObjectID, "user_id": objectID}).Decode(&order)
-	if err != nil {
+	order, err := h.orders.FindByID(ctx, orderObjectID)
+	if err != nil || order.UserID != objectID {
 		utils.NotFoundError(c, "Order not found")
 		return
 	}
 
+	// Customers can only cancel before the order is being prepared
 	if order.Status != models.OrderPending && order.Status != models.OrderConfirmed {
 		utils.ErrorResponse(c, http.StatusBadRequest, "Order cannot be cancelled")
 		return
 	}
 
-	_, err = database.Orders().UpdateOne(
+	userRole, _ := c.Get("userRole")
+	note := "Cancelled by customer"
+	if input.Reason != "" {
+		note += ": " + input.Reason
+	}
+	err = transitionOrder(
 		ctx,
-		bson.M{"_id": orderObjectID},
-		bson.M{"$set": bson.M{
-			"status":        models.OrderCancelled,
-			"cancel_reason": input.Reason,
-			"updated_at":    time.Now(),
-		}},
+		h.orders,
+		orderObjectID,
+		order.Status,
+		models.OrderCancelled,
+		actorEntry(userID, userRole, note),
+		nil,
+		repository.Fields{"cancel_reason": input.Reason},
 	)
+	if errors.Is(err, errStatusChanged) {
+		utils.ErrorResponse(c, http.StatusConflict, "Order status changed, please retry")
+		return
+	}
 	if err != nil {
 		utils.InternalError(c, "Failed to cancel order")
 		return
 	}
 
-	// Restore product stock
-	for _, item := range order.Items {
-		database.Products().UpdateOne(
-			ctx,
-			bson.M{"_id": item.ProductID},
-			bson.M{"$inc": bson.M{"stock": item.Quantity}},
-		)
+	// Restore product stock and coupon usage
+	releaseStock(ctx, h.products, order.Items)
+	if !order.CouponID.IsZero() {
+		coupons.Release(ctx, h.coupons, order.CouponID, order.UserID)
 	}
+	h.refundCancelled(ctx, orderObjectID, note)
 
 	utils.SuccessResponse(c, http.StatusOK, "Order cancelled successfully", nil)
 }
@@ -259,37 +473,28 @@ func (h *OrderHandler) GetAllOrders(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	filter := bson.M{}
+	query := repository.OrderQuery{
+		Page: repository.Page{Skip: int64((page - 1) * limit), Limit: int64(limit)},
+	}
 	if status != "" {
-		filter["status"] = status
+		query.Statuses = []models.OrderStatus{models.OrderStatus(status)}
 	}
 
-	skip := int64((page - 1) * limit)
-	opts := options.Find().
-		SetSort(bson.D{{Key: "created_at", Value: -1}}).
-		SetSkip(skip).
-		SetLimit(int64(limit))
-
-	cursor, err := database.Orders().Find(ctx, filter, opts)
+	orders, err := h.orders.Find(ctx, query)
 	if err != nil {
 		utils.InternalError(c, "Failed to fetch orders")
 		return
 	}
-	defer cursor.Close(ctx)
 
-	var orders []models.Order
-	if err := cursor.All(ctx, &orders); err != nil {
-		utils.InternalError(c, "Failed to decode orders")
-		return
-	}
-
-	total, _ := database.Orders().CountDocuments(ctx, filter)
+	total, _ := h.orders.Count(ctx, query)
 
 	utils.PaginatedSuccessResponse(c, orders, page, limit, total)
 }
 
 func (h *OrderHandler) UpdateOrderStatus(c *gin.Context) {
 	orderID := c.Param("id")
+	userID, _ := c.Get("userId")
+	userRole, _ := c.Get("userRole")
 
 	var input models.UpdateOrderStatusInput
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -297,6 +502,18 @@ func (h *OrderHandler) UpdateOrderStatus(c *gin.Context) {
 		return
 	}
 
+	if !input.Status.IsValid() {
+		utils.ValidationError(c, "Invalid order status")
+		return
+	}
+
+	// Orders are only refunded once the money has gone back, through a
+	// return or by cancelling a paid order
+	if input.Status == models.OrderRefunded {
+		utils.ValidationError(c, "Orders are refunded through returns or by cancelling them")
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -306,11 +523,17 @@ func (h *OrderHandler) UpdateOrderStatus(c *gin.Context) {
 		return
 	}
 
-	update := bson.M{
-		"status":     input.Status,
-		"updated_at": time.Now(),
+	order, err := h.orders.FindByID(ctx, orderObjectID)
+	if err != nil {
+		utils.NotFoundError(c, "Order not found")
+		return
 	}
 
+	update := repository.Fields{}
+	entry := actorEntry(userID, userRole, input.Note)
+	entry.TrackingID = input.TrackingID
+	entry.Carrier = input.Carrier
+
 	if input.TrackingID != "" {
 		update["shipping_info.tracking_id"] = input.TrackingID
 	}
@@ -319,23 +542,65 @@ func (h *OrderHandler) UpdateOrderStatus(c *gin.Context) {
 	}
 	if input.CancelReason != "" {
 		update["cancel_reason"] = input.CancelReason
+		if entry.Note == "" {
+			entry.Note = input.CancelReason
+		}
 	}
 
-	// If delivered, update payment status
 	if input.Status == models.OrderDelivered {
-		update["payment_info.status"] = models.PaymentCompleted
-		update["payment_info.paid_at"] = time.Now()
+		for key, value := range deliveredFields(order) {
+			update[key] = value
+		}
 	}
 
-	_, err = database.Orders().UpdateOne(ctx, bson.M{"_id": orderObjectID}, bson.M{"$set": update})
+	err = transitionOrder(ctx, h.orders, orderObjectID, order.Status, input.Status, entry, nil, update)
+	if errors.Is(err, errIllegalTransition) {
+		utils.ErrorResponse(c, http.StatusConflict, fmt.Sprintf("Cannot change order status from %s to %s", order.Status, input.Status))
+		return
+	}
+	if errors.Is(err, errStatusChanged) {
+		utils.ErrorResponse(c, http.StatusConflict, "Order status changed, please retry")
+		return
+	}
 	if err != nil {
 		utils.InternalError(c, "Failed to update order")
 		return
 	}
 
-	var order models.Order
-	database.Orders().FindOne(ctx, bson.M{"_id": orderObjectID}).Decode(&order)
+	// Cancelled orders give back their stock, coupon and payment
+	if input.Status == models.OrderCancelled {
+		releaseStock(ctx, h.products, order.Items)
+		if !order.CouponID.IsZero() {
+			coupons.Release(ctx, h.coupons, order.CouponID, order.UserID)
+		}
+		h.refundCancelled(ctx, orderObjectID, entry.Note)
+	}
+
+	if updated, err := h.orders.FindByID(ctx, orderObjectID); err == nil {
+		order = updated
+	}
+
+	// Sellers earn their share once their part is delivered; the ledger
+	// posts it in the background, retrying until it succeeds
+	if input.Status == models.OrderDelivered {
+		if err := h.events.Publish(ctx, models.EventOrderDelivered, order.ID); err != nil {
+			log.Printf("Failed to publish delivery of order %s: %v", order.OrderNumber, err)
+		}
+	}
 
 	utils.SuccessResponse(c, http.StatusOK, "Order status updated", order)
 }
 
+// refundCancelled refunds the payment of a cancelled order. A refund the
+// provider fails is left marked needs_refund and does not fail the
+// cancellation.
+func (h *OrderHandler) refundCancelled(ctx context.Context, orderID primitive.ObjectID, reason string) {
+	order, err := h.orders.FindByID(ctx, orderID)
+	if err != nil {
+		log.Printf("Failed to load cancelled order %s for refund: %v", orderID.Hex(), err)
+		return
+	}
+	if err := refundCancelledOrder(ctx, h.orders, h.payments, h.events, order, reason); err != nil {
+		log.Printf("Failed to refund cancelled order %s: %v", order.OrderNumber, err)
+	}
+}
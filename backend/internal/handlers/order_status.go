@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"ejewel/internal/events"
+	"ejewel/internal/models"
+	"ejewel/internal/payments"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	errIllegalTransition = errors.New("illegal order status transition")
+	errStatusChanged     = errors.New("order status changed concurrently")
+)
+
+// transitionOrder moves an order from one status to another and appends the
+// change to its status history. The update only matches while the order is
+// still in the from status, so concurrent transitions cannot both succeed.
+// Extra conditions in match narrow the update further and extra fields in
+// set are written along with the status.
+func transitionOrder(ctx context.Context, orders repository.OrderRepository, orderID primitive.ObjectID, from, to models.OrderStatus, entry models.StatusHistoryEntry, match, set repository.Fields) error {
+	if !from.CanTransitionTo(to) {
+		return fmt.Errorf("%w: cannot change order status from %s to %s", errIllegalTransition, from, to)
+	}
+
+	now := time.Now()
+	entry.Status = to
+	entry.Timestamp = now
+
+	update := repository.Fields{"updated_at": now}
+	for key, value := range set {
+		update[key] = value
+	}
+
+	err := orders.Transition(ctx, orderID, from, to, entry, match, update)
+	if errors.Is(err, repository.ErrConflict) {
+		return errStatusChanged
+	}
+	if err != nil {
+		return err
+	}
+
+	// Sellers' parts that are behind the order follow it
+	if behind := models.FulfilmentsBefore(to); len(behind) > 0 {
+		if err := orders.AdvanceFulfilments(ctx, orderID, behind, to, entry); err != nil {
+			log.Printf("Failed to update fulfilments of order %s: %v", orderID.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// deliveredFields returns the fields set on an order when it is delivered.
+func deliveredFields(order *models.Order) repository.Fields {
+	now := time.Now()
+	update := repository.Fields{"delivered_at": now}
+
+	// Cash on delivery is paid when the order is delivered
+	if order.PaymentInfo.Method == models.PaymentCOD {
+		update["payment_info.status"] = models.PaymentCompleted
+		update["payment_info.paid_at"] = now
+	}
+	return update
+}
+
+// refundCancelledOrder gives back what was captured for a cancelled order
+// and moves it to refunded. The amount is claimed on the order before the
+// provider is asked, so a payment is only ever refunded once. When the
+// provider fails the claim is dropped and the payment is marked
+// needs_refund, which a later attempt picks up again. Sales already posted
+// for delivered parts are reversed in the background.
+func refundCancelledOrder(ctx context.Context, orders repository.OrderRepository, provider payments.Provider, bus *events.Bus, order *models.Order, reason string) error {
+	paid := order.PaymentInfo.Status == models.PaymentCompleted || order.PaymentInfo.Status == models.PaymentNeedsRefund
+	amount := order.Total - order.RefundedAmount
+	if order.Status != models.OrderCancelled || !paid || order.PaymentInfo.IntentID == "" || amount <= 0 {
+		return nil
+	}
+
+	err := orders.AddRefund(ctx, order.ID, amount)
+	if errors.Is(err, repository.ErrConflict) {
+		// Refunded concurrently
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	refund, err := provider.Refund(ctx, payments.RefundRequest{
+		IntentID:      order.PaymentInfo.IntentID,
+		TransactionID: order.PaymentInfo.TransactionID,
+		Amount:        amount,
+		Reason:        reason,
+	})
+	if err != nil {
+		orders.AddRefund(ctx, order.ID, -amount)
+		orders.Update(ctx, order.ID, nil, repository.Fields{"payment_info.status": models.PaymentNeedsRefund})
+		return fmt.Errorf("refunding order %s: %w", order.OrderNumber, err)
+	}
+
+	err = transitionOrder(
+		ctx,
+		orders,
+		order.ID,
+		models.OrderCancelled,
+		models.OrderRefunded,
+		systemEntry(fmt.Sprintf("Refund of %.2f issued", amount)),
+		nil,
+		repository.Fields{
+			"payment_info.status":      models.PaymentRefunded,
+			"payment_info.refund_id":   refund.ID,
+			"payment_info.refunded_at": time.Now(),
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := bus.Publish(ctx, models.EventOrderRefunded, order.ID); err != nil {
+		log.Printf("Failed to publish refund of order %s: %v", order.OrderNumber, err)
+	}
+	return nil
+}
+
+// rollUpFulfilments moves the order on, one step at a time, to the
+// furthest status all of its sellers' parts have reached.
+func rollUpFulfilments(ctx context.Context, orders repository.OrderRepository, order *models.Order) error {
+	for next := order.RollUpStatus(); next != ""; next = order.RollUpStatus() {
+		var set repository.Fields
+		if next == models.OrderDelivered {
+			set = deliveredFields(order)
+		}
+		entry := systemEntry("Every seller has reached " + string(next))
+		if err := transitionOrder(ctx, orders, order.ID, order.Status, next, entry, nil, set); err != nil {
+			return err
+		}
+		order.Status = next
+	}
+	return nil
+}
+
+func containsStatus(statuses []models.OrderStatus, status models.OrderStatus) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// actorEntry starts a status history entry for the user in the request.
+func actorEntry(userID interface{}, role interface{}, note string) models.StatusHistoryEntry {
+	entry := models.StatusHistoryEntry{Note: note}
+	if id, ok := userID.(string); ok {
+		entry.ActorID, _ = primitive.ObjectIDFromHex(id)
+	}
+	if r, ok := role.(models.Role); ok {
+		entry.ActorRole = string(r)
+	}
+	return entry
+}
+
+// systemEntry starts a status history entry for an automated change.
+func systemEntry(note string) models.StatusHistoryEntry {
+	return models.StatusHistoryEntry{ActorRole: models.ActorSystem, Note: note}
+}
@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"ejewel/internal/coupons"
+	"ejewel/internal/events"
+	"ejewel/internal/models"
+	"ejewel/internal/payments"
+	"ejewel/internal/repository"
+	"ejewel/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type PaymentHandler struct {
+	orders   repository.OrderRepository
+	products repository.ProductRepository
+	coupons  repository.CouponRepository
+	counters repository.CounterRepository
+	provider payments.Provider
+	events   *events.Bus
+}
+
+func NewPaymentHandler(orders repository.OrderRepository, products repository.ProductRepository, couponStore repository.CouponRepository, counters repository.CounterRepository, provider payments.Provider, bus *events.Bus) *PaymentHandler {
+	return &PaymentHandler{orders: orders, products: products, coupons: couponStore, counters: counters, provider: provider, events: bus}
+}
+
+func (h *PaymentHandler) Webhook(c *gin.Context) {
+	payload, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+	if err != nil {
+		utils.ValidationError(c, "Failed to read request body")
+		return
+	}
+
+	event, err := h.provider.ParseWebhook(c.Request.Header, payload)
+	if err != nil {
+		if errors.Is(err, payments.ErrInvalidSignature) {
+			utils.UnauthorizedError(c, "Invalid signature")
+			return
+		}
+		utils.ValidationError(c, "Invalid webhook payload")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	order, err := h.applyEvent(ctx, event)
+	if err == repository.ErrNotFound {
+		utils.NotFoundError(c, "Order not found for payment")
+		return
+	}
+	if err != nil {
+		utils.InternalError(c, "Failed to process payment event")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Event processed", gin.H{
+		"orderId": order.ID,
+		"status":  order.Status,
+		"payment": order.PaymentInfo.Status,
+	})
+}
+
+// SimulatePayment lets a customer complete, fail or expire the payment of
+// their own order through the mock provider, exercising the same webhook
+// path a real gateway would.
+func (h *PaymentHandler) SimulatePayment(c *gin.Context) {
+	mock, ok := h.provider.(*payments.MockProvider)
+	if !ok {
+		utils.NotFoundError(c, "Payment simulation is not available")
+		return
+	}
+
+	userID, _ := c.Get("userId")
+
+	var input struct {
+		OrderID string             `json:"orderId" binding:"required"`
+		Event   payments.EventType `json:"event" binding:"required"`
+		Reason  string             `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	objectID, _ := primitive.ObjectIDFromHex(userID.(string))
+	orderObjectID, err := primitive.ObjectIDFromHex(input.OrderID)
+	if err != nil {
+		utils.ValidationError(c, "Invalid order ID")
+		return
+	}
+
+	order, err := h.orders.FindByID(ctx, orderObjectID)
+	if err != nil || order.UserID != objectID || order.PaymentInfo.IntentID == "" {
+		utils.NotFoundError(c, "Order not found")
+		return
+	}
+
+	payload, signature, err := mock.SignedEvent(input.Event, order.PaymentInfo.IntentID, input.Reason)
+	if err != nil {
+		utils.InternalError(c, "Failed to build payment event")
+		return
+	}
+
+	header := http.Header{}
+	header.Set(payments.SignatureHeader, signature)
+	event, err := h.provider.ParseWebhook(header, payload)
+	if err != nil {
+		utils.InternalError(c, "Failed to verify payment event")
+		return
+	}
+
+	updated, err := h.applyEvent(ctx, event)
+	if err != nil {
+		utils.InternalError(c, "Failed to process payment event")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Payment event simulated", updated)
+}
+
+// StartExpiryWorker periodically expires unpaid orders whose payment intent
+// has lapsed, releasing their reserved stock.
+func (h *PaymentHandler) StartExpiryWorker(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				h.expireStalePayments(ctx)
+			}
+		}
+	}()
+}
+
+func (h *PaymentHandler) expireStalePayments(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	orders, err := h.orders.Find(ctx, repository.OrderQuery{
+		Statuses:             []models.OrderStatus{models.OrderPending},
+		PaymentStatus:        models.PaymentPending,
+		PaymentExpiredBefore: time.Now(),
+	})
+	if err != nil {
+		log.Println("Failed to find expired payments:", err)
+		return
+	}
+
+	for i := range orders {
+		order := &orders[i]
+		if err := h.failPayment(ctx, order, models.PaymentExpired, "Payment window expired"); err != nil {
+			log.Println("Failed to expire payment for order", order.OrderNumber+":", err)
+		}
+	}
+}
+
+// applyEvent moves the order behind a payment intent according to a
+// verified provider event and returns the updated order. Replayed events
+// are harmless because every transition is conditional on the current
+// payment status.
+func (h *PaymentHandler) applyEvent(ctx context.Context, event *payments.Event) (*models.Order, error) {
+	order, err := h.orders.FindByIntentID(ctx, event.IntentID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch event.Type {
+	case payments.EventCaptured:
+		err = h.confirmPayment(ctx, order, event.TransactionID)
+	case payments.EventFailed:
+		reason := event.Reason
+		if reason == "" {
+			reason = "Payment failed"
+		}
+		err = h.failPayment(ctx, order, models.PaymentFailed, reason)
+	case payments.EventExpired:
+		err = h.failPayment(ctx, order, models.PaymentExpired, "Payment window expired")
+	default:
+		log.Println("Ignoring payment event of type", event.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return h.orders.FindByID(ctx, order.ID)
+}
+
+// confirmPayment records a captured payment and confirms the order if it is
+// still waiting for payment. Money captured for an order that has already
+// been cancelled is refunded straight away.
+func (h *PaymentHandler) confirmPayment(ctx context.Context, order *models.Order, transactionID string) error {
+	now := time.Now()
+	err := h.orders.Update(
+		ctx,
+		order.ID,
+		repository.Fields{"payment_info.status": models.PaymentPending},
+		repository.Fields{
+			"payment_info.status":         models.PaymentCompleted,
+			"payment_info.transaction_id": transactionID,
+			"payment_info.paid_at":        now,
+			"updated_at":                  now,
+		},
+	)
+	if errors.Is(err, repository.ErrConflict) {
+		return h.confirmLatePayment(ctx, order.ID, transactionID)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = transitionOrder(ctx, h.orders, order.ID, models.OrderPending, models.OrderConfirmed, systemEntry("Payment received"), nil, nil)
+	if errors.Is(err, errStatusChanged) || errors.Is(err, errIllegalTransition) {
+		// The customer cancelled before the payment went through
+		return h.refundCapture(ctx, order.ID)
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := issueInvoice(ctx, h.orders, h.counters, order); err != nil {
+		log.Println("Failed to issue invoice for order", order.OrderNumber, err)
+	}
+	return nil
+}
+
+// confirmLatePayment handles a capture for a payment that is no longer
+// pending. Replayed events find it completed and change nothing, but a
+// payment written off as failed or expired has already cancelled its
+// order, so the capture is recorded and refunded. A refund the provider
+// failed earlier is tried again.
+func (h *PaymentHandler) confirmLatePayment(ctx context.Context, orderID primitive.ObjectID, transactionID string) error {
+	order, err := h.orders.FindByID(ctx, orderID)
+	if err != nil {
+		return err
+	}
+
+	switch status := order.PaymentInfo.Status; status {
+	case models.PaymentFailed, models.PaymentExpired:
+		now := time.Now()
+		err = h.orders.Update(
+			ctx,
+			orderID,
+			repository.Fields{"payment_info.status": status},
+			repository.Fields{
+				"payment_info.status":         models.PaymentCompleted,
+				"payment_info.transaction_id": transactionID,
+				"payment_info.paid_at":        now,
+				"updated_at":                  now,
+			},
+		)
+		if errors.Is(err, repository.ErrConflict) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return h.refundCapture(ctx, orderID)
+	case models.PaymentNeedsRefund:
+		return h.refundCapture(ctx, orderID)
+	}
+	return nil
+}
+
+// refundCapture refunds a payment captured for a cancelled order.
+func (h *PaymentHandler) refundCapture(ctx context.Context, orderID primitive.ObjectID) error {
+	order, err := h.orders.FindByID(ctx, orderID)
+	if err != nil {
+		return err
+	}
+
+	log.Println("Refunding payment captured for cancelled order", order.OrderNumber)
+	return refundCancelledOrder(ctx, h.orders, h.provider, h.events, order, "Payment captured after the order was cancelled")
+}
+
+// failPayment cancels an unpaid order and gives back its stock and coupon.
+func (h *PaymentHandler) failPayment(ctx context.Context, order *models.Order, status models.PaymentStatus, reason string) error {
+	err := transitionOrder(
+		ctx,
+		h.orders,
+		order.ID,
+		models.OrderPending,
+		models.OrderCancelled,
+		systemEntry(reason),
+		repository.Fields{"payment_info.status": models.PaymentPending},
+		repository.Fields{
+			"cancel_reason":               reason,
+			"payment_info.status":         status,
+			"payment_info.failure_reason": reason,
+		},
+	)
+	if errors.Is(err, errStatusChanged) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	releaseStock(ctx, h.products, order.Items)
+	if !order.CouponID.IsZero() {
+		coupons.Release(ctx, h.coupons, order.CouponID, order.UserID)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"ejewel/internal/models"
+	"ejewel/internal/pricing"
+	"ejewel/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PricingHandler struct {
+	engine *pricing.Engine
+}
+
+func NewPricingHandler(engine *pricing.Engine) *PricingHandler {
+	return &PricingHandler{engine: engine}
+}
+
+func (h *PricingHandler) GetRates(c *gin.Context) {
+	utils.SuccessResponse(c, http.StatusOK, "", h.engine.Rates())
+}
+
+// Admin handlers
+
+func (h *PricingHandler) UpdateRates(c *gin.Context) {
+	var input models.UpdateMetalRatesInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	if err := h.engine.SetRates(ctx, input.Rates, "admin"); err != nil {
+		if errors.Is(err, pricing.ErrUnknownMetal) {
+			utils.ValidationError(c, err.Error())
+			return
+		}
+		utils.InternalError(c, "Failed to update metal rates")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Metal rates updated", h.engine.Rates())
+}
+
+func (h *PricingHandler) SyncRates(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	count, err := h.engine.SyncFeed(ctx)
+	if err != nil {
+		utils.ErrorResponse(c, http.StatusBadGateway, "Failed to sync metal rates: "+err.Error())
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Metal rates synced", gin.H{
+		"updated": count,
+		"rates":   h.engine.Rates(),
+	})
+}
@@ -2,23 +2,42 @@ package handlers
 
 import (
 	"context"
+	"fmt"
+	"log"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
-	"ejewel/internal/database"
+	"ejewel/internal/events"
 	"ejewel/internal/models"
+	"ejewel/internal/pricing"
+	"ejewel/internal/repository"
+	"ejewel/internal/search"
 	"ejewel/internal/utils"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-type ProductHandler struct{}
+type ProductHandler struct {
+	products   repository.ProductRepository
+	categories repository.CategoryRepository
+	pricing    *pricing.Engine
+	search     *search.Index
+	events     *events.Bus
+}
+
+func NewProductHandler(products repository.ProductRepository, categories repository.CategoryRepository, pricingEngine *pricing.Engine, searchIndex *search.Index, bus *events.Bus) *ProductHandler {
+	return &ProductHandler{products: products, categories: categories, pricing: pricingEngine, search: searchIndex, events: bus}
+}
 
-func NewProductHandler() *ProductHandler {
-	return &ProductHandler{}
+// applyPricing refreshes rate-based prices with the latest metal rates.
+func (h *ProductHandler) applyPricing(products []models.Product) {
+	for i := range products {
+		h.pricing.Apply(&products[i])
+	}
 }
 
 func (h *ProductHandler) GetProducts(c *gin.Context) {
@@ -28,6 +47,30 @@ func (h *ProductHandler) GetProducts(c *gin.Context) {
 		return
 	}
 
+	h.listProducts(c, filter)
+}
+
+// SearchProducts lists the products matching q, most relevant first unless
+// sortBy is given. The listing filters apply as well.
+func (h *ProductHandler) SearchProducts(c *gin.Context) {
+	var filter models.ProductFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	filter.Search = strings.TrimSpace(c.Query("q"))
+	if filter.Search == "" {
+		utils.ValidationError(c, "Search query is required")
+		return
+	}
+
+	h.listProducts(c, filter)
+}
+
+// listProducts writes a page of the products matching the filter. Searches
+// are sorted by relevance unless another order is asked for.
+func (h *ProductHandler) listProducts(c *gin.Context, filter models.ProductFilter) {
 	if filter.Page <= 0 {
 		filter.Page = 1
 	}
@@ -35,85 +78,240 @@ func (h *ProductHandler) GetProducts(c *gin.Context) {
 		filter.Limit = 12
 	}
 
+	query, err := productQuery(filter)
+	if err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	query := bson.M{"is_active": true}
-
-	if filter.MetalType != "" {
-		query["metal_type"] = filter.MetalType
-	}
-	if filter.CategoryID != "" {
-		catID, _ := primitive.ObjectIDFromHex(filter.CategoryID)
-		query["category_id"] = catID
-	}
-	if filter.MinPrice > 0 {
-		query["base_price"] = bson.M{"$gte": filter.MinPrice}
-	}
-	if filter.MaxPrice > 0 {
-		if _, ok := query["base_price"]; ok {
-			query["base_price"].(bson.M)["$lte"] = filter.MaxPrice
-		} else {
-			query["base_price"] = bson.M{"$lte": filter.MaxPrice}
-		}
-	}
-	if filter.Purity != "" {
-		query["purity"] = filter.Purity
+	if err := h.withSubcategories(ctx, &query); err != nil {
+		utils.InternalError(c, "Failed to fetch products")
+		return
 	}
+
 	if filter.Search != "" {
-		query["$or"] = []bson.M{
-			{"name": bson.M{"$regex": filter.Search, "$options": "i"}},
-			{"description": bson.M{"$regex": filter.Search, "$options": "i"}},
-			{"tags": bson.M{"$regex": filter.Search, "$options": "i"}},
+		query.IDs = h.searchIDs(filter.Search)
+		if len(query.IDs) == 0 {
+			utils.PaginatedSuccessResponse(c, []models.Product{}, filter.Page, filter.Limit, 0)
+			return
+		}
+		if filter.SortBy == "" || filter.SortBy == "relevance" {
+			h.listByRelevance(ctx, c, query, filter.Page, filter.Limit)
+			return
 		}
-	}
-	if filter.IsFeatured == "true" {
-		query["is_featured"] = true
 	}
 
 	// Sorting
-	sortField := "created_at"
-	sortOrder := -1
+	query.SortBy = "created_at"
+	query.SortDesc = filter.SortOrder != "asc"
 	if filter.SortBy != "" {
 		switch filter.SortBy {
 		case "price":
-			sortField = "base_price"
+			query.SortBy = "base_price"
 		case "name":
-			sortField = "name"
+			query.SortBy = "name"
 		case "rating":
-			sortField = "rating"
+			query.SortBy = "rating"
 		case "newest":
-			sortField = "created_at"
+			query.SortBy = "created_at"
 		}
 	}
-	if filter.SortOrder == "asc" {
-		sortOrder = 1
+
+	query.Page = repository.Page{
+		Skip:  int64((filter.Page - 1) * filter.Limit),
+		Limit: int64(filter.Limit),
 	}
 
-	skip := int64((filter.Page - 1) * filter.Limit)
-	limit := int64(filter.Limit)
+	products, err := h.products.Find(ctx, query)
+	if err != nil {
+		utils.InternalError(c, "Failed to fetch products")
+		return
+	}
+	h.applyPricing(products)
 
-	opts := options.Find().
-		SetSort(bson.D{{Key: sortField, Value: sortOrder}}).
-		SetSkip(skip).
-		SetLimit(limit)
+	total, _ := h.products.Count(ctx, query)
 
-	cursor, err := database.Products().Find(ctx, query, opts)
+	utils.PaginatedSuccessResponse(c, products, filter.Page, filter.Limit, total)
+}
+
+// listByRelevance writes a page of the products matching a query for
+// search hits, in the order of query.IDs.
+func (h *ProductHandler) listByRelevance(ctx context.Context, c *gin.Context, query repository.ProductQuery, page, limit int) {
+	products, err := h.products.Find(ctx, query)
 	if err != nil {
 		utils.InternalError(c, "Failed to fetch products")
 		return
 	}
-	defer cursor.Close(ctx)
 
-	var products []models.Product
-	if err := cursor.All(ctx, &products); err != nil {
-		utils.InternalError(c, "Failed to decode products")
+	rank := make(map[primitive.ObjectID]int, len(query.IDs))
+	for i, id := range query.IDs {
+		rank[id] = i
+	}
+	sort.Slice(products, func(i, j int) bool { return rank[products[i].ID] < rank[products[j].ID] })
+
+	total := len(products)
+	from := min((page-1)*limit, total)
+	products = products[from:min(from+limit, total)]
+	h.applyPricing(products)
+
+	utils.PaginatedSuccessResponse(c, products, page, limit, int64(total))
+}
+
+// withSubcategories widens the category filter of the query to the
+// categories below the ones asked for.
+func (h *ProductHandler) withSubcategories(ctx context.Context, query *repository.ProductQuery) error {
+	if len(query.CategoryIDs) == 0 {
+		return nil
+	}
+
+	categories, err := h.categories.FindAll(ctx)
+	if err != nil {
+		return err
+	}
+	tree := models.NewCategoryTree(categories)
+
+	var ids []primitive.ObjectID
+	seen := map[primitive.ObjectID]bool{}
+	for _, id := range query.CategoryIDs {
+		for _, subID := range tree.Subtree(id) {
+			if !seen[subID] {
+				seen[subID] = true
+				ids = append(ids, subID)
+			}
+		}
+	}
+	query.CategoryIDs = ids
+	return nil
+}
+
+// searchIDs returns the products matching the search text, most relevant
+// first.
+func (h *ProductHandler) searchIDs(text string) []primitive.ObjectID {
+	hits := h.search.Search(text, search.MaxHits)
+	ids := make([]primitive.ObjectID, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.ID
+	}
+	return ids
+}
+
+// SuggestProducts completes what a shopper has typed into the search box
+// with category names, tags and product names.
+func (h *ProductHandler) SuggestProducts(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		utils.ValidationError(c, "Search query is required")
 		return
 	}
 
-	total, _ := database.Products().CountDocuments(ctx, query)
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > 20 {
+		limit = 8
+	}
 
-	utils.PaginatedSuccessResponse(c, products, filter.Page, filter.Limit, total)
+	utils.SuccessResponse(c, http.StatusOK, "", h.search.Suggest(q, limit))
+}
+
+// GetProductFacets counts the active products matching the listing filters
+// by each facet value. A facet's counts leave out its own filter, so the
+// other values it could be widened to are counted too.
+func (h *ProductHandler) GetProductFacets(c *gin.Context) {
+	var filter models.ProductFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	query, err := productQuery(filter)
+	if err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	if filter.Search != "" {
+		if query.IDs = h.searchIDs(filter.Search); len(query.IDs) == 0 {
+			utils.SuccessResponse(c, http.StatusOK, "", repository.EmptyFacets())
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := h.withSubcategories(ctx, &query); err != nil {
+		utils.InternalError(c, "Failed to fetch product facets")
+		return
+	}
+
+	facets, err := h.products.Facets(ctx, query)
+	if err != nil {
+		utils.InternalError(c, "Failed to fetch product facets")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "", facets)
+}
+
+// productQuery turns the listing filters into a query for active products.
+func productQuery(filter models.ProductFilter) (repository.ProductQuery, error) {
+	query := repository.ProductQuery{
+		ActiveOnly: true,
+		MinPrice:   filter.MinPrice,
+		MaxPrice:   filter.MaxPrice,
+		Featured:   filter.IsFeatured == "true",
+	}
+
+	for _, metalType := range splitValues(filter.MetalType) {
+		query.MetalTypes = append(query.MetalTypes, models.MetalType(metalType))
+	}
+	query.Purities = splitValues(filter.Purity)
+	query.Tags = splitValues(filter.Tags...)
+
+	for _, id := range splitValues(filter.CategoryID) {
+		objectID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return query, fmt.Errorf("Invalid category ID %q", id)
+		}
+		query.CategoryIDs = append(query.CategoryIDs, objectID)
+	}
+	for _, value := range splitValues(filter.PriceRange) {
+		priceRange, err := repository.ParsePriceRange(value)
+		if err != nil {
+			return query, fmt.Errorf("Invalid price range %q, expected such as 10000-25000", value)
+		}
+		query.PriceRanges = append(query.PriceRanges, priceRange)
+	}
+	for _, value := range splitValues(filter.Rating) {
+		stars, err := strconv.Atoi(value)
+		if err != nil || stars < 0 || stars > 5 {
+			return query, fmt.Errorf("Invalid rating %q, expected 0 to 5 stars", value)
+		}
+		query.Ratings = append(query.Ratings, min(stars, 4))
+	}
+	if filter.InStock != "" {
+		inStock, err := strconv.ParseBool(filter.InStock)
+		if err != nil {
+			return query, fmt.Errorf("Invalid inStock %q, expected true or false", filter.InStock)
+		}
+		query.InStock = &inStock
+	}
+	return query, nil
+}
+
+// splitValues splits comma separated query values, dropping empty ones.
+func splitValues(values ...string) []string {
+	var out []string
+	for _, value := range values {
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				out = append(out, v)
+			}
+		}
+	}
+	return out
 }
 
 func (h *ProductHandler) GetProduct(c *gin.Context) {
@@ -122,20 +320,21 @@ func (h *ProductHandler) GetProduct(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	var product models.Product
+	var product *models.Product
 
 	// Try to find by ID first, then by slug
 	objectID, err := primitive.ObjectIDFromHex(idParam)
 	if err == nil {
-		err = database.Products().FindOne(ctx, bson.M{"_id": objectID}).Decode(&product)
+		product, err = h.products.FindByID(ctx, objectID)
 	} else {
-		err = database.Products().FindOne(ctx, bson.M{"slug": idParam}).Decode(&product)
+		product, err = h.products.FindBySlug(ctx, idParam)
 	}
 
 	if err != nil {
 		utils.NotFoundError(c, "Product not found")
 		return
 	}
+	h.pricing.Apply(product)
 
 	utils.SuccessResponse(c, http.StatusOK, "", product)
 }
@@ -147,6 +346,11 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 		return
 	}
 
+	if input.BasePrice <= 0 && input.NetWeight <= 0 {
+		utils.ValidationError(c, "Either basePrice or netWeight is required")
+		return
+	}
+
 	userID, _ := c.Get("userId")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -156,8 +360,10 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 	sellerID, _ := primitive.ObjectIDFromHex(userID.(string))
 
 	// Get category name
-	var category models.Category
-	database.Categories().FindOne(ctx, bson.M{"_id": categoryID}).Decode(&category)
+	categoryName := ""
+	if category, err := h.categories.FindByID(ctx, categoryID); err == nil {
+		categoryName = category.Name
+	}
 
 	discountPrice := utils.CalculateDiscountPrice(input.BasePrice, input.DiscountPercent)
 
@@ -170,17 +376,20 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 		MetalType:       input.MetalType,
 		Purity:          input.Purity,
 		CategoryID:      categoryID,
-		CategoryName:    category.Name,
+		CategoryName:    categoryName,
 		Images:          input.Images,
 		Thumbnail:       input.Thumbnail,
 		BasePrice:       input.BasePrice,
 		DiscountPrice:   discountPrice,
 		DiscountPercent: input.DiscountPercent,
+		NetWeight:       input.NetWeight,
+		MakingCharge:    input.MakingCharge,
+		StoneValue:      input.StoneValue,
 		Variants:        input.Variants,
 		Tags:            input.Tags,
 		Features:        input.Features,
-		IsFeatured:      input.IsFeatured,
-		IsNewArrival:    input.IsNewArrival,
+		IsFeatured:      input.IsFeatured && canMerchandise(c),
+		IsNewArrival:    input.IsNewArrival && canMerchandise(c),
 		IsActive:        true,
 		Stock:           input.Stock,
 		SellerID:        sellerID,
@@ -195,15 +404,31 @@ func (h *ProductHandler) CreateProduct(c *gin.Context) {
 		}
 	}
 
-	_, err := database.Products().InsertOne(ctx, product)
+	// Rate-priced products take their price from the current metal rates
+	h.pricing.Apply(&product)
+	if !pricing.Priced(&product) {
+		utils.ValidationError(c, "Product has no price: set a basePrice and variant prices, or a metal rate for its metal and purity")
+		return
+	}
+
+	err := h.products.Create(ctx, &product)
 	if err != nil {
 		utils.InternalError(c, "Failed to create product")
 		return
 	}
+	h.search.Put(&product)
 
 	utils.SuccessResponse(c, http.StatusCreated, "Product created successfully", product)
 }
 
+// canMerchandise reports whether the caller may place products in the
+// featured, new arrival and best seller listings. Sellers cannot.
+func canMerchandise(c *gin.Context) bool {
+	userRole, _ := c.Get("userRole")
+	role, _ := userRole.(models.Role)
+	return role.IsStaff()
+}
+
 func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 	id := c.Param("id")
 	objectID, err := primitive.ObjectIDFromHex(id)
@@ -221,7 +446,17 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	update := bson.M{"updated_at": time.Now()}
+	current, err := h.products.FindByID(ctx, objectID)
+	if err == repository.ErrNotFound {
+		utils.NotFoundError(c, "Product not found")
+		return
+	}
+	if err != nil {
+		utils.InternalError(c, "Failed to fetch product")
+		return
+	}
+
+	update := repository.Fields{"updated_at": time.Now()}
 
 	if input.Name != "" {
 		update["name"] = input.Name
@@ -242,9 +477,10 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 	if input.CategoryID != "" {
 		catID, _ := primitive.ObjectIDFromHex(input.CategoryID)
 		update["category_id"] = catID
-		var category models.Category
-		database.Categories().FindOne(ctx, bson.M{"_id": catID}).Decode(&category)
-		update["category_name"] = category.Name
+		update["category_name"] = ""
+		if category, err := h.categories.FindByID(ctx, catID); err == nil {
+			update["category_name"] = category.Name
+		}
 	}
 	if input.Images != nil {
 		update["images"] = input.Images
@@ -262,6 +498,15 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 			update["discount_price"] = utils.CalculateDiscountPrice(basePrice, input.DiscountPercent)
 		}
 	}
+	if input.NetWeight != nil {
+		update["net_weight"] = *input.NetWeight
+	}
+	if input.MakingCharge != nil {
+		update["making_charge"] = *input.MakingCharge
+	}
+	if input.StoneValue != nil {
+		update["stone_value"] = *input.StoneValue
+	}
 	if input.Variants != nil {
 		for i := range input.Variants {
 			if input.Variants[i].ID.IsZero() {
@@ -276,20 +521,44 @@ func (h *ProductHandler) UpdateProduct(c *gin.Context) {
 	if input.Features != nil {
 		update["features"] = input.Features
 	}
-	update["is_featured"] = input.IsFeatured
-	update["is_new_arrival"] = input.IsNewArrival
-	update["is_best_seller"] = input.IsBestSeller
+	if canMerchandise(c) {
+		update["is_featured"] = input.IsFeatured
+		update["is_new_arrival"] = input.IsNewArrival
+		update["is_best_seller"] = input.IsBestSeller
+	}
 	update["is_active"] = input.IsActive
 	update["stock"] = input.Stock
 
-	_, err = database.Products().UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{"$set": update})
+	err = h.products.Update(ctx, objectID, update)
+	if err == repository.ErrNotFound {
+		utils.NotFoundError(c, "Product not found")
+		return
+	}
+	if err != nil {
+		utils.InternalError(c, "Failed to update product")
+		return
+	}
+
+	product, err := h.products.FindByID(ctx, objectID)
 	if err != nil {
 		utils.InternalError(c, "Failed to update product")
 		return
 	}
+	h.search.Put(product)
 
-	var product models.Product
-	database.Products().FindOne(ctx, bson.M{"_id": objectID}).Decode(&product)
+	// Cart lines carry the name and thumbnail, and are brought up to date
+	// in the background
+	if product.Name != current.Name || product.Thumbnail != current.Thumbnail {
+		if err := h.events.Publish(ctx, models.EventProductChanged, objectID); err != nil {
+			log.Printf("Failed to publish change of product %s: %v", objectID.Hex(), err)
+		}
+	}
+
+	// Weight, purity or making charge changes move the rate-based price
+	if _, err := h.pricing.Reprice(ctx, product); err != nil {
+		utils.InternalError(c, "Failed to reprice product")
+		return
+	}
 
 	utils.SuccessResponse(c, http.StatusOK, "Product updated successfully", product)
 }
@@ -305,11 +574,16 @@ func (h *ProductHandler) DeleteProduct(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	_, err = database.Products().DeleteOne(ctx, bson.M{"_id": objectID})
+	err = h.products.Delete(ctx, objectID)
+	if err == repository.ErrNotFound {
+		utils.NotFoundError(c, "Product not found")
+		return
+	}
 	if err != nil {
 		utils.InternalError(c, "Failed to delete product")
 		return
 	}
+	h.search.Remove(objectID)
 
 	utils.SuccessResponse(c, http.StatusOK, "Product deleted successfully", nil)
 }
@@ -318,19 +592,18 @@ func (h *ProductHandler) GetFeaturedProducts(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	opts := options.Find().SetLimit(8).SetSort(bson.D{{Key: "created_at", Value: -1}})
-	cursor, err := database.Products().Find(ctx, bson.M{"is_featured": true, "is_active": true}, opts)
+	products, err := h.products.Find(ctx, repository.ProductQuery{
+		ActiveOnly: true,
+		Featured:   true,
+		SortBy:     "created_at",
+		SortDesc:   true,
+		Page:       repository.Page{Limit: 8},
+	})
 	if err != nil {
 		utils.InternalError(c, "Failed to fetch featured products")
 		return
 	}
-	defer cursor.Close(ctx)
-
-	var products []models.Product
-	if err := cursor.All(ctx, &products); err != nil {
-		utils.InternalError(c, "Failed to decode products")
-		return
-	}
+	h.applyPricing(products)
 
 	utils.SuccessResponse(c, http.StatusOK, "", products)
 }
@@ -339,19 +612,18 @@ func (h *ProductHandler) GetNewArrivals(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	opts := options.Find().SetLimit(8).SetSort(bson.D{{Key: "created_at", Value: -1}})
-	cursor, err := database.Products().Find(ctx, bson.M{"is_new_arrival": true, "is_active": true}, opts)
+	products, err := h.products.Find(ctx, repository.ProductQuery{
+		ActiveOnly: true,
+		NewArrival: true,
+		SortBy:     "created_at",
+		SortDesc:   true,
+		Page:       repository.Page{Limit: 8},
+	})
 	if err != nil {
 		utils.InternalError(c, "Failed to fetch new arrivals")
 		return
 	}
-	defer cursor.Close(ctx)
-
-	var products []models.Product
-	if err := cursor.All(ctx, &products); err != nil {
-		utils.InternalError(c, "Failed to decode products")
-		return
-	}
+	h.applyPricing(products)
 
 	utils.SuccessResponse(c, http.StatusOK, "", products)
 }
@@ -360,57 +632,18 @@ func (h *ProductHandler) GetBestSellers(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	opts := options.Find().SetLimit(8).SetSort(bson.D{{Key: "review_count", Value: -1}})
-	cursor, err := database.Products().Find(ctx, bson.M{"is_best_seller": true, "is_active": true}, opts)
+	products, err := h.products.Find(ctx, repository.ProductQuery{
+		ActiveOnly: true,
+		BestSeller: true,
+		SortBy:     "review_count",
+		SortDesc:   true,
+		Page:       repository.Page{Limit: 8},
+	})
 	if err != nil {
 		utils.InternalError(c, "Failed to fetch best sellers")
 		return
 	}
-	defer cursor.Close(ctx)
-
-	var products []models.Product
-	if err := cursor.All(ctx, &products); err != nil {
-		utils.InternalError(c, "Failed to decode products")
-		return
-	}
-
-	utils.SuccessResponse(c, http.StatusOK, "", products)
-}
-
-func (h *ProductHandler) SearchProducts(c *gin.Context) {
-	query := c.Query("q")
-	if query == "" {
-		utils.ValidationError(c, "Search query is required")
-		return
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	filter := bson.M{
-		"is_active": true,
-		"$or": []bson.M{
-			{"name": bson.M{"$regex": query, "$options": "i"}},
-			{"description": bson.M{"$regex": query, "$options": "i"}},
-			{"tags": bson.M{"$regex": query, "$options": "i"}},
-			{"category_name": bson.M{"$regex": query, "$options": "i"}},
-		},
-	}
-
-	opts := options.Find().SetLimit(20)
-	cursor, err := database.Products().Find(ctx, filter, opts)
-	if err != nil {
-		utils.InternalError(c, "Failed to search products")
-		return
-	}
-	defer cursor.Close(ctx)
-
-	var products []models.Product
-	if err := cursor.All(ctx, &products); err != nil {
-		utils.InternalError(c, "Failed to decode products")
-		return
-	}
+	h.applyPricing(products)
 
 	utils.SuccessResponse(c, http.StatusOK, "", products)
 }
-
@@ -0,0 +1,582 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"ejewel/internal/config"
+	"ejewel/internal/events"
+	"ejewel/internal/models"
+	"ejewel/internal/payments"
+	"ejewel/internal/repository"
+	"ejewel/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var errIllegalReturnTransition = errors.New("illegal return status transition")
+
+type ReturnHandler struct {
+	returns  repository.ReturnRepository
+	orders   repository.OrderRepository
+	products repository.ProductRepository
+	payments payments.Provider
+	events   *events.Bus
+}
+
+func NewReturnHandler(returns repository.ReturnRepository, orders repository.OrderRepository, products repository.ProductRepository, paymentProvider payments.Provider, bus *events.Bus) *ReturnHandler {
+	return &ReturnHandler{returns: returns, orders: orders, products: products, payments: paymentProvider, events: bus}
+}
+
+func (h *ReturnHandler) CreateReturn(c *gin.Context) {
+	userID, _ := c.Get("userId")
+	userRole, _ := c.Get("userRole")
+
+	var input models.CreateReturnInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	objectID, _ := primitive.ObjectIDFromHex(userID.(string))
+	orderObjectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		utils.ValidationError(c, "Invalid order ID")
+		return
+	}
+	productID, err := primitive.ObjectIDFromHex(input.ProductID)
+	if err != nil {
+		utils.ValidationError(c, "Invalid product ID")
+		return
+	}
+	var variantID primitive.ObjectID
+	if input.VariantID != "" {
+		variantID, err = primitive.ObjectIDFromHex(input.VariantID)
+		if err != nil {
+			utils.ValidationError(c, "Invalid variant ID")
+			return
+		}
+	}
+
+	order, err := h.orders.FindByID(ctx, orderObjectID)
+	if err != nil || order.UserID != objectID {
+		utils.NotFoundError(c, "Order not found")
+		return
+	}
+
+	if order.Status != models.OrderDelivered {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Only delivered orders can be returned")
+		return
+	}
+
+	window := time.Duration(config.AppConfig.ReturnWindowDays) * 24 * time.Hour
+	if time.Since(deliveredAt(order)) > window {
+		utils.ErrorResponse(c, http.StatusBadRequest, "The return window for this order has closed")
+		return
+	}
+
+	var line *models.OrderItem
+	for i := range order.Items {
+		if order.Items[i].ProductID == productID && order.Items[i].VariantID == variantID {
+			line = &order.Items[i]
+			break
+		}
+	}
+	if line == nil {
+		utils.NotFoundError(c, "Item not found in order")
+		return
+	}
+
+	// Reserve the quantity on the order line so concurrent requests cannot
+	// return more units than were delivered
+	err = h.orders.ReserveReturn(ctx, order.ID, productID, variantID, input.Quantity)
+	if errors.Is(err, repository.ErrConflict) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Quantity exceeds the returnable quantity for this item")
+		return
+	}
+	if err != nil {
+		utils.InternalError(c, "Failed to create return request")
+		return
+	}
+
+	entry := returnEntry(userID, userRole, input.Reason)
+	entry.Status = models.ReturnRequested
+	entry.Timestamp = time.Now()
+
+	photos := input.Photos
+	if photos == nil {
+		photos = []string{}
+	}
+
+	returnRequest := models.ReturnRequest{
+		ID:           primitive.NewObjectID(),
+		ReturnNumber: utils.GenerateReturnNumber(),
+		OrderID:      order.ID,
+		OrderNumber:  order.OrderNumber,
+		UserID:       objectID,
+		ProductID:    line.ProductID,
+		ProductName:  line.ProductName,
+		VariantID:    line.VariantID,
+		Size:         line.Size,
+		Quantity:     input.Quantity,
+		UnitPrice:    line.Price,
+		Reason:       input.Reason,
+		Photos:       photos,
+		Status:       models.ReturnRequested,
+		History:      []models.ReturnHistoryEntry{entry},
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+
+	err = h.returns.Create(ctx, &returnRequest)
+	if err != nil {
+		releaseReturnQuantity(ctx, h.orders, &returnRequest)
+		utils.InternalError(c, "Failed to create return request")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Return requested successfully", returnRequest)
+}
+
+func (h *ReturnHandler) GetMyReturns(c *gin.Context) {
+	userID, _ := c.Get("userId")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	objectID, _ := primitive.ObjectIDFromHex(userID.(string))
+
+	returns, err := h.returns.Find(ctx, repository.ReturnQuery{UserID: objectID})
+	if err != nil {
+		utils.InternalError(c, "Failed to fetch returns")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "", returns)
+}
+
+func (h *ReturnHandler) GetMyReturn(c *gin.Context) {
+	userID, _ := c.Get("userId")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	objectID, _ := primitive.ObjectIDFromHex(userID.(string))
+	returnID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		utils.ValidationError(c, "Invalid return ID")
+		return
+	}
+
+	returnRequest, err := h.returns.FindByID(ctx, returnID)
+	if err != nil || returnRequest.UserID != objectID {
+		utils.NotFoundError(c, "Return not found")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "", returnRequest)
+}
+
+// Admin handlers
+
+func (h *ReturnHandler) GetAllReturns(c *gin.Context) {
+	page, limit := pageParams(c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := repository.ReturnQuery{
+		Status: models.ReturnStatus(c.Query("status")),
+		Page:   repository.Page{Skip: int64((page - 1) * limit), Limit: int64(limit)},
+	}
+
+	returns, err := h.returns.Find(ctx, query)
+	if err != nil {
+		utils.InternalError(c, "Failed to fetch returns")
+		return
+	}
+
+	total, _ := h.returns.Count(ctx, query)
+
+	utils.PaginatedSuccessResponse(c, returns, page, limit, total)
+}
+
+func (h *ReturnHandler) GetReturn(c *gin.Context) {
+	returnRequest, ok := h.loadReturn(c)
+	if !ok {
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "", returnRequest)
+}
+
+func (h *ReturnHandler) ApproveReturn(c *gin.Context) {
+	var input models.ReviewReturnInput
+	c.ShouldBindJSON(&input)
+
+	h.updateReturn(c, models.ReturnApproved, input.Note, repository.Fields{"admin_note": input.Note}, "Return approved")
+}
+
+func (h *ReturnHandler) RejectReturn(c *gin.Context) {
+	var input models.ReviewReturnInput
+	c.ShouldBindJSON(&input)
+
+	h.updateReturn(c, models.ReturnRejected, input.Note, repository.Fields{"admin_note": input.Note}, "Return rejected")
+}
+
+func (h *ReturnHandler) ScheduleReturnPickup(c *gin.Context) {
+	var input models.ScheduleReturnPickupInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	returnRequest, ok := h.loadReturn(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Pick up from the address the order was delivered to
+	pickup := models.ReturnPickup{
+		ScheduledAt: input.ScheduledAt,
+		Carrier:     input.Carrier,
+		TrackingID:  input.TrackingID,
+	}
+	if order, err := h.orders.FindByID(ctx, returnRequest.OrderID); err == nil {
+		pickup.Address = order.ShippingInfo.Address
+	}
+	note := fmt.Sprintf("Pickup scheduled with %s on %s", input.Carrier, input.ScheduledAt.Format("02 Jan 2006"))
+
+	h.updateReturn(c, models.ReturnPickupScheduled, note, repository.Fields{"pickup": pickup}, "Pickup scheduled")
+}
+
+func (h *ReturnHandler) InspectReturn(c *gin.Context) {
+	userID, _ := c.Get("userId")
+	userRole, _ := c.Get("userRole")
+
+	var input models.InspectReturnInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	returnRequest, ok := h.loadReturn(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	inspectorID, _ := primitive.ObjectIDFromHex(userID.(string))
+	inspection := models.ReturnInspection{
+		Passed:      input.Passed,
+		Restocked:   input.Passed && input.Restock,
+		Notes:       input.Notes,
+		InspectedBy: inspectorID,
+		InspectedAt: time.Now(),
+	}
+
+	note := "Inspection failed"
+	if inspection.Passed {
+		note = "Inspection passed"
+	}
+	if input.Notes != "" {
+		note += ": " + input.Notes
+	}
+
+	err := transitionReturn(ctx, h.returns, returnRequest, models.ReturnInspected, returnEntry(userID, userRole, note), repository.Fields{"inspection": inspection})
+	if !h.handleTransitionError(c, err) {
+		return
+	}
+
+	// Items that passed inspection go back on the shelf
+	if inspection.Restocked {
+		releaseStock(ctx, h.products, []models.OrderItem{{
+			ProductID: returnRequest.ProductID,
+			VariantID: returnRequest.VariantID,
+			Quantity:  returnRequest.Quantity,
+		}})
+	}
+
+	h.respondWithReturn(c, ctx, returnRequest.ID, "Return inspected")
+}
+
+func (h *ReturnHandler) RefundReturn(c *gin.Context) {
+	userID, _ := c.Get("userId")
+	userRole, _ := c.Get("userRole")
+
+	var input models.RefundReturnInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	returnRequest, ok := h.loadReturn(c)
+	if !ok {
+		return
+	}
+
+	if returnRequest.Status == models.ReturnInspected && (returnRequest.Inspection == nil || !returnRequest.Inspection.Passed) && input.Amount == 0 {
+		utils.ValidationError(c, "Item failed inspection; specify the refund amount explicitly")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	order, err := h.orders.FindByID(ctx, returnRequest.OrderID)
+	if err != nil {
+		utils.NotFoundError(c, "Order not found")
+		return
+	}
+
+	amount := input.Amount
+	if amount == 0 {
+		amount = refundableShare(order, returnRequest.UnitPrice*float64(returnRequest.Quantity))
+	}
+	if amount <= 0 {
+		utils.ValidationError(c, "Nothing to refund for this return")
+		return
+	}
+
+	refund := models.ReturnRefund{Amount: amount, Provider: "manual"}
+	if order.PaymentInfo.IntentID != "" {
+		refund.Provider = h.payments.Name()
+	}
+
+	// Claim the return first so it can only be refunded once
+	note := fmt.Sprintf("Refund of %.2f issued", amount)
+	err = transitionReturn(ctx, h.returns, returnRequest, models.ReturnRefunded, returnEntry(userID, userRole, note), repository.Fields{"refund": refund})
+	if !h.handleTransitionError(c, err) {
+		return
+	}
+
+	// Never refund more than the customer paid across all returns
+	err = h.orders.AddRefund(ctx, order.ID, amount)
+	if err != nil {
+		revertRefundClaim(ctx, h.returns, returnRequest)
+		if errors.Is(err, repository.ErrConflict) {
+			utils.ValidationError(c, "Refund exceeds the amount remaining on the order")
+			return
+		}
+		utils.InternalError(c, "Failed to record refund")
+		return
+	}
+
+	// Cash on delivery refunds are paid out manually by finance
+	if refund.Provider != "manual" {
+		issued, err := h.payments.Refund(ctx, payments.RefundRequest{
+			IntentID:      order.PaymentInfo.IntentID,
+			TransactionID: order.PaymentInfo.TransactionID,
+			Amount:        amount,
+			Reason:        returnRequest.Reason,
+		})
+		if err != nil {
+			h.orders.AddRefund(ctx, order.ID, -amount)
+			revertRefundClaim(ctx, h.returns, returnRequest)
+			utils.ErrorResponse(c, http.StatusBadGateway, "Payment provider failed to issue refund")
+			return
+		}
+		refund.RefundID = issued.ID
+	}
+
+	refund.RefundedAt = time.Now()
+	h.returns.Update(ctx, returnRequest.ID, repository.Fields{"refund": refund})
+
+	// Take back the seller's earnings for the returned units
+	if err := h.events.Publish(ctx, models.EventReturnRefunded, returnRequest.ID); err != nil {
+		log.Printf("Failed to publish refund of return %s: %v", returnRequest.ReturnNumber, err)
+	}
+
+	// Reflect the refund on the order and close it once fully refunded
+	if updated, err := h.orders.FindByID(ctx, order.ID); err == nil {
+		order = updated
+	}
+	if fullyRefunded(order) {
+		err = transitionOrder(
+			ctx,
+			h.orders,
+			order.ID,
+			order.Status,
+			models.OrderRefunded,
+			systemEntry("Order fully refunded"),
+			nil,
+			repository.Fields{"payment_info.status": models.PaymentRefunded},
+		)
+		if err != nil && !errors.Is(err, errIllegalTransition) {
+			utils.InternalError(c, "Failed to update order after refund")
+			return
+		}
+	} else {
+		err = h.orders.Update(ctx, order.ID, nil, repository.Fields{"payment_info.status": models.PaymentPartiallyRefunded})
+		if err != nil {
+			utils.InternalError(c, "Failed to update order after refund")
+			return
+		}
+	}
+
+	h.respondWithReturn(c, ctx, returnRequest.ID, "Refund issued")
+}
+
+// loadReturn fetches the return named in the path, writing an error
+// response when it does not exist.
+func (h *ReturnHandler) loadReturn(c *gin.Context) (*models.ReturnRequest, bool) {
+	returnID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		utils.ValidationError(c, "Invalid return ID")
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	returnRequest, err := h.returns.FindByID(ctx, returnID)
+	if err != nil {
+		utils.NotFoundError(c, "Return not found")
+		return nil, false
+	}
+
+	return returnRequest, true
+}
+
+// updateReturn applies a simple admin transition to the return in the path.
+func (h *ReturnHandler) updateReturn(c *gin.Context, to models.ReturnStatus, note string, set repository.Fields, message string) {
+	userID, _ := c.Get("userId")
+	userRole, _ := c.Get("userRole")
+
+	returnRequest, ok := h.loadReturn(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := transitionReturn(ctx, h.returns, returnRequest, to, returnEntry(userID, userRole, note), set)
+	if !h.handleTransitionError(c, err) {
+		return
+	}
+
+	// Rejected units can be returned again in a new request
+	if to == models.ReturnRejected {
+		releaseReturnQuantity(ctx, h.orders, returnRequest)
+	}
+
+	h.respondWithReturn(c, ctx, returnRequest.ID, message)
+}
+
+// handleTransitionError writes the response for a failed transition and
+// reports whether the caller may continue.
+func (h *ReturnHandler) handleTransitionError(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, errIllegalReturnTransition):
+		utils.ErrorResponse(c, http.StatusConflict, err.Error())
+	case errors.Is(err, errStatusChanged):
+		utils.ErrorResponse(c, http.StatusConflict, "Return status changed, please retry")
+	default:
+		utils.InternalError(c, "Failed to update return")
+	}
+	return false
+}
+
+func (h *ReturnHandler) respondWithReturn(c *gin.Context, ctx context.Context, returnID primitive.ObjectID, message string) {
+	returnRequest, _ := h.returns.FindByID(ctx, returnID)
+
+	utils.SuccessResponse(c, http.StatusOK, message, returnRequest)
+}
+
+// transitionReturn moves a return to a new status if it is still in the
+// status it was loaded with, appending the change to its history.
+func transitionReturn(ctx context.Context, returns repository.ReturnRepository, returnRequest *models.ReturnRequest, to models.ReturnStatus, entry models.ReturnHistoryEntry, set repository.Fields) error {
+	from := returnRequest.Status
+	if !from.CanTransitionTo(to) {
+		return fmt.Errorf("%w: cannot change return status from %s to %s", errIllegalReturnTransition, from, to)
+	}
+
+	now := time.Now()
+	entry.Status = to
+	entry.Timestamp = now
+
+	update := repository.Fields{"updated_at": now}
+	for key, value := range set {
+		update[key] = value
+	}
+
+	err := returns.Transition(ctx, returnRequest.ID, from, to, entry, update)
+	if errors.Is(err, repository.ErrConflict) {
+		return errStatusChanged
+	}
+	return err
+}
+
+// revertRefundClaim puts a return back into the inspected state after its
+// refund could not be completed. This bypasses the transition table on
+// purpose: the refund never happened.
+func revertRefundClaim(ctx context.Context, returns repository.ReturnRepository, returnRequest *models.ReturnRequest) {
+	returns.Revert(ctx, returnRequest.ID, models.ReturnRefunded, returnRequest.Status, "refund")
+}
+
+// releaseReturnQuantity frees the units a return reserved on its order line.
+func releaseReturnQuantity(ctx context.Context, orders repository.OrderRepository, returnRequest *models.ReturnRequest) {
+	orders.ReleaseReturn(ctx, returnRequest.OrderID, returnRequest.ProductID, returnRequest.VariantID, returnRequest.Quantity)
+}
+
+// refundableShare is the part of the amount paid attributable to a line
+// value: its share of the discounted subtotal plus tax. Shipping is not
+// refunded.
+func refundableShare(order *models.Order, lineValue float64) float64 {
+	if order.Subtotal <= 0 {
+		return 0
+	}
+	paidForGoods := order.Subtotal - order.Discount + order.Tax
+	return math.Round(lineValue/order.Subtotal*paidForGoods*100) / 100
+}
+
+// fullyRefunded reports whether the returns of an order have refunded all
+// that was paid for its goods. Shipping is not refunded, and each return's
+// share is rounded to the paisa.
+func fullyRefunded(order *models.Order) bool {
+	units := 0
+	for _, item := range order.Items {
+		units += item.Quantity
+	}
+	return order.RefundedAmount >= order.Total-order.ShippingInfo.Cost-0.005*float64(units)
+}
+
+// deliveredAt returns when the order was delivered, falling back to the
+// status history and last update for orders delivered before it was stored.
+func deliveredAt(order *models.Order) time.Time {
+	if !order.DeliveredAt.IsZero() {
+		return order.DeliveredAt
+	}
+	for _, entry := range order.StatusHistory {
+		if entry.Status == models.OrderDelivered {
+			return entry.Timestamp
+		}
+	}
+	return order.UpdatedAt
+}
+
+func returnEntry(userID interface{}, role interface{}, note string) models.ReturnHistoryEntry {
+	actor := actorEntry(userID, role, note)
+	return models.ReturnHistoryEntry{
+		Note:      actor.Note,
+		ActorID:   actor.ActorID,
+		ActorRole: actor.ActorRole,
+	}
+}
@@ -5,20 +5,25 @@ import (
 	"net/http"
 	"time"
 
-	"ejewel/internal/database"
 	"ejewel/internal/models"
+	"ejewel/internal/rbac"
+	"ejewel/internal/repository"
 	"ejewel/internal/utils"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-type ReviewHandler struct{}
+type ReviewHandler struct {
+	reviews  repository.ReviewRepository
+	products repository.ProductRepository
+	users    repository.UserRepository
+	orders   repository.OrderRepository
+	roles    *rbac.Roles
+}
 
-func NewReviewHandler() *ReviewHandler {
-	return &ReviewHandler{}
+func NewReviewHandler(reviews repository.ReviewRepository, products repository.ProductRepository, users repository.UserRepository, orders repository.OrderRepository, roles *rbac.Roles) *ReviewHandler {
+	return &ReviewHandler{reviews: reviews, products: products, users: users, orders: orders, roles: roles}
 }
 
 func (h *ReviewHandler) GetProductReviews(c *gin.Context) {
@@ -33,19 +38,11 @@ func (h *ReviewHandler) GetProductReviews(c *gin.Context) {
 		return
 	}
 
-	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
-	cursor, err := database.Reviews().Find(ctx, bson.M{"product_id": productObjectID}, opts)
+	reviews, err := h.reviews.FindByProduct(ctx, productObjectID)
 	if err != nil {
 		utils.InternalError(c, "Failed to fetch reviews")
 		return
 	}
-	defer cursor.Close(ctx)
-
-	var reviews []models.Review
-	if err := cursor.All(ctx, &reviews); err != nil {
-		utils.InternalError(c, "Failed to decode reviews")
-		return
-	}
 
 	// Calculate average rating
 	var totalRating float64
@@ -58,9 +55,9 @@ func (h *ReviewHandler) GetProductReviews(c *gin.Context) {
 	}
 
 	utils.SuccessResponse(c, http.StatusOK, "", gin.H{
-		"reviews":    reviews,
-		"count":      len(reviews),
-		"avgRating":  avgRating,
+		"reviews":   reviews,
+		"count":     len(reviews),
+		"avgRating": avgRating,
 	})
 }
 
@@ -84,28 +81,30 @@ func (h *ReviewHandler) CreateReview(c *gin.Context) {
 	}
 
 	// Check if product exists
-	count, _ := database.Products().CountDocuments(ctx, bson.M{"_id": productID})
-	if count == 0 {
+	if _, err := h.products.FindByID(ctx, productID); err != nil {
 		utils.NotFoundError(c, "Product not found")
 		return
 	}
 
 	// Check if user has already reviewed
-	existingCount, _ := database.Reviews().CountDocuments(ctx, bson.M{"product_id": productID, "user_id": objectID})
-	if existingCount > 0 {
+	exists, _ := h.reviews.Exists(ctx, productID, objectID)
+	if exists {
 		utils.ErrorResponse(c, http.StatusConflict, "You have already reviewed this product")
 		return
 	}
 
 	// Get user details
-	var user models.User
-	database.Users().FindOne(ctx, bson.M{"_id": objectID}).Decode(&user)
+	user, err := h.users.FindByID(ctx, objectID)
+	if err != nil {
+		utils.NotFoundError(c, "User not found")
+		return
+	}
 
 	// Check if user has purchased this product (for verified review)
-	purchaseCount, _ := database.Orders().CountDocuments(ctx, bson.M{
-		"user_id":          objectID,
-		"items.product_id": productID,
-		"status":           models.OrderDelivered,
+	purchaseCount, _ := h.orders.Count(ctx, repository.OrderQuery{
+		UserID:    objectID,
+		ProductID: productID,
+		Statuses:  []models.OrderStatus{models.OrderDelivered},
 	})
 	isVerified := purchaseCount > 0
 
@@ -124,7 +123,7 @@ func (h *ReviewHandler) CreateReview(c *gin.Context) {
 		UpdatedAt:  time.Now(),
 	}
 
-	_, err = database.Reviews().InsertOne(ctx, review)
+	err = h.reviews.Create(ctx, &review)
 	if err != nil {
 		utils.InternalError(c, "Failed to create review")
 		return
@@ -156,14 +155,13 @@ func (h *ReviewHandler) UpdateReview(c *gin.Context) {
 		return
 	}
 
-	var review models.Review
-	err = database.Reviews().FindOne(ctx, bson.M{"_id": reviewObjectID, "user_id": objectID}).Decode(&review)
-	if err != nil {
+	review, err := h.reviews.FindByID(ctx, reviewObjectID)
+	if err != nil || review.UserID != objectID {
 		utils.NotFoundError(c, "Review not found")
 		return
 	}
 
-	update := bson.M{"updated_at": time.Now()}
+	update := repository.Fields{"updated_at": time.Now()}
 	if input.Rating > 0 {
 		update["rating"] = input.Rating
 	}
@@ -177,7 +175,7 @@ func (h *ReviewHandler) UpdateReview(c *gin.Context) {
 		update["images"] = input.Images
 	}
 
-	_, err = database.Reviews().UpdateOne(ctx, bson.M{"_id": reviewObjectID}, bson.M{"$set": update})
+	err = h.reviews.Update(ctx, reviewObjectID, update)
 	if err != nil {
 		utils.InternalError(c, "Failed to update review")
 		return
@@ -186,7 +184,7 @@ func (h *ReviewHandler) UpdateReview(c *gin.Context) {
 	// Update product rating
 	h.updateProductRating(ctx, review.ProductID)
 
-	database.Reviews().FindOne(ctx, bson.M{"_id": reviewObjectID}).Decode(&review)
+	review, _ = h.reviews.FindByID(ctx, reviewObjectID)
 
 	utils.SuccessResponse(c, http.StatusOK, "Review updated successfully", review)
 }
@@ -206,19 +204,20 @@ func (h *ReviewHandler) DeleteReview(c *gin.Context) {
 		return
 	}
 
-	filter := bson.M{"_id": reviewObjectID}
-	if userRole != models.RoleAdmin {
-		filter["user_id"] = objectID
-	}
-
-	var review models.Review
-	err = database.Reviews().FindOne(ctx, filter).Decode(&review)
+	review, err := h.reviews.FindByID(ctx, reviewObjectID)
 	if err != nil {
 		utils.NotFoundError(c, "Review not found")
 		return
 	}
+	if review.UserID != objectID {
+		role, _ := userRole.(models.Role)
+		if moderator, _ := h.roles.Allows(ctx, role, models.PermReviewsModerate); !moderator {
+			utils.NotFoundError(c, "Review not found")
+			return
+		}
+	}
 
-	_, err = database.Reviews().DeleteOne(ctx, filter)
+	err = h.reviews.Delete(ctx, reviewObjectID)
 	if err != nil {
 		utils.InternalError(c, "Failed to delete review")
 		return
@@ -231,14 +230,10 @@ func (h *ReviewHandler) DeleteReview(c *gin.Context) {
 }
 
 func (h *ReviewHandler) updateProductRating(ctx context.Context, productID primitive.ObjectID) {
-	cursor, err := database.Reviews().Find(ctx, bson.M{"product_id": productID})
+	reviews, err := h.reviews.FindByProduct(ctx, productID)
 	if err != nil {
 		return
 	}
-	defer cursor.Close(ctx)
-
-	var reviews []models.Review
-	cursor.All(ctx, &reviews)
 
 	var totalRating float64
 	for _, review := range reviews {
@@ -250,13 +245,8 @@ func (h *ReviewHandler) updateProductRating(ctx context.Context, productID primi
 		avgRating = totalRating / float64(len(reviews))
 	}
 
-	database.Products().UpdateOne(
-		ctx,
-		bson.M{"_id": productID},
-		bson.M{"$set": bson.M{
-			"rating":       avgRating,
-			"review_count": len(reviews),
-		}},
-	)
+	h.products.Update(ctx, productID, repository.Fields{
+		"rating":       avgRating,
+		"review_count": len(reviews),
+	})
 }
-
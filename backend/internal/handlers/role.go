@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"ejewel/internal/models"
+	"ejewel/internal/rbac"
+	"ejewel/internal/repository"
+	"ejewel/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,31}$`)
+
+type RoleHandler struct {
+	roles repository.RoleRepository
+	users repository.UserRepository
+	rbac  *rbac.Roles
+}
+
+func NewRoleHandler(roles repository.RoleRepository, users repository.UserRepository, rbacRoles *rbac.Roles) *RoleHandler {
+	return &RoleHandler{roles: roles, users: users, rbac: rbacRoles}
+}
+
+func (h *RoleHandler) GetRoles(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	roles, err := h.roles.FindAll(ctx)
+	if err != nil {
+		utils.InternalError(c, "Failed to fetch roles")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "", gin.H{
+		"roles":       roles,
+		"permissions": models.Permissions,
+	})
+}
+
+func (h *RoleHandler) CreateRole(c *gin.Context) {
+	var input models.CreateRoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	name := models.Role(input.Name)
+	if !roleNamePattern.MatchString(input.Name) || !name.IsStaff() {
+		utils.ValidationError(c, "Role names are 2-32 lowercase letters, digits or underscores and cannot be customer or seller")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if !h.checkPermissions(ctx, c, input.Permissions) {
+		return
+	}
+
+	role := models.RoleDefinition{
+		ID:          primitive.NewObjectID(),
+		Name:        name,
+		Description: input.Description,
+		Permissions: input.Permissions,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+
+	err := h.roles.Create(ctx, &role)
+	if err == repository.ErrDuplicate {
+		utils.ErrorResponse(c, http.StatusConflict, "A role with this name already exists")
+		return
+	}
+	if err != nil {
+		utils.InternalError(c, "Failed to create role")
+		return
+	}
+	h.rbac.Invalidate()
+
+	utils.SuccessResponse(c, http.StatusCreated, "Role created successfully", role)
+}
+
+func (h *RoleHandler) UpdateRole(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		utils.ValidationError(c, "Invalid role ID")
+		return
+	}
+
+	var input models.UpdateRoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	role, err := h.roles.FindByID(ctx, objectID)
+	if err != nil {
+		utils.NotFoundError(c, "Role not found")
+		return
+	}
+	if role.IsSystem {
+		utils.ForbiddenError(c, "Built-in roles cannot be changed")
+		return
+	}
+	// Removing permissions is as sensitive as granting them
+	if !h.checkPermissions(ctx, c, append(input.Permissions, role.Permissions...)) {
+		return
+	}
+
+	err = h.roles.Update(ctx, objectID, repository.Fields{
+		"description": input.Description,
+		"permissions": input.Permissions,
+		"updated_at":  time.Now(),
+	})
+	if err == repository.ErrNotFound {
+		utils.NotFoundError(c, "Role not found")
+		return
+	}
+	if err != nil {
+		utils.InternalError(c, "Failed to update role")
+		return
+	}
+	h.rbac.Invalidate()
+
+	role, _ = h.roles.FindByID(ctx, objectID)
+
+	utils.SuccessResponse(c, http.StatusOK, "Role updated successfully", role)
+}
+
+func (h *RoleHandler) DeleteRole(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		utils.ValidationError(c, "Invalid role ID")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	role, err := h.roles.FindByID(ctx, objectID)
+	if err != nil {
+		utils.NotFoundError(c, "Role not found")
+		return
+	}
+	if role.IsSystem {
+		utils.ForbiddenError(c, "Built-in roles cannot be deleted")
+		return
+	}
+	if !h.checkPermissions(ctx, c, role.Permissions) {
+		return
+	}
+
+	holders, err := h.users.Count(ctx, repository.UserQuery{Role: role.Name})
+	if err != nil {
+		utils.InternalError(c, "Failed to delete role")
+		return
+	}
+	if holders > 0 {
+		utils.ErrorResponse(c, http.StatusConflict, "Cannot delete a role that is assigned to users")
+		return
+	}
+
+	err = h.roles.Delete(ctx, objectID)
+	if err == repository.ErrNotFound {
+		utils.NotFoundError(c, "Role not found")
+		return
+	}
+	if err != nil {
+		utils.InternalError(c, "Failed to delete role")
+		return
+	}
+	h.rbac.Invalidate()
+
+	utils.SuccessResponse(c, http.StatusOK, "Role deleted successfully", nil)
+}
+
+// checkPermissions validates permissions and makes sure the caller holds
+// each of them, so roles cannot be used to gain access. It writes the error
+// response and returns false when they do not pass.
+func (h *RoleHandler) checkPermissions(ctx context.Context, c *gin.Context, permissions []models.Permission) bool {
+	return holdsPermissions(ctx, c, h.rbac, permissions, "You cannot manage roles with permission %q")
+}
+
+// holdsPermissions validates permissions and checks that the caller's role
+// grants each of them. Otherwise it writes the error response, using denied
+// as the format of the message for a permission the caller lacks, and
+// returns false.
+func holdsPermissions(ctx context.Context, c *gin.Context, roles *rbac.Roles, permissions []models.Permission, denied string) bool {
+	userRole, _ := c.Get("userRole")
+	holder, _ := userRole.(models.Role)
+
+	for _, p := range permissions {
+		if !p.Valid() {
+			utils.ValidationError(c, fmt.Sprintf("Unknown permission %q", p))
+			return false
+		}
+		allowed, err := roles.Allows(ctx, holder, p)
+		if err != nil {
+			utils.InternalError(c, "Failed to check permissions")
+			return false
+		}
+		if !allowed {
+			utils.ForbiddenError(c, fmt.Sprintf(denied, p))
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,1135 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ejewel/internal/config"
+	"ejewel/internal/events"
+	"ejewel/internal/invoice"
+	"ejewel/internal/ledger"
+	"ejewel/internal/mailer"
+	"ejewel/internal/models"
+	"ejewel/internal/payments"
+	"ejewel/internal/pricing"
+	"ejewel/internal/repository"
+	"ejewel/internal/repository/memory"
+	"ejewel/internal/revocation"
+	"ejewel/internal/search"
+	"ejewel/internal/shipping"
+	"ejewel/internal/totp"
+	"ejewel/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// testServer routes requests to the handlers over in-memory repositories.
+// Requests are signed in as the user named in the X-Test-User header.
+type testServer struct {
+	t        *testing.T
+	repos    repository.Repositories
+	bus      *events.Bus
+	search   *search.Index
+	provider *testProvider
+	auth     *AuthHandler
+	router   *gin.Engine
+}
+
+// testProvider is the mock gateway with its refunds recorded. Refunds fail
+// while fail is set.
+type testProvider struct {
+	*payments.MockProvider
+	refunds []payments.RefundRequest
+	fail    bool
+}
+
+func (p *testProvider) Refund(ctx context.Context, req payments.RefundRequest) (*payments.Refund, error) {
+	if p.fail {
+		return nil, errors.New("gateway unavailable")
+	}
+	p.refunds = append(p.refunds, req)
+	return p.MockProvider.Refund(ctx, req)
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	config.AppConfig = &config.Config{
+		ReturnWindowDays: 7,
+		SellerState:      "Maharashtra",
+		SellerName:       "eJewel",
+		JWTSecret:        "test-secret",
+		JWTExpiry:        15 * time.Minute,
+		RefreshTokenTTL:  24 * time.Hour,
+	}
+
+	repos := memory.NewRepositories()
+	ctx := context.Background()
+	for _, zone := range shipping.DefaultZones() {
+		zone.ID = primitive.NewObjectID()
+		if err := repos.Zones.Create(ctx, &zone); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	engine := pricing.NewEngine(nil, repos.MetalRates, repos.Products)
+	provider := &testProvider{MockProvider: payments.NewMockProvider("test-webhook-secret", time.Hour)}
+	sellerLedger := ledger.New(repos.Ledger, repos.Commissions, repos.Payouts, repos.Sellers, repos.Products)
+	bus := events.NewBus(repos.Events, 3)
+	events.PostLedger(bus, repos, sellerLedger)
+	searchIndex := search.NewIndex(repos.Products, nil)
+
+	authHandler := NewAuthHandler(repos.Users, repos.Sessions, revocation.NewList(repos.Users, repos.Revocations, 0, 0), repos.Carts, repos.Products, engine, mailer.NewFileMailer(t.TempDir()+"/mail.log"), bus)
+	cartHandler := NewCartHandler(repos.Carts, repos.Products, repos.Coupons, repos.Zones, engine)
+	orderHandler := NewOrderHandler(repos.Orders, repos.Carts, repos.Products, repos.Users, repos.Sellers, repos.Coupons, repos.Zones, repos.Counters, engine, provider, bus)
+	couponHandler := NewCouponHandler(repos.Coupons)
+	returnHandler := NewReturnHandler(repos.Returns, repos.Orders, repos.Products, provider, bus)
+	shippingHandler := NewShippingHandler(repos.Zones, repos.Carts, repos.Products, engine)
+	categoryHandler := NewCategoryHandler(repos.Categories, repos.Products, searchIndex, bus)
+	paymentHandler := NewPaymentHandler(repos.Orders, repos.Products, repos.Coupons, repos.Counters, provider, bus)
+	ledgerHandler := NewLedgerHandler(sellerLedger, repos.Ledger, repos.Commissions, repos.Payouts, repos.Sellers)
+
+	router := gin.New()
+	api := router.Group("/api", func(c *gin.Context) {
+		if id := c.GetHeader("X-Test-User"); id != "" {
+			c.Set("userId", id)
+			c.Set("userRole", c.GetHeader("X-Test-Role"))
+		}
+	})
+	api.POST("/auth/login", authHandler.Login)
+	api.POST("/auth/refresh", authHandler.RefreshToken)
+	api.POST("/cart", cartHandler.AddToCart)
+	api.POST("/cart/apply-coupon", cartHandler.ApplyCoupon)
+	api.GET("/shipping/quote", shippingHandler.Quote)
+	api.PUT("/admin/shipping/zones/:id", shippingHandler.UpdateZone)
+	api.POST("/orders", orderHandler.CreateOrder)
+	api.GET("/orders/:id/invoice", orderHandler.GetInvoice)
+	api.POST("/orders/:id/cancel", orderHandler.CancelOrder)
+	api.POST("/payments/webhook", paymentHandler.Webhook)
+	api.POST("/orders/:id/returns", returnHandler.CreateReturn)
+	api.GET("/returns", returnHandler.GetMyReturns)
+	api.GET("/admin/returns", returnHandler.GetAllReturns)
+	api.PUT("/admin/returns/:id/approve", returnHandler.ApproveReturn)
+	api.POST("/admin/returns/:id/refund", returnHandler.RefundReturn)
+	api.POST("/admin/coupons", couponHandler.CreateCoupon)
+	api.PUT("/admin/coupons/:id", couponHandler.UpdateCoupon)
+	api.DELETE("/admin/coupons/:id", couponHandler.DeleteCoupon)
+	api.PUT("/admin/orders/:id/status", orderHandler.UpdateOrderStatus)
+	api.GET("/admin/sellers/:id/statement", ledgerHandler.GetStatement)
+	api.DELETE("/admin/categories/:id", categoryHandler.DeleteCategory)
+
+	return &testServer{t: t, repos: repos, bus: bus, search: searchIndex, provider: provider, auth: authHandler, router: router}
+}
+
+// customer stores a signed up customer with a Mumbai address.
+func (s *testServer) customer() *models.User {
+	s.t.Helper()
+	user := &models.User{
+		ID:        primitive.NewObjectID(),
+		Email:     primitive.NewObjectID().Hex() + "@example.com",
+		FirstName: "Asha",
+		LastName:  "Rao",
+		Role:      models.RoleCustomer,
+		Addresses: []models.Address{{
+			ID:      primitive.NewObjectID(),
+			Street:  "12 Marine Drive",
+			City:    "Mumbai",
+			State:   "Maharashtra",
+			Country: "India",
+			ZipCode: "400020",
+		}},
+		IsActive:  true,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if err := s.repos.Users.Create(context.Background(), user); err != nil {
+		s.t.Fatal(err)
+	}
+	return user
+}
+
+// product stores an active fixed price product.
+func (s *testServer) product(price float64, stock int) *models.Product {
+	s.t.Helper()
+	product := &models.Product{
+		ID:        primitive.NewObjectID(),
+		Name:      "Gold Stud Earrings",
+		Slug:      primitive.NewObjectID().Hex(),
+		MetalType: models.MetalGold,
+		Purity:    "22K",
+		BasePrice: price,
+		Stock:     stock,
+		IsActive:  true,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if err := s.repos.Products.Create(context.Background(), product); err != nil {
+		s.t.Fatal(err)
+	}
+	return product
+}
+
+// do sends a JSON request as the user, or signed out when user is nil, and
+// decodes the data of the response into out.
+func (s *testServer) do(method, path string, user *models.User, body, out interface{}) int {
+	s.t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			s.t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &payload)
+	req.Header.Set("Content-Type", "application/json")
+	if user != nil {
+		req.Header.Set("X-Test-User", user.ID.Hex())
+		req.Header.Set("X-Test-Role", string(user.Role))
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+
+	if out != nil {
+		var envelope struct {
+			Data  json.RawMessage `json:"data"`
+			Error string          `json:"error"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil {
+			s.t.Fatalf("%s %s: decoding %q: %v", method, path, rec.Body.String(), err)
+		}
+		if len(envelope.Data) > 0 {
+			if err := json.Unmarshal(envelope.Data, out); err != nil {
+				s.t.Fatalf("%s %s: decoding data: %v", method, path, err)
+			}
+		}
+	}
+	return rec.Code
+}
+
+func (s *testServer) addToCart(user *models.User, product *models.Product, quantity int) {
+	s.t.Helper()
+	code := s.do(http.MethodPost, "/api/cart", user, models.AddToCartInput{ProductID: product.ID.Hex(), Quantity: quantity}, nil)
+	if code != http.StatusOK && code != http.StatusCreated {
+		s.t.Fatalf("add to cart: status %d", code)
+	}
+}
+
+// prepaidOrder checks out a card paid order for one unit of product.
+func (s *testServer) prepaidOrder(user *models.User, product *models.Product) *models.Order {
+	s.t.Helper()
+	s.addToCart(user, product, 1)
+	var order models.Order
+	code := s.do(http.MethodPost, "/api/orders", user, models.CreateOrderInput{
+		AddressID:     user.Addresses[0].ID.Hex(),
+		PaymentMethod: models.PaymentCard,
+	}, &order)
+	if code != http.StatusCreated {
+		s.t.Fatalf("create prepaid order: status %d", code)
+	}
+	return &order
+}
+
+// paymentEvent delivers a signed gateway webhook for the order's payment.
+func (s *testServer) paymentEvent(eventType payments.EventType, order *models.Order) int {
+	s.t.Helper()
+	payload, signature, err := s.provider.SignedEvent(eventType, order.PaymentInfo.IntentID, "")
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/payments/webhook", bytes.NewReader(payload))
+	req.Header.Set(payments.SignatureHeader, signature)
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+// reload fetches the stored order.
+func (s *testServer) reload(order *models.Order) *models.Order {
+	s.t.Helper()
+	stored, err := s.repos.Orders.FindByID(context.Background(), order.ID)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return stored
+}
+
+func TestCreateOrderReservesStockAndInvoices(t *testing.T) {
+	s := newTestServer(t)
+	user := s.customer()
+	product := s.product(10000, 3)
+	s.addToCart(user, product, 2)
+
+	var order models.Order
+	code := s.do(http.MethodPost, "/api/orders", user, models.CreateOrderInput{
+		AddressID:     user.Addresses[0].ID.Hex(),
+		PaymentMethod: models.PaymentCOD,
+	}, &order)
+	if code != http.StatusCreated {
+		t.Fatalf("create order: status %d", code)
+	}
+
+	if order.Status != models.OrderConfirmed {
+		t.Errorf("status = %s, want confirmed", order.Status)
+	}
+	if order.Subtotal != 20000 {
+		t.Errorf("subtotal = %v, want 20000", order.Subtotal)
+	}
+	if order.ShippingInfo.Cost != 0 {
+		t.Errorf("shipping = %v, want free above the threshold", order.ShippingInfo.Cost)
+	}
+	if order.Invoice == nil || order.Invoice.Number == "" {
+		t.Fatal("confirmed order was not invoiced")
+	}
+
+	stored, err := s.repos.Products.FindByID(context.Background(), product.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Stock != 1 {
+		t.Errorf("stock = %d, want 1", stored.Stock)
+	}
+
+	// A second order is numbered after the first
+	s.addToCart(user, product, 1)
+	var second models.Order
+	if code := s.do(http.MethodPost, "/api/orders", user, models.CreateOrderInput{
+		AddressID:     user.Addresses[0].ID.Hex(),
+		PaymentMethod: models.PaymentCOD,
+	}, &second); code != http.StatusCreated {
+		t.Fatalf("second order: status %d", code)
+	}
+	if second.Invoice == nil || second.Invoice.Number <= order.Invoice.Number {
+		t.Errorf("second invoice %v does not follow %s", second.Invoice, order.Invoice.Number)
+	}
+}
+
+func TestCreateOrderRefusesOversoldLines(t *testing.T) {
+	s := newTestServer(t)
+	user := s.customer()
+	product := s.product(5000, 2)
+	s.addToCart(user, product, 2)
+
+	// Someone else buys the last units first
+	if _, err := s.repos.Products.ReserveStock(context.Background(), product.ID, primitive.NilObjectID, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	code := s.do(http.MethodPost, "/api/orders", user, models.CreateOrderInput{
+		AddressID:     user.Addresses[0].ID.Hex(),
+		PaymentMethod: models.PaymentCOD,
+	}, nil)
+	if code == http.StatusCreated {
+		t.Fatal("order placed for more units than are in stock")
+	}
+}
+
+func TestCouponPerUserLimit(t *testing.T) {
+	s := newTestServer(t)
+	admin := &models.User{ID: primitive.NewObjectID(), Role: models.RoleAdmin}
+	user := s.customer()
+	product := s.product(2000, 10)
+
+	var coupon models.Coupon
+	code := s.do(http.MethodPost, "/api/admin/coupons", admin, models.CreateCouponInput{
+		Code:         "festive10",
+		Type:         models.CouponPercentage,
+		Value:        10,
+		PerUserLimit: 1,
+	}, &coupon)
+	if code != http.StatusCreated {
+		t.Fatalf("create coupon: status %d", code)
+	}
+	if code := s.do(http.MethodPost, "/api/admin/coupons", admin, models.CreateCouponInput{
+		Code:  "FESTIVE10",
+		Type:  models.CouponFlat,
+		Value: 100,
+	}, nil); code != http.StatusConflict {
+		t.Errorf("duplicate coupon code: status %d, want 409", code)
+	}
+
+	checkout := func() (models.Order, int) {
+		s.addToCart(user, product, 1)
+		var order models.Order
+		code := s.do(http.MethodPost, "/api/orders", user, models.CreateOrderInput{
+			AddressID:     user.Addresses[0].ID.Hex(),
+			PaymentMethod: models.PaymentCOD,
+			CouponCode:    "FESTIVE10",
+		}, &order)
+		return order, code
+	}
+
+	order, code := checkout()
+	if code != http.StatusCreated {
+		t.Fatalf("first order with coupon: status %d", code)
+	}
+	if order.Discount != 200 {
+		t.Errorf("discount = %v, want 200", order.Discount)
+	}
+	if _, code := checkout(); code != http.StatusBadRequest {
+		t.Errorf("second order with coupon: status %d, want 400", code)
+	}
+
+	// Deactivating only touches is_active
+	active := false
+	var updated models.Coupon
+	if code := s.do(http.MethodPut, "/api/admin/coupons/"+coupon.ID.Hex(), admin, models.UpdateCouponInput{IsActive: &active}, &updated); code != http.StatusOK {
+		t.Fatalf("update coupon: status %d", code)
+	}
+	if updated.IsActive || updated.PerUserLimit != 1 || updated.Value != 10 {
+		t.Errorf("updated coupon = %+v", updated)
+	}
+
+	if code := s.do(http.MethodDelete, "/api/admin/coupons/"+coupon.ID.Hex(), admin, nil, nil); code != http.StatusOK {
+		t.Errorf("delete coupon: status %d", code)
+	}
+	if code := s.do(http.MethodDelete, "/api/admin/coupons/"+coupon.ID.Hex(), admin, nil, nil); code != http.StatusNotFound {
+		t.Errorf("delete missing coupon: status %d, want 404", code)
+	}
+}
+
+func TestShippingQuoteUsesZones(t *testing.T) {
+	s := newTestServer(t)
+
+	var quote models.ShippingQuote
+	if code := s.do(http.MethodGet, "/api/shipping/quote?pincode=560001", nil, nil, &quote); code != http.StatusOK {
+		t.Fatalf("quote: status %d", code)
+	}
+	if quote.Zone != "Metro" || len(quote.Options) == 0 {
+		t.Errorf("quote = %+v", quote)
+	}
+
+	if code := s.do(http.MethodGet, "/api/shipping/quote?pincode=12", nil, nil, nil); code != http.StatusBadRequest {
+		t.Errorf("invalid pincode: status %d, want 400", code)
+	}
+}
+
+func TestReturnFlow(t *testing.T) {
+	s := newTestServer(t)
+	admin := &models.User{ID: primitive.NewObjectID(), Role: models.RoleAdmin}
+	user := s.customer()
+	product := s.product(8000, 5)
+	s.addToCart(user, product, 2)
+
+	var order models.Order
+	if code := s.do(http.MethodPost, "/api/orders", user, models.CreateOrderInput{
+		AddressID:     user.Addresses[0].ID.Hex(),
+		PaymentMethod: models.PaymentCOD,
+	}, &order); code != http.StatusCreated {
+		t.Fatalf("create order: status %d", code)
+	}
+
+	returnPath := "/api/orders/" + order.ID.Hex() + "/returns"
+	input := models.CreateReturnInput{ProductID: product.ID.Hex(), Quantity: 1, Reason: "Too small"}
+	if code := s.do(http.MethodPost, returnPath, user, input, nil); code != http.StatusBadRequest {
+		t.Fatalf("return before delivery: status %d, want 400", code)
+	}
+
+	err := s.repos.Orders.Update(context.Background(), order.ID, nil, repository.Fields{
+		"status":       models.OrderDelivered,
+		"delivered_at": time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var returnRequest models.ReturnRequest
+	if code := s.do(http.MethodPost, returnPath, user, input, &returnRequest); code != http.StatusCreated {
+		t.Fatalf("create return: status %d", code)
+	}
+	input.Quantity = 2
+	if code := s.do(http.MethodPost, returnPath, user, input, nil); code != http.StatusBadRequest {
+		t.Errorf("returning more than delivered: status %d, want 400", code)
+	}
+
+	var approved models.ReturnRequest
+	path := "/api/admin/returns/" + returnRequest.ID.Hex() + "/approve"
+	if code := s.do(http.MethodPut, path, admin, models.ReviewReturnInput{Note: "ok"}, &approved); code != http.StatusOK {
+		t.Fatalf("approve return: status %d", code)
+	}
+	if approved.Status != models.ReturnApproved || len(approved.History) != 2 {
+		t.Errorf("approved return = %+v", approved)
+	}
+	if code := s.do(http.MethodPut, path, admin, models.ReviewReturnInput{}, nil); code != http.StatusConflict {
+		t.Errorf("approving twice: status %d, want 409", code)
+	}
+
+	var mine []models.ReturnRequest
+	if code := s.do(http.MethodGet, "/api/returns", user, nil, &mine); code != http.StatusOK || len(mine) != 1 {
+		t.Errorf("my returns: status %d, %d returns", code, len(mine))
+	}
+	var all []models.ReturnRequest
+	if code := s.do(http.MethodGet, "/api/admin/returns?status=approved", admin, nil, &all); code != http.StatusOK || len(all) != 1 {
+		t.Errorf("approved returns: status %d, %d returns", code, len(all))
+	}
+}
+
+func TestGetAllReturnsPaginates(t *testing.T) {
+	s := newTestServer(t)
+	admin := &models.User{ID: primitive.NewObjectID(), Role: models.RoleAdmin}
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 25; i++ {
+		err := s.repos.Returns.Create(ctx, &models.ReturnRequest{
+			ID:        primitive.NewObjectID(),
+			Status:    models.ReturnRequested,
+			CreatedAt: start.Add(time.Duration(i) * time.Minute),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/returns?page=3&limit=10", nil)
+	req.Header.Set("X-Test-User", admin.ID.Hex())
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+
+	var page struct {
+		Data  []models.ReturnRequest `json:"data"`
+		Page  int                    `json:"page"`
+		Limit int                    `json:"limit"`
+		Total int64                  `json:"total"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	if page.Page != 3 || page.Limit != 10 || page.Total != 25 || len(page.Data) != 5 {
+		t.Errorf("page %d, limit %d, total %d, %d returns; want 3, 10, 25, 5", page.Page, page.Limit, page.Total, len(page.Data))
+	}
+}
+
+func TestUnpricedProductsCannotBeBought(t *testing.T) {
+	s := newTestServer(t)
+	user := s.customer()
+
+	// Rate priced, but no rate is known for its metal and purity
+	product := s.product(0, 5)
+	if err := s.repos.Products.Update(context.Background(), product.ID, repository.Fields{"net_weight": 4.5}); err != nil {
+		t.Fatal(err)
+	}
+	code := s.do(http.MethodPost, "/api/cart", user, models.AddToCartInput{ProductID: product.ID.Hex(), Quantity: 1}, nil)
+	if code != http.StatusBadRequest {
+		t.Fatalf("add unpriced product to cart: status %d, want 400", code)
+	}
+
+	// A line whose price is lost after it was added is not sold for nothing
+	priced := s.product(3000, 5)
+	s.addToCart(user, priced, 1)
+	if err := s.repos.Products.Update(context.Background(), priced.ID, repository.Fields{"base_price": 0.0, "discount_price": 0.0}); err != nil {
+		t.Fatal(err)
+	}
+	code = s.do(http.MethodPost, "/api/orders", user, models.CreateOrderInput{
+		AddressID:     user.Addresses[0].ID.Hex(),
+		PaymentMethod: models.PaymentCOD,
+	}, nil)
+	if code != http.StatusConflict {
+		t.Errorf("checkout with an unpriced line: status %d, want 409", code)
+	}
+}
+
+func TestDeliveryIsPostedToTheLedger(t *testing.T) {
+	s := newTestServer(t)
+	admin := &models.User{ID: primitive.NewObjectID(), Role: models.RoleAdmin}
+	ctx := context.Background()
+
+	sellerID := primitive.NewObjectID()
+	order := &models.Order{
+		ID:          primitive.NewObjectID(),
+		OrderNumber: "ORD-LEDGER",
+		Items: []models.OrderItem{{
+			ProductID:  primitive.NewObjectID(),
+			SellerID:   sellerID,
+			Quantity:   1,
+			Price:      10000,
+			TotalPrice: 10000,
+		}},
+		Subtotal:    10000,
+		Total:       10000,
+		Status:      models.OrderShipped,
+		Fulfilments: []models.Fulfilment{{SellerID: sellerID, Status: models.OrderShipped}},
+		CreatedAt:   time.Now(),
+	}
+	if err := s.repos.Orders.Create(ctx, order); err != nil {
+		t.Fatal(err)
+	}
+
+	code := s.do(http.MethodPut, "/api/admin/orders/"+order.ID.Hex()+"/status", admin, models.UpdateOrderStatusInput{Status: models.OrderDelivered}, nil)
+	if code != http.StatusOK {
+		t.Fatalf("mark delivered: status %d", code)
+	}
+
+	// The sale is posted by the event worker, and posting it again adds
+	// nothing
+	for i := 0; i < 2; i++ {
+		if err := s.bus.Publish(ctx, models.EventOrderDelivered, order.ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.bus.RunDue(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := s.repos.Ledger.Find(ctx, repository.LedgerQuery{SellerID: sellerID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Type != models.LedgerSale || entries[0].Gross != 10000 {
+		t.Errorf("ledger entries = %+v, want one sale of 10000", entries)
+	}
+}
+
+func TestStatementIncludesTheLastDay(t *testing.T) {
+	s := newTestServer(t)
+	admin := &models.User{ID: primitive.NewObjectID(), Role: models.RoleAdmin}
+	ctx := context.Background()
+
+	seller := &models.Seller{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID(), StoreName: "Kundan House"}
+	if err := s.repos.Sellers.Create(ctx, seller); err != nil {
+		t.Fatal(err)
+	}
+	for _, day := range []int{1, 31} {
+		entry := &models.LedgerEntry{
+			ID:          primitive.NewObjectID(),
+			Key:         primitive.NewObjectID().Hex(),
+			SellerID:    seller.UserID,
+			Type:        models.LedgerSale,
+			OrderNumber: "ORD-" + time.Date(2024, 1, day, 0, 0, 0, 0, time.UTC).Format("0102"),
+			Quantity:    1,
+			CreatedAt:   time.Date(2024, 1, day, 15, 30, 0, 0, time.UTC),
+		}
+		if err := s.repos.Ledger.Record(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/sellers/"+seller.ID.Hex()+"/statement?from=2024-01-01&to=2024-01-31", nil)
+	req.Header.Set("X-Test-User", admin.ID.Hex())
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("statement: status %d", rec.Code)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "ORD-0101") || !strings.Contains(body, "ORD-0131") {
+		t.Errorf("statement misses entries of the first or last day:\n%s", body)
+	}
+	if !strings.Contains(rec.Header().Get("Content-Disposition"), "20240101-20240131") {
+		t.Errorf("filename = %s", rec.Header().Get("Content-Disposition"))
+	}
+}
+
+func TestReparentedProductsAreReindexed(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	admin := &models.User{ID: primitive.NewObjectID(), Role: models.RoleAdmin}
+
+	parent := &models.Category{ID: primitive.NewObjectID(), Name: "Necklaces", Slug: "necklaces", IsActive: true}
+	child := &models.Category{ID: primitive.NewObjectID(), Name: "Chokers", Slug: "chokers", ParentID: parent.ID, IsActive: true}
+	for _, category := range []*models.Category{parent, child} {
+		if err := s.repos.Categories.Create(ctx, category); err != nil {
+			t.Fatal(err)
+		}
+	}
+	product := s.product(10000, 1)
+	if err := s.repos.Products.Update(ctx, product.ID, repository.Fields{"category_id": child.ID, "category_name": child.Name}); err != nil {
+		t.Fatal(err)
+	}
+	product.CategoryID, product.CategoryName = child.ID, child.Name
+	s.search.Put(product)
+
+	code := s.do(http.MethodDelete, "/api/admin/categories/"+child.ID.Hex()+"?cascade=reparent", admin, nil, nil)
+	if code != http.StatusOK {
+		t.Fatalf("delete category: status %d", code)
+	}
+
+	hits := s.search.Search("necklaces", 10)
+	if len(hits) != 1 || hits[0].ID != product.ID {
+		t.Errorf("search for the parent category = %v, want the moved product", hits)
+	}
+	if hits := s.search.Search("chokers", 10); len(hits) != 0 {
+		t.Errorf("search for the deleted category = %v, want nothing", hits)
+	}
+}
+
+func TestPaymentCapturedAfterExpiryIsRefunded(t *testing.T) {
+	s := newTestServer(t)
+	user := s.customer()
+	order := s.prepaidOrder(user, s.product(5000, 2))
+
+	if code := s.paymentEvent(payments.EventExpired, order); code != http.StatusOK {
+		t.Fatalf("expire payment: status %d", code)
+	}
+	// The customer paid just as the window closed, and the gateway
+	// delivers the capture twice
+	for i := 0; i < 2; i++ {
+		if code := s.paymentEvent(payments.EventCaptured, order); code != http.StatusOK {
+			t.Fatalf("capture payment: status %d", code)
+		}
+	}
+
+	stored := s.reload(order)
+	if stored.Status != models.OrderRefunded || stored.PaymentInfo.Status != models.PaymentRefunded || stored.PaymentInfo.RefundID == "" {
+		t.Errorf("order %s, payment %s, refund %q; want refunded", stored.Status, stored.PaymentInfo.Status, stored.PaymentInfo.RefundID)
+	}
+	if len(s.provider.refunds) != 1 || s.provider.refunds[0].Amount != order.Total {
+		t.Errorf("refunds = %+v, want one of %.2f", s.provider.refunds, order.Total)
+	}
+}
+
+func TestPaymentCapturedAfterCancellationIsRefunded(t *testing.T) {
+	s := newTestServer(t)
+	user := s.customer()
+	order := s.prepaidOrder(user, s.product(5000, 2))
+
+	err := transitionOrder(context.Background(), s.repos.Orders, order.ID, models.OrderPending, models.OrderCancelled, systemEntry("Cancelled by customer"), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A failing gateway leaves the refund owed, and the redelivered event
+	// pays it
+	s.provider.fail = true
+	if code := s.paymentEvent(payments.EventCaptured, order); code != http.StatusInternalServerError {
+		t.Fatalf("capture with the gateway down: status %d, want 500", code)
+	}
+	if stored := s.reload(order); stored.Status != models.OrderCancelled || stored.PaymentInfo.Status != models.PaymentNeedsRefund || stored.RefundedAmount != 0 {
+		t.Errorf("order %s, payment %s, refunded %.2f; want cancelled, needs_refund, 0", stored.Status, stored.PaymentInfo.Status, stored.RefundedAmount)
+	}
+
+	s.provider.fail = false
+	if code := s.paymentEvent(payments.EventCaptured, order); code != http.StatusOK {
+		t.Fatalf("redelivered capture: status %d", code)
+	}
+	stored := s.reload(order)
+	if stored.Status != models.OrderRefunded || stored.PaymentInfo.Status != models.PaymentRefunded || stored.RefundedAmount != order.Total {
+		t.Errorf("order %s, payment %s, refunded %.2f; want refunded in full", stored.Status, stored.PaymentInfo.Status, stored.RefundedAmount)
+	}
+	if len(s.provider.refunds) != 1 {
+		t.Errorf("%d refunds, want 1", len(s.provider.refunds))
+	}
+}
+
+func TestReplayedCaptureIsNotRefunded(t *testing.T) {
+	s := newTestServer(t)
+	user := s.customer()
+	order := s.prepaidOrder(user, s.product(5000, 2))
+
+	for i := 0; i < 2; i++ {
+		if code := s.paymentEvent(payments.EventCaptured, order); code != http.StatusOK {
+			t.Fatalf("capture payment: status %d", code)
+		}
+	}
+	if stored := s.reload(order); stored.Status != models.OrderConfirmed || stored.PaymentInfo.Status != models.PaymentCompleted {
+		t.Errorf("order %s, payment %s; want confirmed and completed", stored.Status, stored.PaymentInfo.Status)
+	}
+	if len(s.provider.refunds) != 0 {
+		t.Errorf("refunds = %+v, want none", s.provider.refunds)
+	}
+}
+
+func TestCancellingPaidOrderRefundsIt(t *testing.T) {
+	s := newTestServer(t)
+	user := s.customer()
+	order := s.prepaidOrder(user, s.product(5000, 2))
+	if code := s.paymentEvent(payments.EventCaptured, order); code != http.StatusOK {
+		t.Fatalf("capture payment: status %d", code)
+	}
+
+	if code := s.do(http.MethodPost, "/api/orders/"+order.ID.Hex()+"/cancel", user, gin.H{"reason": "Ordered twice"}, nil); code != http.StatusOK {
+		t.Fatalf("cancel order: status %d", code)
+	}
+
+	stored := s.reload(order)
+	if stored.Status != models.OrderRefunded || stored.PaymentInfo.Status != models.PaymentRefunded || stored.RefundedAmount != order.Total {
+		t.Errorf("order %s, payment %s, refunded %.2f; want refunded in full", stored.Status, stored.PaymentInfo.Status, stored.RefundedAmount)
+	}
+	if len(s.provider.refunds) != 1 || s.provider.refunds[0].Amount != order.Total {
+		t.Errorf("refunds = %+v, want one of %.2f", s.provider.refunds, order.Total)
+	}
+}
+
+func TestAdminCannotMarkOrderRefunded(t *testing.T) {
+	s := newTestServer(t)
+	admin := &models.User{ID: primitive.NewObjectID(), Role: models.RoleAdmin}
+	user := s.customer()
+	order := s.prepaidOrder(user, s.product(5000, 2))
+	if code := s.paymentEvent(payments.EventCaptured, order); code != http.StatusOK {
+		t.Fatalf("capture payment: status %d", code)
+	}
+
+	path := "/api/admin/orders/" + order.ID.Hex() + "/status"
+	if code := s.do(http.MethodPut, path, admin, models.UpdateOrderStatusInput{Status: models.OrderCancelled, CancelReason: "Out of stock"}, nil); code != http.StatusOK {
+		t.Fatalf("cancel order: status %d", code)
+	}
+	if stored := s.reload(order); stored.Status != models.OrderRefunded || len(s.provider.refunds) != 1 {
+		t.Errorf("order %s after %d refunds; want refunded once", stored.Status, len(s.provider.refunds))
+	}
+
+	// Without a payment to give back the order stays cancelled, and
+	// cannot be marked refunded by hand
+	cod := s.customer()
+	s.addToCart(cod, s.product(3000, 2), 1)
+	var codOrder models.Order
+	if code := s.do(http.MethodPost, "/api/orders", cod, models.CreateOrderInput{
+		AddressID:     cod.Addresses[0].ID.Hex(),
+		PaymentMethod: models.PaymentCOD,
+	}, &codOrder); code != http.StatusCreated {
+		t.Fatalf("create order: status %d", code)
+	}
+	path = "/api/admin/orders/" + codOrder.ID.Hex() + "/status"
+	if code := s.do(http.MethodPut, path, admin, models.UpdateOrderStatusInput{Status: models.OrderCancelled}, nil); code != http.StatusOK {
+		t.Fatalf("cancel COD order: status %d", code)
+	}
+	if code := s.do(http.MethodPut, path, admin, models.UpdateOrderStatusInput{Status: models.OrderRefunded}, nil); code != http.StatusBadRequest {
+		t.Errorf("mark refunded: status %d, want 400", code)
+	}
+	if stored := s.reload(&codOrder); stored.Status != models.OrderCancelled {
+		t.Errorf("COD order %s, want cancelled", stored.Status)
+	}
+}
+
+func TestReturningEveryLineRefundsTheOrder(t *testing.T) {
+	s := newTestServer(t)
+	admin := &models.User{ID: primitive.NewObjectID(), Role: models.RoleAdmin}
+	ctx := context.Background()
+
+	// Shipping is paid but never refunded
+	order := &models.Order{
+		ID:          primitive.NewObjectID(),
+		OrderNumber: "ORD-RETURNS",
+		Items: []models.OrderItem{
+			{ProductID: primitive.NewObjectID(), Quantity: 1, Price: 6000, TotalPrice: 6000},
+			{ProductID: primitive.NewObjectID(), Quantity: 2, Price: 2000, TotalPrice: 4000},
+		},
+		Subtotal:     10000,
+		Tax:          300,
+		ShippingInfo: models.ShippingInfo{Cost: 150},
+		PaymentInfo: models.PaymentInfo{
+			Method:        models.PaymentCard,
+			Status:        models.PaymentCompleted,
+			IntentID:      "pi_returns",
+			TransactionID: "txn_returns",
+		},
+		Total:       10450,
+		Status:      models.OrderDelivered,
+		DeliveredAt: time.Now(),
+		CreatedAt:   time.Now(),
+	}
+	if err := s.repos.Orders.Create(ctx, order); err != nil {
+		t.Fatal(err)
+	}
+
+	var returns []*models.ReturnRequest
+	for i, item := range order.Items {
+		returnRequest := &models.ReturnRequest{
+			ID:           primitive.NewObjectID(),
+			ReturnNumber: fmt.Sprintf("RET-%d", i),
+			OrderID:      order.ID,
+			ProductID:    item.ProductID,
+			Quantity:     item.Quantity,
+			UnitPrice:    item.Price,
+			Status:       models.ReturnInspected,
+			Inspection:   &models.ReturnInspection{Passed: true},
+			CreatedAt:    time.Now(),
+		}
+		if err := s.repos.Returns.Create(ctx, returnRequest); err != nil {
+			t.Fatal(err)
+		}
+		returns = append(returns, returnRequest)
+	}
+
+	refund := func(returnRequest *models.ReturnRequest) {
+		t.Helper()
+		path := "/api/admin/returns/" + returnRequest.ID.Hex() + "/refund"
+		if code := s.do(http.MethodPost, path, admin, models.RefundReturnInput{}, nil); code != http.StatusOK {
+			t.Fatalf("refund %s: status %d", returnRequest.ReturnNumber, code)
+		}
+	}
+
+	refund(returns[0])
+	if stored := s.reload(order); stored.Status != models.OrderDelivered || stored.PaymentInfo.Status != models.PaymentPartiallyRefunded || stored.RefundedAmount != 6180 {
+		t.Errorf("after one return: order %s, payment %s, refunded %.2f; want delivered, partially_refunded, 6180", stored.Status, stored.PaymentInfo.Status, stored.RefundedAmount)
+	}
+
+	refund(returns[1])
+	if stored := s.reload(order); stored.Status != models.OrderRefunded || stored.PaymentInfo.Status != models.PaymentRefunded || stored.RefundedAmount != 10300 {
+		t.Errorf("after every return: order %s, payment %s, refunded %.2f; want refunded, refunded, 10300", stored.Status, stored.PaymentInfo.Status, stored.RefundedAmount)
+	}
+	if len(s.provider.refunds) != 2 {
+		t.Errorf("%d provider refunds, want 2", len(s.provider.refunds))
+	}
+}
+
+func TestCancellingPartDeliveredOrderReversesTheSale(t *testing.T) {
+	s := newTestServer(t)
+	admin := &models.User{ID: primitive.NewObjectID(), Role: models.RoleAdmin}
+	ctx := context.Background()
+
+	delivered, pending := primitive.NewObjectID(), primitive.NewObjectID()
+	order := &models.Order{
+		ID:          primitive.NewObjectID(),
+		OrderNumber: "ORD-CANCELLED",
+		Items: []models.OrderItem{
+			{ProductID: primitive.NewObjectID(), SellerID: delivered, Quantity: 1, Price: 6000, TotalPrice: 6000},
+			{ProductID: primitive.NewObjectID(), SellerID: pending, Quantity: 1, Price: 4000, TotalPrice: 4000},
+		},
+		Subtotal: 10000,
+		PaymentInfo: models.PaymentInfo{
+			Method:        models.PaymentCard,
+			Status:        models.PaymentCompleted,
+			IntentID:      "pi_cancelled",
+			TransactionID: "txn_cancelled",
+		},
+		Total:  10000,
+		Status: models.OrderProcessing,
+		Fulfilments: []models.Fulfilment{
+			{SellerID: delivered, Status: models.OrderDelivered},
+			{SellerID: pending, Status: models.OrderProcessing},
+		},
+		CreatedAt: time.Now(),
+	}
+	if err := s.repos.Orders.Create(ctx, order); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.bus.Publish(ctx, models.EventOrderDelivered, order.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.bus.RunDue(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	path := "/api/admin/orders/" + order.ID.Hex() + "/status"
+	if code := s.do(http.MethodPut, path, admin, models.UpdateOrderStatusInput{Status: models.OrderCancelled, CancelReason: "Second part lost in transit"}, nil); code != http.StatusOK {
+		t.Fatalf("cancel order: status %d", code)
+	}
+	if err := s.bus.RunDue(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := s.repos.Ledger.Find(ctx, repository.LedgerQuery{SellerID: delivered})
+	if err != nil {
+		t.Fatal(err)
+	}
+	net := 0.0
+	for _, entry := range entries {
+		net += entry.Net
+	}
+	if len(entries) != 2 || net != 0 {
+		t.Errorf("ledger entries = %+v, want the sale and its reversal", entries)
+	}
+}
+
+func TestSecondFactorCodesAreUsedOnce(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	user := s.customer()
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.repos.Users.Update(ctx, user.ID, repository.Fields{
+		"two_factor.enabled":        true,
+		"two_factor.secret":         secret,
+		"two_factor.recovery_codes": []string{utils.HashToken("abcde12345")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two logins both read the user before either used the code
+	stale, err := s.repos.Users.FindByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, code := range []string{code, "ABCDE-12345"} {
+		if ok, err := s.auth.checkSecondFactor(ctx, stale, code); !ok || err != nil {
+			t.Fatalf("first use of %s: %v, %v", code, ok, err)
+		}
+		if ok, err := s.auth.checkSecondFactor(ctx, stale, code); ok || err != nil {
+			t.Errorf("second use of %s: %v, %v; want rejected", code, ok, err)
+		}
+	}
+
+	stored, err := s.repos.Users.FindByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored.TwoFactor.RecoveryCodes) != 0 || stored.FailedLogins != 2 {
+		t.Errorf("%d recovery codes left, %d failed logins; want 0 and 2", len(stored.TwoFactor.RecoveryCodes), stored.FailedLogins)
+	}
+}
+
+func TestUpdateZoneOnlyChangesFieldsSent(t *testing.T) {
+	s := newTestServer(t)
+	admin := &models.User{ID: primitive.NewObjectID(), Role: models.RoleAdmin}
+	ctx := context.Background()
+
+	zones, err := s.repos.Zones.FindAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var zone *models.ShippingZone
+	for i := range zones {
+		if zones[i].CODAvailable && zones[i].CODLimit > 0 {
+			zone = &zones[i]
+			break
+		}
+	}
+	if zone == nil {
+		t.Fatal("no default zone takes cash on delivery")
+	}
+
+	name := "Metro and suburbs"
+	if code := s.do(http.MethodPut, "/api/admin/shipping/zones/"+zone.ID.Hex(), admin, gin.H{"name": name}, nil); code != http.StatusOK {
+		t.Fatalf("rename zone: status %d", code)
+	}
+	stored, err := s.repos.Zones.FindByID(ctx, zone.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Name != name || !stored.IsActive || !stored.CODAvailable || stored.CODLimit != zone.CODLimit {
+		t.Errorf("renamed zone = %+v, want only the name changed", stored)
+	}
+
+	if code := s.do(http.MethodPut, "/api/admin/shipping/zones/"+zone.ID.Hex(), admin, gin.H{"isActive": false}, nil); code != http.StatusOK {
+		t.Fatalf("deactivate zone: status %d", code)
+	}
+	if stored, err = s.repos.Zones.FindByID(ctx, zone.ID); err != nil {
+		t.Fatal(err)
+	}
+	if stored.IsActive || !stored.CODAvailable || stored.CODLimit != zone.CODLimit {
+		t.Errorf("deactivated zone = %+v, want only is_active changed", stored)
+	}
+}
+
+func TestInvoiceNumbersAreDrawnOnce(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	config.AppConfig.SellerState = "Maharashtra"
+
+	order := &models.Order{
+		ID:          primitive.NewObjectID(),
+		OrderNumber: "ORD-INVOICE",
+		Items:       []models.OrderItem{{ProductID: primitive.NewObjectID(), Quantity: 1, Price: 5000, TotalPrice: 5000}},
+		Subtotal:    5000,
+		Total:       5000,
+		Status:      models.OrderConfirmed,
+		CreatedAt:   time.Now(),
+	}
+	if err := s.repos.Orders.Create(ctx, order); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both requests read the order before either invoiced it
+	first, err := issueInvoice(ctx, s.repos.Orders, s.repos.Counters, order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := issueInvoice(ctx, s.repos.Orders, s.repos.Counters, order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Number == "" || second.Number != first.Number {
+		t.Errorf("invoice numbers %q and %q, want the same one", first.Number, second.Number)
+	}
+
+	// A claim that is still being numbered is left alone, and one
+	// abandoned by a stopped request is taken over
+	for _, claimed := range []struct {
+		age  time.Duration
+		want error
+	}{{0, errInvoicePending}, {2 * invoiceClaimTimeout, nil}} {
+		other := *order
+		other.ID = primitive.NewObjectID()
+		other.Invoice = &models.Invoice{IssuedAt: time.Now().Add(-claimed.age).Truncate(time.Millisecond)}
+		if err := s.repos.Orders.Create(ctx, &other); err != nil {
+			t.Fatal(err)
+		}
+		inv, err := issueInvoice(ctx, s.repos.Orders, s.repos.Counters, &other)
+		if err != claimed.want {
+			t.Fatalf("claim %s old: err = %v, want %v", claimed.age, err, claimed.want)
+		}
+		if err == nil && inv.Number == "" {
+			t.Errorf("claim %s old: invoice left unnumbered", claimed.age)
+		}
+	}
+
+	// Only two numbers were drawn, one per invoice issued
+	next, err := s.repos.Counters.Next(ctx, "invoice/"+invoice.FinancialYear(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != 3 {
+		t.Errorf("next invoice sequence = %d, want 3", next)
+	}
+}
+
+func TestReusedRefreshTokenEndsTheSession(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	user := s.customer()
+	password, err := utils.HashPassword("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.repos.Users.Update(ctx, user.ID, repository.Fields{"password": password}); err != nil {
+		t.Fatal(err)
+	}
+
+	var login models.AuthResponse
+	if code := s.do("POST", "/api/auth/login", nil, models.LoginInput{Email: user.Email, Password: "correct horse battery"}, &login); code != http.StatusOK {
+		t.Fatalf("login: status %d", code)
+	}
+
+	type tokens struct {
+		AccessToken  string `json:"accessToken"`
+		RefreshToken string `json:"refreshToken"`
+	}
+	refresh := func(token string) (tokens, int) {
+		var out tokens
+		code := s.do("POST", "/api/auth/refresh", nil, gin.H{"refreshToken": token}, &out)
+		return out, code
+	}
+
+	first, code := refresh(login.RefreshToken)
+	if code != http.StatusOK || first.RefreshToken == login.RefreshToken {
+		t.Fatalf("first refresh: status %d, token rotated %v", code, first.RefreshToken != login.RefreshToken)
+	}
+	second, code := refresh(first.RefreshToken)
+	if code != http.StatusOK {
+		t.Fatalf("second refresh: status %d", code)
+	}
+
+	// The token rotated away first is presented again, as a thief would
+	if _, code := refresh(login.RefreshToken); code != http.StatusUnauthorized {
+		t.Fatalf("reused refresh token: status %d, want 401", code)
+	}
+
+	// The legitimate device is signed out too
+	if _, code := refresh(second.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("refresh after reuse: status %d, want 401", code)
+	}
+	claims, err := utils.ValidateToken(second.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked, err := s.repos.Revocations.IsRevoked(ctx, claims.SessionID); err != nil || !revoked {
+		t.Errorf("session access tokens revoked = %v, %v; want true", revoked, err)
+	}
+}
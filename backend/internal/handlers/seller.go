@@ -0,0 +1,576 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"ejewel/internal/events"
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+	"ejewel/internal/revocation"
+	"ejewel/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fulfillableStatuses are the order statuses in which sellers may work on
+// their part. Pending orders are still awaiting payment.
+var fulfillableStatuses = []models.OrderStatus{models.OrderConfirmed, models.OrderProcessing, models.OrderShipped}
+
+type SellerHandler struct {
+	sellers     repository.SellerRepository
+	users       repository.UserRepository
+	products    repository.ProductRepository
+	orders      repository.OrderRepository
+	revocations *revocation.List
+	events      *events.Bus
+}
+
+func NewSellerHandler(sellers repository.SellerRepository, users repository.UserRepository, products repository.ProductRepository, orders repository.OrderRepository, revocations *revocation.List, bus *events.Bus) *SellerHandler {
+	return &SellerHandler{
+		sellers:     sellers,
+		users:       users,
+		products:    products,
+		orders:      orders,
+		revocations: revocations,
+		events:      bus,
+	}
+}
+
+// Apply submits the caller's application to sell. Rejected applications
+// may be corrected and submitted again.
+func (h *SellerHandler) Apply(c *gin.Context) {
+	userID, _ := c.Get("userId")
+	userRole, _ := c.Get("userRole")
+
+	var input models.SellerApplicationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	if role, _ := userRole.(models.Role); role.IsStaff() {
+		utils.ForbiddenError(c, "Staff accounts cannot apply to sell")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	objectID, _ := primitive.ObjectIDFromHex(userID.(string))
+
+	application := repository.Fields{
+		"store_name":    input.StoreName,
+		"description":   input.Description,
+		"contact_email": input.ContactEmail,
+		"phone":         input.Phone,
+		"address":       input.Address,
+		"kyc": models.KYC{
+			LegalName:   input.KYC.LegalName,
+			PAN:         input.KYC.PAN,
+			GSTIN:       input.KYC.GSTIN,
+			BankAccount: input.KYC.BankAccount,
+			Documents:   input.KYC.Documents,
+		},
+		"status":      models.SellerPending,
+		"review_note": "",
+		"updated_at":  time.Now(),
+	}
+
+	existing, err := h.sellers.FindByUser(ctx, objectID)
+	if err == nil {
+		if existing.Status != models.SellerRejected {
+			utils.ErrorResponse(c, http.StatusConflict, fmt.Sprintf("You already have a seller application that is %s", existing.Status))
+			return
+		}
+
+		err = h.sellers.Update(ctx, existing.ID, repository.Fields{"status": models.SellerRejected}, application)
+		if err == repository.ErrConflict {
+			utils.ErrorResponse(c, http.StatusConflict, "Your application changed, please retry")
+			return
+		}
+		if err != nil {
+			utils.InternalError(c, "Failed to submit application")
+			return
+		}
+
+		seller, _ := h.sellers.FindByID(ctx, existing.ID)
+		utils.SuccessResponse(c, http.StatusOK, "Application resubmitted for review", seller)
+		return
+	}
+	if err != repository.ErrNotFound {
+		utils.InternalError(c, "Failed to submit application")
+		return
+	}
+
+	seller := models.Seller{
+		ID:           primitive.NewObjectID(),
+		UserID:       objectID,
+		StoreName:    input.StoreName,
+		Description:  input.Description,
+		ContactEmail: input.ContactEmail,
+		Phone:        input.Phone,
+		Address:      input.Address,
+		KYC:          application["kyc"].(models.KYC),
+		Status:       models.SellerPending,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+
+	err = h.sellers.Create(ctx, &seller)
+	if err == repository.ErrDuplicate {
+		utils.ErrorResponse(c, http.StatusConflict, "You already have a seller application")
+		return
+	}
+	if err != nil {
+		utils.InternalError(c, "Failed to submit application")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Application submitted for review", seller)
+}
+
+// GetProfile returns the caller's seller application and its review.
+func (h *SellerHandler) GetProfile(c *gin.Context) {
+	userID, _ := c.Get("userId")
+	objectID, _ := primitive.ObjectIDFromHex(userID.(string))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	seller, err := h.sellers.FindByUser(ctx, objectID)
+	if err != nil {
+		utils.NotFoundError(c, "You have not applied to sell")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "", seller)
+}
+
+// Seller products
+
+func (h *SellerHandler) GetProducts(c *gin.Context) {
+	userID, _ := c.Get("userId")
+	objectID, _ := primitive.ObjectIDFromHex(userID.(string))
+	page, limit := pageParams(c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := repository.ProductQuery{
+		SellerID: objectID,
+		Search:   c.Query("search"),
+		SortDesc: true,
+		Page:     repository.Page{Skip: int64((page - 1) * limit), Limit: int64(limit)},
+	}
+
+	products, err := h.products.Find(ctx, query)
+	if err != nil {
+		utils.InternalError(c, "Failed to fetch products")
+		return
+	}
+
+	total, _ := h.products.Count(ctx, query)
+
+	utils.PaginatedSuccessResponse(c, products, page, limit, total)
+}
+
+func (h *SellerHandler) GetProduct(c *gin.Context) {
+	product, ok := h.ownProduct(c)
+	if !ok {
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "", product)
+}
+
+// OwnProduct only lets the request through to the product handlers when
+// the product in the path belongs to the caller.
+func (h *SellerHandler) OwnProduct(c *gin.Context) {
+	if _, ok := h.ownProduct(c); !ok {
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+// ownProduct loads the product in the path for its seller. It writes the
+// error response and returns false when the caller does not own it.
+func (h *SellerHandler) ownProduct(c *gin.Context) (*models.Product, bool) {
+	userID, _ := c.Get("userId")
+	objectID, _ := primitive.ObjectIDFromHex(userID.(string))
+
+	productID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		utils.ValidationError(c, "Invalid product ID")
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	product, err := h.products.FindByID(ctx, productID)
+	if err != nil || product.SellerID != objectID {
+		utils.NotFoundError(c, "Product not found")
+		return nil, false
+	}
+	return product, true
+}
+
+// Seller orders
+
+func (h *SellerHandler) GetOrders(c *gin.Context) {
+	userID, _ := c.Get("userId")
+	objectID, _ := primitive.ObjectIDFromHex(userID.(string))
+	page, limit := pageParams(c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := repository.OrderQuery{
+		SellerID: objectID,
+		Page:     repository.Page{Skip: int64((page - 1) * limit), Limit: int64(limit)},
+	}
+	if status := c.Query("status"); status != "" {
+		query.Statuses = []models.OrderStatus{models.OrderStatus(status)}
+	}
+
+	orders, err := h.orders.Find(ctx, query)
+	if err != nil {
+		utils.InternalError(c, "Failed to fetch orders")
+		return
+	}
+
+	total, _ := h.orders.Count(ctx, query)
+
+	views := make([]models.SellerOrder, 0, len(orders))
+	for i := range orders {
+		if view, ok := orders[i].ForSeller(objectID); ok {
+			views = append(views, view)
+		}
+	}
+
+	utils.PaginatedSuccessResponse(c, views, page, limit, total)
+}
+
+func (h *SellerHandler) GetOrder(c *gin.Context) {
+	userID, _ := c.Get("userId")
+	objectID, _ := primitive.ObjectIDFromHex(userID.(string))
+
+	orderID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		utils.ValidationError(c, "Invalid order ID")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	order, err := h.orders.FindByID(ctx, orderID)
+	if err != nil {
+		utils.NotFoundError(c, "Order not found")
+		return
+	}
+	view, ok := order.ForSeller(objectID)
+	if !ok {
+		utils.NotFoundError(c, "Order not found")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "", view)
+}
+
+// UpdateFulfilment moves the caller's part of an order on by one step. The
+// order itself follows once every seller has reached the same step.
+func (h *SellerHandler) UpdateFulfilment(c *gin.Context) {
+	userID, _ := c.Get("userId")
+	userRole, _ := c.Get("userRole")
+	objectID, _ := primitive.ObjectIDFromHex(userID.(string))
+
+	orderID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		utils.ValidationError(c, "Invalid order ID")
+		return
+	}
+
+	var input models.UpdateFulfilmentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+	if input.Status == models.OrderShipped && (input.TrackingID == "" || input.Carrier == "") {
+		utils.ValidationError(c, "trackingId and carrier are required to ship")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	order, err := h.orders.FindByID(ctx, orderID)
+	if err != nil {
+		utils.NotFoundError(c, "Order not found")
+		return
+	}
+	part := order.Fulfilment(objectID)
+	if part == nil {
+		utils.NotFoundError(c, "Order not found")
+		return
+	}
+	if !containsStatus(fulfillableStatuses, order.Status) {
+		utils.ErrorResponse(c, http.StatusConflict, fmt.Sprintf("Orders that are %s cannot be fulfilled", order.Status))
+		return
+	}
+	if !part.Status.CanFulfilTo(input.Status) {
+		utils.ErrorResponse(c, http.StatusConflict, fmt.Sprintf("Cannot change fulfilment status from %s to %s", part.Status, input.Status))
+		return
+	}
+
+	entry := actorEntry(userID, userRole, input.Note)
+	entry.Status = input.Status
+	entry.TrackingID = input.TrackingID
+	entry.Carrier = input.Carrier
+	entry.Timestamp = time.Now()
+
+	err = h.orders.UpdateFulfilment(ctx, orderID, objectID, part.Status, input.Status, fulfillableStatuses, entry)
+	if err == repository.ErrConflict {
+		utils.ErrorResponse(c, http.StatusConflict, "Order status changed, please retry")
+		return
+	}
+	if err != nil {
+		utils.InternalError(c, "Failed to update fulfilment")
+		return
+	}
+
+	if updated, err := h.orders.FindByID(ctx, orderID); err == nil {
+		if err := rollUpFulfilments(ctx, h.orders, updated); err != nil {
+			log.Printf("Failed to advance order %s after fulfilment update: %v", order.OrderNumber, err)
+		}
+	}
+	if updated, err := h.orders.FindByID(ctx, orderID); err == nil {
+		order = updated
+	}
+
+	if input.Status == models.OrderDelivered {
+		if err := h.events.Publish(ctx, models.EventOrderDelivered, order.ID); err != nil {
+			log.Printf("Failed to publish delivery of order %s: %v", order.OrderNumber, err)
+		}
+	}
+
+	view, _ := order.ForSeller(objectID)
+	utils.SuccessResponse(c, http.StatusOK, "Fulfilment updated", view)
+}
+
+// Admin handlers
+
+func (h *SellerHandler) GetSellers(c *gin.Context) {
+	page, limit := pageParams(c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := repository.SellerQuery{
+		Status: models.SellerStatus(c.Query("status")),
+		Page:   repository.Page{Skip: int64((page - 1) * limit), Limit: int64(limit)},
+	}
+
+	sellers, err := h.sellers.Find(ctx, query)
+	if err != nil {
+		utils.InternalError(c, "Failed to fetch sellers")
+		return
+	}
+
+	total, _ := h.sellers.Count(ctx, query)
+
+	utils.PaginatedSuccessResponse(c, sellers, page, limit, total)
+}
+
+func (h *SellerHandler) GetSeller(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		utils.ValidationError(c, "Invalid seller ID")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	seller, err := h.sellers.FindByID(ctx, objectID)
+	if err != nil {
+		utils.NotFoundError(c, "Seller not found")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "", seller)
+}
+
+// ApproveSeller accepts a pending application, or reinstates a suspended
+// seller, and gives the user the seller role.
+func (h *SellerHandler) ApproveSeller(c *gin.Context) {
+	h.reviewSeller(c, models.SellerApproved, models.RoleSeller, "Seller approved", models.SellerPending, models.SellerSuspended)
+}
+
+// RejectSeller turns down a pending application. The applicant may correct
+// it and apply again.
+func (h *SellerHandler) RejectSeller(c *gin.Context) {
+	h.reviewSeller(c, models.SellerRejected, "", "Seller application rejected", models.SellerPending)
+}
+
+// SuspendSeller stops an approved seller from selling. Their products are
+// taken off the store and the user goes back to being a customer.
+func (h *SellerHandler) SuspendSeller(c *gin.Context) {
+	h.reviewSeller(c, models.SellerSuspended, models.RoleCustomer, "Seller suspended", models.SellerApproved)
+}
+
+// reviewSeller moves a seller from one of the from statuses to status and,
+// when role is set, gives the user that role.
+func (h *SellerHandler) reviewSeller(c *gin.Context, status models.SellerStatus, role models.Role, message string, from ...models.SellerStatus) {
+	userID, _ := c.Get("userId")
+	reviewerID, _ := primitive.ObjectIDFromHex(userID.(string))
+
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		utils.ValidationError(c, "Invalid seller ID")
+		return
+	}
+
+	var input models.ReviewSellerInput
+	c.ShouldBindJSON(&input)
+	if status != models.SellerApproved && input.Note == "" {
+		utils.ValidationError(c, "A note explaining the decision is required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	seller, err := h.sellers.FindByID(ctx, objectID)
+	if err != nil {
+		utils.NotFoundError(c, "Seller not found")
+		return
+	}
+
+	allowed := false
+	for _, s := range from {
+		allowed = allowed || seller.Status == s
+	}
+	if !allowed {
+		utils.ErrorResponse(c, http.StatusConflict, fmt.Sprintf("Cannot change a seller that is %s to %s", seller.Status, status))
+		return
+	}
+
+	err = h.sellers.Update(ctx, objectID, repository.Fields{"status": seller.Status}, repository.Fields{
+		"status":      status,
+		"review_note": input.Note,
+		"reviewed_by": reviewerID,
+		"reviewed_at": time.Now(),
+		"updated_at":  time.Now(),
+	})
+	if err == repository.ErrConflict {
+		utils.ErrorResponse(c, http.StatusConflict, "Seller changed, please retry")
+		return
+	}
+	if err != nil {
+		utils.InternalError(c, "Failed to update seller")
+		return
+	}
+
+	if status == models.SellerSuspended {
+		if err := h.deactivateProducts(ctx, seller.UserID); err != nil {
+			utils.InternalError(c, "Seller suspended but their products could not be deactivated")
+			return
+		}
+	}
+
+	if role != "" {
+		err := h.users.Update(ctx, seller.UserID, repository.Fields{"role": role, "updated_at": time.Now()})
+		if err != nil {
+			utils.InternalError(c, "Seller updated but the user's role could not be changed")
+			return
+		}
+		// Tokens carry the role, so they must not outlive a change to it
+		if err := h.revocations.RevokeUser(ctx, seller.UserID); err != nil {
+			utils.InternalError(c, "Seller updated but existing tokens could not be revoked")
+			return
+		}
+	}
+
+	seller, _ = h.sellers.FindByID(ctx, objectID)
+
+	utils.SuccessResponse(c, http.StatusOK, message, seller)
+}
+
+// deactivateProducts takes every product of the seller off the store.
+func (h *SellerHandler) deactivateProducts(ctx context.Context, sellerID primitive.ObjectID) error {
+	products, err := h.products.Find(ctx, repository.ProductQuery{SellerID: sellerID})
+	if err != nil {
+		return err
+	}
+	for _, product := range products {
+		if !product.IsActive {
+			continue
+		}
+		err := h.products.Update(ctx, product.ID, repository.Fields{"is_active": false, "updated_at": time.Now()})
+		if err != nil && err != repository.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitBySeller assigns order lines to the marketplace sellers of their
+// products and returns a fulfilment for each seller. Lines of products
+// sold by the store itself are left unassigned.
+func splitBySeller(ctx context.Context, sellers repository.SellerRepository, items []models.OrderItem, products map[primitive.ObjectID]*models.Product) ([]models.Fulfilment, error) {
+	approved := make(map[primitive.ObjectID]bool)
+	var fulfilments []models.Fulfilment
+
+	for i := range items {
+		product, ok := products[items[i].ProductID]
+		if !ok || product.SellerID.IsZero() {
+			continue
+		}
+
+		sellerID := product.SellerID
+		isSeller, checked := approved[sellerID]
+		if !checked {
+			seller, err := sellers.FindByUser(ctx, sellerID)
+			if err != nil && err != repository.ErrNotFound {
+				return nil, err
+			}
+			isSeller = err == nil && seller.Status == models.SellerApproved
+			approved[sellerID] = isSeller
+			if isSeller {
+				now := time.Now()
+				fulfilments = append(fulfilments, models.Fulfilment{
+					SellerID:  sellerID,
+					Status:    models.OrderPending,
+					History:   []models.StatusHistoryEntry{{Status: models.OrderPending, ActorRole: models.ActorSystem, Note: "Awaiting seller", Timestamp: now}},
+					UpdatedAt: now,
+				})
+			}
+		}
+		if isSeller {
+			items[i].SellerID = sellerID
+		}
+	}
+	return fulfilments, nil
+}
+
+// pageParams reads the page and limit query parameters, defaulting to the
+// first page of 20.
+func pageParams(c *gin.Context) (int, int) {
+	page, _ := strconv.Atoi(c.Query("page"))
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if page <= 0 {
+		page = 1
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	return page, limit
+}
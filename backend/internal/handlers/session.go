@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"ejewel/internal/config"
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+	"ejewel/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetSessions lists the devices signed in to the account.
+func (h *AuthHandler) GetSessions(c *gin.Context) {
+	userID, _ := c.Get("userId")
+	objectID, _ := primitive.ObjectIDFromHex(userID.(string))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sessions, err := h.sessions.FindActiveByUser(ctx, objectID)
+	if err != nil {
+		utils.InternalError(c, "Failed to fetch sessions")
+		return
+	}
+
+	current := c.GetString("sessionId")
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID.Hex() == current
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "", sessions)
+}
+
+// RevokeSession signs one device out of the account.
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	userID, _ := c.Get("userId")
+	objectID, _ := primitive.ObjectIDFromHex(userID.(string))
+
+	sessionID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		utils.ValidationError(c, "Invalid session ID")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	session, err := h.sessions.FindByID(ctx, sessionID)
+	if err != nil || session.UserID != objectID || !session.IsActive(time.Now()) {
+		utils.NotFoundError(c, "Session not found")
+		return
+	}
+
+	if err := h.endSession(ctx, session, "revoked by user"); err != nil {
+		utils.InternalError(c, "Failed to revoke session")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Session revoked successfully", nil)
+}
+
+// RevokeOtherSessions signs every device but the current one out of the
+// account.
+func (h *AuthHandler) RevokeOtherSessions(c *gin.Context) {
+	userID, _ := c.Get("userId")
+	objectID, _ := primitive.ObjectIDFromHex(userID.(string))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	current, _ := h.requestSession(ctx, c, objectID)
+	if err := h.endOtherSessions(ctx, objectID, current, "revoked by user"); err != nil {
+		utils.InternalError(c, "Failed to revoke sessions")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Other sessions revoked successfully", nil)
+}
+
+// requestSession loads the session the request's access token was issued
+// for.
+func (h *AuthHandler) requestSession(ctx context.Context, c *gin.Context, userID primitive.ObjectID) (*models.Session, error) {
+	sessionID, err := primitive.ObjectIDFromHex(c.GetString("sessionId"))
+	if err != nil {
+		return nil, repository.ErrNotFound
+	}
+	session, err := h.sessions.FindByID(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session.UserID != userID {
+		return nil, repository.ErrNotFound
+	}
+	return session, nil
+}
+
+// revokeReusedSession ends a session whose refresh token was presented
+// after it had been rotated.
+func (h *AuthHandler) revokeReusedSession(ctx context.Context, session *models.Session) {
+	log.Printf("Refresh token reuse detected for session %s of user %s", session.ID.Hex(), session.UserID.Hex())
+	h.endSession(ctx, session, "refresh token reused")
+}
+
+// endSession revokes a session along with the access tokens already
+// issued for it.
+func (h *AuthHandler) endSession(ctx context.Context, session *models.Session, reason string) error {
+	if err := h.sessions.Revoke(ctx, session.ID, reason); err != nil {
+		return err
+	}
+	return h.revocations.Revoke(ctx, session.ID.Hex(), time.Now().Add(config.AppConfig.JWTExpiry))
+}
+
+// endOtherSessions ends every active session of the user except current,
+// which may be nil.
+func (h *AuthHandler) endOtherSessions(ctx context.Context, userID primitive.ObjectID, current *models.Session, reason string) error {
+	sessions, err := h.sessions.FindActiveByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for i := range sessions {
+		if current != nil && sessions[i].ID == current.ID {
+			continue
+		}
+		if err := h.endSession(ctx, &sessions[i], reason); err != nil {
+			return err
+		}
+	}
+	return nil
+}
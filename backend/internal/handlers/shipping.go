@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"ejewel/internal/models"
+	"ejewel/internal/pricing"
+	"ejewel/internal/repository"
+	"ejewel/internal/shipping"
+	"ejewel/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ShippingHandler struct {
+	zones repository.ShippingZoneRepository
+	carts cartStore
+}
+
+func NewShippingHandler(zones repository.ShippingZoneRepository, carts repository.CartRepository, products repository.ProductRepository, engine *pricing.Engine) *ShippingHandler {
+	return &ShippingHandler{zones: zones, carts: cartStore{carts: carts, products: products, pricing: engine}}
+}
+
+// Quote lists the shipping options for the user's or guest's cart to a
+// pincode.
+func (h *ShippingHandler) Quote(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var parcel shipping.Parcel
+	cart, err := h.carts.find(ctx, requestCartOwner(c))
+	if err == nil && len(cart.Items) > 0 {
+		products, err := h.carts.loadProducts(ctx, cart.Items)
+		if err != nil {
+			utils.InternalError(c, "Failed to fetch products")
+			return
+		}
+		items := priceCartItems(cart.Items, products)
+		parcel = cartParcel(items, products, itemsSubtotal(items))
+	}
+
+	pincode := c.Query("pincode")
+	zone, err := shipping.FindZone(ctx, h.zones, pincode)
+	if err != nil {
+		if shipping.IsRuleError(err) {
+			utils.ValidationError(c, err.Error())
+			return
+		}
+		utils.InternalError(c, "Failed to fetch shipping zones")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "", models.ShippingQuote{
+		Pincode:       pincode,
+		Zone:          zone.Name,
+		CODAvailable:  shipping.CheckCOD(zone, parcel.DeclaredValue) == nil,
+		Weight:        parcel.Weight + shipping.PackagingWeight,
+		DeclaredValue: parcel.DeclaredValue,
+		Options:       shipping.Options(zone, parcel, time.Now()),
+	})
+}
+
+// Admin handlers
+
+func (h *ShippingHandler) GetZones(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	zones, err := h.zones.FindAll(ctx)
+	if err != nil {
+		utils.InternalError(c, "Failed to fetch shipping zones")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "", zones)
+}
+
+func (h *ShippingHandler) CreateZone(c *gin.Context) {
+	var input models.CreateShippingZoneInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	zone := models.ShippingZone{
+		ID:           primitive.NewObjectID(),
+		Name:         input.Name,
+		Pincodes:     input.Pincodes,
+		Rates:        input.Rates,
+		CODAvailable: input.CODAvailable,
+		CODLimit:     input.CODLimit,
+		IsActive:     true,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+
+	if msg := shipping.ValidateZone(&zone); msg != "" {
+		utils.ValidationError(c, msg)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := h.zones.Create(ctx, &zone)
+	if err != nil {
+		utils.InternalError(c, "Failed to create shipping zone")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusCreated, "Shipping zone created successfully", zone)
+}
+
+func (h *ShippingHandler) UpdateZone(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		utils.ValidationError(c, "Invalid shipping zone ID")
+		return
+	}
+
+	var input models.UpdateShippingZoneInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	zone, err := h.zones.FindByID(ctx, objectID)
+	if err != nil {
+		utils.NotFoundError(c, "Shipping zone not found")
+		return
+	}
+
+	// Only the fields sent are changed
+	update := repository.Fields{}
+	if input.Name != "" {
+		zone.Name = input.Name
+		update["name"] = zone.Name
+	}
+	if input.Pincodes != nil {
+		zone.Pincodes = input.Pincodes
+		update["pincodes"] = zone.Pincodes
+	}
+	if input.Rates != nil {
+		zone.Rates = input.Rates
+		update["rates"] = zone.Rates
+	}
+	if input.CODAvailable != nil {
+		zone.CODAvailable = *input.CODAvailable
+		update["cod_available"] = zone.CODAvailable
+	}
+	if input.CODLimit != nil {
+		zone.CODLimit = *input.CODLimit
+		update["cod_limit"] = zone.CODLimit
+	}
+	if input.IsActive != nil {
+		zone.IsActive = *input.IsActive
+		update["is_active"] = zone.IsActive
+	}
+
+	if msg := shipping.ValidateZone(zone); msg != "" {
+		utils.ValidationError(c, msg)
+		return
+	}
+
+	zone.UpdatedAt = time.Now()
+	update["updated_at"] = zone.UpdatedAt
+
+	if err := h.zones.Update(ctx, objectID, update); err != nil {
+		utils.InternalError(c, "Failed to update shipping zone")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Shipping zone updated successfully", zone)
+}
+
+func (h *ShippingHandler) DeleteZone(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		utils.ValidationError(c, "Invalid shipping zone ID")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err = h.zones.Delete(ctx, objectID)
+	if err == repository.ErrNotFound {
+		utils.NotFoundError(c, "Shipping zone not found")
+		return
+	}
+	if err != nil {
+		utils.InternalError(c, "Failed to delete shipping zone")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Shipping zone deleted successfully", nil)
+}
+
+// cartParcel sums the metal weight of the order lines into a parcel with
+// the given declared value.
+func cartParcel(items []models.OrderItem, products map[primitive.ObjectID]*models.Product, declaredValue float64) shipping.Parcel {
+	parcel := shipping.Parcel{DeclaredValue: declaredValue}
+	for _, item := range items {
+		product, ok := products[item.ProductID]
+		if !ok {
+			continue
+		}
+		weight := product.NetWeight
+		if _, variant := pricing.UnitPrice(product, item.VariantID); variant != nil && variant.Weight > 0 {
+			weight = variant.Weight
+		}
+		parcel.Weight += weight * float64(item.Quantity)
+	}
+	return parcel
+}
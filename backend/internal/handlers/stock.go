@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+)
+
+// reserveStock atomically decrements product and variant stock for every
+// order line. Each decrement only matches while enough stock is left, so two
+// concurrent checkouts can never oversell. If any line cannot be reserved,
+// the lines already taken are released again and the per-line errors are
+// returned.
+func reserveStock(ctx context.Context, products repository.ProductRepository, items []models.OrderItem) ([]models.OrderItemError, error) {
+	var reserved []models.OrderItem
+	var itemErrors []models.OrderItemError
+
+	for _, item := range items {
+		ok, err := products.ReserveStock(ctx, item.ProductID, item.VariantID, item.Quantity)
+		if err != nil {
+			releaseStock(ctx, products, reserved)
+			return nil, err
+		}
+
+		if !ok {
+			itemErrors = append(itemErrors, stockError(ctx, products, item))
+			continue
+		}
+
+		reserved = append(reserved, item)
+	}
+
+	if len(itemErrors) > 0 {
+		releaseStock(ctx, products, reserved)
+	}
+
+	return itemErrors, nil
+}
+
+// releaseStock returns reserved quantities to product and variant stock.
+func releaseStock(ctx context.Context, products repository.ProductRepository, items []models.OrderItem) {
+	for _, item := range items {
+		products.ReleaseStock(ctx, item.ProductID, item.VariantID, item.Quantity)
+	}
+}
+
+// stockError describes why an order line could not be reserved.
+func stockError(ctx context.Context, products repository.ProductRepository, item models.OrderItem) models.OrderItemError {
+	itemError := models.OrderItemError{
+		ProductID:   item.ProductID,
+		ProductName: item.ProductName,
+		VariantID:   item.VariantID,
+		Size:        item.Size,
+		Requested:   item.Quantity,
+	}
+
+	product, err := products.FindByID(ctx, item.ProductID)
+	if err != nil || !product.IsActive {
+		itemError.Message = "Product is no longer available"
+		return itemError
+	}
+
+	available := product.Stock
+	if !item.VariantID.IsZero() {
+		variantFound := false
+		for _, v := range product.Variants {
+			if v.ID == item.VariantID {
+				variantFound = true
+				if v.Stock < available {
+					available = v.Stock
+				}
+				break
+			}
+		}
+		if !variantFound {
+			itemError.Message = "Selected variant is no longer available"
+			return itemError
+		}
+	}
+	if available < 0 {
+		available = 0
+	}
+
+	itemError.Available = available
+	if available == 0 {
+		itemError.Message = "Out of stock"
+	} else {
+		itemError.Message = fmt.Sprintf("Only %d left in stock", available)
+	}
+
+	return itemError
+}
@@ -0,0 +1,337 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"ejewel/internal/config"
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+	"ejewel/internal/totp"
+	"ejewel/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const recoveryCodeCount = 10
+
+// LoginTwoFactor completes a two-factor login with the challenge token from
+// Login and a code from the authenticator app or a recovery code.
+func (h *AuthHandler) LoginTwoFactor(c *gin.Context) {
+	var input models.TwoFactorLoginInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	claims, err := utils.ParseActionToken(input.ChallengeToken, utils.PurposeTwoFactorLogin)
+	if err != nil {
+		utils.UnauthorizedError(c, "Login challenge is invalid or has expired")
+		return
+	}
+
+	userID, _ := primitive.ObjectIDFromHex(claims.UserID)
+	user, err := h.users.FindByID(ctx, userID)
+	if err != nil || !utils.CheckActionStamp(claims, user) || !user.TwoFactor.Enabled {
+		utils.UnauthorizedError(c, "Login challenge is invalid or has expired")
+		return
+	}
+
+	if !user.IsActive {
+		utils.ErrorResponse(c, http.StatusForbidden, "Account is deactivated")
+		return
+	}
+
+	if user.LockedUntil != nil && time.Now().Before(*user.LockedUntil) {
+		utils.TooManyRequestsError(c, "Too many failed sign-in attempts, please try again later", time.Until(*user.LockedUntil))
+		return
+	}
+
+	ok, err := h.checkSecondFactor(ctx, user, input.Code)
+	if err != nil {
+		utils.InternalError(c, "Failed to verify code")
+		return
+	}
+	if !ok {
+		utils.UnauthorizedError(c, "Invalid authentication code")
+		return
+	}
+
+	h.clearFailedLogins(ctx, user)
+	h.signIn(ctx, c, user, true)
+}
+
+// SetupTwoFactor starts enrolment with a new secret. It has no effect until
+// a code from it is confirmed.
+func (h *AuthHandler) SetupTwoFactor(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.TwoFactor.Enabled {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Two-factor authentication is already enabled")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		utils.InternalError(c, "Failed to generate secret")
+		return
+	}
+
+	err = h.users.Update(ctx, user.ID, repository.Fields{"two_factor.pending_secret": secret, "updated_at": time.Now()})
+	if err != nil {
+		utils.InternalError(c, "Failed to start two-factor setup")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Scan the code with your authenticator app, then confirm a code", models.TwoFactorSetup{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(secret, config.AppConfig.TwoFactorIssuer, user.Email),
+	})
+}
+
+// ConfirmTwoFactor turns two-factor on once the user proves their app
+// produces valid codes. The recovery codes are shown only in this response,
+// along with tokens for a session that counts as two-factor.
+func (h *AuthHandler) ConfirmTwoFactor(c *gin.Context) {
+	var input models.TwoFactorCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if user.TwoFactor.Enabled {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Two-factor authentication is already enabled")
+		return
+	}
+	if user.TwoFactor.PendingSecret == "" {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Start two-factor setup first")
+		return
+	}
+
+	step, valid := totp.Validate(user.TwoFactor.PendingSecret, input.Code, time.Now(), 0)
+	if !valid {
+		utils.ValidationError(c, "Invalid authentication code")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		utils.InternalError(c, "Failed to generate recovery codes")
+		return
+	}
+
+	user.TwoFactor = models.TwoFactor{
+		Enabled:       true,
+		Secret:        user.TwoFactor.PendingSecret,
+		RecoveryCodes: hashes,
+		LastStep:      step,
+		EnabledAt:     time.Now(),
+	}
+	err = h.users.Update(ctx, user.ID, repository.Fields{"two_factor": user.TwoFactor, "updated_at": time.Now()})
+	if err != nil {
+		utils.InternalError(c, "Failed to enable two-factor authentication")
+		return
+	}
+
+	accessToken, refreshToken, err := h.issueTokens(ctx, c, user, true)
+	if err != nil {
+		utils.InternalError(c, "Failed to generate tokens")
+		return
+	}
+
+	// The new session replaces the one opened without a second factor
+	if session, err := h.requestSession(ctx, c, user.ID); err == nil {
+		h.endSession(ctx, session, "replaced by two-factor session")
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Two-factor authentication enabled", gin.H{
+		"recoveryCodes": codes,
+		"accessToken":   accessToken,
+		"refreshToken":  refreshToken,
+	})
+}
+
+// DisableTwoFactor turns two-factor off after checking the password and a
+// current code. Admins cannot turn it off while it is mandatory for them.
+func (h *AuthHandler) DisableTwoFactor(c *gin.Context) {
+	var input models.DisableTwoFactorInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if !user.TwoFactor.Enabled {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Two-factor authentication is not enabled")
+		return
+	}
+	if user.Role.IsStaff() && config.AppConfig.RequireAdmin2FA {
+		utils.ForbiddenError(c, "Two-factor authentication is mandatory for staff accounts")
+		return
+	}
+	if !utils.CheckPassword(input.Password, user.Password) {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Password is incorrect")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	valid, err := h.checkSecondFactor(ctx, user, input.Code)
+	if err != nil {
+		utils.InternalError(c, "Failed to verify code")
+		return
+	}
+	if !valid {
+		utils.ValidationError(c, "Invalid authentication code")
+		return
+	}
+
+	err = h.users.Update(ctx, user.ID, repository.Fields{"two_factor": models.TwoFactor{}, "updated_at": time.Now()})
+	if err != nil {
+		utils.InternalError(c, "Failed to disable two-factor authentication")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Two-factor authentication disabled", nil)
+}
+
+// RegenerateRecoveryCodes replaces every recovery code after checking a
+// code from the authenticator app.
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	var input models.TwoFactorCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	if !user.TwoFactor.Enabled {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Two-factor authentication is not enabled")
+		return
+	}
+
+	step, valid := totp.Validate(user.TwoFactor.Secret, input.Code, time.Now(), user.TwoFactor.LastStep)
+	if !valid {
+		utils.ValidationError(c, "Invalid authentication code")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		utils.InternalError(c, "Failed to generate recovery codes")
+		return
+	}
+
+	err = h.users.Update(ctx, user.ID, repository.Fields{
+		"two_factor.recovery_codes": hashes,
+		"two_factor.last_step":      step,
+		"updated_at":                time.Now(),
+	})
+	if err != nil {
+		utils.InternalError(c, "Failed to save recovery codes")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Recovery codes regenerated", gin.H{"recoveryCodes": codes})
+}
+
+// currentUser loads the signed in user, writing an error response if the
+// account no longer exists.
+func (h *AuthHandler) currentUser(c *gin.Context) (*models.User, bool) {
+	userID, _ := c.Get("userId")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	objectID, _ := primitive.ObjectIDFromHex(userID.(string))
+	user, err := h.users.FindByID(ctx, objectID)
+	if err != nil {
+		utils.NotFoundError(c, "User not found")
+		return nil, false
+	}
+	return user, true
+}
+
+// checkSecondFactor accepts a current authenticator code or an unused
+// recovery code, recording the use so neither can be replayed. Wrong codes
+// count as failed sign-ins, towards locking the account.
+func (h *AuthHandler) checkSecondFactor(ctx context.Context, user *models.User, code string) (bool, error) {
+	if step, ok := totp.Validate(user.TwoFactor.Secret, code, time.Now(), user.TwoFactor.LastStep); ok {
+		// The step is only used once, even by concurrent logins
+		return h.useSecondFactor(ctx, user, h.users.UseTwoFactorStep(ctx, user.ID, step))
+	}
+
+	hash := utils.HashToken(normalizeRecoveryCode(code))
+	for _, stored := range user.TwoFactor.RecoveryCodes {
+		if stored == hash {
+			return h.useSecondFactor(ctx, user, h.users.UseRecoveryCode(ctx, user.ID, hash))
+		}
+	}
+
+	h.recordFailedLogin(ctx, user)
+	return false, nil
+}
+
+// useSecondFactor reports whether a valid code was used by this login. A
+// code used by another login in the meantime counts as a wrong code.
+func (h *AuthHandler) useSecondFactor(ctx context.Context, user *models.User, err error) (bool, error) {
+	if errors.Is(err, repository.ErrConflict) {
+		h.recordFailedLogin(ctx, user)
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// generateRecoveryCodes returns fresh recovery codes for display and their
+// hashes for storage.
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		token, err := utils.GenerateRandomToken(5)
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, token[:5]+"-"+token[5:])
+		hashes = append(hashes, utils.HashToken(token))
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
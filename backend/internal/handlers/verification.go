@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"ejewel/internal/config"
+	"ejewel/internal/mailer"
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+	"ejewel/internal/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// VerifyEmail marks the account named by a verification token as verified.
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var input models.VerifyEmailInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, ok := h.userForActionToken(ctx, c, input.Token, utils.PurposeVerifyEmail)
+	if !ok {
+		return
+	}
+
+	err := h.users.Update(ctx, user.ID, repository.Fields{"is_verified": true, "updated_at": time.Now()})
+	if err != nil {
+		utils.InternalError(c, "Failed to verify email")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Email verified successfully", nil)
+}
+
+// ResendVerification sends a fresh verification link to the signed in user.
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	userID, _ := c.Get("userId")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	objectID, _ := primitive.ObjectIDFromHex(userID.(string))
+	user, err := h.users.FindByID(ctx, objectID)
+	if err != nil {
+		utils.NotFoundError(c, "User not found")
+		return
+	}
+
+	if user.IsVerified {
+		utils.ErrorResponse(c, http.StatusBadRequest, "Email is already verified")
+		return
+	}
+
+	if err := h.sendVerificationEmail(ctx, user); err != nil {
+		log.Println("Failed to send verification email to", user.Email+":", err)
+		utils.InternalError(c, "Failed to send verification email")
+		return
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Verification email sent", nil)
+}
+
+// ForgotPassword emails a password reset link. The response is the same
+// whether or not the address has an account, so it cannot be used to find
+// out who is registered.
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var input models.ForgotPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := h.users.FindByEmail(ctx, input.Email)
+	if err == nil && user.IsActive {
+		if err := h.sendResetEmail(ctx, user); err != nil {
+			log.Println("Failed to send password reset email to", user.Email+":", err)
+		}
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "If an account exists for this email, a reset link has been sent", nil)
+}
+
+// ResetPassword sets a new password using a reset token. Signing in is
+// required afterwards on every device, and the account counts as verified
+// since the token proved access to its mailbox; a sign-in lockout ends.
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var input models.ResetPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		utils.ValidationError(c, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, ok := h.userForActionToken(ctx, c, input.Token, utils.PurposeResetPassword)
+	if !ok {
+		return
+	}
+
+	if !user.IsActive {
+		utils.ErrorResponse(c, http.StatusForbidden, "Account is deactivated")
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(input.Password)
+	if err != nil {
+		utils.InternalError(c, "Failed to hash password")
+		return
+	}
+
+	err = h.users.Update(ctx, user.ID, repository.Fields{
+		"password":      hashedPassword,
+		"is_verified":   true,
+		"failed_logins": 0,
+		"locked_until":  nil,
+		"updated_at":    time.Now(),
+	})
+	if err != nil {
+		utils.InternalError(c, "Failed to reset password")
+		return
+	}
+
+	if err := h.sessions.RevokeByUser(ctx, user.ID, primitive.NilObjectID, "password reset"); err != nil {
+		log.Println("Failed to revoke sessions after password reset:", err)
+	}
+	if err := h.revocations.RevokeUser(ctx, user.ID); err != nil {
+		log.Println("Failed to revoke access tokens after password reset:", err)
+	}
+
+	utils.SuccessResponse(c, http.StatusOK, "Password reset successfully", nil)
+}
+
+// userForActionToken resolves the user an emailed token was issued to,
+// writing an error response when the token is invalid, expired or already
+// used.
+func (h *AuthHandler) userForActionToken(ctx context.Context, c *gin.Context, token string, purpose utils.TokenPurpose) (*models.User, bool) {
+	claims, err := utils.ParseActionToken(token, purpose)
+	if err != nil {
+		utils.ValidationError(c, "Invalid or expired link")
+		return nil, false
+	}
+
+	userID, _ := primitive.ObjectIDFromHex(claims.UserID)
+	user, err := h.users.FindByID(ctx, userID)
+	if err != nil || !utils.CheckActionStamp(claims, user) {
+		utils.ValidationError(c, "Invalid or expired link")
+		return nil, false
+	}
+
+	return user, true
+}
+
+func (h *AuthHandler) sendVerificationEmail(ctx context.Context, user *models.User) error {
+	token, err := utils.GenerateActionToken(user, utils.PurposeVerifyEmail, config.AppConfig.VerifyTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	return h.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your eJewel email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\nThe link expires in %s.\n",
+			user.FirstName, actionLink("/verify-email", token), config.AppConfig.VerifyTokenTTL,
+		),
+	})
+}
+
+func (h *AuthHandler) sendResetEmail(ctx context.Context, user *models.User) error {
+	token, err := utils.GenerateActionToken(user, utils.PurposeResetPassword, config.AppConfig.ResetTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	return h.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your eJewel password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nWe received a request to reset your password. Choose a new one here:\n\n%s\n\nThe link expires in %s and can be used once. If you did not ask for this, you can ignore this email.\n",
+			user.FirstName, actionLink("/reset-password", token), config.AppConfig.ResetTokenTTL,
+		),
+	})
+}
+
+// actionLink builds a storefront link carrying an emailed token.
+func actionLink(path, token string) string {
+	return config.AppConfig.AppURL + path + "?token=" + url.QueryEscape(token)
+}
@@ -5,20 +5,21 @@ import (
 	"net/http"
 	"time"
 
-	"ejewel/internal/database"
 	"ejewel/internal/models"
+	"ejewel/internal/repository"
 	"ejewel/internal/utils"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-type WishlistHandler struct{}
+type WishlistHandler struct {
+	wishlists repository.WishlistRepository
+	products  repository.ProductRepository
+}
 
-func NewWishlistHandler() *WishlistHandler {
-	return &WishlistHandler{}
+func NewWishlistHandler(wishlists repository.WishlistRepository, products repository.ProductRepository) *WishlistHandler {
+	return &WishlistHandler{wishlists: wishlists, products: products}
 }
 
 func (h *WishlistHandler) GetWishlist(c *gin.Context) {
@@ -29,10 +30,9 @@ func (h *WishlistHandler) GetWishlist(c *gin.Context) {
 
 	objectID, _ := primitive.ObjectIDFromHex(userID.(string))
 
-	var wishlist models.Wishlist
-	err := database.Wishlists().FindOne(ctx, bson.M{"user_id": objectID}).Decode(&wishlist)
+	wishlist, err := h.wishlists.FindByUser(ctx, objectID)
 	if err != nil {
-		wishlist = models.Wishlist{
+		wishlist = &models.Wishlist{
 			UserID:   objectID,
 			Products: []primitive.ObjectID{},
 		}
@@ -41,12 +41,9 @@ func (h *WishlistHandler) GetWishlist(c *gin.Context) {
 	// Get product details for wishlist items
 	var products []models.WishlistProduct
 	if len(wishlist.Products) > 0 {
-		cursor, err := database.Products().Find(ctx, bson.M{"_id": bson.M{"$in": wishlist.Products}})
+		found, err := h.products.Find(ctx, repository.ProductQuery{IDs: wishlist.Products})
 		if err == nil {
-			defer cursor.Close(ctx)
-			for cursor.Next(ctx) {
-				var product models.Product
-				cursor.Decode(&product)
+			for _, product := range found {
 				products = append(products, models.WishlistProduct{
 					ID:            product.ID,
 					Name:          product.Name,
@@ -88,24 +85,14 @@ func (h *WishlistHandler) AddToWishlist(c *gin.Context) {
 	}
 
 	// Check if product exists
-	count, _ := database.Products().CountDocuments(ctx, bson.M{"_id": productID, "is_active": true})
-	if count == 0 {
+	product, err := h.products.FindByID(ctx, productID)
+	if err != nil || !product.IsActive {
 		utils.NotFoundError(c, "Product not found")
 		return
 	}
 
 	// Add to wishlist
-	opts := options.Update().SetUpsert(true)
-	_, err = database.Wishlists().UpdateOne(
-		ctx,
-		bson.M{"user_id": objectID},
-		bson.M{
-			"$addToSet":   bson.M{"products": productID},
-			"$set":        bson.M{"updated_at": time.Now()},
-			"$setOnInsert": bson.M{"user_id": objectID},
-		},
-		opts,
-	)
+	err = h.wishlists.AddProduct(ctx, objectID, productID)
 	if err != nil {
 		utils.InternalError(c, "Failed to add to wishlist")
 		return
@@ -128,14 +115,7 @@ func (h *WishlistHandler) RemoveFromWishlist(c *gin.Context) {
 		return
 	}
 
-	_, err = database.Wishlists().UpdateOne(
-		ctx,
-		bson.M{"user_id": objectID},
-		bson.M{
-			"$pull": bson.M{"products": productID},
-			"$set":  bson.M{"updated_at": time.Now()},
-		},
-	)
+	err = h.wishlists.RemoveProduct(ctx, objectID, productID)
 	if err != nil {
 		utils.InternalError(c, "Failed to remove from wishlist")
 		return
@@ -152,7 +132,7 @@ func (h *WishlistHandler) ClearWishlist(c *gin.Context) {
 
 	objectID, _ := primitive.ObjectIDFromHex(userID.(string))
 
-	_, err := database.Wishlists().DeleteOne(ctx, bson.M{"user_id": objectID})
+	err := h.wishlists.DeleteByUser(ctx, objectID)
 	if err != nil {
 		utils.InternalError(c, "Failed to clear wishlist")
 		return
@@ -160,4 +140,3 @@ func (h *WishlistHandler) ClearWishlist(c *gin.Context) {
 
 	utils.SuccessResponse(c, http.StatusOK, "Wishlist cleared", nil)
 }
-
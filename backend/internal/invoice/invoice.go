@@ -0,0 +1,85 @@
+// Package invoice issues GST invoices for orders and renders them as PDF.
+package invoice
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"ejewel/internal/config"
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+	"ejewel/internal/tax"
+)
+
+// Seller returns the invoicing party configured for the store.
+func Seller() models.InvoiceParty {
+	return models.InvoiceParty{
+		Name:  config.AppConfig.SellerName,
+		GSTIN: config.AppConfig.SellerGSTIN,
+		Address: models.Address{
+			Street:  config.AppConfig.SellerAddress,
+			State:   config.AppConfig.SellerState,
+			Country: "India",
+		},
+	}
+}
+
+// FinancialYear returns the Indian financial year (April to March) a date
+// falls in, e.g. "2026-27".
+func FinancialYear(t time.Time) string {
+	year := t.Year()
+	if t.Month() < time.April {
+		year--
+	}
+	return fmt.Sprintf("%d-%02d", year, (year+1)%100)
+}
+
+// NextNumber allocates the next invoice number in the financial year of
+// issuedAt. Numbers are consecutive within a year, as GST rules require.
+func NextNumber(ctx context.Context, counters repository.CounterRepository, issuedAt time.Time) (string, error) {
+	year := FinancialYear(issuedAt)
+
+	seq, err := counters.Next(ctx, "invoice/"+year)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("INV/%s/%06d", year, seq), nil
+}
+
+// Build prepares the invoice for an order. The tax is recomputed line by
+// line from the order items so every supply carries its HSN code and rate.
+func Build(order *models.Order, number string, seller models.InvoiceParty, issuedAt time.Time) *models.Invoice {
+	buyerAddress := order.ShippingInfo.Address
+
+	interstate := tax.IsInterstate(buyerAddress.State, seller.Address.State)
+	if order.TaxBreakup != nil {
+		interstate = order.TaxBreakup.Interstate
+	}
+	breakup, lines := tax.Compute(order.Items, order.Discount, interstate)
+
+	total := order.ShippingInfo.Cost
+	for _, line := range lines {
+		total += line.Total
+	}
+
+	return &models.Invoice{
+		Number:      number,
+		OrderNumber: order.OrderNumber,
+		IssuedAt:    issuedAt,
+		Seller:      seller,
+		Buyer: models.InvoiceParty{
+			Name:    order.UserName,
+			Email:   order.UserEmail,
+			Address: buyerAddress,
+		},
+		PlaceOfSupply: buyerAddress.State,
+		Lines:         lines,
+		Discount:      order.Discount,
+		Shipping:      order.ShippingInfo.Cost,
+		Tax:           breakup,
+		Total:         math.Round(total*100) / 100,
+	}
+}
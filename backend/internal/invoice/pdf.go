@@ -0,0 +1,308 @@
+package invoice
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"ejewel/internal/models"
+)
+
+// A4 page size and margins in points
+const (
+	pageWidth    = 595.0
+	pageHeight   = 842.0
+	marginLeft   = 40.0
+	marginRight  = 555.0
+	marginTop    = 800.0
+	marginBottom = 70.0
+)
+
+// RenderPDF lays the invoice out on A4 pages using the standard Helvetica
+// fonts, so no font files need to be embedded.
+func RenderPDF(inv *models.Invoice) []byte {
+	doc := &document{}
+	doc.newPage()
+
+	doc.text(marginLeft, doc.y, 16, true, "TAX INVOICE")
+	doc.y -= 28
+
+	// Seller on the left, invoice details on the right
+	top := doc.y
+	doc.text(marginLeft, doc.y, 11, true, inv.Seller.Name)
+	doc.y -= 14
+	for _, line := range addressLines(inv.Seller.Address) {
+		doc.text(marginLeft, doc.y, 9, false, line)
+		doc.y -= 12
+	}
+	if inv.Seller.GSTIN != "" {
+		doc.text(marginLeft, doc.y, 9, false, "GSTIN: "+inv.Seller.GSTIN)
+		doc.y -= 12
+	}
+	sellerBottom := doc.y
+
+	doc.y = top
+	for _, row := range [][2]string{
+		{"Invoice No:", inv.Number},
+		{"Invoice Date:", inv.IssuedAt.Format("02 Jan 2006")},
+		{"Order No:", inv.OrderNumber},
+		{"Place of Supply:", inv.PlaceOfSupply},
+	} {
+		doc.text(360, doc.y, 9, true, row[0])
+		doc.text(440, doc.y, 9, false, row[1])
+		doc.y -= 12
+	}
+	if sellerBottom < doc.y {
+		doc.y = sellerBottom
+	}
+	doc.y -= 10
+
+	doc.text(marginLeft, doc.y, 10, true, "Bill To / Ship To")
+	doc.y -= 14
+	doc.text(marginLeft, doc.y, 9, false, inv.Buyer.Name)
+	doc.y -= 12
+	for _, line := range addressLines(inv.Buyer.Address) {
+		doc.text(marginLeft, doc.y, 9, false, line)
+		doc.y -= 12
+	}
+	if inv.Buyer.Email != "" {
+		doc.text(marginLeft, doc.y, 9, false, inv.Buyer.Email)
+		doc.y -= 12
+	}
+	doc.y -= 10
+
+	columns := lineColumns(inv.Tax.Interstate)
+	doc.tableHeader(columns)
+	for _, line := range inv.Lines {
+		if doc.y < marginBottom {
+			doc.newPage()
+			doc.tableHeader(columns)
+		}
+		for _, column := range columns {
+			value := column.value(line)
+			if column.right {
+				doc.textRight(column.x, doc.y, 8, false, value)
+			} else {
+				doc.text(column.x, doc.y, 8, false, value)
+			}
+		}
+		doc.y -= 14
+	}
+	doc.rule(doc.y + 8)
+	doc.y -= 8
+
+	// Totals
+	totals := [][2]string{
+		{"Taxable value", money(inv.Tax.GoodsValue + inv.Tax.MakingValue)},
+	}
+	if inv.Tax.Interstate {
+		totals = append(totals, [2]string{"IGST", money(inv.Tax.IGST)})
+	} else {
+		totals = append(totals,
+			[2]string{"CGST", money(inv.Tax.CGST)},
+			[2]string{"SGST", money(inv.Tax.SGST)},
+		)
+	}
+	totals = append(totals, [2]string{"Shipping", money(inv.Shipping)})
+	if inv.Discount > 0 {
+		totals = append(totals, [2]string{"Discount (included in taxable value)", money(inv.Discount)})
+	}
+
+	if doc.y-float64(len(totals)+2)*14 < marginBottom {
+		doc.newPage()
+	}
+	for _, row := range totals {
+		doc.textRight(450, doc.y, 9, false, row[0])
+		doc.textRight(marginRight, doc.y, 9, false, row[1])
+		doc.y -= 14
+	}
+	doc.rule(doc.y + 8)
+	doc.y -= 6
+	doc.textRight(450, doc.y, 11, true, "Grand Total (INR)")
+	doc.textRight(marginRight, doc.y, 11, true, money(inv.Total))
+	doc.y -= 30
+
+	doc.text(marginLeft, doc.y, 8, false, "This is a computer generated invoice and does not require a signature.")
+
+	return doc.bytes()
+}
+
+type column struct {
+	title string
+	x     float64
+	right bool
+	value func(models.InvoiceLine) string
+}
+
+func lineColumns(interstate bool) []column {
+	columns := []column{
+		{"Description", marginLeft, false, func(l models.InvoiceLine) string { return truncate(l.Description, 45) }},
+		{"HSN/SAC", 250, false, func(l models.InvoiceLine) string { return l.HSNCode }},
+		{"Qty", 320, true, func(l models.InvoiceLine) string { return fmt.Sprintf("%d", l.Quantity) }},
+		{"Taxable", 385, true, func(l models.InvoiceLine) string { return money(l.TaxableValue) }},
+		{"Rate", 420, true, func(l models.InvoiceLine) string { return fmt.Sprintf("%g%%", l.TaxRate) }},
+	}
+	if interstate {
+		columns = append(columns,
+			column{"IGST", 490, true, func(l models.InvoiceLine) string { return money(l.IGST) }},
+		)
+	} else {
+		columns = append(columns,
+			column{"CGST", 465, true, func(l models.InvoiceLine) string { return money(l.CGST) }},
+			column{"SGST", 510, true, func(l models.InvoiceLine) string { return money(l.SGST) }},
+		)
+	}
+	return append(columns,
+		column{"Total", marginRight, true, func(l models.InvoiceLine) string { return money(l.Total) }},
+	)
+}
+
+func addressLines(address models.Address) []string {
+	var lines []string
+	if address.Street != "" {
+		lines = append(lines, address.Street)
+	}
+	var parts []string
+	for _, part := range []string{address.City, address.State, address.ZipCode} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) > 0 {
+		lines = append(lines, strings.Join(parts, ", "))
+	}
+	if address.Phone != "" {
+		lines = append(lines, "Phone: "+address.Phone)
+	}
+	return lines
+}
+
+func money(value float64) string {
+	return fmt.Sprintf("%.2f", value)
+}
+
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	return s[:max-3] + "..."
+}
+
+// document is a minimal PDF writer supporting text and horizontal rules.
+type document struct {
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+	y     float64
+}
+
+func (d *document) newPage() {
+	d.page = &bytes.Buffer{}
+	d.pages = append(d.pages, d.page)
+	d.y = marginTop
+}
+
+func (d *document) tableHeader(columns []column) {
+	d.rule(d.y + 12)
+	for _, column := range columns {
+		if column.right {
+			d.textRight(column.x, d.y, 8, true, column.title)
+		} else {
+			d.text(column.x, d.y, 8, true, column.title)
+		}
+	}
+	d.rule(d.y - 5)
+	d.y -= 18
+}
+
+func (d *document) text(x, y, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(d.page, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, escape(s))
+}
+
+// textRight draws s so that it ends at x. Widths are estimated from the
+// Helvetica metrics, which is close enough for numeric columns.
+func (d *document) textRight(x, y, size float64, bold bool, s string) {
+	d.text(x-textWidth(s, size), y, size, bold, s)
+}
+
+func (d *document) rule(y float64) {
+	fmt.Fprintf(d.page, "0.5 w %.2f %.2f m %.2f %.2f l S\n", marginLeft, y, marginRight, y)
+}
+
+func (d *document) bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+
+	// Objects 1-4 are fixed; each page then takes a page and a content object
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+i*2)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range d.pages {
+		object(fmt.Sprintf(
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, 6+i*2,
+		))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return out.Bytes()
+}
+
+// escape quotes PDF string delimiters and replaces characters the standard
+// fonts cannot encode.
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case r == '₹':
+			b.WriteString("Rs.")
+		case r < 32 || r > 126:
+			b.WriteRune('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func textWidth(s string, size float64) float64 {
+	width := 0.0
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			width += 0.556
+		case r == '.' || r == ',' || r == ' ' || r == 'I' || r == 'i' || r == 'l':
+			width += 0.278
+		case r >= 'A' && r <= 'Z':
+			width += 0.667
+		default:
+			width += 0.5
+		}
+	}
+	return width * size
+}
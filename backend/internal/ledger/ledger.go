@@ -0,0 +1,297 @@
+// Package ledger records what the marketplace owes each seller. A sale
+// entry is posted for every seller line of an order once the seller's part
+// is delivered, and refunded returns and cancelled orders post reversing
+// entries. Unsettled entries are paid out in batches.
+package ledger
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"ejewel/internal/config"
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrNothingToPay is returned when no seller is owed anything for a
+// period.
+var ErrNothingToPay = errors.New("no seller is owed a payout for this period")
+
+// ErrSaleNotPosted is returned when a sale to be reversed has not been
+// posted yet.
+var ErrSaleNotPosted = errors.New("sale not posted to the ledger yet")
+
+type Ledger struct {
+	entries     repository.LedgerRepository
+	commissions repository.CommissionRepository
+	payouts     repository.PayoutRepository
+	sellers     repository.SellerRepository
+	products    repository.ProductRepository
+}
+
+func New(entries repository.LedgerRepository, commissions repository.CommissionRepository, payouts repository.PayoutRepository, sellers repository.SellerRepository, products repository.ProductRepository) *Ledger {
+	return &Ledger{
+		entries:     entries,
+		commissions: commissions,
+		payouts:     payouts,
+		sellers:     sellers,
+		products:    products,
+	}
+}
+
+// RecordDelivery posts a sale for each line of the sellers whose part of
+// the order has been delivered. Lines already posted are skipped.
+func (l *Ledger) RecordDelivery(ctx context.Context, order *models.Order) error {
+	rules, err := l.commissions.FindAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, part := range order.Fulfilments {
+		if part.Status != models.OrderDelivered {
+			continue
+		}
+		for _, item := range order.Items {
+			if item.SellerID != part.SellerID {
+				continue
+			}
+
+			categoryID := primitive.NilObjectID
+			if product, err := l.products.FindByID(ctx, item.ProductID); err == nil {
+				categoryID = product.CategoryID
+			}
+
+			entry := sale(order, item, commissionRate(rules, item.SellerID, categoryID))
+			if err := l.entries.Record(ctx, &entry); err != nil && err != repository.ErrDuplicate {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RecordReturn reverses the seller's earnings for the units of a refunded
+// return, in proportion to the sale of the line. It returns
+// ErrSaleNotPosted while the sale itself is still on its way, so that the
+// reversal is retried after it.
+func (l *Ledger) RecordReturn(ctx context.Context, order *models.Order, returnRequest *models.ReturnRequest) error {
+	var line *models.OrderItem
+	for i := range order.Items {
+		if order.Items[i].ProductID == returnRequest.ProductID && order.Items[i].VariantID == returnRequest.VariantID {
+			line = &order.Items[i]
+			break
+		}
+	}
+	if line == nil || line.SellerID.IsZero() {
+		return nil
+	}
+
+	sold, err := l.entries.FindByKey(ctx, saleKey(order.ID, *line))
+	if err == repository.ErrNotFound {
+		return ErrSaleNotPosted
+	}
+	if err != nil {
+		return err
+	}
+
+	entry := reversal(sold, "reversal:"+returnRequest.ID.Hex(), returnRequest.Quantity)
+	entry.ReturnID = returnRequest.ID
+	if err := l.entries.Record(ctx, &entry); err != nil && err != repository.ErrDuplicate {
+		return err
+	}
+	return nil
+}
+
+// RecordRefund reverses the sales posted for a cancelled order that was
+// refunded in full, such as a seller's part delivered before the rest of
+// the order was cancelled. Like RecordReturn it returns ErrSaleNotPosted
+// while the sale of a delivered part is still on its way.
+func (l *Ledger) RecordRefund(ctx context.Context, order *models.Order) error {
+	for _, part := range order.Fulfilments {
+		if part.Status != models.OrderDelivered {
+			continue
+		}
+		for _, item := range order.Items {
+			if item.SellerID != part.SellerID {
+				continue
+			}
+
+			sold, err := l.entries.FindByKey(ctx, saleKey(order.ID, item))
+			if err == repository.ErrNotFound {
+				return ErrSaleNotPosted
+			}
+			if err != nil {
+				return err
+			}
+
+			entry := reversal(sold, "refund:"+sold.Key, sold.Quantity)
+			if err := l.entries.Record(ctx, &entry); err != nil && err != repository.ErrDuplicate {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// CreateBatch settles every entry recorded before the end of the period
+// that is not in a batch yet, including ones carried over from earlier
+// periods, and returns the batch. Sellers whose entries do not add up to a
+// positive amount are carried over again.
+func (l *Ledger) CreateBatch(ctx context.Context, from, to time.Time, createdBy primitive.ObjectID) (*models.PayoutBatch, error) {
+	balances, err := l.entries.Balances(ctx, repository.LedgerQuery{Unsettled: true, To: to})
+	if err != nil {
+		return nil, err
+	}
+
+	batch := models.PayoutBatch{
+		ID:          primitive.NewObjectID(),
+		PeriodStart: from,
+		PeriodEnd:   to,
+		Status:      models.PayoutPending,
+		Payouts:     []models.Payout{},
+		CreatedBy:   createdBy,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	for _, balance := range balances {
+		if round(balance.Net) > 0 {
+			batch.Payouts = append(batch.Payouts, models.Payout{SellerID: balance.SellerID})
+		}
+	}
+	if len(batch.Payouts) == 0 {
+		return nil, ErrNothingToPay
+	}
+
+	if err := l.payouts.Create(ctx, &batch); err != nil {
+		return nil, err
+	}
+
+	// Sum what was actually settled, which includes entries recorded
+	// since the balances were taken
+	batch.Total = 0
+	for i := range batch.Payouts {
+		payout := &batch.Payouts[i]
+		if err := l.entries.Settle(ctx, repository.LedgerQuery{SellerID: payout.SellerID, To: to}, batch.ID); err != nil {
+			return nil, err
+		}
+		settled, err := l.entries.Balances(ctx, repository.LedgerQuery{SellerID: payout.SellerID, PayoutID: batch.ID})
+		if err != nil {
+			return nil, err
+		}
+		if len(settled) > 0 {
+			payout.Entries = settled[0].Entries
+			payout.Gross = round(settled[0].Gross)
+			payout.Commission = round(settled[0].Commission)
+			payout.TaxWithheld = round(settled[0].TaxWithheld)
+			payout.Net = round(settled[0].Net)
+		}
+		if seller, err := l.sellers.FindByUser(ctx, payout.SellerID); err == nil {
+			payout.StoreName = seller.StoreName
+			payout.BankAccount = seller.KYC.BankAccount
+		}
+		batch.Total += payout.Net
+	}
+	batch.Total = round(batch.Total)
+
+	err = l.payouts.Update(ctx, batch.ID, nil, repository.Fields{
+		"payouts":    batch.Payouts,
+		"total":      batch.Total,
+		"updated_at": time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// MarkPaid records that a pending batch has been paid out.
+func (l *Ledger) MarkPaid(ctx context.Context, id primitive.ObjectID, reference string, paidBy primitive.ObjectID) error {
+	return l.payouts.Update(ctx, id, repository.Fields{"status": models.PayoutPending}, repository.Fields{
+		"status":     models.PayoutPaid,
+		"reference":  reference,
+		"paid_by":    paidBy,
+		"paid_at":    time.Now(),
+		"updated_at": time.Now(),
+	})
+}
+
+// sale works out a seller's earnings for an order line. The gross is what
+// the customer paid for the line: its share of the discounted subtotal
+// plus GST. Commission is charged on the gross, and tax is withheld on the
+// taxable value.
+func sale(order *models.Order, item models.OrderItem, rate float64) models.LedgerEntry {
+	gross, taxable := 0.0, 0.0
+	if order.Subtotal > 0 {
+		share := item.TotalPrice / order.Subtotal
+		gross = round(share * (order.Subtotal - order.Discount + order.Tax))
+		taxable = share * (order.Subtotal - order.Discount)
+	}
+
+	entry := models.LedgerEntry{
+		ID:             primitive.NewObjectID(),
+		Key:            saleKey(order.ID, item),
+		SellerID:       item.SellerID,
+		Type:           models.LedgerSale,
+		OrderID:        order.ID,
+		OrderNumber:    order.OrderNumber,
+		ProductID:      item.ProductID,
+		VariantID:      item.VariantID,
+		ProductName:    item.ProductName,
+		Quantity:       item.Quantity,
+		Gross:          gross,
+		CommissionRate: rate,
+		Commission:     round(gross * rate / 100),
+		TaxWithheld:    round(taxable * config.AppConfig.TaxWithholdingRate / 100),
+		CreatedAt:      time.Now(),
+	}
+	entry.Net = round(entry.Gross - entry.Commission - entry.TaxWithheld)
+	return entry
+}
+
+// reversal takes back the seller's earnings for quantity units of a sale.
+func reversal(sold *models.LedgerEntry, key string, quantity int) models.LedgerEntry {
+	share := float64(quantity) / float64(sold.Quantity)
+	entry := models.LedgerEntry{
+		ID:             primitive.NewObjectID(),
+		Key:            key,
+		SellerID:       sold.SellerID,
+		Type:           models.LedgerReversal,
+		OrderID:        sold.OrderID,
+		OrderNumber:    sold.OrderNumber,
+		ProductID:      sold.ProductID,
+		VariantID:      sold.VariantID,
+		ProductName:    sold.ProductName,
+		Quantity:       -quantity,
+		Gross:          -round(sold.Gross * share),
+		CommissionRate: sold.CommissionRate,
+		Commission:     -round(sold.Commission * share),
+		TaxWithheld:    -round(sold.TaxWithheld * share),
+		CreatedAt:      time.Now(),
+	}
+	entry.Net = round(entry.Gross - entry.Commission - entry.TaxWithheld)
+	return entry
+}
+
+func saleKey(orderID primitive.ObjectID, item models.OrderItem) string {
+	return "sale:" + orderID.Hex() + ":" + item.ProductID.Hex() + ":" + item.VariantID.Hex()
+}
+
+// commissionRate returns the rate of the most specific rule for the seller
+// and category, or the configured default.
+func commissionRate(rules []models.CommissionRule, sellerID, categoryID primitive.ObjectID) float64 {
+	rate, best := config.AppConfig.CommissionRate, -1
+	for i := range rules {
+		if ok, specificity := rules[i].Matches(sellerID, categoryID); ok && specificity > best {
+			rate, best = rules[i].Rate, specificity
+		}
+	}
+	return rate
+}
+
+func round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
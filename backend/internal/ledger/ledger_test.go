@@ -0,0 +1,138 @@
+package ledger
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"ejewel/internal/config"
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+	"ejewel/internal/repository/memory"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newTestLedger(t *testing.T) (*Ledger, repository.Repositories) {
+	t.Helper()
+	config.AppConfig = &config.Config{CommissionRate: 10, TaxWithholdingRate: 1}
+	repos := memory.NewRepositories()
+	return New(repos.Ledger, repos.Commissions, repos.Payouts, repos.Sellers, repos.Products), repos
+}
+
+// deliveredOrder is an order of two units from one seller, delivered.
+func deliveredOrder(sellerID primitive.ObjectID) *models.Order {
+	return &models.Order{
+		ID:          primitive.NewObjectID(),
+		OrderNumber: "ORD-LEDGER",
+		Items: []models.OrderItem{{
+			ProductID:  primitive.NewObjectID(),
+			SellerID:   sellerID,
+			Quantity:   2,
+			Price:      5000,
+			TotalPrice: 10000,
+		}},
+		Subtotal:    10000,
+		Total:       10000,
+		Status:      models.OrderDelivered,
+		Fulfilments: []models.Fulfilment{{SellerID: sellerID, Status: models.OrderDelivered}},
+		CreatedAt:   time.Now(),
+	}
+}
+
+func TestRecordDeliveryPostsEachSaleOnce(t *testing.T) {
+	l, repos := newTestLedger(t)
+	ctx := context.Background()
+	sellerID := primitive.NewObjectID()
+	order := deliveredOrder(sellerID)
+
+	for i := 0; i < 2; i++ {
+		if err := l.RecordDelivery(ctx, order); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := repos.Ledger.Find(ctx, repository.LedgerQuery{SellerID: sellerID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("%d entries, want 1", len(entries))
+	}
+	sale := entries[0]
+	if sale.Gross != 10000 || sale.Commission != 1000 || sale.TaxWithheld != 100 || sale.Net != 8900 {
+		t.Errorf("sale = %+v, want gross 10000, commission 1000, tax 100, net 8900", sale)
+	}
+}
+
+func TestRecordReturnWaitsForTheSale(t *testing.T) {
+	l, repos := newTestLedger(t)
+	ctx := context.Background()
+	sellerID := primitive.NewObjectID()
+	order := deliveredOrder(sellerID)
+	returnRequest := &models.ReturnRequest{
+		ID:        primitive.NewObjectID(),
+		OrderID:   order.ID,
+		ProductID: order.Items[0].ProductID,
+		Quantity:  1,
+	}
+
+	if err := l.RecordReturn(ctx, order, returnRequest); err != ErrSaleNotPosted {
+		t.Fatalf("reversing before the sale: err = %v, want ErrSaleNotPosted", err)
+	}
+
+	if err := l.RecordDelivery(ctx, order); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := l.RecordReturn(ctx, order, returnRequest); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	balances, err := repos.Ledger.Balances(ctx, repository.LedgerQuery{SellerID: sellerID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(balances) != 1 || balances[0].Entries != 2 || balances[0].Gross != 5000 || balances[0].Net != 4450 {
+		t.Errorf("balances = %+v, want half the sale left over two entries", balances)
+	}
+}
+
+func TestRecordRefundReversesDeliveredParts(t *testing.T) {
+	l, repos := newTestLedger(t)
+	ctx := context.Background()
+	delivered, pending := primitive.NewObjectID(), primitive.NewObjectID()
+	order := deliveredOrder(delivered)
+	order.Items = append(order.Items, models.OrderItem{
+		ProductID:  primitive.NewObjectID(),
+		SellerID:   pending,
+		Quantity:   1,
+		Price:      4000,
+		TotalPrice: 4000,
+	})
+	order.Subtotal, order.Total = 14000, 14000
+	order.Fulfilments = append(order.Fulfilments, models.Fulfilment{SellerID: pending, Status: models.OrderProcessing})
+
+	if err := l.RecordRefund(ctx, order); err != ErrSaleNotPosted {
+		t.Fatalf("reversing before the sale: err = %v, want ErrSaleNotPosted", err)
+	}
+
+	if err := l.RecordDelivery(ctx, order); err != nil {
+		t.Fatal(err)
+	}
+	order.Status = models.OrderRefunded
+	for i := 0; i < 2; i++ {
+		if err := l.RecordRefund(ctx, order); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	balances, err := repos.Ledger.Balances(ctx, repository.LedgerQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(balances) != 1 || balances[0].SellerID != delivered || balances[0].Entries != 2 || balances[0].Net != 0 {
+		t.Errorf("balances = %+v, want the delivered seller's sale reversed in full", balances)
+	}
+}
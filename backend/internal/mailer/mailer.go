@@ -0,0 +1,16 @@
+package mailer
+
+import "context"
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers transactional email such as verification and password
+// reset links.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
@@ -1,15 +1,24 @@
 package middleware
 
 import (
+	"context"
+	"net/http"
 	"strings"
+	"time"
 
+	"ejewel/internal/apikeys"
+	"ejewel/internal/config"
 	"ejewel/internal/models"
+	"ejewel/internal/rbac"
+	"ejewel/internal/revocation"
 	"ejewel/internal/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware accepts a valid access token only while the revocation
+// list still honours it.
+func AuthMiddleware(revocations *revocation.List) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -32,13 +41,90 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		err = checkRevocation(revocations, claims)
+		if err == revocation.ErrRevoked {
+			utils.UnauthorizedError(c, "Token has been revoked")
+			c.Abort()
+			return
+		}
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusServiceUnavailable, "Unable to verify token")
+			c.Abort()
+			return
+		}
+
 		c.Set("userId", claims.UserID)
 		c.Set("userEmail", claims.Email)
 		c.Set("userRole", claims.Role)
+		c.Set("sessionId", claims.SessionID)
+		c.Set("tokenId", claims.ID)
+		c.Set("mfa", claims.MFA)
+		c.Next()
+	}
+}
+
+// APIKeyOrAuthMiddleware accepts an API key in the X-API-Key header, and
+// otherwise a bearer token as AuthMiddleware does. A key acts for the staff
+// member who issued it, limited to its scopes, and within its rate limit.
+func APIKeyOrAuthMiddleware(revocations *revocation.List, keys *apikeys.Keys) gin.HandlerFunc {
+	bearer := AuthMiddleware(revocations)
+	return func(c *gin.Context) {
+		raw := c.GetHeader("X-API-Key")
+		if raw == "" {
+			bearer(c)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		key, user, err := keys.Authenticate(ctx, raw, c.ClientIP())
+		if err == apikeys.ErrInvalidKey {
+			utils.UnauthorizedError(c, "Invalid or expired API key")
+			c.Abort()
+			return
+		}
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusServiceUnavailable, "Unable to verify API key")
+			c.Abort()
+			return
+		}
+
+		allowed, wait, err := keys.Allow(ctx, key)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusServiceUnavailable, "Unable to verify API key")
+			c.Abort()
+			return
+		}
+		if !allowed {
+			utils.TooManyRequestsError(c, "API key rate limit exceeded", wait)
+			c.Abort()
+			return
+		}
+
+		c.Set("userId", user.ID.Hex())
+		c.Set("userEmail", user.Email)
+		c.Set("userRole", user.Role)
+		c.Set("apiKey", key)
 		c.Next()
 	}
 }
 
+// SignedInMiddleware refuses requests made with an API key, for actions
+// only a person should take, such as issuing keys.
+func SignedInMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("apiKey"); ok {
+			utils.ForbiddenError(c, "API keys cannot be used for this action")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// AdminMiddleware admits staff to the admin API. What each of them may do
+// there is checked per route by RequirePermission.
 func AdminMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		role, exists := c.Get("userRole")
@@ -48,8 +134,49 @@ func AdminMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		if role != models.RoleAdmin {
-			utils.ForbiddenError(c, "Admin access required")
+		if userRole, _ := role.(models.Role); !userRole.IsStaff() {
+			utils.ForbiddenError(c, "Staff access required")
+			c.Abort()
+			return
+		}
+
+		// API keys are only issued to signed in staff and need no second
+		// factor of their own
+		_, withKey := c.Get("apiKey")
+		if config.AppConfig.RequireAdmin2FA && !c.GetBool("mfa") && !withKey {
+			utils.ForbiddenError(c, "Two-factor authentication is required for admin access")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequirePermission lets the request through only when the user's role
+// grants the permission and, for requests made with an API key, so do the
+// key's scopes.
+func RequirePermission(roles *rbac.Roles, permission models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, _ := c.Get("userRole")
+		userRole, _ := role.(models.Role)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		allowed, err := roles.Allows(ctx, userRole, permission)
+		if err != nil {
+			utils.ErrorResponse(c, http.StatusServiceUnavailable, "Unable to check permissions")
+			c.Abort()
+			return
+		}
+		if !allowed {
+			utils.ForbiddenError(c, "Missing permission "+string(permission))
+			c.Abort()
+			return
+		}
+		if key, ok := c.Get("apiKey"); ok && !key.(*models.APIKey).Allows(permission) {
+			utils.ForbiddenError(c, "API key is missing scope "+string(permission))
 			c.Abort()
 			return
 		}
@@ -77,7 +204,7 @@ func SellerMiddleware() gin.HandlerFunc {
 	}
 }
 
-func OptionalAuthMiddleware() gin.HandlerFunc {
+func OptionalAuthMiddleware(revocations *revocation.List) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -92,7 +219,7 @@ func OptionalAuthMiddleware() gin.HandlerFunc {
 		}
 
 		claims, err := utils.ValidateToken(tokenParts[1])
-		if err != nil {
+		if err != nil || checkRevocation(revocations, claims) != nil {
 			c.Next()
 			return
 		}
@@ -100,7 +227,13 @@ func OptionalAuthMiddleware() gin.HandlerFunc {
 		c.Set("userId", claims.UserID)
 		c.Set("userEmail", claims.Email)
 		c.Set("userRole", claims.Role)
+		c.Set("sessionId", claims.SessionID)
 		c.Next()
 	}
 }
 
+func checkRevocation(revocations *revocation.List, claims *utils.Claims) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return revocations.Check(ctx, claims)
+}
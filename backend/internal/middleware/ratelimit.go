@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"ejewel/internal/ratelimit"
+	"ejewel/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxPeekedBody bounds how much of a request body is read to find the
+// account it is for.
+const maxPeekedBody = 64 << 10
+
+// LimitByIP meters the requests of each client IP in the route group. When
+// the store cannot be reached, requests are let through.
+func LimitByIP(store ratelimit.Store, group string, limit ratelimit.Limit) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !limit.Enabled() {
+			c.Next()
+			return
+		}
+		if !take(c, store, group+":ip:"+c.ClientIP(), limit) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// LimitByAccount meters the requests made for each account in the route
+// group: the signed in user's, or on sign in and sign up routes the one
+// named by the email in the body, or by the login challenge when a
+// two-factor code is entered. Requests made with an API key are left to
+// the key's own limit.
+func LimitByAccount(store ratelimit.Store, group string, limit ratelimit.Limit) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, withKey := c.Get("apiKey"); withKey || !limit.Enabled() {
+			c.Next()
+			return
+		}
+
+		account := c.GetString("userId")
+		if account == "" {
+			account = accountInBody(c)
+		}
+		if account == "" {
+			c.Next()
+			return
+		}
+		if !take(c, store, group+":account:"+account, limit) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// take removes a token from the bucket for key, and writes the 429
+// response and returns false when there is none.
+func take(c *gin.Context, store ratelimit.Store, key string, limit ratelimit.Limit) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	allowed, wait, err := store.Take(ctx, key, limit)
+	if err != nil {
+		log.Println("Rate limit store unavailable:", err)
+		return true
+	}
+	if !allowed {
+		utils.TooManyRequestsError(c, "Too many requests, please try again later", wait)
+		c.Abort()
+		return false
+	}
+	return true
+}
+
+// accountInBody returns the account a JSON body is for: the user a login
+// challenge was issued to, or else the normalised email field. The body is
+// left in place for the handler.
+func accountInBody(c *gin.Context) string {
+	if c.Request.Body == nil || !strings.HasPrefix(c.ContentType(), "application/json") {
+		return ""
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxPeekedBody))
+	c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+	if err != nil {
+		return ""
+	}
+
+	var fields struct {
+		Email          string `json:"email"`
+		ChallengeToken string `json:"challengeToken"`
+	}
+	json.Unmarshal(body, &fields)
+	if fields.ChallengeToken != "" {
+		if claims, err := utils.ParseActionToken(fields.ChallengeToken, utils.PurposeTwoFactorLogin); err == nil {
+			return claims.UserID
+		}
+	}
+	return strings.ToLower(strings.TrimSpace(fields.Email))
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// APIKey lets an integration such as an ERP or warehouse script call the
+// admin API without signing in. The key acts for the staff member who
+// issued it, limited to its scopes, and only its hash is stored.
+type APIKey struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name       string             `bson:"name" json:"name"`
+	Prefix     string             `bson:"prefix" json:"prefix"` // Start of the key, to tell keys apart
+	KeyHash    string             `bson:"key_hash" json:"-"`
+	Scopes     []Permission       `bson:"scopes" json:"scopes"`
+	RateLimit  int                `bson:"rate_limit" json:"rateLimit"` // Requests per minute
+	CreatedBy  primitive.ObjectID `bson:"created_by" json:"createdBy"`
+	ExpiresAt  *time.Time         `bson:"expires_at,omitempty" json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time         `bson:"last_used_at,omitempty" json:"lastUsedAt,omitempty"`
+	LastUsedIP string             `bson:"last_used_ip,omitempty" json:"lastUsedIp,omitempty"`
+	RevokedAt  *time.Time         `bson:"revoked_at,omitempty" json:"revokedAt,omitempty"`
+	RevokedBy  primitive.ObjectID `bson:"revoked_by,omitempty" json:"revokedBy,omitempty"`
+	CreatedAt  time.Time          `bson:"created_at" json:"createdAt"`
+}
+
+// IsActive reports whether the key can still be used.
+func (k *APIKey) IsActive(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// Allows reports whether the key's scopes grant the permission.
+func (k *APIKey) Allows(want Permission) bool {
+	for _, scope := range k.Scopes {
+		if scope.Grants(want) {
+			return true
+		}
+	}
+	return false
+}
+
+type CreateAPIKeyInput struct {
+	Name      string       `json:"name" binding:"required"`
+	Scopes    []Permission `json:"scopes" binding:"required,min=1"`
+	RateLimit int          `json:"rateLimit" binding:"min=0"` // Zero uses API_KEY_RATE_LIMIT
+	ExpiresAt *time.Time   `json:"expiresAt"`
+}
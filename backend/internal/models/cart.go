@@ -15,14 +15,31 @@ type CartItem struct {
 	Price       float64            `bson:"price" json:"price"`
 	Quantity    int                `bson:"quantity" json:"quantity"`
 	AddedAt     time.Time          `bson:"added_at" json:"addedAt"`
+
+	// Set when the cart is revalidated against the catalogue, never stored.
+	// Price then holds the current price and PreviousPrice the price the
+	// customer last saw.
+	PriceChanged      bool    `bson:"-" json:"priceChanged,omitempty"`
+	PreviousPrice     float64 `bson:"-" json:"previousPrice,omitempty"`
+	OutOfStock        bool    `bson:"-" json:"outOfStock,omitempty"`
+	AvailableQuantity int     `bson:"-" json:"availableQuantity"`
+	Unavailable       bool    `bson:"-" json:"unavailable,omitempty"`
 }
 
+// Cart belongs either to a user or, for guests, to the holder of an opaque
+// cart token. Guest carts expire at ExpiresAt unless they are used again.
 type Cart struct {
 	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	UserID    primitive.ObjectID `bson:"user_id" json:"userId"`
+	UserID    primitive.ObjectID `bson:"user_id,omitempty" json:"userId"`
+	TokenHash string             `bson:"token_hash,omitempty" json:"-"`
+	Token     string             `bson:"-" json:"token,omitempty"` // returned to guests only
 	Items     []CartItem         `bson:"items" json:"items"`
 	Total     float64            `bson:"total" json:"total"`
+	ExpiresAt time.Time          `bson:"expires_at,omitempty" json:"-"`
 	UpdatedAt time.Time          `bson:"updated_at" json:"updatedAt"`
+	// Set when a revalidated line changed; checkout is blocked until the
+	// customer acknowledges the changes
+	HasChanges bool `bson:"-" json:"hasChanges"`
 }
 
 type AddToCartInput struct {
@@ -52,4 +69,3 @@ type WishlistProduct struct {
 	IsActive      bool               `json:"isActive"`
 	Stock         int                `json:"stock"`
 }
-
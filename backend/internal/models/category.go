@@ -1,6 +1,7 @@
 package models
 
 import (
+	"sort"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -20,6 +21,113 @@ type Category struct {
 	UpdatedAt   time.Time          `bson:"updated_at" json:"updatedAt"`
 }
 
+// CategoryNode is a category with its subcategories.
+type CategoryNode struct {
+	Category
+	Children []CategoryNode `json:"children"`
+}
+
+// CategoryCrumb is one step of the path from the top of the tree down to a
+// category.
+type CategoryCrumb struct {
+	ID   primitive.ObjectID `json:"id"`
+	Name string             `json:"name"`
+	Slug string             `json:"slug"`
+}
+
+// CategoryDetail is a category with the path leading to it.
+type CategoryDetail struct {
+	Category
+	Breadcrumbs []CategoryCrumb `json:"breadcrumbs"`
+}
+
+// CategoryTree arranges categories by parent. Categories whose parent is
+// missing are placed at the top.
+type CategoryTree struct {
+	byID     map[primitive.ObjectID]*Category
+	children map[primitive.ObjectID][]*Category
+}
+
+func NewCategoryTree(categories []Category) *CategoryTree {
+	t := &CategoryTree{
+		byID:     make(map[primitive.ObjectID]*Category, len(categories)),
+		children: make(map[primitive.ObjectID][]*Category),
+	}
+	for i := range categories {
+		t.byID[categories[i].ID] = &categories[i]
+	}
+	for i := range categories {
+		parentID := categories[i].ParentID
+		if _, ok := t.byID[parentID]; !ok {
+			parentID = primitive.NilObjectID
+		}
+		t.children[parentID] = append(t.children[parentID], &categories[i])
+	}
+	for _, children := range t.children {
+		sort.SliceStable(children, func(i, j int) bool {
+			if children[i].SortOrder != children[j].SortOrder {
+				return children[i].SortOrder < children[j].SortOrder
+			}
+			return children[i].Name < children[j].Name
+		})
+	}
+	return t
+}
+
+// Nodes returns the nested tree ordered by sort order. With activeOnly,
+// inactive categories are left out together with everything below them.
+func (t *CategoryTree) Nodes(activeOnly bool) []CategoryNode {
+	var nodes func(parentID primitive.ObjectID, seen map[primitive.ObjectID]bool) []CategoryNode
+	nodes = func(parentID primitive.ObjectID, seen map[primitive.ObjectID]bool) []CategoryNode {
+		out := []CategoryNode{}
+		for _, category := range t.children[parentID] {
+			if seen[category.ID] || (activeOnly && !category.IsActive) {
+				continue
+			}
+			seen[category.ID] = true
+			out = append(out, CategoryNode{Category: *category, Children: nodes(category.ID, seen)})
+		}
+		return out
+	}
+	return nodes(primitive.NilObjectID, map[primitive.ObjectID]bool{})
+}
+
+// Breadcrumbs returns the path from the top of the tree down to the
+// category, ending with the category itself.
+func (t *CategoryTree) Breadcrumbs(id primitive.ObjectID) []CategoryCrumb {
+	crumbs := []CategoryCrumb{}
+	seen := map[primitive.ObjectID]bool{}
+	for category := t.byID[id]; category != nil && !seen[category.ID]; category = t.byID[category.ParentID] {
+		seen[category.ID] = true
+		crumbs = append([]CategoryCrumb{{ID: category.ID, Name: category.Name, Slug: category.Slug}}, crumbs...)
+	}
+	return crumbs
+}
+
+// Subtree returns the category and every category below it.
+func (t *CategoryTree) Subtree(id primitive.ObjectID) []primitive.ObjectID {
+	ids := []primitive.ObjectID{id}
+	seen := map[primitive.ObjectID]bool{id: true}
+	for i := 0; i < len(ids); i++ {
+		for _, child := range t.children[ids[i]] {
+			if !seen[child.ID] {
+				seen[child.ID] = true
+				ids = append(ids, child.ID)
+			}
+		}
+	}
+	return ids
+}
+
+// Children returns the categories directly below the category.
+func (t *CategoryTree) Children(id primitive.ObjectID) []Category {
+	children := make([]Category, 0, len(t.children[id]))
+	for _, child := range t.children[id] {
+		children = append(children, *child)
+	}
+	return children
+}
+
 type CreateCategoryInput struct {
 	Name        string `json:"name" binding:"required"`
 	Description string `json:"description"`
@@ -30,12 +138,11 @@ type CreateCategoryInput struct {
 }
 
 type UpdateCategoryInput struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Image       string `json:"image"`
-	Icon        string `json:"icon"`
-	ParentID    string `json:"parentId"`
-	IsActive    bool   `json:"isActive"`
-	SortOrder   int    `json:"sortOrder"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Image       string  `json:"image"`
+	Icon        string  `json:"icon"`
+	ParentID    *string `json:"parentId"` // An empty string moves the category to the top
+	IsActive    bool    `json:"isActive"`
+	SortOrder   int     `json:"sortOrder"`
 }
-
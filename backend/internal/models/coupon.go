@@ -0,0 +1,99 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type CouponType string
+
+const (
+	CouponPercentage   CouponType = "percentage"
+	CouponFlat         CouponType = "flat"
+	CouponFreeShipping CouponType = "free_shipping"
+	CouponBuyXGetY     CouponType = "buy_x_get_y"
+)
+
+type Coupon struct {
+	ID           primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	Code         string               `bson:"code" json:"code"`
+	Description  string               `bson:"description" json:"description"`
+	Type         CouponType           `bson:"type" json:"type"`
+	Value        float64              `bson:"value" json:"value"`              // percent or flat amount
+	MaxDiscount  float64              `bson:"max_discount" json:"maxDiscount"` // 0 means uncapped
+	BuyQuantity  int                  `bson:"buy_quantity" json:"buyQuantity"` // buy_x_get_y only
+	GetQuantity  int                  `bson:"get_quantity" json:"getQuantity"` // buy_x_get_y only
+	MinCartValue float64              `bson:"min_cart_value" json:"minCartValue"`
+	MetalTypes   []MetalType          `bson:"metal_types" json:"metalTypes"`
+	CategoryIDs  []primitive.ObjectID `bson:"category_ids" json:"categoryIds"`
+	UsageLimit   int                  `bson:"usage_limit" json:"usageLimit"`      // 0 means unlimited
+	PerUserLimit int                  `bson:"per_user_limit" json:"perUserLimit"` // 0 means unlimited
+	UsedCount    int                  `bson:"used_count" json:"usedCount"`
+	StartsAt     time.Time            `bson:"starts_at" json:"startsAt"`
+	ExpiresAt    time.Time            `bson:"expires_at" json:"expiresAt"`
+	IsActive     bool                 `bson:"is_active" json:"isActive"`
+	CreatedAt    time.Time            `bson:"created_at" json:"createdAt"`
+	UpdatedAt    time.Time            `bson:"updated_at" json:"updatedAt"`
+}
+
+// CouponUsage counts how often a user has redeemed a coupon.
+type CouponUsage struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CouponID primitive.ObjectID `bson:"coupon_id" json:"couponId"`
+	UserID   primitive.ObjectID `bson:"user_id" json:"userId"`
+	Count    int                `bson:"count" json:"count"`
+}
+
+type CreateCouponInput struct {
+	Code         string      `json:"code" binding:"required"`
+	Description  string      `json:"description"`
+	Type         CouponType  `json:"type" binding:"required"`
+	Value        float64     `json:"value"`
+	MaxDiscount  float64     `json:"maxDiscount"`
+	BuyQuantity  int         `json:"buyQuantity"`
+	GetQuantity  int         `json:"getQuantity"`
+	MinCartValue float64     `json:"minCartValue"`
+	MetalTypes   []MetalType `json:"metalTypes"`
+	CategoryIDs  []string    `json:"categoryIds"`
+	UsageLimit   int         `json:"usageLimit"`
+	PerUserLimit int         `json:"perUserLimit"`
+	StartsAt     time.Time   `json:"startsAt"`
+	ExpiresAt    time.Time   `json:"expiresAt"`
+}
+
+// UpdateCouponInput changes only the fields that are sent; a zero limit
+// still has to be sent explicitly to lift it.
+type UpdateCouponInput struct {
+	Description  *string     `json:"description"`
+	Value        *float64    `json:"value"`
+	MaxDiscount  *float64    `json:"maxDiscount"`
+	BuyQuantity  *int        `json:"buyQuantity"`
+	GetQuantity  *int        `json:"getQuantity"`
+	MinCartValue *float64    `json:"minCartValue"`
+	MetalTypes   []MetalType `json:"metalTypes"`
+	CategoryIDs  []string    `json:"categoryIds"`
+	UsageLimit   *int        `json:"usageLimit"`
+	PerUserLimit *int        `json:"perUserLimit"`
+	StartsAt     *time.Time  `json:"startsAt"`
+	ExpiresAt    *time.Time  `json:"expiresAt"`
+	IsActive     *bool       `json:"isActive"`
+}
+
+type ApplyCouponInput struct {
+	Code string `json:"code" binding:"required"`
+	// Optional; when given the preview includes the shipping cost
+	Pincode        string         `json:"pincode"`
+	ShippingMethod ShippingMethod `json:"shippingMethod"`
+}
+
+// CouponPreview shows what a coupon would take off the current cart.
+type CouponPreview struct {
+	Code         string     `json:"code"`
+	Type         CouponType `json:"type"`
+	Description  string     `json:"description"`
+	Subtotal     float64    `json:"subtotal"`
+	Discount     float64    `json:"discount"`
+	FreeShipping bool       `json:"freeShipping"`
+	ShippingCost float64    `json:"shippingCost"`
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// EventType names a change that other documents keep a copy of.
+type EventType string
+
+const (
+	// The category's name changed; products carry it as category_name
+	EventCategoryRenamed EventType = "category.renamed"
+	// The user's name or avatar changed; reviews carry them
+	EventUserProfileChanged EventType = "user.profile_changed"
+	// The product's name or thumbnail changed; cart lines carry them
+	EventProductChanged EventType = "product.changed"
+	// The order or a seller's part of it was delivered; the seller ledger
+	// posts the sales
+	EventOrderDelivered EventType = "order.delivered"
+	// The return was refunded; the seller ledger reverses the sale
+	EventReturnRefunded EventType = "return.refunded"
+	// The cancelled order was refunded; the seller ledger reverses the
+	// sales of parts delivered before it was cancelled
+	EventOrderRefunded EventType = "order.refunded"
+)
+
+type EventStatus string
+
+const (
+	EventPending EventStatus = "pending"
+	EventDone    EventStatus = "done"
+	EventFailed  EventStatus = "failed" // Gave up after the last attempt
+)
+
+// Event waits in the outbox until its handlers have copied the change to
+// the documents that denormalise it. Handlers read the subject's current
+// state, so events carry no payload and handling one twice is harmless.
+type Event struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Type      EventType          `bson:"type" json:"type"`
+	SubjectID primitive.ObjectID `bson:"subject_id" json:"subjectId"`
+	Status    EventStatus        `bson:"status" json:"status"`
+	Attempts  int                `bson:"attempts" json:"attempts"`
+	LastError string             `bson:"last_error,omitempty" json:"lastError,omitempty"`
+	RunAt     time.Time          `bson:"run_at" json:"runAt"` // When the event may next be attempted
+	DoneAt    *time.Time         `bson:"done_at,omitempty" json:"doneAt,omitempty"`
+	CreatedAt time.Time          `bson:"created_at" json:"createdAt"`
+}
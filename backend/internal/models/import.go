@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ImportStatus string
+
+const (
+	ImportQueued  ImportStatus = "queued"
+	ImportRunning ImportStatus = "running"
+	ImportDone    ImportStatus = "done"
+	ImportFailed  ImportStatus = "failed" // The file could not be read at all
+)
+
+// ImportJob tracks a product import running in the background. Products
+// with errors are skipped and reported; the rest are created, or updated
+// when their slug or a variant SKU is already in the catalogue. A dry run
+// checks the file and counts what would change without saving anything.
+type ImportJob struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	FileName   string             `bson:"file_name" json:"fileName"`
+	Format     string             `bson:"format" json:"format"`
+	DryRun     bool               `bson:"dry_run" json:"dryRun"`
+	Status     ImportStatus       `bson:"status" json:"status"`
+	Error      string             `bson:"error,omitempty" json:"error,omitempty"`
+	Products   int                `bson:"products" json:"products"`   // Read from the file
+	Processed  int                `bson:"processed" json:"processed"` // Checked so far
+	Created    int                `bson:"created" json:"created"`
+	Updated    int                `bson:"updated" json:"updated"`
+	Rejected   int                `bson:"rejected" json:"rejected"`
+	RowErrors  []ImportRowError   `bson:"row_errors" json:"rowErrors"`
+	Truncated  bool               `bson:"truncated" json:"truncated"` // More errors than listed
+	CreatedBy  primitive.ObjectID `bson:"created_by" json:"createdBy"`
+	CreatedAt  time.Time          `bson:"created_at" json:"createdAt"`
+	StartedAt  *time.Time         `bson:"started_at,omitempty" json:"startedAt,omitempty"`
+	FinishedAt *time.Time         `bson:"finished_at,omitempty" json:"finishedAt,omitempty"`
+	// HeartbeatAt is when the instance holding the job last reported it
+	// was still alive
+	HeartbeatAt time.Time `bson:"heartbeat_at" json:"-"`
+}
+
+// ImportRowError is a problem with one product of an import. Row is the
+// line of the file the product starts on.
+type ImportRowError struct {
+	Row     int    `bson:"row" json:"row"`
+	Product string `bson:"product,omitempty" json:"product,omitempty"` // Its slug or name
+	Error   string `bson:"error" json:"error"`
+}
@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// TaxBreakup splits the GST charged on an order. Goods are taxed at 3% and
+// making charges at 5%. Supplies within the seller's state split the tax
+// equally into CGST and SGST; supplies to other states are charged IGST.
+type TaxBreakup struct {
+	Interstate  bool    `bson:"interstate" json:"interstate"`
+	GoodsValue  float64 `bson:"goods_value" json:"goodsValue"`
+	GoodsTax    float64 `bson:"goods_tax" json:"goodsTax"`
+	MakingValue float64 `bson:"making_value" json:"makingValue"`
+	MakingTax   float64 `bson:"making_tax" json:"makingTax"`
+	CGST        float64 `bson:"cgst" json:"cgst"`
+	SGST        float64 `bson:"sgst" json:"sgst"`
+	IGST        float64 `bson:"igst" json:"igst"`
+	Total       float64 `bson:"total" json:"total"`
+}
+
+type InvoiceParty struct {
+	Name    string  `bson:"name" json:"name"`
+	GSTIN   string  `bson:"gstin,omitempty" json:"gstin,omitempty"`
+	Email   string  `bson:"email,omitempty" json:"email,omitempty"`
+	Address Address `bson:"address" json:"address"`
+}
+
+// InvoiceLine is one taxable supply on an invoice. Each order line yields a
+// goods line and, when the piece carries making charges, a separate
+// making charges line with its own HSN/SAC code and rate.
+type InvoiceLine struct {
+	Description  string  `bson:"description" json:"description"`
+	HSNCode      string  `bson:"hsn_code" json:"hsnCode"`
+	Quantity     int     `bson:"quantity" json:"quantity"`
+	TaxableValue float64 `bson:"taxable_value" json:"taxableValue"`
+	TaxRate      float64 `bson:"tax_rate" json:"taxRate"` // percent
+	CGST         float64 `bson:"cgst" json:"cgst"`
+	SGST         float64 `bson:"sgst" json:"sgst"`
+	IGST         float64 `bson:"igst" json:"igst"`
+	Total        float64 `bson:"total" json:"total"`
+}
+
+type Invoice struct {
+	Number        string        `bson:"number" json:"number"`
+	OrderNumber   string        `bson:"order_number" json:"orderNumber"`
+	IssuedAt      time.Time     `bson:"issued_at" json:"issuedAt"`
+	Seller        InvoiceParty  `bson:"seller" json:"seller"`
+	Buyer         InvoiceParty  `bson:"buyer" json:"buyer"`
+	PlaceOfSupply string        `bson:"place_of_supply" json:"placeOfSupply"`
+	Lines         []InvoiceLine `bson:"lines" json:"lines"`
+	Discount      float64       `bson:"discount" json:"discount"`
+	Shipping      float64       `bson:"shipping" json:"shipping"`
+	Tax           TaxBreakup    `bson:"tax" json:"tax"`
+	Total         float64       `bson:"total" json:"total"`
+}
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type LedgerEntryType string
+
+const (
+	// LedgerSale records what a seller earns for a delivered order line
+	LedgerSale LedgerEntryType = "sale"
+	// LedgerReversal takes back the earnings for returned units; its
+	// amounts are negative
+	LedgerReversal LedgerEntryType = "reversal"
+)
+
+// LedgerEntry is one movement in what the marketplace owes a seller. Each
+// entry has a unique key, so recording the same event twice has no effect.
+type LedgerEntry struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Key            string             `bson:"key" json:"-"`
+	SellerID       primitive.ObjectID `bson:"seller_id" json:"sellerId"`
+	Type           LedgerEntryType    `bson:"type" json:"type"`
+	OrderID        primitive.ObjectID `bson:"order_id" json:"orderId"`
+	OrderNumber    string             `bson:"order_number" json:"orderNumber"`
+	ReturnID       primitive.ObjectID `bson:"return_id,omitempty" json:"returnId,omitempty"`
+	ProductID      primitive.ObjectID `bson:"product_id" json:"productId"`
+	VariantID      primitive.ObjectID `bson:"variant_id,omitempty" json:"variantId,omitempty"`
+	ProductName    string             `bson:"product_name" json:"productName"`
+	Quantity       int                `bson:"quantity" json:"quantity"`
+	Gross          float64            `bson:"gross" json:"gross"`
+	CommissionRate float64            `bson:"commission_rate" json:"commissionRate"`
+	Commission     float64            `bson:"commission" json:"commission"`
+	TaxWithheld    float64            `bson:"tax_withheld" json:"taxWithheld"`
+	Net            float64            `bson:"net" json:"net"`
+	PayoutID       primitive.ObjectID `bson:"payout_id,omitempty" json:"payoutId,omitempty"`
+	CreatedAt      time.Time          `bson:"created_at" json:"createdAt"`
+}
+
+// CommissionRule sets the commission for a seller, a category or a seller
+// in a category. A zero ID applies to all; the most specific rule wins.
+type CommissionRule struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	SellerID   primitive.ObjectID `bson:"seller_id" json:"sellerId"`
+	CategoryID primitive.ObjectID `bson:"category_id" json:"categoryId"`
+	Rate       float64            `bson:"rate" json:"rate"`
+	CreatedAt  time.Time          `bson:"created_at" json:"createdAt"`
+	UpdatedAt  time.Time          `bson:"updated_at" json:"updatedAt"`
+}
+
+// Matches reports whether the rule applies to a sale by the seller in the
+// category, and how specific it is.
+func (r *CommissionRule) Matches(sellerID, categoryID primitive.ObjectID) (bool, int) {
+	if (!r.SellerID.IsZero() && r.SellerID != sellerID) || (!r.CategoryID.IsZero() && r.CategoryID != categoryID) {
+		return false, 0
+	}
+	specificity := 0
+	if !r.SellerID.IsZero() {
+		specificity += 2
+	}
+	if !r.CategoryID.IsZero() {
+		specificity++
+	}
+	return true, specificity
+}
+
+type SetCommissionRuleInput struct {
+	SellerID   string  `json:"sellerId"`
+	CategoryID string  `json:"categoryId"`
+	Rate       float64 `json:"rate" binding:"min=0,max=100"`
+}
+
+type PayoutStatus string
+
+const (
+	PayoutPending PayoutStatus = "pending"
+	PayoutPaid    PayoutStatus = "paid"
+)
+
+// Payout sums the ledger entries of one seller settled in a batch.
+type Payout struct {
+	SellerID    primitive.ObjectID `bson:"seller_id" json:"sellerId"`
+	StoreName   string             `bson:"store_name" json:"storeName"`
+	BankAccount BankAccount        `bson:"bank_account" json:"bankAccount"`
+	Entries     int                `bson:"entries" json:"entries"`
+	Gross       float64            `bson:"gross" json:"gross"`
+	Commission  float64            `bson:"commission" json:"commission"`
+	TaxWithheld float64            `bson:"tax_withheld" json:"taxWithheld"`
+	Net         float64            `bson:"net" json:"net"`
+}
+
+// PayoutBatch settles the ledger entries recorded in a period. Sellers who
+// are owed nothing overall are left out and carried over to a later batch.
+type PayoutBatch struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	PeriodStart time.Time          `bson:"period_start" json:"periodStart"`
+	PeriodEnd   time.Time          `bson:"period_end" json:"periodEnd"`
+	Status      PayoutStatus       `bson:"status" json:"status"`
+	Payouts     []Payout           `bson:"payouts" json:"payouts"`
+	Total       float64            `bson:"total" json:"total"`
+	Reference   string             `bson:"reference,omitempty" json:"reference,omitempty"`
+	CreatedBy   primitive.ObjectID `bson:"created_by" json:"createdBy"`
+	PaidBy      primitive.ObjectID `bson:"paid_by,omitempty" json:"paidBy,omitempty"`
+	PaidAt      time.Time          `bson:"paid_at,omitempty" json:"paidAt,omitempty"`
+	CreatedAt   time.Time          `bson:"created_at" json:"createdAt"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updatedAt"`
+}
+
+type CreatePayoutBatchInput struct {
+	From time.Time `json:"from" binding:"required"`
+	To   time.Time `json:"to" binding:"required"`
+}
+
+type MarkPayoutPaidInput struct {
+	Reference string `json:"reference" binding:"required"`
+}
@@ -18,6 +18,114 @@ const (
 	OrderRefunded   OrderStatus = "refunded"
 )
 
+// orderTransitions lists the statuses an order may move to from each status.
+// Orders only become refunded when the money goes back, through a return
+// or the cancellation of a paid order, never by an admin setting it.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderPending:    {OrderConfirmed, OrderCancelled},
+	OrderConfirmed:  {OrderProcessing, OrderCancelled},
+	OrderProcessing: {OrderShipped, OrderCancelled},
+	OrderShipped:    {OrderDelivered},
+	OrderDelivered:  {OrderRefunded},
+	OrderCancelled:  {OrderRefunded},
+	OrderRefunded:   {},
+}
+
+// CanTransitionTo reports whether an order may move from s to next.
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range orderTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValid reports whether s is a known order status.
+func (s OrderStatus) IsValid() bool {
+	_, ok := orderTransitions[s]
+	return ok
+}
+
+// fulfilmentSteps lists, in order, the statuses a seller's part of an
+// order goes through.
+var fulfilmentSteps = []OrderStatus{OrderPending, OrderProcessing, OrderShipped, OrderDelivered}
+
+func fulfilmentStep(s OrderStatus) int {
+	for i, step := range fulfilmentSteps {
+		if step == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// CanFulfilTo reports whether a seller's part of an order may move from s
+// to next. Parts move one step at a time and only the order as a whole can
+// be cancelled.
+func (s OrderStatus) CanFulfilTo(next OrderStatus) bool {
+	step := fulfilmentStep(s)
+	return step >= 0 && step+1 < len(fulfilmentSteps) && fulfilmentSteps[step+1] == next
+}
+
+// FulfilmentsBefore lists the statuses of the parts an order leaves behind
+// when it moves to status. Those parts follow the order.
+func FulfilmentsBefore(status OrderStatus) []OrderStatus {
+	if status == OrderCancelled {
+		return []OrderStatus{OrderPending, OrderProcessing}
+	}
+	if step := fulfilmentStep(status); step > 0 {
+		return append([]OrderStatus(nil), fulfilmentSteps[:step]...)
+	}
+	return nil
+}
+
+// RollUpStatus returns the status the order moves on to once every
+// seller's part has reached it, or "" when it is not due to move. Orders
+// with lines that no seller fulfils are only moved by the admin.
+func (o *Order) RollUpStatus() OrderStatus {
+	var next OrderStatus
+	switch o.Status {
+	case OrderConfirmed:
+		next = OrderProcessing
+	case OrderProcessing:
+		next = OrderShipped
+	case OrderShipped:
+		next = OrderDelivered
+	default:
+		return ""
+	}
+
+	if len(o.Fulfilments) == 0 {
+		return ""
+	}
+	for _, item := range o.Items {
+		if item.SellerID.IsZero() {
+			return ""
+		}
+	}
+	for _, part := range o.Fulfilments {
+		if fulfilmentStep(part.Status) < fulfilmentStep(next) {
+			return ""
+		}
+	}
+	return next
+}
+
+// Actors recorded in the status history besides user roles
+const ActorSystem = "system"
+
+// StatusHistoryEntry records one status change of an order.
+type StatusHistoryEntry struct {
+	Status     OrderStatus        `bson:"status" json:"status"`
+	Note       string             `bson:"note,omitempty" json:"note,omitempty"`
+	ActorID    primitive.ObjectID `bson:"actor_id,omitempty" json:"actorId,omitempty"`
+	ActorRole  string             `bson:"actor_role" json:"actor"`
+	TrackingID string             `bson:"tracking_id,omitempty" json:"trackingId,omitempty"`
+	Carrier    string             `bson:"carrier,omitempty" json:"carrier,omitempty"`
+	Timestamp  time.Time          `bson:"timestamp" json:"timestamp"`
+}
+
 type PaymentStatus string
 
 const (
@@ -25,6 +133,12 @@ const (
 	PaymentCompleted PaymentStatus = "completed"
 	PaymentFailed    PaymentStatus = "failed"
 	PaymentRefunded  PaymentStatus = "refunded"
+	PaymentExpired   PaymentStatus = "expired"
+
+	PaymentPartiallyRefunded PaymentStatus = "partially_refunded"
+	// The provider failed to refund a captured payment; finance pays it
+	// out by hand
+	PaymentNeedsRefund PaymentStatus = "needs_refund"
 )
 
 type PaymentMethod string
@@ -39,12 +153,29 @@ const (
 type OrderItem struct {
 	ProductID   primitive.ObjectID `bson:"product_id" json:"productId"`
 	ProductName string             `bson:"product_name" json:"productName"`
+	SellerID    primitive.ObjectID `bson:"seller_id,omitempty" json:"sellerId,omitempty"`
 	Thumbnail   string             `bson:"thumbnail" json:"thumbnail"`
 	VariantID   primitive.ObjectID `bson:"variant_id,omitempty" json:"variantId,omitempty"`
 	Size        string             `bson:"size" json:"size"`
 	Quantity    int                `bson:"quantity" json:"quantity"`
 	Price       float64            `bson:"price" json:"price"`
 	TotalPrice  float64            `bson:"total_price" json:"totalPrice"`
+	// Making charges included in Price, taxed separately from the goods
+	MakingCharges float64 `bson:"making_charges" json:"makingCharges"`
+	// Units covered by open or completed return requests
+	ReturnQuantity int `bson:"return_quantity" json:"returnQuantity"`
+}
+
+// Fulfilment is one seller's part of an order. Each seller moves their part
+// through processing, shipping and delivery on their own, and the order
+// follows once every part has got there.
+type Fulfilment struct {
+	SellerID   primitive.ObjectID   `bson:"seller_id" json:"sellerId"`
+	Status     OrderStatus          `bson:"status" json:"status"`
+	TrackingID string               `bson:"tracking_id,omitempty" json:"trackingId,omitempty"`
+	Carrier    string               `bson:"carrier,omitempty" json:"carrier,omitempty"`
+	History    []StatusHistoryEntry `bson:"history" json:"history"`
+	UpdatedAt  time.Time            `bson:"updated_at" json:"updatedAt"`
 }
 
 type ShippingInfo struct {
@@ -59,37 +190,62 @@ type ShippingInfo struct {
 type PaymentInfo struct {
 	Method        PaymentMethod `bson:"method" json:"method"`
 	Status        PaymentStatus `bson:"status" json:"status"`
+	Provider      string        `bson:"provider,omitempty" json:"provider,omitempty"`
+	IntentID      string        `bson:"intent_id,omitempty" json:"intentId,omitempty"`
+	ClientSecret  string        `bson:"-" json:"clientSecret,omitempty"` // only returned at checkout
 	TransactionID string        `bson:"transaction_id" json:"transactionId"`
+	FailureReason string        `bson:"failure_reason,omitempty" json:"failureReason,omitempty"`
+	ExpiresAt     time.Time     `bson:"expires_at" json:"expiresAt"`
 	PaidAt        time.Time     `bson:"paid_at" json:"paidAt"`
+	RefundID      string        `bson:"refund_id,omitempty" json:"refundId,omitempty"`
+	RefundedAt    time.Time     `bson:"refunded_at,omitempty" json:"refundedAt,omitempty"`
 }
 
 type Order struct {
-	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	OrderNumber   string             `bson:"order_number" json:"orderNumber"`
-	UserID        primitive.ObjectID `bson:"user_id" json:"userId"`
-	UserEmail     string             `bson:"user_email" json:"userEmail"`
-	UserName      string             `bson:"user_name" json:"userName"`
-	Items         []OrderItem        `bson:"items" json:"items"`
-	Subtotal      float64            `bson:"subtotal" json:"subtotal"`
-	Tax           float64            `bson:"tax" json:"tax"`
-	Discount      float64            `bson:"discount" json:"discount"`
-	CouponCode    string             `bson:"coupon_code" json:"couponCode"`
-	ShippingInfo  ShippingInfo       `bson:"shipping_info" json:"shippingInfo"`
-	PaymentInfo   PaymentInfo        `bson:"payment_info" json:"paymentInfo"`
-	Total         float64            `bson:"total" json:"total"`
-	Status        OrderStatus        `bson:"status" json:"status"`
-	Notes         string             `bson:"notes" json:"notes"`
-	CancelReason  string             `bson:"cancel_reason" json:"cancelReason"`
-	CreatedAt     time.Time          `bson:"created_at" json:"createdAt"`
-	UpdatedAt     time.Time          `bson:"updated_at" json:"updatedAt"`
+	ID             primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	OrderNumber    string               `bson:"order_number" json:"orderNumber"`
+	UserID         primitive.ObjectID   `bson:"user_id" json:"userId"`
+	UserEmail      string               `bson:"user_email" json:"userEmail"`
+	UserName       string               `bson:"user_name" json:"userName"`
+	Items          []OrderItem          `bson:"items" json:"items"`
+	Subtotal       float64              `bson:"subtotal" json:"subtotal"`
+	Tax            float64              `bson:"tax" json:"tax"`
+	TaxBreakup     *TaxBreakup          `bson:"tax_breakup,omitempty" json:"taxBreakup,omitempty"`
+	Discount       float64              `bson:"discount" json:"discount"`
+	CouponCode     string               `bson:"coupon_code" json:"couponCode"`
+	CouponID       primitive.ObjectID   `bson:"coupon_id,omitempty" json:"couponId,omitempty"`
+	ShippingInfo   ShippingInfo         `bson:"shipping_info" json:"shippingInfo"`
+	PaymentInfo    PaymentInfo          `bson:"payment_info" json:"paymentInfo"`
+	Total          float64              `bson:"total" json:"total"`
+	RefundedAmount float64              `bson:"refunded_amount" json:"refundedAmount"`
+	Status         OrderStatus          `bson:"status" json:"status"`
+	Notes          string               `bson:"notes" json:"notes"`
+	CancelReason   string               `bson:"cancel_reason" json:"cancelReason"`
+	DeliveredAt    time.Time            `bson:"delivered_at" json:"deliveredAt"`
+	StatusHistory  []StatusHistoryEntry `bson:"status_history" json:"statusHistory"`
+	Fulfilments    []Fulfilment         `bson:"fulfilments,omitempty" json:"fulfilments,omitempty"`
+	Invoice        *Invoice             `bson:"invoice,omitempty" json:"invoice,omitempty"`
+	CreatedAt      time.Time            `bson:"created_at" json:"createdAt"`
+	UpdatedAt      time.Time            `bson:"updated_at" json:"updatedAt"`
 }
 
 type CreateOrderInput struct {
-	AddressID     string        `json:"addressId" binding:"required"`
-	PaymentMethod PaymentMethod `json:"paymentMethod" binding:"required"`
-	ShippingMethod string       `json:"shippingMethod"`
-	CouponCode    string        `json:"couponCode"`
-	Notes         string        `json:"notes"`
+	AddressID      string         `json:"addressId" binding:"required"`
+	PaymentMethod  PaymentMethod  `json:"paymentMethod" binding:"required"`
+	ShippingMethod ShippingMethod `json:"shippingMethod"` // defaults to standard
+	CouponCode     string         `json:"couponCode"`
+	Notes          string         `json:"notes"`
+}
+
+// OrderItemError reports an order line that could not be fulfilled at checkout.
+type OrderItemError struct {
+	ProductID   primitive.ObjectID `json:"productId"`
+	ProductName string             `json:"productName"`
+	VariantID   primitive.ObjectID `json:"variantId,omitempty"`
+	Size        string             `json:"size,omitempty"`
+	Requested   int                `json:"requested"`
+	Available   int                `json:"available"`
+	Message     string             `json:"message"`
 }
 
 type UpdateOrderStatusInput struct {
@@ -97,5 +253,74 @@ type UpdateOrderStatusInput struct {
 	TrackingID   string      `json:"trackingId"`
 	Carrier      string      `json:"carrier"`
 	CancelReason string      `json:"cancelReason"`
+	Note         string      `json:"note"`
+}
+
+// OrderTimeline is the customer-facing status history of an order.
+type OrderTimeline struct {
+	OrderID     primitive.ObjectID   `json:"orderId"`
+	OrderNumber string               `json:"orderNumber"`
+	Status      OrderStatus          `json:"status"`
+	TrackingID  string               `json:"trackingId"`
+	Carrier     string               `json:"carrier"`
+	Entries     []StatusHistoryEntry `json:"entries"`
 }
 
+// Fulfilment returns the seller's part of the order, or nil.
+func (o *Order) Fulfilment(sellerID primitive.ObjectID) *Fulfilment {
+	for i := range o.Fulfilments {
+		if o.Fulfilments[i].SellerID == sellerID {
+			return &o.Fulfilments[i]
+		}
+	}
+	return nil
+}
+
+// SellerOrder is what a seller sees of an order: their own lines, their
+// part of the fulfilment and where to ship it.
+type SellerOrder struct {
+	OrderID         primitive.ObjectID `json:"orderId"`
+	OrderNumber     string             `json:"orderNumber"`
+	OrderStatus     OrderStatus        `json:"orderStatus"`
+	Items           []OrderItem        `json:"items"`
+	Subtotal        float64            `json:"subtotal"`
+	Fulfilment      Fulfilment         `json:"fulfilment"`
+	ShippingAddress Address            `json:"shippingAddress"`
+	ShippingMethod  string             `json:"shippingMethod"`
+	PaymentMethod   PaymentMethod      `json:"paymentMethod"`
+	CreatedAt       time.Time          `json:"createdAt"`
+}
+
+// ForSeller returns the seller's view of the order.
+func (o *Order) ForSeller(sellerID primitive.ObjectID) (SellerOrder, bool) {
+	fulfilment := o.Fulfilment(sellerID)
+	if fulfilment == nil {
+		return SellerOrder{}, false
+	}
+
+	view := SellerOrder{
+		OrderID:         o.ID,
+		OrderNumber:     o.OrderNumber,
+		OrderStatus:     o.Status,
+		Items:           []OrderItem{},
+		Fulfilment:      *fulfilment,
+		ShippingAddress: o.ShippingInfo.Address,
+		ShippingMethod:  o.ShippingInfo.Method,
+		PaymentMethod:   o.PaymentInfo.Method,
+		CreatedAt:       o.CreatedAt,
+	}
+	for _, item := range o.Items {
+		if item.SellerID == sellerID {
+			view.Items = append(view.Items, item)
+			view.Subtotal += item.TotalPrice
+		}
+	}
+	return view, true
+}
+
+type UpdateFulfilmentInput struct {
+	Status     OrderStatus `json:"status" binding:"required"`
+	TrackingID string      `json:"trackingId"`
+	Carrier    string      `json:"carrier"`
+	Note       string      `json:"note"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type MakingChargeType string
+
+const (
+	MakingPerGram MakingChargeType = "per_gram"
+	MakingPercent MakingChargeType = "percent"
+	MakingFlat    MakingChargeType = "flat"
+)
+
+// MakingCharge describes how labour is charged on top of the metal value.
+// Percent charges are applied to the metal value only.
+type MakingCharge struct {
+	Type  MakingChargeType `bson:"type" json:"type"`
+	Value float64          `bson:"value" json:"value"`
+}
+
+// MetalRate is the per-gram price of a metal at a given purity for one day.
+type MetalRate struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	MetalType   MetalType          `bson:"metal_type" json:"metalType"`
+	Purity      string             `bson:"purity" json:"purity"`
+	RatePerGram float64            `bson:"rate_per_gram" json:"ratePerGram"`
+	Date        string             `bson:"date" json:"date"` // YYYY-MM-DD
+	Source      string             `bson:"source" json:"source"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updatedAt"`
+}
+
+// PriceBreakup records how a rate-based price was derived.
+type PriceBreakup struct {
+	MetalRate     float64   `bson:"metal_rate" json:"metalRate"`
+	NetWeight     float64   `bson:"net_weight" json:"netWeight"`
+	MetalValue    float64   `bson:"metal_value" json:"metalValue"`
+	MakingCharges float64   `bson:"making_charges" json:"makingCharges"`
+	StoneValue    float64   `bson:"stone_value" json:"stoneValue"`
+	Total         float64   `bson:"total" json:"total"`
+	RateDate      string    `bson:"rate_date" json:"rateDate"`
+	ComputedAt    time.Time `bson:"computed_at" json:"computedAt"`
+}
+
+type MetalRateInput struct {
+	MetalType   MetalType `json:"metalType" binding:"required"`
+	Purity      string    `json:"purity" binding:"required"`
+	RatePerGram float64   `json:"ratePerGram" binding:"required,gt=0"`
+}
+
+type UpdateMetalRatesInput struct {
+	Rates []MetalRateInput `json:"rates" binding:"required,min=1,dive"`
+}
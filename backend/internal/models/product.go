@@ -16,43 +16,54 @@ const (
 )
 
 type ProductVariant struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	Size      string             `bson:"size" json:"size"`
-	Weight    float64            `bson:"weight" json:"weight"` // in grams
-	Price     float64            `bson:"price" json:"price"`
-	Stock     int                `bson:"stock" json:"stock"`
-	SKU       string             `bson:"sku" json:"sku"`
-	IsDefault bool               `bson:"is_default" json:"isDefault"`
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Size   string             `bson:"size" json:"size"`
+	Weight float64            `bson:"weight" json:"weight"` // net metal weight in grams
+	Price  float64            `bson:"price" json:"price"`
+	// Optional overrides of the product's making charge and stone value
+	// when the variant is rate priced
+	MakingCharge *MakingCharge `bson:"making_charge,omitempty" json:"makingCharge,omitempty"`
+	StoneValue   float64       `bson:"stone_value" json:"stoneValue"`
+	PriceBreakup *PriceBreakup `bson:"price_breakup,omitempty" json:"priceBreakup,omitempty"`
+	Stock        int           `bson:"stock" json:"stock"`
+	SKU          string        `bson:"sku" json:"sku"`
+	IsDefault    bool          `bson:"is_default" json:"isDefault"`
 }
 
 type Product struct {
-	ID             primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
-	Name           string               `bson:"name" json:"name"`
-	Slug           string               `bson:"slug" json:"slug"`
-	Description    string               `bson:"description" json:"description"`
-	ShortDesc      string               `bson:"short_desc" json:"shortDesc"`
-	MetalType      MetalType            `bson:"metal_type" json:"metalType"`
-	Purity         string               `bson:"purity" json:"purity"` // 22K, 24K, 925 Sterling, etc.
-	CategoryID     primitive.ObjectID   `bson:"category_id" json:"categoryId"`
-	CategoryName   string               `bson:"category_name" json:"categoryName"`
-	Images         []string             `bson:"images" json:"images"`
-	Thumbnail      string               `bson:"thumbnail" json:"thumbnail"`
-	BasePrice      float64              `bson:"base_price" json:"basePrice"`
-	DiscountPrice  float64              `bson:"discount_price" json:"discountPrice"`
-	DiscountPercent float64             `bson:"discount_percent" json:"discountPercent"`
-	Variants       []ProductVariant     `bson:"variants" json:"variants"`
-	Tags           []string             `bson:"tags" json:"tags"`
-	Features       []string             `bson:"features" json:"features"`
-	IsFeatured     bool                 `bson:"is_featured" json:"isFeatured"`
-	IsNewArrival   bool                 `bson:"is_new_arrival" json:"isNewArrival"`
-	IsBestSeller   bool                 `bson:"is_best_seller" json:"isBestSeller"`
-	IsActive       bool                 `bson:"is_active" json:"isActive"`
-	Stock          int                  `bson:"stock" json:"stock"`
-	Rating         float64              `bson:"rating" json:"rating"`
-	ReviewCount    int                  `bson:"review_count" json:"reviewCount"`
-	SellerID       primitive.ObjectID   `bson:"seller_id" json:"sellerId"`
-	CreatedAt      time.Time            `bson:"created_at" json:"createdAt"`
-	UpdatedAt      time.Time            `bson:"updated_at" json:"updatedAt"`
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name            string             `bson:"name" json:"name"`
+	Slug            string             `bson:"slug" json:"slug"`
+	Description     string             `bson:"description" json:"description"`
+	ShortDesc       string             `bson:"short_desc" json:"shortDesc"`
+	MetalType       MetalType          `bson:"metal_type" json:"metalType"`
+	Purity          string             `bson:"purity" json:"purity"` // 22K, 24K, 925 Sterling, etc.
+	CategoryID      primitive.ObjectID `bson:"category_id" json:"categoryId"`
+	CategoryName    string             `bson:"category_name" json:"categoryName"`
+	Images          []string           `bson:"images" json:"images"`
+	Thumbnail       string             `bson:"thumbnail" json:"thumbnail"`
+	BasePrice       float64            `bson:"base_price" json:"basePrice"`
+	DiscountPrice   float64            `bson:"discount_price" json:"discountPrice"`
+	DiscountPercent float64            `bson:"discount_percent" json:"discountPercent"`
+	// Rate-based pricing; a product with a net weight is priced from the
+	// current metal rates instead of a fixed BasePrice
+	NetWeight    float64            `bson:"net_weight" json:"netWeight"` // in grams
+	MakingCharge MakingCharge       `bson:"making_charge" json:"makingCharge"`
+	StoneValue   float64            `bson:"stone_value" json:"stoneValue"`
+	PriceBreakup *PriceBreakup      `bson:"price_breakup,omitempty" json:"priceBreakup,omitempty"`
+	Variants     []ProductVariant   `bson:"variants" json:"variants"`
+	Tags         []string           `bson:"tags" json:"tags"`
+	Features     []string           `bson:"features" json:"features"`
+	IsFeatured   bool               `bson:"is_featured" json:"isFeatured"`
+	IsNewArrival bool               `bson:"is_new_arrival" json:"isNewArrival"`
+	IsBestSeller bool               `bson:"is_best_seller" json:"isBestSeller"`
+	IsActive     bool               `bson:"is_active" json:"isActive"`
+	Stock        int                `bson:"stock" json:"stock"`
+	Rating       float64            `bson:"rating" json:"rating"`
+	ReviewCount  int                `bson:"review_count" json:"reviewCount"`
+	SellerID     primitive.ObjectID `bson:"seller_id" json:"sellerId"`
+	CreatedAt    time.Time          `bson:"created_at" json:"createdAt"`
+	UpdatedAt    time.Time          `bson:"updated_at" json:"updatedAt"`
 }
 
 type CreateProductInput struct {
@@ -64,8 +75,11 @@ type CreateProductInput struct {
 	CategoryID      string           `json:"categoryId" binding:"required"`
 	Images          []string         `json:"images"`
 	Thumbnail       string           `json:"thumbnail"`
-	BasePrice       float64          `json:"basePrice" binding:"required"`
+	BasePrice       float64          `json:"basePrice"`
 	DiscountPercent float64          `json:"discountPercent"`
+	NetWeight       float64          `json:"netWeight"`
+	MakingCharge    MakingCharge     `json:"makingCharge"`
+	StoneValue      float64          `json:"stoneValue"`
 	Variants        []ProductVariant `json:"variants"`
 	Tags            []string         `json:"tags"`
 	Features        []string         `json:"features"`
@@ -85,6 +99,9 @@ type UpdateProductInput struct {
 	Thumbnail       string           `json:"thumbnail"`
 	BasePrice       float64          `json:"basePrice"`
 	DiscountPercent float64          `json:"discountPercent"`
+	NetWeight       *float64         `json:"netWeight"`
+	MakingCharge    *MakingCharge    `json:"makingCharge"`
+	StoneValue      *float64         `json:"stoneValue"`
 	Variants        []ProductVariant `json:"variants"`
 	Tags            []string         `json:"tags"`
 	Features        []string         `json:"features"`
@@ -95,12 +112,17 @@ type UpdateProductInput struct {
 	Stock           int              `json:"stock"`
 }
 
+// ProductFilter is the product listing query. The facet filters take
+// comma separated values, any of which may match.
 type ProductFilter struct {
 	MetalType  string   `form:"metalType"`
 	CategoryID string   `form:"categoryId"`
 	MinPrice   float64  `form:"minPrice"`
 	MaxPrice   float64  `form:"maxPrice"`
+	PriceRange string   `form:"priceRange"` // Such as 10000-25000 or 250000-
 	Purity     string   `form:"purity"`
+	Rating     string   `form:"rating"` // Whole stars, 4 also matching 5
+	InStock    string   `form:"inStock"`
 	Tags       []string `form:"tags"`
 	Search     string   `form:"search"`
 	IsFeatured string   `form:"isFeatured"`
@@ -109,4 +131,3 @@ type ProductFilter struct {
 	Page       int      `form:"page"`
 	Limit      int      `form:"limit"`
 }
-
@@ -0,0 +1,124 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ReturnStatus string
+
+const (
+	ReturnRequested       ReturnStatus = "requested"
+	ReturnApproved        ReturnStatus = "approved"
+	ReturnRejected        ReturnStatus = "rejected"
+	ReturnPickupScheduled ReturnStatus = "pickup_scheduled"
+	ReturnInspected       ReturnStatus = "inspected"
+	ReturnRefunded        ReturnStatus = "refunded"
+)
+
+// returnTransitions lists the statuses a return may move to from each status.
+var returnTransitions = map[ReturnStatus][]ReturnStatus{
+	ReturnRequested:       {ReturnApproved, ReturnRejected},
+	ReturnApproved:        {ReturnPickupScheduled, ReturnRejected},
+	ReturnPickupScheduled: {ReturnInspected},
+	ReturnInspected:       {ReturnRefunded, ReturnRejected},
+	ReturnRejected:        {},
+	ReturnRefunded:        {},
+}
+
+// CanTransitionTo reports whether a return may move from s to next.
+func (s ReturnStatus) CanTransitionTo(next ReturnStatus) bool {
+	for _, allowed := range returnTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+type ReturnPickup struct {
+	ScheduledAt time.Time `bson:"scheduled_at" json:"scheduledAt"`
+	Carrier     string    `bson:"carrier" json:"carrier"`
+	TrackingID  string    `bson:"tracking_id" json:"trackingId"`
+	Address     Address   `bson:"address" json:"address"`
+}
+
+type ReturnInspection struct {
+	Passed      bool               `bson:"passed" json:"passed"`
+	Restocked   bool               `bson:"restocked" json:"restocked"`
+	Notes       string             `bson:"notes" json:"notes"`
+	InspectedBy primitive.ObjectID `bson:"inspected_by" json:"inspectedBy"`
+	InspectedAt time.Time          `bson:"inspected_at" json:"inspectedAt"`
+}
+
+type ReturnRefund struct {
+	Amount     float64   `bson:"amount" json:"amount"`
+	Provider   string    `bson:"provider" json:"provider"`
+	RefundID   string    `bson:"refund_id" json:"refundId"`
+	RefundedAt time.Time `bson:"refunded_at" json:"refundedAt"`
+}
+
+type ReturnHistoryEntry struct {
+	Status    ReturnStatus       `bson:"status" json:"status"`
+	Note      string             `bson:"note,omitempty" json:"note,omitempty"`
+	ActorID   primitive.ObjectID `bson:"actor_id,omitempty" json:"actorId,omitempty"`
+	ActorRole string             `bson:"actor_role" json:"actor"`
+	Timestamp time.Time          `bson:"timestamp" json:"timestamp"`
+}
+
+// ReturnRequest is a customer's request to return one line of a delivered
+// order.
+type ReturnRequest struct {
+	ID           primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	ReturnNumber string               `bson:"return_number" json:"returnNumber"`
+	OrderID      primitive.ObjectID   `bson:"order_id" json:"orderId"`
+	OrderNumber  string               `bson:"order_number" json:"orderNumber"`
+	UserID       primitive.ObjectID   `bson:"user_id" json:"userId"`
+	ProductID    primitive.ObjectID   `bson:"product_id" json:"productId"`
+	ProductName  string               `bson:"product_name" json:"productName"`
+	VariantID    primitive.ObjectID   `bson:"variant_id,omitempty" json:"variantId,omitempty"`
+	Size         string               `bson:"size" json:"size"`
+	Quantity     int                  `bson:"quantity" json:"quantity"`
+	UnitPrice    float64              `bson:"unit_price" json:"unitPrice"`
+	Reason       string               `bson:"reason" json:"reason"`
+	Photos       []string             `bson:"photos" json:"photos"`
+	Status       ReturnStatus         `bson:"status" json:"status"`
+	AdminNote    string               `bson:"admin_note" json:"adminNote"`
+	Pickup       *ReturnPickup        `bson:"pickup,omitempty" json:"pickup,omitempty"`
+	Inspection   *ReturnInspection    `bson:"inspection,omitempty" json:"inspection,omitempty"`
+	Refund       *ReturnRefund        `bson:"refund,omitempty" json:"refund,omitempty"`
+	History      []ReturnHistoryEntry `bson:"history" json:"history"`
+	CreatedAt    time.Time            `bson:"created_at" json:"createdAt"`
+	UpdatedAt    time.Time            `bson:"updated_at" json:"updatedAt"`
+}
+
+type CreateReturnInput struct {
+	ProductID string   `json:"productId" binding:"required"`
+	VariantID string   `json:"variantId"`
+	Quantity  int      `json:"quantity" binding:"required,min=1"`
+	Reason    string   `json:"reason" binding:"required"`
+	Photos    []string `json:"photos" binding:"max=5"`
+}
+
+type ReviewReturnInput struct {
+	Note string `json:"note"`
+}
+
+type ScheduleReturnPickupInput struct {
+	ScheduledAt time.Time `json:"scheduledAt" binding:"required"`
+	Carrier     string    `json:"carrier" binding:"required"`
+	TrackingID  string    `json:"trackingId"`
+}
+
+type InspectReturnInput struct {
+	Passed  bool   `json:"passed"`
+	Restock bool   `json:"restock"`
+	Notes   string `json:"notes"`
+}
+
+type RefundReturnInput struct {
+	// Amount overrides the computed refund, e.g. for a deduction after
+	// inspection. Zero refunds the line's share of the amount paid.
+	Amount float64 `json:"amount" binding:"min=0"`
+}
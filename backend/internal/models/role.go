@@ -0,0 +1,173 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Staff roles seeded on first start. Their permissions can be changed, and
+// further roles added, through the admin API.
+const (
+	RoleCatalogManager  Role = "catalog_manager"
+	RoleOrderFulfilment Role = "order_fulfilment"
+	RoleSupport         Role = "support"
+	RoleFinance         Role = "finance"
+)
+
+// IsStaff reports whether the role is a staff role defined in the roles
+// collection. Customers and sellers have no admin permissions.
+func (r Role) IsStaff() bool {
+	return r != RoleCustomer && r != RoleSeller && r != ""
+}
+
+// Permission names an action on the admin API as "resource:action".
+type Permission string
+
+const (
+	PermDashboardRead   Permission = "dashboard:read"
+	PermUsersRead       Permission = "users:read"
+	PermUsersWrite      Permission = "users:write"
+	PermRolesManage     Permission = "roles:manage"
+	PermProductsRead    Permission = "products:read"
+	PermProductsWrite   Permission = "products:write"
+	PermCategoriesWrite Permission = "categories:write"
+	PermOrdersRead      Permission = "orders:read"
+	PermOrdersStatus    Permission = "orders:status"
+	PermReturnsRead     Permission = "returns:read"
+	PermReturnsManage   Permission = "returns:manage"
+	PermRefundsIssue    Permission = "refunds:issue"
+	PermShippingRead    Permission = "shipping:read"
+	PermShippingWrite   Permission = "shipping:write"
+	PermRatesRead       Permission = "rates:read"
+	PermRatesWrite      Permission = "rates:write"
+	PermCouponsRead     Permission = "coupons:read"
+	PermCouponsWrite    Permission = "coupons:write"
+	PermReviewsModerate Permission = "reviews:moderate"
+	PermSellersRead     Permission = "sellers:read"
+	PermSellersManage   Permission = "sellers:manage"
+	PermPayoutsRead     Permission = "payouts:read"
+	PermPayoutsManage   Permission = "payouts:manage"
+	PermAPIKeysManage   Permission = "apikeys:manage"
+
+	// PermAll grants every permission, including ones added later
+	PermAll Permission = "*"
+)
+
+// Permissions lists every permission the API checks.
+var Permissions = []Permission{
+	PermDashboardRead,
+	PermUsersRead,
+	PermUsersWrite,
+	PermRolesManage,
+	PermProductsRead,
+	PermProductsWrite,
+	PermCategoriesWrite,
+	PermOrdersRead,
+	PermOrdersStatus,
+	PermReturnsRead,
+	PermReturnsManage,
+	PermRefundsIssue,
+	PermShippingRead,
+	PermShippingWrite,
+	PermRatesRead,
+	PermRatesWrite,
+	PermCouponsRead,
+	PermCouponsWrite,
+	PermReviewsModerate,
+	PermSellersRead,
+	PermSellersManage,
+	PermPayoutsRead,
+	PermPayoutsManage,
+	PermAPIKeysManage,
+}
+
+// Grants reports whether holding p allows want. Besides an exact match, p
+// may be "*" or a whole resource such as "orders:*".
+func (p Permission) Grants(want Permission) bool {
+	if p == PermAll || p == want {
+		return true
+	}
+	resource, action, ok := strings.Cut(string(p), ":")
+	return ok && action == "*" && strings.HasPrefix(string(want), resource+":")
+}
+
+// Valid reports whether p is a known permission or a wildcard over a known
+// resource.
+func (p Permission) Valid() bool {
+	if p == PermAll {
+		return true
+	}
+	for _, known := range Permissions {
+		if p.Grants(known) {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleDefinition lists what a staff role may do. System roles ship with the
+// application and cannot be changed or removed.
+type RoleDefinition struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name        Role               `bson:"name" json:"name"`
+	Description string             `bson:"description" json:"description"`
+	Permissions []Permission       `bson:"permissions" json:"permissions"`
+	IsSystem    bool               `bson:"is_system" json:"isSystem"`
+	CreatedAt   time.Time          `bson:"created_at" json:"createdAt"`
+	UpdatedAt   time.Time          `bson:"updated_at" json:"updatedAt"`
+}
+
+// Allows reports whether the role grants the permission.
+func (d *RoleDefinition) Allows(want Permission) bool {
+	for _, p := range d.Permissions {
+		if p.Grants(want) {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultRoles returns the roles installed on first start.
+func DefaultRoles() []RoleDefinition {
+	return []RoleDefinition{
+		{
+			Name:        RoleAdmin,
+			Description: "Full access to the admin API",
+			Permissions: []Permission{PermAll},
+			IsSystem:    true,
+		},
+		{
+			Name:        RoleCatalogManager,
+			Description: "Maintains products, categories and metal rates",
+			Permissions: []Permission{PermDashboardRead, PermProductsRead, PermProductsWrite, PermCategoriesWrite, PermRatesRead, PermRatesWrite},
+		},
+		{
+			Name:        RoleOrderFulfilment,
+			Description: "Moves orders and returns through fulfilment",
+			Permissions: []Permission{PermDashboardRead, PermOrdersRead, PermOrdersStatus, PermReturnsRead, PermReturnsManage, PermShippingRead, PermShippingWrite},
+		},
+		{
+			Name:        RoleSupport,
+			Description: "Helps customers with accounts, orders, returns and reviews",
+			Permissions: []Permission{PermUsersRead, PermOrdersRead, PermReturnsRead, PermReturnsManage, PermReviewsModerate, PermSellersRead},
+		},
+		{
+			Name:        RoleFinance,
+			Description: "Issues refunds, manages coupons and pays sellers",
+			Permissions: []Permission{PermDashboardRead, PermOrdersRead, PermReturnsRead, PermRefundsIssue, PermCouponsRead, PermCouponsWrite, PermRatesRead, PermPayoutsRead, PermPayoutsManage},
+		},
+	}
+}
+
+type CreateRoleInput struct {
+	Name        string       `json:"name" binding:"required"`
+	Description string       `json:"description"`
+	Permissions []Permission `json:"permissions" binding:"required"`
+}
+
+type UpdateRoleInput struct {
+	Description string       `json:"description"`
+	Permissions []Permission `json:"permissions" binding:"required"`
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type SellerStatus string
+
+const (
+	SellerPending   SellerStatus = "pending"
+	SellerApproved  SellerStatus = "approved"
+	SellerRejected  SellerStatus = "rejected"
+	SellerSuspended SellerStatus = "suspended"
+)
+
+// BankAccount is where a seller's payouts are sent.
+type BankAccount struct {
+	HolderName    string `bson:"holder_name" json:"holderName"`
+	AccountNumber string `bson:"account_number" json:"accountNumber"`
+	IFSC          string `bson:"ifsc" json:"ifsc"`
+}
+
+// KYC holds the identity and tax details a seller is approved on.
+type KYC struct {
+	LegalName   string      `bson:"legal_name" json:"legalName"`
+	PAN         string      `bson:"pan" json:"pan"`
+	GSTIN       string      `bson:"gstin" json:"gstin"`
+	BankAccount BankAccount `bson:"bank_account" json:"bankAccount"`
+	Documents   []string    `bson:"documents" json:"documents"` // Links to identity and address proofs
+}
+
+// Seller is a user's application to sell on the marketplace. The user only
+// gets the seller role once an admin approves it.
+type Seller struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID       primitive.ObjectID `bson:"user_id" json:"userId"`
+	StoreName    string             `bson:"store_name" json:"storeName"`
+	Description  string             `bson:"description" json:"description"`
+	ContactEmail string             `bson:"contact_email" json:"contactEmail"`
+	Phone        string             `bson:"phone" json:"phone"`
+	Address      Address            `bson:"address" json:"address"`
+	KYC          KYC                `bson:"kyc" json:"kyc"`
+	Status       SellerStatus       `bson:"status" json:"status"`
+	ReviewNote   string             `bson:"review_note,omitempty" json:"reviewNote,omitempty"`
+	ReviewedBy   primitive.ObjectID `bson:"reviewed_by,omitempty" json:"reviewedBy,omitempty"`
+	ReviewedAt   time.Time          `bson:"reviewed_at,omitempty" json:"reviewedAt,omitempty"`
+	CreatedAt    time.Time          `bson:"created_at" json:"createdAt"`
+	UpdatedAt    time.Time          `bson:"updated_at" json:"updatedAt"`
+}
+
+type SellerApplicationInput struct {
+	StoreName    string  `json:"storeName" binding:"required"`
+	Description  string  `json:"description"`
+	ContactEmail string  `json:"contactEmail" binding:"required,email"`
+	Phone        string  `json:"phone" binding:"required"`
+	Address      Address `json:"address" binding:"required"`
+	KYC          struct {
+		LegalName   string      `json:"legalName" binding:"required"`
+		PAN         string      `json:"pan" binding:"required"`
+		GSTIN       string      `json:"gstin" binding:"required"`
+		BankAccount BankAccount `json:"bankAccount" binding:"required"`
+		Documents   []string    `json:"documents" binding:"required,min=1"`
+	} `json:"kyc" binding:"required"`
+}
+
+type ReviewSellerInput struct {
+	Note string `json:"note"`
+}
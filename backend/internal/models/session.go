@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Session is one signed in device. Its refresh token rotates on every use;
+// the hashes of rotated tokens are kept so that presenting one again, which
+// means a copy of the token is in someone else's hands, revokes the whole
+// session. Only the most recent MaxUsedHashes are kept; a token that old
+// has long been superseded on the legitimate device too.
+type Session struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID       primitive.ObjectID `bson:"user_id" json:"-"`
+	UserAgent    string             `bson:"user_agent" json:"userAgent"`
+	IP           string             `bson:"ip" json:"ip"`
+	TokenHash    string             `bson:"token_hash" json:"-"`
+	UsedHashes   []string           `bson:"used_hashes" json:"-"`
+	MFA          bool               `bson:"mfa" json:"mfa"`
+	CreatedAt    time.Time          `bson:"created_at" json:"createdAt"`
+	LastUsedAt   time.Time          `bson:"last_used_at" json:"lastUsedAt"`
+	ExpiresAt    time.Time          `bson:"expires_at" json:"expiresAt"`
+	RevokedAt    *time.Time         `bson:"revoked_at,omitempty" json:"revokedAt,omitempty"`
+	RevokeReason string             `bson:"revoke_reason,omitempty" json:"-"`
+
+	// Current marks the session the request was made with
+	Current bool `bson:"-" json:"current"`
+}
+
+// MaxUsedHashes bounds how many rotated refresh token hashes a session
+// remembers for reuse detection.
+const MaxUsedHashes = 20
+
+// IsActive reports whether the session can still be refreshed.
+func (s *Session) IsActive(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ShippingMethod string
+
+const (
+	ShippingStandard ShippingMethod = "standard"
+	ShippingExpress  ShippingMethod = "express"
+	ShippingInsured  ShippingMethod = "insured"
+)
+
+// PincodeRange is an inclusive range of six digit pincodes.
+type PincodeRange struct {
+	From int `bson:"from" json:"from" binding:"required"`
+	To   int `bson:"to" json:"to" binding:"required"`
+}
+
+// ShippingRate prices one shipping method within a zone. The base charge
+// covers the first weight slab, each further started slab adds the slab
+// charge, and a percentage of the declared value is added on top.
+type ShippingRate struct {
+	Method       ShippingMethod `bson:"method" json:"method" binding:"required"`
+	BaseCharge   float64        `bson:"base_charge" json:"baseCharge"`
+	SlabGrams    float64        `bson:"slab_grams" json:"slabGrams"` // defaults to 500g
+	SlabCharge   float64        `bson:"slab_charge" json:"slabCharge"`
+	ValuePercent float64        `bson:"value_percent" json:"valuePercent"` // e.g. insurance premium
+	FreeAbove    float64        `bson:"free_above" json:"freeAbove"`       // 0 means never free
+	MaxValue     float64        `bson:"max_value" json:"maxValue"`         // 0 means no limit
+	MinDays      int            `bson:"min_days" json:"minDays"`
+	MaxDays      int            `bson:"max_days" json:"maxDays" binding:"required,gt=0"`
+}
+
+type ShippingZone struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name     string             `bson:"name" json:"name"`
+	Pincodes []PincodeRange     `bson:"pincodes" json:"pincodes"`
+	Rates    []ShippingRate     `bson:"rates" json:"rates"`
+	// Cash on delivery is offered up to CODLimit (0 means no limit)
+	CODAvailable bool      `bson:"cod_available" json:"codAvailable"`
+	CODLimit     float64   `bson:"cod_limit" json:"codLimit"`
+	IsActive     bool      `bson:"is_active" json:"isActive"`
+	CreatedAt    time.Time `bson:"created_at" json:"createdAt"`
+	UpdatedAt    time.Time `bson:"updated_at" json:"updatedAt"`
+}
+
+// ShippingOption is a priced shipping method for a parcel.
+type ShippingOption struct {
+	Method        ShippingMethod `json:"method"`
+	Cost          float64        `json:"cost"`
+	MinDays       int            `json:"minDays"`
+	MaxDays       int            `json:"maxDays"`
+	EstimatedDate time.Time      `json:"estimatedDate"`
+}
+
+type ShippingQuote struct {
+	Pincode       string           `json:"pincode"`
+	Zone          string           `json:"zone"`
+	CODAvailable  bool             `json:"codAvailable"`
+	Weight        float64          `json:"weight"` // grams, including packaging
+	DeclaredValue float64          `json:"declaredValue"`
+	Options       []ShippingOption `json:"options"`
+}
+
+type CreateShippingZoneInput struct {
+	Name         string         `json:"name" binding:"required"`
+	Pincodes     []PincodeRange `json:"pincodes" binding:"required,min=1,dive"`
+	Rates        []ShippingRate `json:"rates" binding:"required,min=1,dive"`
+	CODAvailable bool           `json:"codAvailable"`
+	CODLimit     float64        `json:"codLimit"`
+}
+
+// UpdateShippingZoneInput changes only the fields that are sent.
+type UpdateShippingZoneInput struct {
+	Name         string         `json:"name"`
+	Pincodes     []PincodeRange `json:"pincodes" binding:"omitempty,dive"`
+	Rates        []ShippingRate `json:"rates" binding:"omitempty,dive"`
+	CODAvailable *bool          `json:"codAvailable"`
+	CODLimit     *float64       `json:"codLimit"`
+	IsActive     *bool          `json:"isActive"`
+}
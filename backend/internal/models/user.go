@@ -38,11 +38,26 @@ type User struct {
 	Addresses    []Address          `bson:"addresses" json:"addresses"`
 	IsActive     bool               `bson:"is_active" json:"isActive"`
 	IsVerified   bool               `bson:"is_verified" json:"isVerified"`
-	RefreshToken string             `bson:"refresh_token" json:"-"`
+	TwoFactor    TwoFactor          `bson:"two_factor" json:"twoFactor"`
+	TokenVersion int                `bson:"token_version" json:"-"` // bumped to invalidate issued access tokens
+	FailedLogins int                `bson:"failed_logins" json:"-"` // wrong passwords since the last sign in
+	LockedUntil  *time.Time         `bson:"locked_until" json:"-"`
 	CreatedAt    time.Time          `bson:"created_at" json:"createdAt"`
 	UpdatedAt    time.Time          `bson:"updated_at" json:"updatedAt"`
 }
 
+// TwoFactor holds a user's TOTP enrolment. The secret only takes effect
+// once a code from it has been confirmed; until then it waits in
+// PendingSecret. Recovery codes are stored hashed and each works once.
+type TwoFactor struct {
+	Enabled       bool      `bson:"enabled" json:"enabled"`
+	Secret        string    `bson:"secret,omitempty" json:"-"`
+	PendingSecret string    `bson:"pending_secret,omitempty" json:"-"`
+	RecoveryCodes []string  `bson:"recovery_codes,omitempty" json:"-"`
+	LastStep      int64     `bson:"last_step,omitempty" json:"-"`
+	EnabledAt     time.Time `bson:"enabled_at,omitempty" json:"enabledAt,omitempty"`
+}
+
 type RegisterInput struct {
 	Email     string `json:"email" binding:"required,email"`
 	Password  string `json:"password" binding:"required,min=6"`
@@ -56,6 +71,19 @@ type LoginInput struct {
 	Password string `json:"password" binding:"required"`
 }
 
+type VerifyEmailInput struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ForgotPasswordInput struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordInput struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
 type UpdateUserInput struct {
 	FirstName string    `json:"firstName"`
 	LastName  string    `json:"lastName"`
@@ -68,5 +96,35 @@ type AuthResponse struct {
 	User         *User  `json:"user"`
 	AccessToken  string `json:"accessToken"`
 	RefreshToken string `json:"refreshToken"`
+
+	// Set for admins who must enrol in two-factor authentication before
+	// they can use the admin API
+	TwoFactorSetupRequired bool `json:"twoFactorSetupRequired,omitempty"`
 }
 
+// TwoFactorChallenge is returned by the first login step when the account
+// has two-factor authentication on.
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool   `json:"twoFactorRequired"`
+	ChallengeToken    string `json:"challengeToken"`
+}
+
+type TwoFactorLoginInput struct {
+	ChallengeToken string `json:"challengeToken" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+type TwoFactorCodeInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type DisableTwoFactorInput struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// TwoFactorSetup is shown once when enrolment starts.
+type TwoFactorSetup struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioningUri"`
+}
@@ -0,0 +1,101 @@
+package payments
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// SignatureHeader carries the HMAC of the webhook body.
+const SignatureHeader = "X-Webhook-Signature"
+
+// MockProvider accepts every intent and relies on signed webhooks, sent by
+// hand or through SignedEvent, to move payments along. It is meant for local
+// development and tests.
+type MockProvider struct {
+	secret string
+	ttl    time.Duration
+}
+
+func NewMockProvider(secret string, ttl time.Duration) *MockProvider {
+	return &MockProvider{secret: secret, ttl: ttl}
+}
+
+type mockWebhook struct {
+	ID   string    `json:"id"`
+	Type EventType `json:"type"`
+	Data struct {
+		IntentID      string `json:"intentId"`
+		TransactionID string `json:"transactionId"`
+		Reason        string `json:"reason"`
+	} `json:"data"`
+}
+
+func (p *MockProvider) Name() string {
+	return "mock"
+}
+
+func (p *MockProvider) CreateIntent(ctx context.Context, req IntentRequest) (*Intent, error) {
+	id := "pi_mock_" + randomHex(12)
+	return &Intent{
+		ID:           id,
+		ClientSecret: id + "_secret_" + randomHex(12),
+		Amount:       req.Amount,
+		Currency:     req.Currency,
+		ExpiresAt:    time.Now().Add(p.ttl),
+	}, nil
+}
+
+func (p *MockProvider) ParseWebhook(header http.Header, payload []byte) (*Event, error) {
+	if !VerifySignature(p.secret, payload, header.Get(SignatureHeader)) {
+		return nil, ErrInvalidSignature
+	}
+
+	var webhook mockWebhook
+	if err := json.Unmarshal(payload, &webhook); err != nil {
+		return nil, err
+	}
+
+	return &Event{
+		ID:            webhook.ID,
+		Type:          webhook.Type,
+		IntentID:      webhook.Data.IntentID,
+		TransactionID: webhook.Data.TransactionID,
+		Reason:        webhook.Data.Reason,
+	}, nil
+}
+
+func (p *MockProvider) Refund(ctx context.Context, req RefundRequest) (*Refund, error) {
+	return &Refund{
+		ID:     "rf_mock_" + randomHex(12),
+		Amount: req.Amount,
+	}, nil
+}
+
+// SignedEvent builds a webhook body and signature as the gateway would send
+// them, so local clients can simulate a customer completing payment.
+func (p *MockProvider) SignedEvent(eventType EventType, intentID, reason string) ([]byte, string, error) {
+	var webhook mockWebhook
+	webhook.ID = "evt_mock_" + randomHex(12)
+	webhook.Type = eventType
+	webhook.Data.IntentID = intentID
+	webhook.Data.Reason = reason
+	if eventType == EventCaptured {
+		webhook.Data.TransactionID = "txn_mock_" + randomHex(12)
+	}
+
+	payload, err := json.Marshal(webhook)
+	if err != nil {
+		return nil, "", err
+	}
+	return payload, Sign(p.secret, payload), nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
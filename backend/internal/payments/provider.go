@@ -0,0 +1,91 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+)
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+type EventType string
+
+const (
+	EventCaptured EventType = "payment.captured"
+	EventFailed   EventType = "payment.failed"
+	EventExpired  EventType = "payment.expired"
+)
+
+// IntentRequest asks a provider to start collecting payment for an order.
+type IntentRequest struct {
+	OrderID     string
+	OrderNumber string
+	Amount      float64
+	Currency    string
+	Method      string
+	Email       string
+}
+
+// Intent is a provider-side payment attempt for an order.
+type Intent struct {
+	ID           string
+	ClientSecret string
+	Amount       float64
+	Currency     string
+	ExpiresAt    time.Time
+}
+
+// Event is a verified payment status change received from a provider.
+type Event struct {
+	ID            string
+	Type          EventType
+	IntentID      string
+	TransactionID string
+	Reason        string
+}
+
+// RefundRequest returns part or all of a captured payment.
+type RefundRequest struct {
+	IntentID      string
+	TransactionID string
+	Amount        float64
+	Reason        string
+}
+
+type Refund struct {
+	ID     string
+	Amount float64
+}
+
+// Provider is implemented by every payment gateway integration.
+type Provider interface {
+	Name() string
+	CreateIntent(ctx context.Context, req IntentRequest) (*Intent, error)
+	// ParseWebhook verifies the signature of a webhook request and decodes
+	// its payload. It returns ErrInvalidSignature for forged requests.
+	ParseWebhook(header http.Header, payload []byte) (*Event, error)
+	Refund(ctx context.Context, req RefundRequest) (*Refund, error)
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of payload.
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature compares a hex encoded HMAC-SHA256 signature in constant
+// time.
+func VerifySignature(secret string, payload []byte, signature string) bool {
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hmac.Equal(expected, mac.Sum(nil))
+}
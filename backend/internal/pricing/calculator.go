@@ -0,0 +1,131 @@
+package pricing
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"ejewel/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// finePurity is the purity each metal's base rate is quoted at when no
+// rate exists for the exact purity of a product.
+var finePurity = map[models.MetalType]string{
+	models.MetalGold:     "24K",
+	models.MetalSilver:   "999 Silver",
+	models.MetalPlatinum: "999 Platinum",
+}
+
+// rateMetal maps metals that are priced off another metal's rate.
+func rateMetal(metal models.MetalType) models.MetalType {
+	if metal == models.MetalRoseGold {
+		return models.MetalGold
+	}
+	return metal
+}
+
+// PurityFactor converts a purity label into the fraction of fine metal,
+// e.g. "22K" is 22/24 and "925 Sterling" is 0.925. It returns 0 for labels
+// it does not understand.
+func PurityFactor(purity string) float64 {
+	purity = strings.TrimSpace(strings.ToUpper(purity))
+
+	end := strings.IndexFunc(purity, func(r rune) bool { return !unicode.IsDigit(r) && r != '.' })
+	if end == -1 {
+		end = len(purity)
+	}
+	value, err := strconv.ParseFloat(purity[:end], 64)
+	if err != nil || value <= 0 {
+		return 0
+	}
+
+	if strings.HasPrefix(purity[end:], "K") {
+		return math.Min(value/24, 1)
+	}
+	if value >= 100 {
+		return math.Min(value/1000, 1)
+	}
+	return 0
+}
+
+// Calculate prices a piece as metal rate x net weight, plus making charges
+// and stone value. The total is rounded to the nearest rupee.
+func Calculate(ratePerGram, netWeight float64, making models.MakingCharge, stoneValue float64) models.PriceBreakup {
+	metalValue := ratePerGram * netWeight
+
+	var makingCharges float64
+	switch making.Type {
+	case models.MakingPerGram:
+		makingCharges = making.Value * netWeight
+	case models.MakingPercent:
+		makingCharges = metalValue * making.Value / 100
+	case models.MakingFlat:
+		makingCharges = making.Value
+	}
+
+	return models.PriceBreakup{
+		MetalRate:     ratePerGram,
+		NetWeight:     netWeight,
+		MetalValue:    round(metalValue),
+		MakingCharges: round(makingCharges),
+		StoneValue:    round(stoneValue),
+		Total:         math.Round(metalValue + makingCharges + stoneValue),
+	}
+}
+
+func round(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// UnitPrice returns the price a customer pays for one unit of a product or
+// one of its variants. The returned variant is nil when no variant matched.
+func UnitPrice(product *models.Product, variantID primitive.ObjectID) (float64, *models.ProductVariant) {
+	price := product.DiscountPrice
+	if price == 0 {
+		price = product.BasePrice
+	}
+
+	if !variantID.IsZero() {
+		for i := range product.Variants {
+			if product.Variants[i].ID == variantID {
+				return product.Variants[i].Price, &product.Variants[i]
+			}
+		}
+	}
+
+	return price, nil
+}
+
+// Priced reports whether the product and each of its variants has a price
+// to sell at. A rate-priced product has none until a rate is known for its
+// metal and purity.
+func Priced(product *models.Product) bool {
+	if product.BasePrice <= 0 {
+		return false
+	}
+	for _, variant := range product.Variants {
+		if variant.Price <= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// UnitMakingCharges returns the making charges included in the unit price
+// of a rate-priced product or variant, and 0 for fixed-price products.
+func UnitMakingCharges(product *models.Product, variantID primitive.ObjectID) float64 {
+	_, variant := UnitPrice(product, variantID)
+	if variant != nil {
+		if variant.PriceBreakup != nil {
+			return variant.PriceBreakup.MakingCharges
+		}
+		return 0
+	}
+	if product.PriceBreakup != nil {
+		return product.PriceBreakup.MakingCharges
+	}
+	return 0
+}
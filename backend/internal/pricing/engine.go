@@ -0,0 +1,265 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+	"ejewel/internal/utils"
+)
+
+var ErrUnknownMetal = errors.New("unknown metal type")
+
+// Engine keeps the current metal rates in memory and recomputes the price of
+// every rate-priced product whenever they change. Rates are persisted per day
+// so every instance loads the same values.
+type Engine struct {
+	feed     Feed
+	stored   repository.MetalRateRepository
+	products repository.ProductRepository
+
+	mu    sync.RWMutex
+	rates map[string]models.MetalRate
+}
+
+func NewEngine(feed Feed, stored repository.MetalRateRepository, products repository.ProductRepository) *Engine {
+	return &Engine{
+		feed:     feed,
+		stored:   stored,
+		products: products,
+		rates:    make(map[string]models.MetalRate),
+	}
+}
+
+func rateKey(metal models.MetalType, purity string) string {
+	return string(metal) + "|" + strings.ToLower(strings.TrimSpace(purity))
+}
+
+// Load reads the latest rate for every metal and purity from the database.
+func (e *Engine) Load(ctx context.Context) error {
+	rates, err := e.stored.Latest(ctx)
+	if err != nil {
+		return err
+	}
+
+	loaded := make(map[string]models.MetalRate, len(rates))
+	for _, rate := range rates {
+		loaded[rateKey(rate.MetalType, rate.Purity)] = rate
+	}
+
+	e.mu.Lock()
+	e.rates = loaded
+	e.mu.Unlock()
+
+	return nil
+}
+
+// Rates returns the current rate for every metal and purity.
+func (e *Engine) Rates() []models.MetalRate {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	rates := make([]models.MetalRate, 0, len(e.rates))
+	for _, rate := range e.rates {
+		rates = append(rates, rate)
+	}
+	return rates
+}
+
+// SetRates stores today's rates, reloads them and reprices the catalogue.
+// The whole list is checked before any rate is stored, so a bad rate
+// leaves the current ones in place.
+func (e *Engine) SetRates(ctx context.Context, inputs []models.MetalRateInput, source string) error {
+	for _, input := range inputs {
+		if _, ok := finePurity[rateMetal(input.MetalType)]; !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownMetal, input.MetalType)
+		}
+		if input.RatePerGram <= 0 {
+			return fmt.Errorf("rate for %s %s must be positive", input.MetalType, input.Purity)
+		}
+	}
+
+	date := time.Now().Format("2006-01-02")
+	for _, input := range inputs {
+		err := e.stored.Save(ctx, &models.MetalRate{
+			MetalType:   input.MetalType,
+			Purity:      strings.TrimSpace(input.Purity),
+			RatePerGram: input.RatePerGram,
+			Date:        date,
+			Source:      source,
+			UpdatedAt:   time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := e.Load(ctx); err != nil {
+		return err
+	}
+
+	_, err := e.RepriceAll(ctx)
+	return err
+}
+
+// SyncFeed pulls rates from the configured feed, if any.
+func (e *Engine) SyncFeed(ctx context.Context) (int, error) {
+	if e.feed == nil {
+		return 0, errors.New("no rate feed configured")
+	}
+
+	rates, err := e.feed.Fetch(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if len(rates) == 0 {
+		return 0, nil
+	}
+
+	if err := e.SetRates(ctx, rates, e.feed.Name()); err != nil {
+		return 0, err
+	}
+	return len(rates), nil
+}
+
+// Start polls the feed on the given interval until ctx is cancelled.
+func (e *Engine) Start(ctx context.Context, interval time.Duration) {
+	if e.feed == nil || interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				syncCtx, cancel := context.WithTimeout(ctx, time.Minute)
+				if _, err := e.SyncFeed(syncCtx); err != nil {
+					log.Println("Failed to sync metal rates:", err)
+				}
+				cancel()
+			}
+		}
+	}()
+}
+
+// rateFor finds the per-gram rate for a metal and purity. When no rate is
+// stored for the exact purity, the fine metal rate is scaled by the purity
+// factor.
+func (e *Engine) rateFor(metal models.MetalType, purity string) (float64, string, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if rate, ok := e.rates[rateKey(metal, purity)]; ok {
+		return rate.RatePerGram, rate.Date, true
+	}
+
+	base := rateMetal(metal)
+	if rate, ok := e.rates[rateKey(base, purity)]; ok {
+		return rate.RatePerGram, rate.Date, true
+	}
+
+	fine, ok := e.rates[rateKey(base, finePurity[base])]
+	if !ok {
+		return 0, "", false
+	}
+
+	factor := PurityFactor(purity)
+	fineFactor := PurityFactor(fine.Purity)
+	if factor == 0 || fineFactor == 0 {
+		return 0, "", false
+	}
+
+	return fine.RatePerGram * factor / fineFactor, fine.Date, true
+}
+
+// Apply recomputes the prices of a rate-priced product in place. It returns
+// false, leaving the stored prices untouched, when the product has no net
+// weight or no rate is known for its metal and purity.
+func (e *Engine) Apply(product *models.Product) bool {
+	if product.NetWeight <= 0 {
+		return false
+	}
+
+	rate, date, ok := e.rateFor(product.MetalType, product.Purity)
+	if !ok {
+		return false
+	}
+
+	now := time.Now()
+	breakup := Calculate(rate, product.NetWeight, product.MakingCharge, product.StoneValue)
+	breakup.RateDate = date
+	breakup.ComputedAt = now
+
+	product.BasePrice = breakup.Total
+	product.DiscountPrice = utils.CalculateDiscountPrice(breakup.Total, product.DiscountPercent)
+	product.PriceBreakup = &breakup
+
+	for i := range product.Variants {
+		variant := &product.Variants[i]
+		if variant.Weight <= 0 {
+			continue
+		}
+
+		making := product.MakingCharge
+		if variant.MakingCharge != nil {
+			making = *variant.MakingCharge
+		}
+		stoneValue := product.StoneValue
+		if variant.StoneValue > 0 {
+			stoneValue = variant.StoneValue
+		}
+
+		variantBreakup := Calculate(rate, variant.Weight, making, stoneValue)
+		variantBreakup.RateDate = date
+		variantBreakup.ComputedAt = now
+
+		variant.Price = variantBreakup.Total
+		variant.PriceBreakup = &variantBreakup
+	}
+
+	return true
+}
+
+// Reprice recomputes and stores the price of a single product. It reports
+// whether the product is rate priced.
+func (e *Engine) Reprice(ctx context.Context, product *models.Product) (bool, error) {
+	if !e.Apply(product) {
+		return false, nil
+	}
+
+	err := e.products.SavePrices(ctx, product)
+	return err == nil, err
+}
+
+// RepriceAll recomputes the stored price of every rate-priced product so
+// listing filters and sorting on base_price stay accurate.
+func (e *Engine) RepriceAll(ctx context.Context) (int, error) {
+	products, err := e.products.Find(ctx, repository.ProductQuery{RatePriced: true})
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := range products {
+		repriced, err := e.Reprice(ctx, &products[i])
+		if err != nil {
+			return count, err
+		}
+		if repriced {
+			count++
+		}
+	}
+
+	return count, nil
+}
@@ -0,0 +1,36 @@
+package pricing
+
+import (
+	"context"
+	"testing"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository/memory"
+)
+
+func TestSetRatesStoresNothingWhenARateIsBad(t *testing.T) {
+	ctx := context.Background()
+	repos := memory.NewRepositories()
+	engine := NewEngine(nil, repos.MetalRates, repos.Products)
+
+	good := models.MetalRateInput{MetalType: models.MetalGold, Purity: "22K", RatePerGram: 6500}
+	if err := engine.SetRates(ctx, []models.MetalRateInput{good}, "manual"); err != nil {
+		t.Fatal(err)
+	}
+
+	update := []models.MetalRateInput{
+		{MetalType: models.MetalGold, Purity: "22K", RatePerGram: 6800},
+		{MetalType: models.MetalSilver, Purity: "925", RatePerGram: 0},
+	}
+	if err := engine.SetRates(ctx, update, "manual"); err == nil {
+		t.Fatal("rates with a zero rate were accepted")
+	}
+
+	stored, err := repos.MetalRates.Latest(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 1 || stored[0].RatePerGram != 6500 {
+		t.Errorf("stored rates = %+v, want only the earlier 22K gold rate", stored)
+	}
+}
@@ -0,0 +1,48 @@
+package pricing
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"ejewel/internal/models"
+)
+
+// Feed supplies the latest metal rates from an external source such as a
+// bullion rate API.
+type Feed interface {
+	Name() string
+	Fetch(ctx context.Context) ([]models.MetalRateInput, error)
+}
+
+// FileFeed reads rates from a JSON file. It stands in for a live rate feed
+// in development and can be updated by a cron job in small deployments.
+//
+// The file holds an array of objects:
+//
+//	[{"metalType": "gold", "purity": "22K", "ratePerGram": 6650}]
+type FileFeed struct {
+	Path string
+}
+
+func NewFileFeed(path string) *FileFeed {
+	return &FileFeed{Path: path}
+}
+
+func (f *FileFeed) Name() string {
+	return "file"
+}
+
+func (f *FileFeed) Fetch(ctx context.Context) ([]models.MetalRateInput, error) {
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rates []models.MetalRateInput
+	if err := json.Unmarshal(data, &rates); err != nil {
+		return nil, err
+	}
+
+	return rates, nil
+}
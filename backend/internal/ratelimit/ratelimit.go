@@ -0,0 +1,100 @@
+// Package ratelimit meters requests with token buckets. Each bucket holds up
+// to a burst of tokens and refills at a steady rate; a request takes one
+// token and is refused while the bucket is empty.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit describes a bucket that holds up to Burst tokens and refills at
+// Rate tokens per second.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerMinute allows n requests a minute, all of which may come at once.
+func PerMinute(n int) Limit {
+	return Every(n, time.Minute)
+}
+
+// Every allows n requests per period, all of which may come at once.
+func Every(n int, period time.Duration) Limit {
+	return Limit{Rate: float64(n) / period.Seconds(), Burst: n}
+}
+
+// Enabled reports whether the limit lets anything through. The zero Limit
+// stands for no limit at all.
+func (l Limit) Enabled() bool {
+	return l.Burst > 0
+}
+
+// Parse reads a limit written as requests per period, such as "20/m".
+// Periods are s, m and h; "0" or an empty string means no limit.
+func Parse(value string) (Limit, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "0" {
+		return Limit{}, nil
+	}
+
+	count, unit, ok := strings.Cut(value, "/")
+	n, err := strconv.Atoi(count)
+	if !ok || err != nil || n < 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q", value)
+	}
+	periods := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}
+	period, ok := periods[unit]
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit period in %q", value)
+	}
+	if n == 0 {
+		return Limit{}, nil
+	}
+	return Every(n, period), nil
+}
+
+// Limits are the limits of a route group per client IP and per account.
+type Limits struct {
+	IP      Limit
+	Account Limit
+}
+
+// Store keeps the buckets by key.
+type Store interface {
+	// Take removes a token from the bucket for key. When the bucket is
+	// empty it returns false and how long until a token is available.
+	Take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error)
+}
+
+// bucket is the state of one bucket as of updated.
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// take refills the bucket up to now and removes a token if there is one.
+func (b *bucket) take(limit Limit, now time.Time) (bool, time.Duration) {
+	b.refill(limit, now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if limit.Rate <= 0 {
+		return false, time.Duration(math.MaxInt64)
+	}
+	wait := time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+	return false, wait
+}
+
+func (b *bucket) refill(limit Limit, now time.Time) {
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+elapsed*limit.Rate)
+	}
+	b.updated = now
+}
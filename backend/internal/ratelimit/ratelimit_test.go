@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value string
+		want  Limit
+		err   bool
+	}{
+		{"", Limit{}, false},
+		{"0", Limit{}, false},
+		{"0/m", Limit{}, false},
+		{"60/m", Limit{Rate: 1, Burst: 60}, false},
+		{"10/s", Limit{Rate: 10, Burst: 10}, false},
+		{" 3600/h ", Limit{Rate: 1, Burst: 3600}, false},
+		{"20", Limit{}, true},
+		{"20/d", Limit{}, true},
+		{"-1/m", Limit{}, true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.value)
+		if (err != nil) != tt.err {
+			t.Errorf("Parse(%q) error = %v, want error %v", tt.value, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestBucketRefillsAtRate(t *testing.T) {
+	limit := Every(2, time.Second)
+	start := time.Now()
+	b := bucket{tokens: float64(limit.Burst), updated: start}
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := b.take(limit, start); !ok {
+			t.Fatalf("take %d refused within the burst", i+1)
+		}
+	}
+	ok, wait := b.take(limit, start)
+	if ok {
+		t.Fatal("take allowed past the burst")
+	}
+	if wait != 500*time.Millisecond {
+		t.Errorf("wait = %v, want 500ms", wait)
+	}
+
+	if ok, _ := b.take(limit, start.Add(500*time.Millisecond)); !ok {
+		t.Error("take refused once a token refilled")
+	}
+
+	// A long pause never refills past the burst
+	b.refill(limit, start.Add(time.Hour))
+	if b.tokens != float64(limit.Burst) {
+		t.Errorf("tokens = %v, want %d", b.tokens, limit.Burst)
+	}
+}
+
+func TestMemoryStoreKeysBucketsSeparately(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	limit := PerMinute(1)
+
+	if ok, _, _ := store.Take(ctx, "a", limit); !ok {
+		t.Fatal("first request for a refused")
+	}
+	if ok, wait, _ := store.Take(ctx, "a", limit); ok || wait <= 0 {
+		t.Errorf("second request for a = %v, wait %v; want refused with a wait", ok, wait)
+	}
+	if ok, _, _ := store.Take(ctx, "b", limit); !ok {
+		t.Error("first request for b refused")
+	}
+}
@@ -0,0 +1,114 @@
+// Package rbac answers whether a role grants a permission. Role definitions
+// live in the roles collection; each instance keeps a copy that is reloaded
+// after a TTL, and at once when this instance changes a role.
+package rbac
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+)
+
+type Roles struct {
+	repo repository.RoleRepository
+	ttl  time.Duration
+
+	mu       sync.RWMutex
+	roles    map[models.Role]models.RoleDefinition
+	loadedAt time.Time
+	// generation changes on Invalidate, so a load that raced a change is
+	// not kept
+	generation int
+}
+
+// NewRoles serves role definitions from repo, reloading them after ttl.
+func NewRoles(repo repository.RoleRepository, ttl time.Duration) *Roles {
+	return &Roles{repo: repo, ttl: ttl}
+}
+
+// Allows reports whether the role grants the permission. Roles without a
+// definition grant nothing.
+func (r *Roles) Allows(ctx context.Context, role models.Role, permission models.Permission) (bool, error) {
+	definition, err := r.Get(ctx, role)
+	if err == repository.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return definition.Allows(permission), nil
+}
+
+// Covers reports whether holder grants every permission of role, so that
+// someone holding it may hand role out without gaining access.
+func (r *Roles) Covers(ctx context.Context, holder, role models.Role) (bool, error) {
+	if !role.IsStaff() {
+		return true, nil
+	}
+	definition, err := r.Get(ctx, role)
+	if err != nil {
+		return false, err
+	}
+	held, err := r.Get(ctx, holder)
+	if err == repository.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, p := range definition.Permissions {
+		if !held.Allows(p) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Get returns the definition of a role.
+func (r *Roles) Get(ctx context.Context, role models.Role) (*models.RoleDefinition, error) {
+	roles, err := r.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	definition, ok := roles[role]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	return &definition, nil
+}
+
+// Invalidate makes the next lookup reload the definitions.
+func (r *Roles) Invalidate() {
+	r.mu.Lock()
+	r.loadedAt = time.Time{}
+	r.generation++
+	r.mu.Unlock()
+}
+
+func (r *Roles) load(ctx context.Context) (map[models.Role]models.RoleDefinition, error) {
+	r.mu.RLock()
+	roles, loadedAt, generation := r.roles, r.loadedAt, r.generation
+	r.mu.RUnlock()
+	if roles != nil && time.Since(loadedAt) < r.ttl {
+		return roles, nil
+	}
+
+	definitions, err := r.repo.FindAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	roles = make(map[models.Role]models.RoleDefinition, len(definitions))
+	for _, definition := range definitions {
+		roles[definition.Name] = definition
+	}
+
+	r.mu.Lock()
+	if r.generation == generation {
+		r.roles, r.loadedAt = roles, time.Now()
+	}
+	r.mu.Unlock()
+	return roles, nil
+}
@@ -0,0 +1,86 @@
+package rbac
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+	"ejewel/internal/repository/memory"
+)
+
+func newTestRoles(t *testing.T) (*Roles, repository.RoleRepository) {
+	t.Helper()
+	ctx := context.Background()
+	repo := memory.NewRoleRepository()
+	roles := append(models.DefaultRoles(),
+		models.RoleDefinition{Name: "order_manager", Permissions: []models.Permission{"orders:*", models.PermReturnsRead}},
+		models.RoleDefinition{Name: "order_clerk", Permissions: []models.Permission{models.PermOrdersRead, models.PermOrdersStatus, models.PermReturnsRead}},
+	)
+	for i := range roles {
+		if err := repo.Create(ctx, &roles[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewRoles(repo, time.Hour), repo
+}
+
+func TestCovers(t *testing.T) {
+	roles, _ := newTestRoles(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name         string
+		holder, role models.Role
+		want         bool
+	}{
+		{"admin covers every role", models.RoleAdmin, models.RoleFinance, true},
+		{"a role covers itself", models.RoleSupport, models.RoleSupport, true},
+		{"resource wildcard covers its actions", "order_manager", "order_clerk", true},
+		{"resource wildcard stops at its resource", "order_manager", models.RoleSupport, false},
+		{"one permission missing", models.RoleFinance, models.RoleOrderFulfilment, false},
+		{"customer role needs nothing", models.RoleSupport, models.RoleCustomer, true},
+		{"holder without a definition", models.RoleCustomer, models.RoleSupport, false},
+	}
+	for _, tt := range tests {
+		got, err := roles.Covers(ctx, tt.holder, tt.role)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: Covers(%s, %s) = %v, want %v", tt.name, tt.holder, tt.role, got, tt.want)
+		}
+	}
+
+	if _, err := roles.Covers(ctx, models.RoleAdmin, "unknown"); err != repository.ErrNotFound {
+		t.Errorf("covering an undefined role: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestInvalidateReloadsRoles(t *testing.T) {
+	roles, repo := newTestRoles(t)
+	ctx := context.Background()
+
+	if ok, _ := roles.Allows(ctx, "order_clerk", models.PermRefundsIssue); ok {
+		t.Fatal("order_clerk allowed to issue refunds before it was granted")
+	}
+
+	clerk, err := repo.FindByName(ctx, "order_clerk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	granted := append(clerk.Permissions, models.PermRefundsIssue)
+	if err := repo.Update(ctx, clerk.ID, repository.Fields{"permissions": granted}); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, _ := roles.Allows(ctx, "order_clerk", models.PermRefundsIssue); ok {
+		t.Error("change seen before the TTL ran out or Invalidate was called")
+	}
+	roles.Invalidate()
+	if ok, _ := roles.Allows(ctx, "order_clerk", models.PermRefundsIssue); !ok {
+		t.Error("change not seen after Invalidate")
+	}
+}
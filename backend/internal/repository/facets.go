@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Product facets, named after the query parameters that filter on them.
+const (
+	FacetMetalType  = "metalType"
+	FacetPurity     = "purity"
+	FacetCategory   = "categoryId"
+	FacetTag        = "tags"
+	FacetPriceRange = "priceRange"
+	FacetRating     = "rating"
+	FacetInStock    = "inStock"
+)
+
+// Facets lists the product facets.
+var Facets = []string{FacetMetalType, FacetPurity, FacetCategory, FacetTag, FacetPriceRange, FacetRating, FacetInStock}
+
+// WithoutFacet returns the query without the filter on facet. Counts for a
+// facet are taken this way, so that each of its values shows what
+// selecting it as well would add.
+func (q ProductQuery) WithoutFacet(facet string) ProductQuery {
+	switch facet {
+	case FacetMetalType:
+		q.MetalTypes = nil
+	case FacetPurity:
+		q.Purities = nil
+	case FacetCategory:
+		q.CategoryIDs = nil
+	case FacetTag:
+		q.Tags = nil
+	case FacetPriceRange:
+		q.PriceRanges = nil
+	case FacetRating:
+		q.Ratings = nil
+	case FacetInStock:
+		q.InStock = nil
+	}
+	return q
+}
+
+// PriceBuckets are the lower bounds of the price ranges counted in facets.
+// The last range has no upper bound.
+var PriceBuckets = []float64{0, 10000, 25000, 50000, 100000, 250000}
+
+// MaxTagFacets caps how many of the most used tags are counted.
+const MaxTagFacets = 20
+
+// PriceRange is a range of prices from Min up to, but not including, Max.
+// A zero Max leaves the range open.
+type PriceRange struct {
+	Min float64
+	Max float64
+}
+
+// ParsePriceRange reads a range written as "min-max" or "min-".
+func ParsePriceRange(value string) (PriceRange, error) {
+	min, max, ok := strings.Cut(value, "-")
+	if !ok {
+		return PriceRange{}, fmt.Errorf("invalid price range %q", value)
+	}
+	var r PriceRange
+	var err error
+	if r.Min, err = strconv.ParseFloat(min, 64); err != nil {
+		return PriceRange{}, fmt.Errorf("invalid price range %q", value)
+	}
+	if max != "" {
+		if r.Max, err = strconv.ParseFloat(max, 64); err != nil || r.Max <= r.Min {
+			return PriceRange{}, fmt.Errorf("invalid price range %q", value)
+		}
+	}
+	return r, nil
+}
+
+func (r PriceRange) String() string {
+	format := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	if r.Max == 0 {
+		return format(r.Min) + "-"
+	}
+	return format(r.Min) + "-" + format(r.Max)
+}
+
+// Contains reports whether price is in the range.
+func (r PriceRange) Contains(price float64) bool {
+	return price >= r.Min && (r.Max == 0 || price < r.Max)
+}
+
+// PriceBucket returns the range of PriceBuckets that price falls in.
+func PriceBucket(price float64) PriceRange {
+	for i := len(PriceBuckets) - 1; i > 0; i-- {
+		if price >= PriceBuckets[i] {
+			if i == len(PriceBuckets)-1 {
+				return PriceRange{Min: PriceBuckets[i]}
+			}
+			return PriceRange{Min: PriceBuckets[i], Max: PriceBuckets[i+1]}
+		}
+	}
+	return PriceRange{Min: PriceBuckets[0], Max: PriceBuckets[1]}
+}
+
+// FacetCount is the number of matching products with one value of a
+// facet. Label names values that are IDs.
+type FacetCount struct {
+	Value string `json:"value"`
+	Label string `json:"label,omitempty"`
+	Count int64  `json:"count"`
+}
+
+// ProductFacets holds the counts of each facet, keyed as the query
+// parameters are. Price ranges and ratings come in ascending order, the
+// rest by descending count.
+type ProductFacets struct {
+	MetalTypes  []FacetCount `json:"metalType"`
+	Purities    []FacetCount `json:"purity"`
+	Categories  []FacetCount `json:"categoryId"`
+	Tags        []FacetCount `json:"tags"`
+	PriceRanges []FacetCount `json:"priceRange"`
+	Ratings     []FacetCount `json:"rating"`
+	InStock     []FacetCount `json:"inStock"`
+}
+
+// EmptyFacets returns facets without counts, for a query that is known to
+// match nothing.
+func EmptyFacets() *ProductFacets {
+	return &ProductFacets{
+		MetalTypes:  []FacetCount{},
+		Purities:    []FacetCount{},
+		Categories:  []FacetCount{},
+		Tags:        []FacetCount{},
+		PriceRanges: []FacetCount{},
+		Ratings:     []FacetCount{},
+		InStock:     []FacetCount{},
+	}
+}
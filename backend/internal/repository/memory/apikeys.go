@@ -0,0 +1,57 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type APIKeyRepository struct {
+	// create serialises the hash check with the insert
+	create sync.Mutex
+	keys   *collection[models.APIKey]
+}
+
+func NewAPIKeyRepository() *APIKeyRepository {
+	return &APIKeyRepository{keys: newCollection[models.APIKey]()}
+}
+
+func (r *APIKeyRepository) Create(ctx context.Context, key *models.APIKey) error {
+	r.create.Lock()
+	defer r.create.Unlock()
+
+	if _, err := r.FindByHash(ctx, key.KeyHash); err == nil {
+		return repository.ErrDuplicate
+	}
+	if key.ID.IsZero() {
+		key.ID = primitive.NewObjectID()
+	}
+	return r.keys.insert(key.ID, key)
+}
+
+func (r *APIKeyRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.APIKey, error) {
+	return r.keys.get(id)
+}
+
+func (r *APIKeyRepository) FindByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	_, key, err := r.keys.findOne(func(k *models.APIKey) bool { return k.KeyHash == hash })
+	return key, err
+}
+
+func (r *APIKeyRepository) FindAll(ctx context.Context) ([]models.APIKey, error) {
+	keys, err := r.keys.find(func(*models.APIKey) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+func (r *APIKeyRepository) Update(ctx context.Context, id primitive.ObjectID, set repository.Fields) error {
+	return r.keys.update(id, nil, set, nil)
+}
@@ -0,0 +1,99 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type CartRepository struct {
+	// mu serialises saves so a key never ends up with two carts
+	mu    sync.Mutex
+	carts *collection[models.Cart]
+}
+
+func NewCartRepository() *CartRepository {
+	return &CartRepository{carts: newCollection[models.Cart]()}
+}
+
+func (r *CartRepository) Find(ctx context.Context, key repository.CartKey) (*models.Cart, error) {
+	_, cart, err := r.carts.findOne(cartMatcher(key))
+	if err != nil {
+		return nil, err
+	}
+	if !cart.ExpiresAt.IsZero() && !cart.ExpiresAt.After(time.Now()) {
+		return nil, repository.ErrNotFound
+	}
+	return cart, nil
+}
+
+func (r *CartRepository) Save(ctx context.Context, key repository.CartKey, cart *models.Cart) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id, _, err := r.carts.findOne(cartMatcher(key))
+	if err == repository.ErrNotFound {
+		id = cart.ID
+		if id.IsZero() {
+			id = primitive.NewObjectID()
+		}
+	} else if err != nil {
+		return err
+	}
+
+	stored := *cart
+	stored.ID = id
+	return r.carts.put(id, &stored)
+}
+
+func (r *CartRepository) Delete(ctx context.Context, key repository.CartKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id, _, err := r.carts.findOne(cartMatcher(key))
+	if err == repository.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return r.carts.remove(id)
+}
+
+func (r *CartRepository) SetProductDetails(ctx context.Context, productID primitive.ObjectID, name, thumbnail string) error {
+	return r.carts.modifyAll(
+		func(c *models.Cart) bool { return hasCartItem(c, productID) },
+		func(c *models.Cart) error {
+			for i := range c.Items {
+				if c.Items[i].ProductID == productID {
+					c.Items[i].ProductName = name
+					c.Items[i].Thumbnail = thumbnail
+				}
+			}
+			return nil
+		},
+	)
+}
+
+func hasCartItem(cart *models.Cart, productID primitive.ObjectID) bool {
+	for _, item := range cart.Items {
+		if item.ProductID == productID {
+			return true
+		}
+	}
+	return false
+}
+
+func cartMatcher(key repository.CartKey) func(*models.Cart) bool {
+	return func(c *models.Cart) bool {
+		if key.TokenHash != "" {
+			return c.TokenHash == key.TokenHash
+		}
+		return c.TokenHash == "" && c.UserID == key.UserID
+	}
+}
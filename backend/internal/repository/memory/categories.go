@@ -0,0 +1,61 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type CategoryRepository struct {
+	categories *collection[models.Category]
+}
+
+func NewCategoryRepository() *CategoryRepository {
+	return &CategoryRepository{categories: newCollection[models.Category]()}
+}
+
+func (r *CategoryRepository) FindActive(ctx context.Context) ([]models.Category, error) {
+	categories, err := r.categories.find(func(c *models.Category) bool { return c.IsActive })
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(categories, func(i, j int) bool { return categories[i].SortOrder < categories[j].SortOrder })
+	return categories, nil
+}
+
+func (r *CategoryRepository) FindAll(ctx context.Context) ([]models.Category, error) {
+	categories, err := r.categories.find(func(*models.Category) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(categories, func(i, j int) bool { return categories[i].SortOrder < categories[j].SortOrder })
+	return categories, nil
+}
+
+func (r *CategoryRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Category, error) {
+	return r.categories.get(id)
+}
+
+func (r *CategoryRepository) FindBySlug(ctx context.Context, slug string) (*models.Category, error) {
+	_, category, err := r.categories.findOne(func(c *models.Category) bool { return c.Slug == slug })
+	return category, err
+}
+
+func (r *CategoryRepository) Create(ctx context.Context, category *models.Category) error {
+	if category.ID.IsZero() {
+		category.ID = primitive.NewObjectID()
+	}
+	return r.categories.insert(category.ID, category)
+}
+
+func (r *CategoryRepository) Update(ctx context.Context, id primitive.ObjectID, set repository.Fields) error {
+	return r.categories.update(id, nil, set, nil)
+}
+
+func (r *CategoryRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return r.categories.remove(id)
+}
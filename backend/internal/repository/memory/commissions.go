@@ -0,0 +1,53 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type CommissionRepository struct {
+	// create serialises the seller and category check with the insert
+	create sync.Mutex
+	rules  *collection[models.CommissionRule]
+}
+
+func NewCommissionRepository() *CommissionRepository {
+	return &CommissionRepository{rules: newCollection[models.CommissionRule]()}
+}
+
+func (r *CommissionRepository) FindAll(ctx context.Context) ([]models.CommissionRule, error) {
+	return r.rules.find(func(*models.CommissionRule) bool { return true })
+}
+
+func (r *CommissionRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.CommissionRule, error) {
+	return r.rules.get(id)
+}
+
+func (r *CommissionRepository) Create(ctx context.Context, rule *models.CommissionRule) error {
+	r.create.Lock()
+	defer r.create.Unlock()
+
+	_, _, err := r.rules.findOne(func(existing *models.CommissionRule) bool {
+		return existing.SellerID == rule.SellerID && existing.CategoryID == rule.CategoryID
+	})
+	if err == nil {
+		return repository.ErrDuplicate
+	}
+	if rule.ID.IsZero() {
+		rule.ID = primitive.NewObjectID()
+	}
+	return r.rules.insert(rule.ID, rule)
+}
+
+func (r *CommissionRepository) Update(ctx context.Context, id primitive.ObjectID, set repository.Fields) error {
+	return r.rules.update(id, nil, set, nil)
+}
+
+func (r *CommissionRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return r.rules.remove(id)
+}
@@ -0,0 +1,23 @@
+package memory
+
+import (
+	"context"
+	"sync"
+)
+
+type CounterRepository struct {
+	mu       sync.Mutex
+	counters map[string]int64
+}
+
+func NewCounterRepository() *CounterRepository {
+	return &CounterRepository{counters: make(map[string]int64)}
+}
+
+func (r *CounterRepository) Next(ctx context.Context, name string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.counters[name]++
+	return r.counters[name], nil
+}
@@ -0,0 +1,137 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type CouponRepository struct {
+	// create serialises the code check with the insert
+	create  sync.Mutex
+	coupons *collection[models.Coupon]
+
+	mu     sync.Mutex
+	usages map[[2]primitive.ObjectID]int
+}
+
+func NewCouponRepository() *CouponRepository {
+	return &CouponRepository{
+		coupons: newCollection[models.Coupon](),
+		usages:  make(map[[2]primitive.ObjectID]int),
+	}
+}
+
+func (r *CouponRepository) Find(ctx context.Context, query repository.CouponQuery) ([]models.Coupon, error) {
+	coupons, err := r.coupons.find(func(coupon *models.Coupon) bool {
+		return query.Active == nil || coupon.IsActive == *query.Active
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(coupons, func(i, j int) bool { return coupons[i].CreatedAt.After(coupons[j].CreatedAt) })
+	return coupons, nil
+}
+
+func (r *CouponRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Coupon, error) {
+	return r.coupons.get(id)
+}
+
+func (r *CouponRepository) FindByCode(ctx context.Context, code string) (*models.Coupon, error) {
+	_, coupon, err := r.coupons.findOne(func(c *models.Coupon) bool { return c.Code == code })
+	return coupon, err
+}
+
+func (r *CouponRepository) Create(ctx context.Context, coupon *models.Coupon) error {
+	r.create.Lock()
+	defer r.create.Unlock()
+
+	if _, err := r.FindByCode(ctx, coupon.Code); err == nil {
+		return repository.ErrDuplicate
+	}
+	if coupon.ID.IsZero() {
+		coupon.ID = primitive.NewObjectID()
+	}
+	return r.coupons.insert(coupon.ID, coupon)
+}
+
+func (r *CouponRepository) Update(ctx context.Context, id primitive.ObjectID, set repository.Fields) error {
+	return r.coupons.update(id, nil, set, nil)
+}
+
+func (r *CouponRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	if err := r.coupons.remove(id); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key := range r.usages {
+		if key[0] == id {
+			delete(r.usages, key)
+		}
+	}
+	return nil
+}
+
+func (r *CouponRepository) UserUses(ctx context.Context, couponID, userID primitive.ObjectID) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.usages[[2]primitive.ObjectID{couponID, userID}], nil
+}
+
+func (r *CouponRepository) ReserveUserUse(ctx context.Context, couponID, userID primitive.ObjectID, limit int) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := [2]primitive.ObjectID{couponID, userID}
+	if limit > 0 && r.usages[key] >= limit {
+		return false, nil
+	}
+	r.usages[key]++
+	return true, nil
+}
+
+func (r *CouponRepository) ReleaseUserUse(ctx context.Context, couponID, userID primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := [2]primitive.ObjectID{couponID, userID}
+	if r.usages[key] > 0 {
+		r.usages[key]--
+	}
+	return nil
+}
+
+func (r *CouponRepository) ReserveUse(ctx context.Context, id primitive.ObjectID, limit int) (bool, error) {
+	err := r.coupons.modify(id, func(c *models.Coupon) error {
+		if !c.IsActive || (limit > 0 && c.UsedCount >= limit) {
+			return repository.ErrConflict
+		}
+		c.UsedCount++
+		return nil
+	})
+	if err == repository.ErrConflict || err == repository.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *CouponRepository) ReleaseUse(ctx context.Context, id primitive.ObjectID) error {
+	err := r.coupons.modify(id, func(c *models.Coupon) error {
+		if c.UsedCount > 0 {
+			c.UsedCount--
+		}
+		return nil
+	})
+	if err == repository.ErrNotFound {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,79 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type EventRepository struct {
+	// claim serialises claims so an event is handed to one worker at a time
+	claim  sync.Mutex
+	events *collection[models.Event]
+}
+
+func NewEventRepository() *EventRepository {
+	return &EventRepository{events: newCollection[models.Event]()}
+}
+
+func (r *EventRepository) Create(ctx context.Context, event *models.Event) error {
+	if event.ID.IsZero() {
+		event.ID = primitive.NewObjectID()
+	}
+	return r.events.insert(event.ID, event)
+}
+
+func (r *EventRepository) Claim(ctx context.Context, now time.Time, lease time.Duration) (*models.Event, error) {
+	r.claim.Lock()
+	defer r.claim.Unlock()
+
+	due, err := r.events.find(func(e *models.Event) bool {
+		return e.Status == models.EventPending && !e.RunAt.After(now)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(due) == 0 {
+		return nil, repository.ErrNotFound
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].RunAt.Before(due[j].RunAt) })
+
+	var event *models.Event
+	err = r.events.modify(due[0].ID, func(e *models.Event) error {
+		e.RunAt = now.Add(lease)
+		e.Attempts++
+		event = e
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+func (r *EventRepository) Update(ctx context.Context, id primitive.ObjectID, set repository.Fields) error {
+	return r.events.update(id, nil, set, nil)
+}
+
+func (r *EventRepository) Published(ctx context.Context, eventType models.EventType, since time.Time) (map[primitive.ObjectID]time.Time, error) {
+	events, err := r.events.find(func(e *models.Event) bool {
+		return e.Type == eventType && !e.CreatedAt.Before(since)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	latest := make(map[primitive.ObjectID]time.Time, len(events))
+	for _, e := range events {
+		if e.CreatedAt.After(latest[e.SubjectID]) {
+			latest[e.SubjectID] = e.CreatedAt
+		}
+	}
+	return latest, nil
+}
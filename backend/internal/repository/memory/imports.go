@@ -0,0 +1,49 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ImportJobRepository struct {
+	jobs *collection[models.ImportJob]
+}
+
+func NewImportJobRepository() *ImportJobRepository {
+	return &ImportJobRepository{jobs: newCollection[models.ImportJob]()}
+}
+
+func (r *ImportJobRepository) Create(ctx context.Context, job *models.ImportJob) error {
+	if job.ID.IsZero() {
+		job.ID = primitive.NewObjectID()
+	}
+	return r.jobs.insert(job.ID, job)
+}
+
+func (r *ImportJobRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.ImportJob, error) {
+	return r.jobs.get(id)
+}
+
+func (r *ImportJobRepository) Update(ctx context.Context, id primitive.ObjectID, set repository.Fields) error {
+	return r.jobs.update(id, nil, set, nil)
+}
+
+func (r *ImportJobRepository) FailAbandoned(ctx context.Context, before time.Time, reason string) (int64, error) {
+	var failed int64
+	now := time.Now()
+	err := r.jobs.modifyAll(func(j *models.ImportJob) bool {
+		return (j.Status == models.ImportQueued || j.Status == models.ImportRunning) && j.HeartbeatAt.Before(before)
+	}, func(j *models.ImportJob) error {
+		j.Status = models.ImportFailed
+		j.Error = reason
+		j.FinishedAt = &now
+		failed++
+		return nil
+	})
+	return failed, err
+}
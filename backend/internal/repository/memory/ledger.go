@@ -0,0 +1,116 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type LedgerRepository struct {
+	// record serialises the key check with the insert
+	record  sync.Mutex
+	entries *collection[models.LedgerEntry]
+}
+
+func NewLedgerRepository() *LedgerRepository {
+	return &LedgerRepository{entries: newCollection[models.LedgerEntry]()}
+}
+
+func (r *LedgerRepository) Record(ctx context.Context, entry *models.LedgerEntry) error {
+	r.record.Lock()
+	defer r.record.Unlock()
+
+	if _, err := r.FindByKey(ctx, entry.Key); err == nil {
+		return repository.ErrDuplicate
+	}
+	if entry.ID.IsZero() {
+		entry.ID = primitive.NewObjectID()
+	}
+	return r.entries.insert(entry.ID, entry)
+}
+
+func (r *LedgerRepository) FindByKey(ctx context.Context, key string) (*models.LedgerEntry, error) {
+	_, entry, err := r.entries.findOne(func(e *models.LedgerEntry) bool { return e.Key == key })
+	return entry, err
+}
+
+func (r *LedgerRepository) Find(ctx context.Context, query repository.LedgerQuery) ([]models.LedgerEntry, error) {
+	entries, err := r.entries.find(ledgerMatcher(query))
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].CreatedAt.Equal(entries[j].CreatedAt) {
+			return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+		}
+		return entries[i].ID.Hex() < entries[j].ID.Hex()
+	})
+	return paginate(entries, query.Page), nil
+}
+
+func (r *LedgerRepository) Balances(ctx context.Context, query repository.LedgerQuery) ([]repository.LedgerBalance, error) {
+	entries, err := r.entries.find(ledgerMatcher(query))
+	if err != nil {
+		return nil, err
+	}
+
+	bySeller := make(map[primitive.ObjectID]*repository.LedgerBalance)
+	for _, entry := range entries {
+		balance, ok := bySeller[entry.SellerID]
+		if !ok {
+			balance = &repository.LedgerBalance{SellerID: entry.SellerID}
+			bySeller[entry.SellerID] = balance
+		}
+		balance.Entries++
+		balance.Gross += entry.Gross
+		balance.Commission += entry.Commission
+		balance.TaxWithheld += entry.TaxWithheld
+		balance.Net += entry.Net
+	}
+
+	balances := make([]repository.LedgerBalance, 0, len(bySeller))
+	for _, balance := range bySeller {
+		balances = append(balances, *balance)
+	}
+	sort.Slice(balances, func(i, j int) bool { return balances[i].SellerID.Hex() < balances[j].SellerID.Hex() })
+	return balances, nil
+}
+
+func (r *LedgerRepository) Settle(ctx context.Context, query repository.LedgerQuery, payoutID primitive.ObjectID) error {
+	query.Unsettled = true
+	entries, err := r.entries.find(ledgerMatcher(query))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		err := r.entries.modify(entry.ID, func(e *models.LedgerEntry) error {
+			if e.PayoutID.IsZero() {
+				e.PayoutID = payoutID
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ledgerMatcher(query repository.LedgerQuery) func(*models.LedgerEntry) bool {
+	return func(e *models.LedgerEntry) bool {
+		switch {
+		case !query.SellerID.IsZero() && e.SellerID != query.SellerID,
+			!query.PayoutID.IsZero() && e.PayoutID != query.PayoutID,
+			query.PayoutID.IsZero() && query.Unsettled && !e.PayoutID.IsZero(),
+			!query.From.IsZero() && e.CreatedAt.Before(query.From),
+			!query.To.IsZero() && !e.CreatedAt.Before(query.To):
+			return false
+		}
+		return true
+	}
+}
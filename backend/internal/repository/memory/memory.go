@@ -0,0 +1,303 @@
+// Package memory implements the repositories in process. Documents are kept
+// in their BSON form, so field names, omitted fields and dotted update paths
+// behave as they do in MongoDB, and callers never share memory with the
+// store.
+package memory
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// NewRepositories returns empty in-memory repositories.
+func NewRepositories() repository.Repositories {
+	return repository.Repositories{
+		Users:       NewUserRepository(),
+		Products:    NewProductRepository(),
+		Categories:  NewCategoryRepository(),
+		Carts:       NewCartRepository(),
+		Wishlists:   NewWishlistRepository(),
+		Orders:      NewOrderRepository(),
+		Reviews:     NewReviewRepository(),
+		Sessions:    NewSessionRepository(),
+		Revocations: NewRevocationRepository(),
+		Roles:       NewRoleRepository(),
+		Sellers:     NewSellerRepository(),
+		Ledger:      NewLedgerRepository(),
+		Commissions: NewCommissionRepository(),
+		Payouts:     NewPayoutRepository(),
+		APIKeys:     NewAPIKeyRepository(),
+		Events:      NewEventRepository(),
+		ImportJobs:  NewImportJobRepository(),
+		Coupons:     NewCouponRepository(),
+		Returns:     NewReturnRepository(),
+		Zones:       NewShippingZoneRepository(),
+		Counters:    NewCounterRepository(),
+		MetalRates:  NewMetalRateRepository(),
+	}
+}
+
+// collection stores encoded documents of one type by id.
+type collection[T any] struct {
+	mu   sync.RWMutex
+	docs map[primitive.ObjectID][]byte
+}
+
+func newCollection[T any]() *collection[T] {
+	return &collection[T]{docs: make(map[primitive.ObjectID][]byte)}
+}
+
+func decode[T any](data []byte) (*T, error) {
+	var v T
+	if err := bson.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (c *collection[T]) get(id primitive.ObjectID) (*T, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	data, ok := c.docs[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	return decode[T](data)
+}
+
+// find returns every document for which keep reports true.
+func (c *collection[T]) find(keep func(*T) bool) ([]T, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	matches := []T{}
+	for _, data := range c.docs {
+		v, err := decode[T](data)
+		if err != nil {
+			return nil, err
+		}
+		if keep(v) {
+			matches = append(matches, *v)
+		}
+	}
+	return matches, nil
+}
+
+// findOne returns the id and value of a document for which keep reports
+// true.
+func (c *collection[T]) findOne(keep func(*T) bool) (primitive.ObjectID, *T, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for id, data := range c.docs {
+		v, err := decode[T](data)
+		if err != nil {
+			return id, nil, err
+		}
+		if keep(v) {
+			return id, v, nil
+		}
+	}
+	return primitive.NilObjectID, nil, repository.ErrNotFound
+}
+
+func (c *collection[T]) insert(id primitive.ObjectID, v *T) error {
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.docs[id]; ok {
+		return repository.ErrDuplicate
+	}
+	c.docs[id] = data
+	return nil
+}
+
+func (c *collection[T]) put(id primitive.ObjectID, v *T) error {
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.docs[id] = data
+	c.mu.Unlock()
+	return nil
+}
+
+// modify applies change to the stored document atomically. The document is
+// left untouched when change returns an error.
+func (c *collection[T]) modify(id primitive.ObjectID, change func(*T) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, ok := c.docs[id]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	v, err := decode[T](data)
+	if err != nil {
+		return err
+	}
+	if err := change(v); err != nil {
+		return err
+	}
+	data, err = bson.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c.docs[id] = data
+	return nil
+}
+
+// modifyAll applies change to every document for which keep reports true.
+// Documents are left untouched when change returns an error.
+func (c *collection[T]) modifyAll(keep func(*T) bool, change func(*T) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	changed := make(map[primitive.ObjectID][]byte)
+	for id, data := range c.docs {
+		v, err := decode[T](data)
+		if err != nil {
+			return err
+		}
+		if !keep(v) {
+			continue
+		}
+		if err := change(v); err != nil {
+			return err
+		}
+		if changed[id], err = bson.Marshal(v); err != nil {
+			return err
+		}
+	}
+	for id, data := range changed {
+		c.docs[id] = data
+	}
+	return nil
+}
+
+// update sets fields on the stored document while every field in match
+// holds its value, then applies change if given.
+func (c *collection[T]) update(id primitive.ObjectID, match, set repository.Fields, change func(*T) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, ok := c.docs[id]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	for path, value := range match {
+		equal, err := equalValues(lookup(doc, path), value)
+		if err != nil {
+			return err
+		}
+		if !equal {
+			return repository.ErrConflict
+		}
+	}
+	for path, value := range set {
+		assign(doc, path, value)
+	}
+
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	// Decode once to make sure the document still fits its type
+	v, err := decode[T](data)
+	if err != nil {
+		return err
+	}
+	if change != nil {
+		if err := change(v); err != nil {
+			return err
+		}
+		if data, err = bson.Marshal(v); err != nil {
+			return err
+		}
+	}
+	c.docs[id] = data
+	return nil
+}
+
+func (c *collection[T]) remove(id primitive.ObjectID) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.docs[id]; !ok {
+		return repository.ErrNotFound
+	}
+	delete(c.docs, id)
+	return nil
+}
+
+// lookup returns the value at a dotted path, or nil if it is unset.
+func lookup(doc bson.M, path string) interface{} {
+	var value interface{} = doc
+	for _, key := range strings.Split(path, ".") {
+		current, ok := value.(bson.M)
+		if !ok {
+			return nil
+		}
+		value = current[key]
+	}
+	return value
+}
+
+// assign sets the value at a dotted path, creating parents as needed.
+func assign(doc bson.M, path string, value interface{}) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		child, ok := doc[key].(bson.M)
+		if !ok {
+			child = bson.M{}
+			doc[key] = child
+		}
+		doc = child
+	}
+	doc[keys[len(keys)-1]] = value
+}
+
+// equalValues compares two values by their BSON encoding, so typed strings
+// equal plain ones and nil equals an unset field.
+func equalValues(a, b interface{}) (bool, error) {
+	encodedA, err := bson.Marshal(bson.M{"v": a})
+	if err != nil {
+		return false, err
+	}
+	encodedB, err := bson.Marshal(bson.M{"v": b})
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(encodedA, encodedB), nil
+}
+
+// paginate applies a page to a sorted listing.
+func paginate[T any](items []T, page repository.Page) []T {
+	if page.Skip >= int64(len(items)) {
+		return []T{}
+	}
+	items = items[page.Skip:]
+	if page.Limit > 0 && page.Limit < int64(len(items)) {
+		items = items[:page.Limit]
+	}
+	return items
+}
@@ -0,0 +1,246 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type OrderRepository struct {
+	orders *collection[models.Order]
+}
+
+func NewOrderRepository() *OrderRepository {
+	return &OrderRepository{orders: newCollection[models.Order]()}
+}
+
+func (r *OrderRepository) Create(ctx context.Context, order *models.Order) error {
+	if order.ID.IsZero() {
+		order.ID = primitive.NewObjectID()
+	}
+	return r.orders.insert(order.ID, order)
+}
+
+func (r *OrderRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Order, error) {
+	return r.orders.get(id)
+}
+
+func (r *OrderRepository) FindByIntentID(ctx context.Context, intentID string) (*models.Order, error) {
+	_, order, err := r.orders.findOne(func(o *models.Order) bool { return o.PaymentInfo.IntentID == intentID })
+	return order, err
+}
+
+func (r *OrderRepository) Find(ctx context.Context, query repository.OrderQuery) ([]models.Order, error) {
+	orders, err := r.orders.find(orderMatcher(query))
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(orders, func(i, j int) bool { return orders[i].CreatedAt.After(orders[j].CreatedAt) })
+	return paginate(orders, query.Page), nil
+}
+
+func (r *OrderRepository) Count(ctx context.Context, query repository.OrderQuery) (int64, error) {
+	orders, err := r.orders.find(orderMatcher(query))
+	return int64(len(orders)), err
+}
+
+func (r *OrderRepository) Revenue(ctx context.Context, query repository.OrderQuery) (float64, error) {
+	orders, err := r.orders.find(orderMatcher(query))
+	if err != nil {
+		return 0, err
+	}
+	total := 0.0
+	for _, order := range orders {
+		total += order.Total
+	}
+	return total, nil
+}
+
+func (r *OrderRepository) MonthlyStats(ctx context.Context, since time.Time) ([]repository.MonthlyStat, error) {
+	orders, err := r.orders.find(orderMatcher(repository.OrderQuery{CreatedSince: since}))
+	if err != nil {
+		return nil, err
+	}
+
+	byMonth := make(map[[2]int]*repository.MonthlyStat)
+	var stats []*repository.MonthlyStat
+	for _, order := range orders {
+		created := order.CreatedAt.UTC()
+		key := [2]int{created.Year(), int(created.Month())}
+		stat, ok := byMonth[key]
+		if !ok {
+			stat = &repository.MonthlyStat{}
+			stat.ID.Year, stat.ID.Month = key[0], key[1]
+			byMonth[key] = stat
+			stats = append(stats, stat)
+		}
+		stat.Revenue += order.Total
+		stat.Orders++
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].ID.Year != stats[j].ID.Year {
+			return stats[i].ID.Year < stats[j].ID.Year
+		}
+		return stats[i].ID.Month < stats[j].ID.Month
+	})
+	result := make([]repository.MonthlyStat, len(stats))
+	for i, stat := range stats {
+		result[i] = *stat
+	}
+	return result, nil
+}
+
+func (r *OrderRepository) Update(ctx context.Context, id primitive.ObjectID, match, set repository.Fields) error {
+	return r.orders.update(id, match, set, nil)
+}
+
+func (r *OrderRepository) Transition(ctx context.Context, id primitive.ObjectID, from, to models.OrderStatus, entry models.StatusHistoryEntry, match, set repository.Fields) error {
+	conditions := repository.Fields{"status": from}
+	for key, value := range match {
+		conditions[key] = value
+	}
+	update := repository.Fields{"status": to}
+	for key, value := range set {
+		update[key] = value
+	}
+
+	err := r.orders.update(id, conditions, update, func(o *models.Order) error {
+		o.StatusHistory = append(o.StatusHistory, entry)
+		return nil
+	})
+	if err == repository.ErrNotFound {
+		return repository.ErrConflict
+	}
+	return err
+}
+
+func (r *OrderRepository) ReserveReturn(ctx context.Context, id, productID, variantID primitive.ObjectID, quantity int) error {
+	return r.orders.modify(id, func(o *models.Order) error {
+		line := orderLine(o, productID, variantID)
+		if o.Status != models.OrderDelivered || line == nil || line.ReturnQuantity+quantity > line.Quantity {
+			return repository.ErrConflict
+		}
+		line.ReturnQuantity += quantity
+		return nil
+	})
+}
+
+func (r *OrderRepository) ReleaseReturn(ctx context.Context, id, productID, variantID primitive.ObjectID, quantity int) error {
+	return r.orders.modify(id, func(o *models.Order) error {
+		line := orderLine(o, productID, variantID)
+		if line == nil {
+			return repository.ErrConflict
+		}
+		line.ReturnQuantity -= quantity
+		return nil
+	})
+}
+
+func (r *OrderRepository) AddRefund(ctx context.Context, id primitive.ObjectID, amount float64) error {
+	return r.orders.modify(id, func(o *models.Order) error {
+		// Tolerate rounding of the per-return shares
+		if amount > 0 && o.RefundedAmount+amount > o.Total+0.005 {
+			return repository.ErrConflict
+		}
+		o.RefundedAmount += amount
+		o.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+func (r *OrderRepository) UpdateFulfilment(ctx context.Context, id, sellerID primitive.ObjectID, from, to models.OrderStatus, orderStatuses []models.OrderStatus, entry models.StatusHistoryEntry) error {
+	err := r.orders.modify(id, func(o *models.Order) error {
+		part := o.Fulfilment(sellerID)
+		if part == nil || part.Status != from || !hasStatus(orderStatuses, o.Status) {
+			return repository.ErrConflict
+		}
+		part.Status = to
+		part.UpdatedAt = entry.Timestamp
+		part.History = append(part.History, entry)
+		if entry.TrackingID != "" {
+			part.TrackingID = entry.TrackingID
+		}
+		if entry.Carrier != "" {
+			part.Carrier = entry.Carrier
+		}
+		o.UpdatedAt = time.Now()
+		return nil
+	})
+	if err == repository.ErrNotFound {
+		return repository.ErrConflict
+	}
+	return err
+}
+
+func (r *OrderRepository) AdvanceFulfilments(ctx context.Context, id primitive.ObjectID, from []models.OrderStatus, to models.OrderStatus, entry models.StatusHistoryEntry) error {
+	return r.orders.modify(id, func(o *models.Order) error {
+		for i := range o.Fulfilments {
+			part := &o.Fulfilments[i]
+			if hasStatus(from, part.Status) {
+				part.Status = to
+				part.UpdatedAt = entry.Timestamp
+				part.History = append(part.History, entry)
+			}
+		}
+		return nil
+	})
+}
+
+func hasStatus(statuses []models.OrderStatus, status models.OrderStatus) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+func orderLine(order *models.Order, productID, variantID primitive.ObjectID) *models.OrderItem {
+	for i := range order.Items {
+		if order.Items[i].ProductID == productID && order.Items[i].VariantID == variantID {
+			return &order.Items[i]
+		}
+	}
+	return nil
+}
+
+func orderMatcher(query repository.OrderQuery) func(*models.Order) bool {
+	return func(o *models.Order) bool {
+		if !query.UserID.IsZero() && o.UserID != query.UserID {
+			return false
+		}
+		if len(query.Statuses) > 0 && !hasStatus(query.Statuses, o.Status) {
+			return false
+		}
+		if query.PaymentStatus != "" && o.PaymentInfo.Status != query.PaymentStatus {
+			return false
+		}
+		if !query.PaymentExpiredBefore.IsZero() && (o.PaymentInfo.IntentID == "" || !o.PaymentInfo.ExpiresAt.Before(query.PaymentExpiredBefore)) {
+			return false
+		}
+		if !query.CreatedSince.IsZero() && o.CreatedAt.Before(query.CreatedSince) {
+			return false
+		}
+		if !query.UpdatedSince.IsZero() && o.UpdatedAt.Before(query.UpdatedSince) {
+			return false
+		}
+		if !query.SellerID.IsZero() && o.Fulfilment(query.SellerID) == nil {
+			return false
+		}
+		if !query.ProductID.IsZero() {
+			for _, item := range o.Items {
+				if item.ProductID == query.ProductID {
+					return true
+				}
+			}
+			return false
+		}
+		return true
+	}
+}
@@ -0,0 +1,52 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type PayoutRepository struct {
+	batches *collection[models.PayoutBatch]
+}
+
+func NewPayoutRepository() *PayoutRepository {
+	return &PayoutRepository{batches: newCollection[models.PayoutBatch]()}
+}
+
+func (r *PayoutRepository) Create(ctx context.Context, batch *models.PayoutBatch) error {
+	if batch.ID.IsZero() {
+		batch.ID = primitive.NewObjectID()
+	}
+	return r.batches.insert(batch.ID, batch)
+}
+
+func (r *PayoutRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.PayoutBatch, error) {
+	return r.batches.get(id)
+}
+
+func (r *PayoutRepository) Find(ctx context.Context, page repository.Page) ([]models.PayoutBatch, error) {
+	batches, err := r.batches.find(func(*models.PayoutBatch) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(batches, func(i, j int) bool { return batches[i].CreatedAt.After(batches[j].CreatedAt) })
+	return paginate(batches, page), nil
+}
+
+func (r *PayoutRepository) Count(ctx context.Context) (int64, error) {
+	batches, err := r.batches.find(func(*models.PayoutBatch) bool { return true })
+	return int64(len(batches)), err
+}
+
+func (r *PayoutRepository) Update(ctx context.Context, id primitive.ObjectID, match, set repository.Fields) error {
+	err := r.batches.update(id, match, set, nil)
+	if err == repository.ErrNotFound && len(match) > 0 {
+		return repository.ErrConflict
+	}
+	return err
+}
@@ -0,0 +1,371 @@
+package memory
+
+import (
+	"context"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ProductRepository struct {
+	products *collection[models.Product]
+}
+
+func NewProductRepository() *ProductRepository {
+	return &ProductRepository{products: newCollection[models.Product]()}
+}
+
+func (r *ProductRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Product, error) {
+	return r.products.get(id)
+}
+
+func (r *ProductRepository) FindBySlug(ctx context.Context, slug string) (*models.Product, error) {
+	_, product, err := r.products.findOne(func(p *models.Product) bool { return p.Slug == slug })
+	return product, err
+}
+
+func (r *ProductRepository) FindBySKU(ctx context.Context, sku string) (*models.Product, error) {
+	_, product, err := r.products.findOne(func(p *models.Product) bool {
+		for _, variant := range p.Variants {
+			if variant.SKU == sku {
+				return true
+			}
+		}
+		return false
+	})
+	return product, err
+}
+
+func (r *ProductRepository) Find(ctx context.Context, query repository.ProductQuery) ([]models.Product, error) {
+	products, err := r.products.find(productMatcher(query))
+	if err != nil {
+		return nil, err
+	}
+
+	less := productOrder(query.SortBy)
+	sort.SliceStable(products, func(i, j int) bool {
+		if query.SortDesc {
+			return less(&products[j], &products[i])
+		}
+		return less(&products[i], &products[j])
+	})
+	return paginate(products, query.Page), nil
+}
+
+func (r *ProductRepository) Each(ctx context.Context, query repository.ProductQuery, fn func(*models.Product) error) error {
+	query.SortBy, query.SortDesc, query.Page = "", false, repository.Page{}
+	products, err := r.Find(ctx, query)
+	if err != nil {
+		return err
+	}
+	for i := range products {
+		if err := fn(&products[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *ProductRepository) Count(ctx context.Context, query repository.ProductQuery) (int64, error) {
+	products, err := r.products.find(productMatcher(query))
+	return int64(len(products)), err
+}
+
+func (r *ProductRepository) Create(ctx context.Context, product *models.Product) error {
+	if product.ID.IsZero() {
+		product.ID = primitive.NewObjectID()
+	}
+	return r.products.insert(product.ID, product)
+}
+
+func (r *ProductRepository) Update(ctx context.Context, id primitive.ObjectID, set repository.Fields) error {
+	return r.products.update(id, nil, set, nil)
+}
+
+func (r *ProductRepository) Import(ctx context.Context, id primitive.ObjectID, set repository.Fields, variants []models.ProductVariant, restock []primitive.ObjectID) error {
+	return r.products.update(id, nil, set, func(p *models.Product) error {
+		stored := make(map[primitive.ObjectID]int, len(p.Variants))
+		for _, v := range p.Variants {
+			stored[v.ID] = v.Stock
+		}
+
+		p.Variants = append([]models.ProductVariant(nil), variants...)
+		for i := range p.Variants {
+			v := &p.Variants[i]
+			if stock, ok := stored[v.ID]; ok && !contains(restock, v.ID) {
+				v.Stock = stock
+			}
+		}
+		return nil
+	})
+}
+
+func (r *ProductRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return r.products.remove(id)
+}
+
+func (r *ProductRepository) ReserveStock(ctx context.Context, productID, variantID primitive.ObjectID, quantity int) (bool, error) {
+	err := r.products.modify(productID, func(p *models.Product) error {
+		if !p.IsActive || p.Stock < quantity {
+			return repository.ErrConflict
+		}
+		if !variantID.IsZero() {
+			variant := findVariant(p, variantID)
+			if variant == nil || variant.Stock < quantity {
+				return repository.ErrConflict
+			}
+			variant.Stock -= quantity
+		}
+		p.Stock -= quantity
+		return nil
+	})
+	if err == repository.ErrConflict || err == repository.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *ProductRepository) ReleaseStock(ctx context.Context, productID, variantID primitive.ObjectID, quantity int) error {
+	err := r.products.modify(productID, func(p *models.Product) error {
+		if !variantID.IsZero() {
+			variant := findVariant(p, variantID)
+			if variant == nil {
+				return repository.ErrNotFound
+			}
+			variant.Stock += quantity
+		}
+		p.Stock += quantity
+		return nil
+	})
+	if err == repository.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+func (r *ProductRepository) SavePrices(ctx context.Context, product *models.Product) error {
+	return r.products.modify(product.ID, func(p *models.Product) error {
+		p.BasePrice = product.BasePrice
+		p.DiscountPrice = product.DiscountPrice
+		p.PriceBreakup = product.PriceBreakup
+		for _, priced := range product.Variants {
+			if priced.PriceBreakup == nil {
+				continue
+			}
+			if variant := findVariant(p, priced.ID); variant != nil {
+				variant.Price = priced.Price
+				variant.PriceBreakup = priced.PriceBreakup
+			}
+		}
+		return nil
+	})
+}
+
+func (r *ProductRepository) Facets(ctx context.Context, query repository.ProductQuery) (*repository.ProductFacets, error) {
+	// counts tallies the products matching the query without the facet's
+	// own filter by the values keys returns for each
+	counts := func(facet string, keys func(p *models.Product) []string, label func(p *models.Product) string) ([]repository.FacetCount, error) {
+		products, err := r.products.find(productMatcher(query.WithoutFacet(facet)))
+		if err != nil {
+			return nil, err
+		}
+		index := map[string]int{}
+		out := []repository.FacetCount{}
+		for i := range products {
+			for _, key := range keys(&products[i]) {
+				n, ok := index[key]
+				if !ok {
+					n = len(out)
+					index[key] = n
+					out = append(out, repository.FacetCount{Value: key})
+					if label != nil {
+						out[n].Label = label(&products[i])
+					}
+				}
+				out[n].Count++
+			}
+		}
+		return out, nil
+	}
+	byCount := func(counts []repository.FacetCount) []repository.FacetCount {
+		sort.SliceStable(counts, func(i, j int) bool {
+			if counts[i].Count != counts[j].Count {
+				return counts[i].Count > counts[j].Count
+			}
+			return counts[i].Value < counts[j].Value
+		})
+		return counts
+	}
+	one := func(key func(p *models.Product) string) func(p *models.Product) []string {
+		return func(p *models.Product) []string { return []string{key(p)} }
+	}
+
+	var facets repository.ProductFacets
+	var err error
+	if facets.MetalTypes, err = counts(repository.FacetMetalType, one(func(p *models.Product) string { return string(p.MetalType) }), nil); err != nil {
+		return nil, err
+	}
+	if facets.Purities, err = counts(repository.FacetPurity, one(func(p *models.Product) string { return p.Purity }), nil); err != nil {
+		return nil, err
+	}
+	if facets.Categories, err = counts(repository.FacetCategory, one(func(p *models.Product) string { return p.CategoryID.Hex() }), func(p *models.Product) string { return p.CategoryName }); err != nil {
+		return nil, err
+	}
+	if facets.Tags, err = counts(repository.FacetTag, func(p *models.Product) []string { return p.Tags }, nil); err != nil {
+		return nil, err
+	}
+	if facets.PriceRanges, err = counts(repository.FacetPriceRange, one(func(p *models.Product) string { return repository.PriceBucket(p.BasePrice).String() }), nil); err != nil {
+		return nil, err
+	}
+	if facets.Ratings, err = counts(repository.FacetRating, one(func(p *models.Product) string { return strconv.Itoa(ratingBucket(p.Rating)) }), nil); err != nil {
+		return nil, err
+	}
+	if facets.InStock, err = counts(repository.FacetInStock, one(func(p *models.Product) string { return strconv.FormatBool(p.Stock > 0) }), nil); err != nil {
+		return nil, err
+	}
+
+	byCount(facets.MetalTypes)
+	byCount(facets.Purities)
+	byCount(facets.Categories)
+	byCount(facets.InStock)
+	if facets.Tags = byCount(facets.Tags); len(facets.Tags) > repository.MaxTagFacets {
+		facets.Tags = facets.Tags[:repository.MaxTagFacets]
+	}
+	sort.SliceStable(facets.PriceRanges, func(i, j int) bool {
+		a, _ := repository.ParsePriceRange(facets.PriceRanges[i].Value)
+		b, _ := repository.ParsePriceRange(facets.PriceRanges[j].Value)
+		return a.Min < b.Min
+	})
+	sort.SliceStable(facets.Ratings, func(i, j int) bool { return facets.Ratings[i].Value < facets.Ratings[j].Value })
+	return &facets, nil
+}
+
+func (r *ProductRepository) SetCategoryName(ctx context.Context, categoryID primitive.ObjectID, name string) error {
+	return r.products.modifyAll(
+		func(p *models.Product) bool { return p.CategoryID == categoryID && p.CategoryName != name },
+		func(p *models.Product) error {
+			p.CategoryName = name
+			return nil
+		},
+	)
+}
+
+func findVariant(product *models.Product, variantID primitive.ObjectID) *models.ProductVariant {
+	for i := range product.Variants {
+		if product.Variants[i].ID == variantID {
+			return &product.Variants[i]
+		}
+	}
+	return nil
+}
+
+func productMatcher(query repository.ProductQuery) func(*models.Product) bool {
+	var search *regexp.Regexp
+	if query.Search != "" {
+		search = regexp.MustCompile("(?i)" + regexp.QuoteMeta(query.Search))
+	}
+
+	ids := make(map[primitive.ObjectID]bool, len(query.IDs))
+	for _, id := range query.IDs {
+		ids[id] = true
+	}
+
+	return func(p *models.Product) bool {
+		switch {
+		case len(ids) > 0 && !ids[p.ID],
+			query.ActiveOnly && !p.IsActive,
+			len(query.MetalTypes) > 0 && !contains(query.MetalTypes, p.MetalType),
+			len(query.CategoryIDs) > 0 && !contains(query.CategoryIDs, p.CategoryID),
+			len(query.Purities) > 0 && !contains(query.Purities, p.Purity),
+			len(query.Tags) > 0 && !containsAny(query.Tags, p.Tags),
+			query.MinPrice > 0 && p.BasePrice < query.MinPrice,
+			query.MaxPrice > 0 && p.BasePrice > query.MaxPrice,
+			len(query.PriceRanges) > 0 && !inPriceRanges(query.PriceRanges, p.BasePrice),
+			len(query.Ratings) > 0 && !contains(query.Ratings, ratingBucket(p.Rating)),
+			query.InStock != nil && *query.InStock != (p.Stock > 0),
+			query.Featured && !p.IsFeatured,
+			query.NewArrival && !p.IsNewArrival,
+			query.BestSeller && !p.IsBestSeller,
+			query.StockBelow > 0 && p.Stock >= query.StockBelow,
+			query.RatePriced && p.NetWeight <= 0,
+			!query.SellerID.IsZero() && p.SellerID != query.SellerID,
+			!query.UpdatedSince.IsZero() && p.UpdatedAt.Before(query.UpdatedSince):
+			return false
+		}
+		if search != nil {
+			return matchesSearch(search, p)
+		}
+		return true
+	}
+}
+
+func contains[T comparable](values []T, v T) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny[T comparable](values, of []T) bool {
+	for _, v := range of {
+		if contains(values, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func inPriceRanges(ranges []repository.PriceRange, price float64) bool {
+	for _, r := range ranges {
+		if r.Contains(price) {
+			return true
+		}
+	}
+	return false
+}
+
+// ratingBucket rounds a rating down to whole stars, counting five-star
+// ratings with four.
+func ratingBucket(rating float64) int {
+	stars := int(math.Floor(rating))
+	if stars > 4 {
+		return 4
+	}
+	return stars
+}
+
+func matchesSearch(search *regexp.Regexp, p *models.Product) bool {
+	if search.MatchString(p.Name) || search.MatchString(p.Description) || search.MatchString(p.CategoryName) {
+		return true
+	}
+	for _, tag := range p.Tags {
+		if search.MatchString(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// productOrder compares products on a stored sort field.
+func productOrder(field string) func(a, b *models.Product) bool {
+	switch field {
+	case "base_price":
+		return func(a, b *models.Product) bool { return a.BasePrice < b.BasePrice }
+	case "name":
+		return func(a, b *models.Product) bool { return a.Name < b.Name }
+	case "rating":
+		return func(a, b *models.Product) bool { return a.Rating < b.Rating }
+	case "review_count":
+		return func(a, b *models.Product) bool { return a.ReviewCount < b.ReviewCount }
+	default:
+		return func(a, b *models.Product) bool { return a.CreatedAt.Before(b.CreatedAt) }
+	}
+}
@@ -0,0 +1,45 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"ejewel/internal/models"
+)
+
+type MetalRateRepository struct {
+	mu    sync.Mutex
+	rates map[[3]string]models.MetalRate
+}
+
+func NewMetalRateRepository() *MetalRateRepository {
+	return &MetalRateRepository{rates: make(map[[3]string]models.MetalRate)}
+}
+
+func (r *MetalRateRepository) Latest(ctx context.Context) ([]models.MetalRate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	latest := make(map[[2]string]models.MetalRate)
+	for _, rate := range r.rates {
+		key := [2]string{string(rate.MetalType), rate.Purity}
+		current, ok := latest[key]
+		if !ok || rate.Date > current.Date || (rate.Date == current.Date && rate.UpdatedAt.After(current.UpdatedAt)) {
+			latest[key] = rate
+		}
+	}
+
+	rates := make([]models.MetalRate, 0, len(latest))
+	for _, rate := range latest {
+		rates = append(rates, rate)
+	}
+	return rates, nil
+}
+
+func (r *MetalRateRepository) Save(ctx context.Context, rate *models.MetalRate) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rates[[3]string{string(rate.MetalType), rate.Purity, rate.Date}] = *rate
+	return nil
+}
@@ -0,0 +1,93 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ReturnRepository struct {
+	returns *collection[models.ReturnRequest]
+}
+
+func NewReturnRepository() *ReturnRepository {
+	return &ReturnRepository{returns: newCollection[models.ReturnRequest]()}
+}
+
+func (r *ReturnRepository) Create(ctx context.Context, returnRequest *models.ReturnRequest) error {
+	if returnRequest.ID.IsZero() {
+		returnRequest.ID = primitive.NewObjectID()
+	}
+	return r.returns.insert(returnRequest.ID, returnRequest)
+}
+
+func (r *ReturnRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.ReturnRequest, error) {
+	return r.returns.get(id)
+}
+
+func (r *ReturnRepository) Find(ctx context.Context, query repository.ReturnQuery) ([]models.ReturnRequest, error) {
+	returns, err := r.returns.find(returnMatcher(query))
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(returns, func(i, j int) bool { return returns[i].CreatedAt.After(returns[j].CreatedAt) })
+	return paginate(returns, query.Page), nil
+}
+
+func (r *ReturnRepository) Count(ctx context.Context, query repository.ReturnQuery) (int64, error) {
+	returns, err := r.returns.find(returnMatcher(query))
+	return int64(len(returns)), err
+}
+
+func (r *ReturnRepository) Update(ctx context.Context, id primitive.ObjectID, set repository.Fields) error {
+	return r.returns.update(id, nil, set, nil)
+}
+
+func (r *ReturnRepository) Transition(ctx context.Context, id primitive.ObjectID, from, to models.ReturnStatus, entry models.ReturnHistoryEntry, set repository.Fields) error {
+	update := repository.Fields{"status": to}
+	for key, value := range set {
+		update[key] = value
+	}
+	err := r.returns.update(id, repository.Fields{"status": from}, update, func(rr *models.ReturnRequest) error {
+		rr.History = append(rr.History, entry)
+		return nil
+	})
+	if err == repository.ErrNotFound {
+		return repository.ErrConflict
+	}
+	return err
+}
+
+func (r *ReturnRepository) Revert(ctx context.Context, id primitive.ObjectID, from, to models.ReturnStatus, unset ...string) error {
+	set := repository.Fields{"status": to, "updated_at": time.Now()}
+	for _, field := range unset {
+		set[field] = nil
+	}
+	err := r.returns.update(id, repository.Fields{"status": from}, set, func(rr *models.ReturnRequest) error {
+		if len(rr.History) > 0 {
+			rr.History = rr.History[:len(rr.History)-1]
+		}
+		return nil
+	})
+	if err == repository.ErrNotFound {
+		return repository.ErrConflict
+	}
+	return err
+}
+
+func returnMatcher(query repository.ReturnQuery) func(*models.ReturnRequest) bool {
+	return func(rr *models.ReturnRequest) bool {
+		if !query.UserID.IsZero() && rr.UserID != query.UserID {
+			return false
+		}
+		if !query.UpdatedSince.IsZero() && rr.UpdatedAt.Before(query.UpdatedSince) {
+			return false
+		}
+		return query.Status == "" || rr.Status == query.Status
+	}
+}
@@ -0,0 +1,68 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ReviewRepository struct {
+	reviews *collection[models.Review]
+}
+
+func NewReviewRepository() *ReviewRepository {
+	return &ReviewRepository{reviews: newCollection[models.Review]()}
+}
+
+func (r *ReviewRepository) FindByProduct(ctx context.Context, productID primitive.ObjectID) ([]models.Review, error) {
+	reviews, err := r.reviews.find(func(rv *models.Review) bool { return rv.ProductID == productID })
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(reviews, func(i, j int) bool { return reviews[i].CreatedAt.After(reviews[j].CreatedAt) })
+	return reviews, nil
+}
+
+func (r *ReviewRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Review, error) {
+	return r.reviews.get(id)
+}
+
+func (r *ReviewRepository) Exists(ctx context.Context, productID, userID primitive.ObjectID) (bool, error) {
+	_, _, err := r.reviews.findOne(func(rv *models.Review) bool {
+		return rv.ProductID == productID && rv.UserID == userID
+	})
+	if err == repository.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *ReviewRepository) Create(ctx context.Context, review *models.Review) error {
+	if review.ID.IsZero() {
+		review.ID = primitive.NewObjectID()
+	}
+	return r.reviews.insert(review.ID, review)
+}
+
+func (r *ReviewRepository) Update(ctx context.Context, id primitive.ObjectID, set repository.Fields) error {
+	return r.reviews.update(id, nil, set, nil)
+}
+
+func (r *ReviewRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return r.reviews.remove(id)
+}
+
+func (r *ReviewRepository) SetAuthor(ctx context.Context, userID primitive.ObjectID, name, avatar string) error {
+	return r.reviews.modifyAll(
+		func(review *models.Review) bool { return review.UserID == userID },
+		func(review *models.Review) error {
+			review.UserName = name
+			review.UserAvatar = avatar
+			return nil
+		},
+	)
+}
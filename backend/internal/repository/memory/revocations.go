@@ -0,0 +1,40 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type RevocationRepository struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+}
+
+func NewRevocationRepository() *RevocationRepository {
+	return &RevocationRepository{revoked: make(map[string]time.Time)}
+}
+
+func (r *RevocationRepository) Revoke(ctx context.Context, id string, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for key, until := range r.revoked {
+		if !until.After(now) {
+			delete(r.revoked, key)
+		}
+	}
+	if expiresAt.After(r.revoked[id]) {
+		r.revoked[id] = expiresAt
+	}
+	return nil
+}
+
+func (r *RevocationRepository) IsRevoked(ctx context.Context, id string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	until, ok := r.revoked[id]
+	return ok && until.After(time.Now()), nil
+}
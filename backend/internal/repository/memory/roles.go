@@ -0,0 +1,61 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type RoleRepository struct {
+	// create serialises the name check with the insert
+	create sync.Mutex
+	roles  *collection[models.RoleDefinition]
+}
+
+func NewRoleRepository() *RoleRepository {
+	return &RoleRepository{roles: newCollection[models.RoleDefinition]()}
+}
+
+func (r *RoleRepository) FindAll(ctx context.Context) ([]models.RoleDefinition, error) {
+	roles, err := r.roles.find(func(*models.RoleDefinition) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	return roles, nil
+}
+
+func (r *RoleRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.RoleDefinition, error) {
+	return r.roles.get(id)
+}
+
+func (r *RoleRepository) FindByName(ctx context.Context, name models.Role) (*models.RoleDefinition, error) {
+	_, role, err := r.roles.findOne(func(d *models.RoleDefinition) bool { return d.Name == name })
+	return role, err
+}
+
+func (r *RoleRepository) Create(ctx context.Context, role *models.RoleDefinition) error {
+	r.create.Lock()
+	defer r.create.Unlock()
+
+	if _, err := r.FindByName(ctx, role.Name); err == nil {
+		return repository.ErrDuplicate
+	}
+	if role.ID.IsZero() {
+		role.ID = primitive.NewObjectID()
+	}
+	return r.roles.insert(role.ID, role)
+}
+
+func (r *RoleRepository) Update(ctx context.Context, id primitive.ObjectID, set repository.Fields) error {
+	return r.roles.update(id, nil, set, nil)
+}
+
+func (r *RoleRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return r.roles.remove(id)
+}
@@ -0,0 +1,72 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type SellerRepository struct {
+	// create serialises the user check with the insert
+	create  sync.Mutex
+	sellers *collection[models.Seller]
+}
+
+func NewSellerRepository() *SellerRepository {
+	return &SellerRepository{sellers: newCollection[models.Seller]()}
+}
+
+func (r *SellerRepository) Create(ctx context.Context, seller *models.Seller) error {
+	r.create.Lock()
+	defer r.create.Unlock()
+
+	if _, err := r.FindByUser(ctx, seller.UserID); err == nil {
+		return repository.ErrDuplicate
+	}
+	if seller.ID.IsZero() {
+		seller.ID = primitive.NewObjectID()
+	}
+	return r.sellers.insert(seller.ID, seller)
+}
+
+func (r *SellerRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Seller, error) {
+	return r.sellers.get(id)
+}
+
+func (r *SellerRepository) FindByUser(ctx context.Context, userID primitive.ObjectID) (*models.Seller, error) {
+	_, seller, err := r.sellers.findOne(func(s *models.Seller) bool { return s.UserID == userID })
+	return seller, err
+}
+
+func (r *SellerRepository) Find(ctx context.Context, query repository.SellerQuery) ([]models.Seller, error) {
+	sellers, err := r.sellers.find(sellerMatcher(query))
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(sellers, func(i, j int) bool { return sellers[i].CreatedAt.After(sellers[j].CreatedAt) })
+	return paginate(sellers, query.Page), nil
+}
+
+func (r *SellerRepository) Count(ctx context.Context, query repository.SellerQuery) (int64, error) {
+	sellers, err := r.sellers.find(sellerMatcher(query))
+	return int64(len(sellers)), err
+}
+
+func (r *SellerRepository) Update(ctx context.Context, id primitive.ObjectID, match, set repository.Fields) error {
+	err := r.sellers.update(id, match, set, nil)
+	if err == repository.ErrNotFound && len(match) > 0 {
+		return repository.ErrConflict
+	}
+	return err
+}
+
+func sellerMatcher(query repository.SellerQuery) func(*models.Seller) bool {
+	return func(s *models.Seller) bool {
+		return query.Status == "" || s.Status == query.Status
+	}
+}
@@ -0,0 +1,108 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type SessionRepository struct {
+	sessions *collection[models.Session]
+}
+
+func NewSessionRepository() *SessionRepository {
+	return &SessionRepository{sessions: newCollection[models.Session]()}
+}
+
+func (r *SessionRepository) Create(ctx context.Context, session *models.Session) error {
+	if session.ID.IsZero() {
+		session.ID = primitive.NewObjectID()
+	}
+	return r.sessions.insert(session.ID, session)
+}
+
+func (r *SessionRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Session, error) {
+	return r.sessions.get(id)
+}
+
+func (r *SessionRepository) FindActiveByUser(ctx context.Context, userID primitive.ObjectID) ([]models.Session, error) {
+	now := time.Now()
+	sessions, err := r.sessions.find(func(s *models.Session) bool {
+		return s.UserID == userID && s.IsActive(now)
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(sessions, func(i, j int) bool { return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt) })
+	return sessions, nil
+}
+
+func (r *SessionRepository) FindByTokenHash(ctx context.Context, hash string) (*models.Session, error) {
+	_, session, err := r.sessions.findOne(func(s *models.Session) bool {
+		if s.TokenHash == hash {
+			return true
+		}
+		for _, used := range s.UsedHashes {
+			if used == hash {
+				return true
+			}
+		}
+		return false
+	})
+	return session, err
+}
+
+func (r *SessionRepository) Rotate(ctx context.Context, id primitive.ObjectID, oldHash, newHash string, set repository.Fields) error {
+	match := repository.Fields{"token_hash": oldHash, "revoked_at": nil}
+	update := repository.Fields{"token_hash": newHash}
+	for key, value := range set {
+		update[key] = value
+	}
+	return r.sessions.update(id, match, update, func(s *models.Session) error {
+		s.UsedHashes = append(s.UsedHashes, oldHash)
+		if len(s.UsedHashes) > models.MaxUsedHashes {
+			s.UsedHashes = s.UsedHashes[len(s.UsedHashes)-models.MaxUsedHashes:]
+		}
+		return nil
+	})
+}
+
+func (r *SessionRepository) Revoke(ctx context.Context, id primitive.ObjectID, reason string) error {
+	err := r.sessions.modify(id, func(s *models.Session) error {
+		revoke(s, reason)
+		return nil
+	})
+	if err == repository.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+func (r *SessionRepository) RevokeByUser(ctx context.Context, userID, keep primitive.ObjectID, reason string) error {
+	sessions, err := r.sessions.find(func(s *models.Session) bool {
+		return s.UserID == userID && s.ID != keep && s.RevokedAt == nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if err := r.Revoke(ctx, session.ID, reason); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func revoke(s *models.Session, reason string) {
+	if s.RevokedAt != nil {
+		return
+	}
+	now := time.Now()
+	s.RevokedAt = &now
+	s.RevokeReason = reason
+}
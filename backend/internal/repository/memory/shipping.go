@@ -0,0 +1,66 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ShippingZoneRepository struct {
+	zones *collection[models.ShippingZone]
+}
+
+func NewShippingZoneRepository() *ShippingZoneRepository {
+	return &ShippingZoneRepository{zones: newCollection[models.ShippingZone]()}
+}
+
+func (r *ShippingZoneRepository) FindAll(ctx context.Context) ([]models.ShippingZone, error) {
+	zones, err := r.zones.find(func(*models.ShippingZone) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(zones, func(i, j int) bool { return zones[i].Name < zones[j].Name })
+	return zones, nil
+}
+
+func (r *ShippingZoneRepository) FindActiveByPincode(ctx context.Context, pincode int) ([]models.ShippingZone, error) {
+	return r.zones.find(func(zone *models.ShippingZone) bool {
+		if !zone.IsActive {
+			return false
+		}
+		for _, pins := range zone.Pincodes {
+			if pincode >= pins.From && pincode <= pins.To {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (r *ShippingZoneRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.ShippingZone, error) {
+	return r.zones.get(id)
+}
+
+func (r *ShippingZoneRepository) Count(ctx context.Context) (int64, error) {
+	zones, err := r.zones.find(func(*models.ShippingZone) bool { return true })
+	return int64(len(zones)), err
+}
+
+func (r *ShippingZoneRepository) Create(ctx context.Context, zone *models.ShippingZone) error {
+	if zone.ID.IsZero() {
+		zone.ID = primitive.NewObjectID()
+	}
+	return r.zones.insert(zone.ID, zone)
+}
+
+func (r *ShippingZoneRepository) Update(ctx context.Context, id primitive.ObjectID, set repository.Fields) error {
+	return r.zones.update(id, nil, set, nil)
+}
+
+func (r *ShippingZoneRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return r.zones.remove(id)
+}
@@ -0,0 +1,101 @@
+package memory
+
+import (
+	"context"
+	"sort"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type UserRepository struct {
+	users *collection[models.User]
+}
+
+func NewUserRepository() *UserRepository {
+	return &UserRepository{users: newCollection[models.User]()}
+}
+
+func (r *UserRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	return r.users.get(id)
+}
+
+func (r *UserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	_, user, err := r.users.findOne(func(u *models.User) bool { return u.Email == email })
+	return user, err
+}
+
+func (r *UserRepository) Find(ctx context.Context, query repository.UserQuery) ([]models.User, error) {
+	users, err := r.users.find(userMatcher(query))
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(users, func(i, j int) bool { return users[i].CreatedAt.After(users[j].CreatedAt) })
+	return paginate(users, query.Page), nil
+}
+
+func (r *UserRepository) Count(ctx context.Context, query repository.UserQuery) (int64, error) {
+	users, err := r.users.find(userMatcher(query))
+	return int64(len(users)), err
+}
+
+func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	return r.users.insert(user.ID, user)
+}
+
+func (r *UserRepository) Update(ctx context.Context, id primitive.ObjectID, set repository.Fields) error {
+	return r.users.update(id, nil, set, nil)
+}
+
+func (r *UserRepository) BumpTokenVersion(ctx context.Context, id primitive.ObjectID) error {
+	return r.users.modify(id, func(u *models.User) error {
+		u.TokenVersion++
+		return nil
+	})
+}
+
+func (r *UserRepository) RecordFailedLogin(ctx context.Context, id primitive.ObjectID) (int, error) {
+	var failures int
+	err := r.users.modify(id, func(u *models.User) error {
+		u.FailedLogins++
+		failures = u.FailedLogins
+		return nil
+	})
+	return failures, err
+}
+
+func (r *UserRepository) UseTwoFactorStep(ctx context.Context, id primitive.ObjectID, step int64) error {
+	return r.users.modify(id, func(u *models.User) error {
+		if u.TwoFactor.LastStep >= step {
+			return repository.ErrConflict
+		}
+		u.TwoFactor.LastStep = step
+		return nil
+	})
+}
+
+func (r *UserRepository) UseRecoveryCode(ctx context.Context, id primitive.ObjectID, hash string) error {
+	return r.users.modify(id, func(u *models.User) error {
+		for i, stored := range u.TwoFactor.RecoveryCodes {
+			if stored == hash {
+				u.TwoFactor.RecoveryCodes = append(u.TwoFactor.RecoveryCodes[:i:i], u.TwoFactor.RecoveryCodes[i+1:]...)
+				return nil
+			}
+		}
+		return repository.ErrConflict
+	})
+}
+
+func userMatcher(query repository.UserQuery) func(*models.User) bool {
+	return func(u *models.User) bool {
+		if !query.UpdatedSince.IsZero() && u.UpdatedAt.Before(query.UpdatedSince) {
+			return false
+		}
+		return query.Role == "" || u.Role == query.Role
+	}
+}
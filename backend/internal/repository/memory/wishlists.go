@@ -0,0 +1,91 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type WishlistRepository struct {
+	// mu serialises writes so a user never ends up with two wishlists
+	mu        sync.Mutex
+	wishlists *collection[models.Wishlist]
+}
+
+func NewWishlistRepository() *WishlistRepository {
+	return &WishlistRepository{wishlists: newCollection[models.Wishlist]()}
+}
+
+func (r *WishlistRepository) FindByUser(ctx context.Context, userID primitive.ObjectID) (*models.Wishlist, error) {
+	_, wishlist, err := r.wishlists.findOne(wishlistMatcher(userID))
+	return wishlist, err
+}
+
+func (r *WishlistRepository) AddProduct(ctx context.Context, userID, productID primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id, wishlist, err := r.wishlists.findOne(wishlistMatcher(userID))
+	if err == repository.ErrNotFound {
+		id = primitive.NewObjectID()
+		wishlist = &models.Wishlist{ID: id, UserID: userID, Products: []primitive.ObjectID{}}
+	} else if err != nil {
+		return err
+	}
+
+	for _, existing := range wishlist.Products {
+		if existing == productID {
+			wishlist.UpdatedAt = time.Now()
+			return r.wishlists.put(id, wishlist)
+		}
+	}
+	wishlist.Products = append(wishlist.Products, productID)
+	wishlist.UpdatedAt = time.Now()
+	return r.wishlists.put(id, wishlist)
+}
+
+func (r *WishlistRepository) RemoveProduct(ctx context.Context, userID, productID primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id, wishlist, err := r.wishlists.findOne(wishlistMatcher(userID))
+	if err == repository.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	kept := wishlist.Products[:0]
+	for _, existing := range wishlist.Products {
+		if existing != productID {
+			kept = append(kept, existing)
+		}
+	}
+	wishlist.Products = kept
+	wishlist.UpdatedAt = time.Now()
+	return r.wishlists.put(id, wishlist)
+}
+
+func (r *WishlistRepository) DeleteByUser(ctx context.Context, userID primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id, _, err := r.wishlists.findOne(wishlistMatcher(userID))
+	if err == repository.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return r.wishlists.remove(id)
+}
+
+func wishlistMatcher(userID primitive.ObjectID) func(*models.Wishlist) bool {
+	return func(w *models.Wishlist) bool { return w.UserID == userID }
+}
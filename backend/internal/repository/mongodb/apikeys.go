@@ -0,0 +1,54 @@
+package mongodb
+
+import (
+	"context"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type APIKeyRepository struct {
+	collection *mongo.Collection
+}
+
+func NewAPIKeyRepository(collection *mongo.Collection) *APIKeyRepository {
+	return &APIKeyRepository{collection: collection}
+}
+
+func (r *APIKeyRepository) Create(ctx context.Context, key *models.APIKey) error {
+	return insertOne(ctx, r.collection, key)
+}
+
+func (r *APIKeyRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := findOne(ctx, r.collection, bson.M{"_id": id}, &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *APIKeyRepository) FindByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := findOne(ctx, r.collection, bson.M{"key_hash": hash}, &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *APIKeyRepository) FindAll(ctx context.Context) ([]models.APIKey, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	keys := []models.APIKey{}
+	if err := findAll(ctx, r.collection, bson.M{}, &keys, opts); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (r *APIKeyRepository) Update(ctx context.Context, id primitive.ObjectID, set repository.Fields) error {
+	return updateOne(ctx, r.collection, bson.M{"_id": id}, bson.M{"$set": set})
+}
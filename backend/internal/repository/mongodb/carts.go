@@ -0,0 +1,66 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type CartRepository struct {
+	collection *mongo.Collection
+}
+
+func NewCartRepository(collection *mongo.Collection) *CartRepository {
+	return &CartRepository{collection: collection}
+}
+
+func (r *CartRepository) Find(ctx context.Context, key repository.CartKey) (*models.Cart, error) {
+	filter := cartFilter(key)
+	if key.TokenHash != "" {
+		// The TTL index removes expired carts only periodically
+		filter["expires_at"] = bson.M{"$gt": time.Now()}
+	}
+
+	var cart models.Cart
+	if err := findOne(ctx, r.collection, filter, &cart); err != nil {
+		return nil, err
+	}
+	return &cart, nil
+}
+
+func (r *CartRepository) Save(ctx context.Context, key repository.CartKey, cart *models.Cart) error {
+	opts := options.Update().SetUpsert(true)
+	_, err := r.collection.UpdateOne(ctx, cartFilter(key), bson.M{"$set": cart}, opts)
+	return err
+}
+
+func (r *CartRepository) Delete(ctx context.Context, key repository.CartKey) error {
+	_, err := r.collection.DeleteOne(ctx, cartFilter(key))
+	return err
+}
+
+func (r *CartRepository) SetProductDetails(ctx context.Context, productID primitive.ObjectID, name, thumbnail string) error {
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"item.product_id": productID}},
+	})
+	_, err := r.collection.UpdateMany(ctx,
+		bson.M{"items.product_id": productID},
+		bson.M{"$set": bson.M{"items.$[item].product_name": name, "items.$[item].thumbnail": thumbnail}},
+		opts,
+	)
+	return err
+}
+
+func cartFilter(key repository.CartKey) bson.M {
+	if key.TokenHash != "" {
+		return bson.M{"token_hash": key.TokenHash}
+	}
+	return bson.M{"user_id": key.UserID}
+}
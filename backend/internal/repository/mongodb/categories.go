@@ -0,0 +1,67 @@
+package mongodb
+
+import (
+	"context"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type CategoryRepository struct {
+	collection *mongo.Collection
+}
+
+func NewCategoryRepository(collection *mongo.Collection) *CategoryRepository {
+	return &CategoryRepository{collection: collection}
+}
+
+func (r *CategoryRepository) FindActive(ctx context.Context) ([]models.Category, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "sort_order", Value: 1}})
+	var categories []models.Category
+	if err := findAll(ctx, r.collection, bson.M{"is_active": true}, &categories, opts); err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+func (r *CategoryRepository) FindAll(ctx context.Context) ([]models.Category, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "sort_order", Value: 1}})
+	var categories []models.Category
+	if err := findAll(ctx, r.collection, bson.M{}, &categories, opts); err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+func (r *CategoryRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Category, error) {
+	var category models.Category
+	if err := findOne(ctx, r.collection, bson.M{"_id": id}, &category); err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+func (r *CategoryRepository) FindBySlug(ctx context.Context, slug string) (*models.Category, error) {
+	var category models.Category
+	if err := findOne(ctx, r.collection, bson.M{"slug": slug}, &category); err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+func (r *CategoryRepository) Create(ctx context.Context, category *models.Category) error {
+	return insertOne(ctx, r.collection, category)
+}
+
+func (r *CategoryRepository) Update(ctx context.Context, id primitive.ObjectID, set repository.Fields) error {
+	return updateOne(ctx, r.collection, bson.M{"_id": id}, bson.M{"$set": set})
+}
+
+func (r *CategoryRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return deleteOne(ctx, r.collection, bson.M{"_id": id})
+}
@@ -0,0 +1,48 @@
+package mongodb
+
+import (
+	"context"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type CommissionRepository struct {
+	collection *mongo.Collection
+}
+
+func NewCommissionRepository(collection *mongo.Collection) *CommissionRepository {
+	return &CommissionRepository{collection: collection}
+}
+
+func (r *CommissionRepository) FindAll(ctx context.Context) ([]models.CommissionRule, error) {
+	rules := []models.CommissionRule{}
+	if err := findAll(ctx, r.collection, bson.M{}, &rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func (r *CommissionRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.CommissionRule, error) {
+	var rule models.CommissionRule
+	if err := findOne(ctx, r.collection, bson.M{"_id": id}, &rule); err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (r *CommissionRepository) Create(ctx context.Context, rule *models.CommissionRule) error {
+	return insertOne(ctx, r.collection, rule)
+}
+
+func (r *CommissionRepository) Update(ctx context.Context, id primitive.ObjectID, set repository.Fields) error {
+	return updateOne(ctx, r.collection, bson.M{"_id": id}, bson.M{"$set": set})
+}
+
+func (r *CommissionRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return deleteOne(ctx, r.collection, bson.M{"_id": id})
+}
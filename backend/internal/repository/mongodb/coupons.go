@@ -0,0 +1,119 @@
+package mongodb
+
+import (
+	"context"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type CouponRepository struct {
+	collection *mongo.Collection
+	usages     *mongo.Collection
+}
+
+func NewCouponRepository(collection, usages *mongo.Collection) *CouponRepository {
+	return &CouponRepository{collection: collection, usages: usages}
+}
+
+func (r *CouponRepository) Find(ctx context.Context, query repository.CouponQuery) ([]models.Coupon, error) {
+	filter := bson.M{}
+	if query.Active != nil {
+		filter["is_active"] = *query.Active
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	coupons := []models.Coupon{}
+	if err := findAll(ctx, r.collection, filter, &coupons, opts); err != nil {
+		return nil, err
+	}
+	return coupons, nil
+}
+
+func (r *CouponRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Coupon, error) {
+	var coupon models.Coupon
+	if err := findOne(ctx, r.collection, bson.M{"_id": id}, &coupon); err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+func (r *CouponRepository) FindByCode(ctx context.Context, code string) (*models.Coupon, error) {
+	var coupon models.Coupon
+	if err := findOne(ctx, r.collection, bson.M{"code": code}, &coupon); err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+func (r *CouponRepository) Create(ctx context.Context, coupon *models.Coupon) error {
+	return insertOne(ctx, r.collection, coupon)
+}
+
+func (r *CouponRepository) Update(ctx context.Context, id primitive.ObjectID, set repository.Fields) error {
+	return updateOne(ctx, r.collection, bson.M{"_id": id}, bson.M{"$set": set})
+}
+
+func (r *CouponRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	if err := deleteOne(ctx, r.collection, bson.M{"_id": id}); err != nil {
+		return err
+	}
+	_, err := r.usages.DeleteMany(ctx, bson.M{"coupon_id": id})
+	return err
+}
+
+func (r *CouponRepository) UserUses(ctx context.Context, couponID, userID primitive.ObjectID) (int, error) {
+	var usage models.CouponUsage
+	err := findOne(ctx, r.usages, bson.M{"coupon_id": couponID, "user_id": userID}, &usage)
+	if err == repository.ErrNotFound {
+		return 0, nil
+	}
+	return usage.Count, err
+}
+
+func (r *CouponRepository) ReserveUserUse(ctx context.Context, couponID, userID primitive.ObjectID, limit int) (bool, error) {
+	filter := bson.M{"coupon_id": couponID, "user_id": userID}
+	if limit > 0 {
+		filter["count"] = bson.M{"$lt": limit}
+	}
+
+	// The unique (coupon_id, user_id) index turns an upsert on a user who
+	// is at the limit into a duplicate key error
+	_, err := r.usages.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"count": 1}}, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *CouponRepository) ReleaseUserUse(ctx context.Context, couponID, userID primitive.ObjectID) error {
+	_, err := r.usages.UpdateOne(ctx,
+		bson.M{"coupon_id": couponID, "user_id": userID, "count": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"count": -1}},
+	)
+	return err
+}
+
+func (r *CouponRepository) ReserveUse(ctx context.Context, id primitive.ObjectID, limit int) (bool, error) {
+	filter := bson.M{"_id": id, "is_active": true}
+	if limit > 0 {
+		filter["used_count"] = bson.M{"$lt": limit}
+	}
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"used_count": 1}})
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+func (r *CouponRepository) ReleaseUse(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "used_count": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"used_count": -1}},
+	)
+	return err
+}
@@ -0,0 +1,77 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type EventRepository struct {
+	collection *mongo.Collection
+}
+
+func NewEventRepository(collection *mongo.Collection) *EventRepository {
+	return &EventRepository{collection: collection}
+}
+
+func (r *EventRepository) Create(ctx context.Context, event *models.Event) error {
+	return insertOne(ctx, r.collection, event)
+}
+
+func (r *EventRepository) Claim(ctx context.Context, now time.Time, lease time.Duration) (*models.Event, error) {
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "run_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var event models.Event
+	err := r.collection.FindOneAndUpdate(ctx,
+		bson.M{"status": models.EventPending, "run_at": bson.M{"$lte": now}},
+		bson.M{"$set": bson.M{"run_at": now.Add(lease)}, "$inc": bson.M{"attempts": 1}},
+		opts,
+	).Decode(&event)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, repository.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+func (r *EventRepository) Update(ctx context.Context, id primitive.ObjectID, set repository.Fields) error {
+	return updateOne(ctx, r.collection, bson.M{"_id": id}, bson.M{"$set": set})
+}
+
+func (r *EventRepository) Published(ctx context.Context, eventType models.EventType, since time.Time) (map[primitive.ObjectID]time.Time, error) {
+	pipeline := []bson.M{
+		{"$match": bson.M{"type": eventType, "created_at": bson.M{"$gte": since}}},
+		{"$group": bson.M{"_id": "$subject_id", "latest": bson.M{"$max": "$created_at"}}},
+	}
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		SubjectID primitive.ObjectID `bson:"_id"`
+		Latest    time.Time          `bson:"latest"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+
+	latest := make(map[primitive.ObjectID]time.Time, len(rows))
+	for _, row := range rows {
+		latest[row.SubjectID] = row.Latest
+	}
+	return latest, nil
+}
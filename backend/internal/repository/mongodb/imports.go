@@ -0,0 +1,55 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type ImportJobRepository struct {
+	collection *mongo.Collection
+}
+
+func NewImportJobRepository(collection *mongo.Collection) *ImportJobRepository {
+	return &ImportJobRepository{collection: collection}
+}
+
+func (r *ImportJobRepository) Create(ctx context.Context, job *models.ImportJob) error {
+	return insertOne(ctx, r.collection, job)
+}
+
+func (r *ImportJobRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.ImportJob, error) {
+	var job models.ImportJob
+	if err := findOne(ctx, r.collection, bson.M{"_id": id}, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (r *ImportJobRepository) Update(ctx context.Context, id primitive.ObjectID, set repository.Fields) error {
+	return updateOne(ctx, r.collection, bson.M{"_id": id}, bson.M{"$set": set})
+}
+
+func (r *ImportJobRepository) FailAbandoned(ctx context.Context, before time.Time, reason string) (int64, error) {
+	result, err := r.collection.UpdateMany(ctx,
+		bson.M{
+			"status": bson.M{"$in": []models.ImportStatus{models.ImportQueued, models.ImportRunning}},
+			// Jobs from before heartbeats were recorded have none
+			"$or": []bson.M{
+				{"heartbeat_at": bson.M{"$lt": before}},
+				{"heartbeat_at": bson.M{"$exists": false}},
+			},
+		},
+		bson.M{"$set": bson.M{"status": models.ImportFailed, "error": reason, "finished_at": time.Now()}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
@@ -0,0 +1,99 @@
+package mongodb
+
+import (
+	"context"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type LedgerRepository struct {
+	collection *mongo.Collection
+}
+
+func NewLedgerRepository(collection *mongo.Collection) *LedgerRepository {
+	return &LedgerRepository{collection: collection}
+}
+
+func (r *LedgerRepository) Record(ctx context.Context, entry *models.LedgerEntry) error {
+	return insertOne(ctx, r.collection, entry)
+}
+
+func (r *LedgerRepository) FindByKey(ctx context.Context, key string) (*models.LedgerEntry, error) {
+	var entry models.LedgerEntry
+	if err := findOne(ctx, r.collection, bson.M{"key": key}, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (r *LedgerRepository) Find(ctx context.Context, query repository.LedgerQuery) ([]models.LedgerEntry, error) {
+	opts := pageOptions(options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}), query.Page)
+	entries := []models.LedgerEntry{}
+	if err := findAll(ctx, r.collection, ledgerFilter(query), &entries, opts); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (r *LedgerRepository) Balances(ctx context.Context, query repository.LedgerQuery) ([]repository.LedgerBalance, error) {
+	pipeline := []bson.M{
+		{"$match": ledgerFilter(query)},
+		{"$group": bson.M{
+			"_id":          "$seller_id",
+			"entries":      bson.M{"$sum": 1},
+			"gross":        bson.M{"$sum": "$gross"},
+			"commission":   bson.M{"$sum": "$commission"},
+			"tax_withheld": bson.M{"$sum": "$tax_withheld"},
+			"net":          bson.M{"$sum": "$net"},
+		}},
+		{"$sort": bson.M{"_id": 1}},
+	}
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	balances := []repository.LedgerBalance{}
+	if err := cursor.All(ctx, &balances); err != nil {
+		return nil, err
+	}
+	return balances, nil
+}
+
+func (r *LedgerRepository) Settle(ctx context.Context, query repository.LedgerQuery, payoutID primitive.ObjectID) error {
+	query.Unsettled = true
+	_, err := r.collection.UpdateMany(ctx, ledgerFilter(query), bson.M{"$set": bson.M{"payout_id": payoutID}})
+	return err
+}
+
+func ledgerFilter(query repository.LedgerQuery) bson.M {
+	filter := bson.M{}
+
+	if !query.SellerID.IsZero() {
+		filter["seller_id"] = query.SellerID
+	}
+	if !query.PayoutID.IsZero() {
+		filter["payout_id"] = query.PayoutID
+	} else if query.Unsettled {
+		filter["payout_id"] = bson.M{"$exists": false}
+	}
+	created := bson.M{}
+	if !query.From.IsZero() {
+		created["$gte"] = query.From
+	}
+	if !query.To.IsZero() {
+		created["$lt"] = query.To
+	}
+	if len(created) > 0 {
+		filter["created_at"] = created
+	}
+
+	return filter
+}
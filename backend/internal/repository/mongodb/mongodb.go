@@ -0,0 +1,124 @@
+// Package mongodb implements the repositories on top of the MongoDB
+// collections in the database package.
+package mongodb
+
+import (
+	"context"
+	"errors"
+
+	"ejewel/internal/database"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// NewRepositories returns repositories backed by the connected database.
+func NewRepositories() repository.Repositories {
+	return repository.Repositories{
+		Users:       NewUserRepository(database.Users()),
+		Products:    NewProductRepository(database.Products()),
+		Categories:  NewCategoryRepository(database.Categories()),
+		Carts:       NewCartRepository(database.Carts()),
+		Wishlists:   NewWishlistRepository(database.Wishlists()),
+		Orders:      NewOrderRepository(database.Orders()),
+		Reviews:     NewReviewRepository(database.Reviews()),
+		Sessions:    NewSessionRepository(database.Sessions()),
+		Revocations: NewRevocationRepository(database.RevokedTokens()),
+		Roles:       NewRoleRepository(database.Roles()),
+		Sellers:     NewSellerRepository(database.Sellers()),
+		Ledger:      NewLedgerRepository(database.LedgerEntries()),
+		Commissions: NewCommissionRepository(database.CommissionRules()),
+		Payouts:     NewPayoutRepository(database.PayoutBatches()),
+		APIKeys:     NewAPIKeyRepository(database.APIKeys()),
+		Events:      NewEventRepository(database.Events()),
+		ImportJobs:  NewImportJobRepository(database.ImportJobs()),
+		Coupons:     NewCouponRepository(database.Coupons(), database.CouponUsages()),
+		Returns:     NewReturnRepository(database.Returns()),
+		Zones:       NewShippingZoneRepository(database.ShippingZones()),
+		Counters:    NewCounterRepository(database.Counters()),
+		MetalRates:  NewMetalRateRepository(database.MetalRates()),
+	}
+}
+
+// findOne decodes the first document matching filter into v.
+func findOne(ctx context.Context, collection *mongo.Collection, filter interface{}, v interface{}) error {
+	err := collection.FindOne(ctx, filter).Decode(v)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return repository.ErrNotFound
+	}
+	return err
+}
+
+// findAll decodes every document matching filter into v, which must point
+// to a slice.
+func findAll(ctx context.Context, collection *mongo.Collection, filter interface{}, v interface{}, opts ...*options.FindOptions) error {
+	cursor, err := collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	return cursor.All(ctx, v)
+}
+
+// insertOne stores a new document, mapping unique index violations to
+// repository.ErrDuplicate.
+func insertOne(ctx context.Context, collection *mongo.Collection, document interface{}) error {
+	_, err := collection.InsertOne(ctx, document)
+	if mongo.IsDuplicateKeyError(err) {
+		return repository.ErrDuplicate
+	}
+	return err
+}
+
+// updateOne applies update to the document matching filter. A filter that
+// names only the id reports ErrNotFound when nothing matches; conditional
+// filters report ErrConflict.
+func updateOne(ctx context.Context, collection *mongo.Collection, filter bson.M, update interface{}, opts ...*options.UpdateOptions) error {
+	result, err := collection.UpdateOne(ctx, filter, update, opts...)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return repository.ErrDuplicate
+		}
+		return err
+	}
+	if result.MatchedCount == 0 {
+		if len(filter) == 1 {
+			return repository.ErrNotFound
+		}
+		return repository.ErrConflict
+	}
+	return nil
+}
+
+// deleteOne removes the document matching filter.
+func deleteOne(ctx context.Context, collection *mongo.Collection, filter bson.M) error {
+	result, err := collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+// pageOptions applies a page to find options.
+func pageOptions(opts *options.FindOptions, page repository.Page) *options.FindOptions {
+	if page.Skip > 0 {
+		opts.SetSkip(page.Skip)
+	}
+	if page.Limit > 0 {
+		opts.SetLimit(page.Limit)
+	}
+	return opts
+}
+
+// withConditions extends an id filter with match conditions.
+func withConditions(filter bson.M, match repository.Fields) bson.M {
+	for key, value := range match {
+		filter[key] = value
+	}
+	return filter
+}
@@ -0,0 +1,264 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type OrderRepository struct {
+	collection *mongo.Collection
+}
+
+func NewOrderRepository(collection *mongo.Collection) *OrderRepository {
+	return &OrderRepository{collection: collection}
+}
+
+func (r *OrderRepository) Create(ctx context.Context, order *models.Order) error {
+	return insertOne(ctx, r.collection, order)
+}
+
+func (r *OrderRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Order, error) {
+	var order models.Order
+	if err := findOne(ctx, r.collection, bson.M{"_id": id}, &order); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (r *OrderRepository) FindByIntentID(ctx context.Context, intentID string) (*models.Order, error) {
+	var order models.Order
+	if err := findOne(ctx, r.collection, bson.M{"payment_info.intent_id": intentID}, &order); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (r *OrderRepository) Find(ctx context.Context, query repository.OrderQuery) ([]models.Order, error) {
+	opts := pageOptions(options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}), query.Page)
+	var orders []models.Order
+	if err := findAll(ctx, r.collection, orderFilter(query), &orders, opts); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+func (r *OrderRepository) Count(ctx context.Context, query repository.OrderQuery) (int64, error) {
+	return r.collection.CountDocuments(ctx, orderFilter(query))
+}
+
+func (r *OrderRepository) Revenue(ctx context.Context, query repository.OrderQuery) (float64, error) {
+	pipeline := []bson.M{
+		{"$match": orderFilter(query)},
+		{"$group": bson.M{"_id": nil, "total": bson.M{"$sum": "$total"}}},
+	}
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var result []struct {
+		Total float64 `bson:"total"`
+	}
+	if err := cursor.All(ctx, &result); err != nil || len(result) == 0 {
+		return 0, err
+	}
+	return result[0].Total, nil
+}
+
+func (r *OrderRepository) MonthlyStats(ctx context.Context, since time.Time) ([]repository.MonthlyStat, error) {
+	pipeline := []bson.M{
+		{"$match": bson.M{"created_at": bson.M{"$gte": since}}},
+		{"$group": bson.M{
+			"_id": bson.M{
+				"year":  bson.M{"$year": "$created_at"},
+				"month": bson.M{"$month": "$created_at"},
+			},
+			"revenue": bson.M{"$sum": "$total"},
+			"orders":  bson.M{"$sum": 1},
+		}},
+		{"$sort": bson.D{{Key: "_id.year", Value: 1}, {Key: "_id.month", Value: 1}}},
+	}
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var stats []repository.MonthlyStat
+	if err := cursor.All(ctx, &stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func (r *OrderRepository) Update(ctx context.Context, id primitive.ObjectID, match, set repository.Fields) error {
+	return updateOne(ctx, r.collection, withConditions(bson.M{"_id": id}, match), bson.M{"$set": set})
+}
+
+func (r *OrderRepository) Transition(ctx context.Context, id primitive.ObjectID, from, to models.OrderStatus, entry models.StatusHistoryEntry, match, set repository.Fields) error {
+	update := bson.M{"status": to}
+	for key, value := range set {
+		update[key] = value
+	}
+
+	filter := withConditions(bson.M{"_id": id, "status": from}, match)
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{
+		"$set":  update,
+		"$push": bson.M{"status_history": entry},
+	})
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return repository.ErrConflict
+	}
+	return nil
+}
+
+func (r *OrderRepository) ReserveReturn(ctx context.Context, id, productID, variantID primitive.ObjectID, quantity int) error {
+	order, err := r.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	delivered := 0
+	for _, item := range order.Items {
+		if item.ProductID == productID && item.VariantID == variantID {
+			delivered = item.Quantity
+			break
+		}
+	}
+
+	// Lines stored before return quantities existed have none yet
+	line := orderLineFilter(productID, variantID)
+	line["return_quantity"] = bson.M{"$not": bson.M{"$gt": delivered - quantity}}
+
+	filter := bson.M{"_id": id, "status": models.OrderDelivered, "items": bson.M{"$elemMatch": line}}
+	return r.incReturn(ctx, filter, quantity)
+}
+
+func (r *OrderRepository) ReleaseReturn(ctx context.Context, id, productID, variantID primitive.ObjectID, quantity int) error {
+	filter := bson.M{"_id": id, "items": bson.M{"$elemMatch": orderLineFilter(productID, variantID)}}
+	return r.incReturn(ctx, filter, -quantity)
+}
+
+func (r *OrderRepository) incReturn(ctx context.Context, filter bson.M, quantity int) error {
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"items.$.return_quantity": quantity}})
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return repository.ErrConflict
+	}
+	return nil
+}
+
+func (r *OrderRepository) AddRefund(ctx context.Context, id primitive.ObjectID, amount float64) error {
+	filter := bson.M{"_id": id}
+	if amount > 0 {
+		// Tolerate rounding of the per-return shares
+		filter["$expr"] = bson.M{"$lte": bson.A{bson.M{"$add": bson.A{"$refunded_amount", amount}}, bson.M{"$add": bson.A{"$total", 0.005}}}}
+	}
+	return updateOne(ctx, r.collection, filter, bson.M{
+		"$inc": bson.M{"refunded_amount": amount},
+		"$set": bson.M{"updated_at": time.Now()},
+	})
+}
+
+func (r *OrderRepository) UpdateFulfilment(ctx context.Context, id, sellerID primitive.ObjectID, from, to models.OrderStatus, orderStatuses []models.OrderStatus, entry models.StatusHistoryEntry) error {
+	update := bson.M{
+		"fulfilments.$.status":     to,
+		"fulfilments.$.updated_at": entry.Timestamp,
+		"updated_at":               time.Now(),
+	}
+	if entry.TrackingID != "" {
+		update["fulfilments.$.tracking_id"] = entry.TrackingID
+	}
+	if entry.Carrier != "" {
+		update["fulfilments.$.carrier"] = entry.Carrier
+	}
+
+	filter := bson.M{
+		"_id":         id,
+		"status":      bson.M{"$in": orderStatuses},
+		"fulfilments": bson.M{"$elemMatch": bson.M{"seller_id": sellerID, "status": from}},
+	}
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{
+		"$set":  update,
+		"$push": bson.M{"fulfilments.$.history": entry},
+	})
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return repository.ErrConflict
+	}
+	return nil
+}
+
+func (r *OrderRepository) AdvanceFulfilments(ctx context.Context, id primitive.ObjectID, from []models.OrderStatus, to models.OrderStatus, entry models.StatusHistoryEntry) error {
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{
+		Filters: []interface{}{bson.M{"part.status": bson.M{"$in": from}}},
+	})
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set": bson.M{
+			"fulfilments.$[part].status":     to,
+			"fulfilments.$[part].updated_at": entry.Timestamp,
+		},
+		"$push": bson.M{"fulfilments.$[part].history": entry},
+	}, opts)
+	return err
+}
+
+func orderFilter(query repository.OrderQuery) bson.M {
+	filter := bson.M{}
+
+	if !query.UserID.IsZero() {
+		filter["user_id"] = query.UserID
+	}
+	if len(query.Statuses) == 1 {
+		filter["status"] = query.Statuses[0]
+	} else if len(query.Statuses) > 1 {
+		filter["status"] = bson.M{"$in": query.Statuses}
+	}
+	if query.PaymentStatus != "" {
+		filter["payment_info.status"] = query.PaymentStatus
+	}
+	if !query.PaymentExpiredBefore.IsZero() {
+		filter["payment_info.intent_id"] = bson.M{"$exists": true, "$ne": ""}
+		filter["payment_info.expires_at"] = bson.M{"$lt": query.PaymentExpiredBefore}
+	}
+	if !query.CreatedSince.IsZero() {
+		filter["created_at"] = bson.M{"$gte": query.CreatedSince}
+	}
+	if !query.UpdatedSince.IsZero() {
+		filter["updated_at"] = bson.M{"$gte": query.UpdatedSince}
+	}
+	if !query.ProductID.IsZero() {
+		filter["items.product_id"] = query.ProductID
+	}
+	if !query.SellerID.IsZero() {
+		filter["fulfilments.seller_id"] = query.SellerID
+	}
+
+	return filter
+}
+
+// orderLineFilter matches the order line for a product and variant.
+func orderLineFilter(productID, variantID primitive.ObjectID) bson.M {
+	filter := bson.M{"product_id": productID}
+	if variantID.IsZero() {
+		filter["variant_id"] = bson.M{"$exists": false}
+	} else {
+		filter["variant_id"] = variantID
+	}
+	return filter
+}
@@ -0,0 +1,50 @@
+package mongodb
+
+import (
+	"context"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type PayoutRepository struct {
+	collection *mongo.Collection
+}
+
+func NewPayoutRepository(collection *mongo.Collection) *PayoutRepository {
+	return &PayoutRepository{collection: collection}
+}
+
+func (r *PayoutRepository) Create(ctx context.Context, batch *models.PayoutBatch) error {
+	return insertOne(ctx, r.collection, batch)
+}
+
+func (r *PayoutRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.PayoutBatch, error) {
+	var batch models.PayoutBatch
+	if err := findOne(ctx, r.collection, bson.M{"_id": id}, &batch); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+func (r *PayoutRepository) Find(ctx context.Context, page repository.Page) ([]models.PayoutBatch, error) {
+	opts := pageOptions(options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}), page)
+	batches := []models.PayoutBatch{}
+	if err := findAll(ctx, r.collection, bson.M{}, &batches, opts); err != nil {
+		return nil, err
+	}
+	return batches, nil
+}
+
+func (r *PayoutRepository) Count(ctx context.Context) (int64, error) {
+	return r.collection.CountDocuments(ctx, bson.M{})
+}
+
+func (r *PayoutRepository) Update(ctx context.Context, id primitive.ObjectID, match, set repository.Fields) error {
+	return updateOne(ctx, r.collection, withConditions(bson.M{"_id": id}, match), bson.M{"$set": set})
+}
@@ -0,0 +1,439 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ProductRepository struct {
+	collection *mongo.Collection
+}
+
+func NewProductRepository(collection *mongo.Collection) *ProductRepository {
+	return &ProductRepository{collection: collection}
+}
+
+func (r *ProductRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Product, error) {
+	var product models.Product
+	if err := findOne(ctx, r.collection, bson.M{"_id": id}, &product); err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+func (r *ProductRepository) FindBySlug(ctx context.Context, slug string) (*models.Product, error) {
+	var product models.Product
+	if err := findOne(ctx, r.collection, bson.M{"slug": slug}, &product); err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+func (r *ProductRepository) FindBySKU(ctx context.Context, sku string) (*models.Product, error) {
+	var product models.Product
+	if err := findOne(ctx, r.collection, bson.M{"variants.sku": sku}, &product); err != nil {
+		return nil, err
+	}
+	return &product, nil
+}
+
+func (r *ProductRepository) Find(ctx context.Context, query repository.ProductQuery) ([]models.Product, error) {
+	sortField := query.SortBy
+	if sortField == "" {
+		sortField = "created_at"
+	}
+	sortOrder := 1
+	if query.SortDesc {
+		sortOrder = -1
+	}
+
+	opts := pageOptions(options.Find().SetSort(bson.D{{Key: sortField, Value: sortOrder}}), query.Page)
+	var products []models.Product
+	if err := findAll(ctx, r.collection, productFilter(query), &products, opts); err != nil {
+		return nil, err
+	}
+	return products, nil
+}
+
+func (r *ProductRepository) Each(ctx context.Context, query repository.ProductQuery, fn func(*models.Product) error) error {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := r.collection.Find(ctx, productFilter(query), opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var product models.Product
+		if err := cursor.Decode(&product); err != nil {
+			return err
+		}
+		if err := fn(&product); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func (r *ProductRepository) Count(ctx context.Context, query repository.ProductQuery) (int64, error) {
+	return r.collection.CountDocuments(ctx, productFilter(query))
+}
+
+// Facets counts every facet in one $facet aggregation. The products
+// matching all filters but the facet ones are selected first; each facet
+// then applies the facet filters other than its own.
+func (r *ProductRepository) Facets(ctx context.Context, query repository.ProductQuery) (*repository.ProductFacets, error) {
+	base := query
+	for _, facet := range repository.Facets {
+		base = base.WithoutFacet(facet)
+	}
+
+	match := func(facet string) bson.D {
+		return bson.D{{Key: "$match", Value: productFilter(query.WithoutFacet(facet))}}
+	}
+	group := func(key interface{}, fields ...bson.E) bson.D {
+		spec := bson.D{{Key: "_id", Value: key}, {Key: "count", Value: bson.M{"$sum": 1}}}
+		return bson.D{{Key: "$group", Value: append(spec, fields...)}}
+	}
+	byCount := bson.D{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}}
+	lastBucket := repository.PriceBuckets[len(repository.PriceBuckets)-1]
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: productFilter(base)}},
+		{{Key: "$facet", Value: bson.M{
+			repository.FacetMetalType: bson.A{match(repository.FacetMetalType), group("$metal_type"), byCount},
+			repository.FacetPurity:    bson.A{match(repository.FacetPurity), group("$purity"), byCount},
+			repository.FacetCategory: bson.A{
+				match(repository.FacetCategory),
+				group("$category_id", bson.E{Key: "label", Value: bson.M{"$first": "$category_name"}}),
+				byCount,
+			},
+			repository.FacetTag: bson.A{
+				match(repository.FacetTag),
+				bson.D{{Key: "$unwind", Value: "$tags"}},
+				group("$tags"),
+				byCount,
+				bson.D{{Key: "$limit", Value: repository.MaxTagFacets}},
+			},
+			repository.FacetPriceRange: bson.A{
+				match(repository.FacetPriceRange),
+				// Prices from the last bound up fall in the default bucket,
+				// which is the open range
+				bson.D{{Key: "$bucket", Value: bson.M{
+					"groupBy":    "$base_price",
+					"boundaries": repository.PriceBuckets,
+					"default":    lastBucket,
+					"output":     bson.M{"count": bson.M{"$sum": 1}},
+				}}},
+			},
+			repository.FacetRating: bson.A{
+				match(repository.FacetRating),
+				group(bson.M{"$min": bson.A{bson.M{"$floor": "$rating"}, 4}}),
+				bson.D{{Key: "$sort", Value: bson.M{"_id": 1}}},
+			},
+			repository.FacetInStock: bson.A{match(repository.FacetInStock), group(bson.M{"$gt": bson.A{"$stock", 0}}), byCount},
+		}}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	type count struct {
+		ID    interface{} `bson:"_id"`
+		Label string      `bson:"label"`
+		Count int64       `bson:"count"`
+	}
+	var results []map[string][]count
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return repository.EmptyFacets(), nil
+	}
+	result := results[0]
+
+	counts := func(facet string, value func(id interface{}) string, labelled bool) []repository.FacetCount {
+		out := []repository.FacetCount{}
+		for _, c := range result[facet] {
+			fc := repository.FacetCount{Value: value(c.ID), Count: c.Count}
+			if labelled {
+				fc.Label = c.Label
+			}
+			out = append(out, fc)
+		}
+		return out
+	}
+	text := func(id interface{}) string { return fmt.Sprint(id) }
+	hex := func(id interface{}) string {
+		if oid, ok := id.(primitive.ObjectID); ok {
+			return oid.Hex()
+		}
+		return fmt.Sprint(id)
+	}
+	number := func(id interface{}) float64 {
+		switch v := id.(type) {
+		case int32:
+			return float64(v)
+		case int64:
+			return float64(v)
+		case float64:
+			return v
+		}
+		return 0
+	}
+
+	facets := &repository.ProductFacets{
+		MetalTypes: counts(repository.FacetMetalType, text, false),
+		Purities:   counts(repository.FacetPurity, text, false),
+		Categories: counts(repository.FacetCategory, hex, true),
+		Tags:       counts(repository.FacetTag, text, false),
+		PriceRanges: counts(repository.FacetPriceRange, func(id interface{}) string {
+			return repository.PriceBucket(number(id)).String()
+		}, false),
+		Ratings: counts(repository.FacetRating, func(id interface{}) string {
+			return strconv.Itoa(int(number(id)))
+		}, false),
+		InStock: counts(repository.FacetInStock, text, false),
+	}
+	return facets, nil
+}
+
+func (r *ProductRepository) Create(ctx context.Context, product *models.Product) error {
+	return insertOne(ctx, r.collection, product)
+}
+
+func (r *ProductRepository) Update(ctx context.Context, id primitive.ObjectID, set repository.Fields) error {
+	return updateOne(ctx, r.collection, bson.M{"_id": id}, bson.M{"$set": set})
+}
+
+func (r *ProductRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return deleteOne(ctx, r.collection, bson.M{"_id": id})
+}
+
+func (r *ProductRepository) ReserveStock(ctx context.Context, productID, variantID primitive.ObjectID, quantity int) (bool, error) {
+	filter := bson.M{
+		"_id":       productID,
+		"is_active": true,
+		"stock":     bson.M{"$gte": quantity},
+	}
+	inc := bson.M{"stock": -quantity}
+
+	if !variantID.IsZero() {
+		filter["variants"] = bson.M{"$elemMatch": bson.M{
+			"_id":   variantID,
+			"stock": bson.M{"$gte": quantity},
+		}}
+		inc["variants.$.stock"] = -quantity
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{"$inc": inc})
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+func (r *ProductRepository) ReleaseStock(ctx context.Context, productID, variantID primitive.ObjectID, quantity int) error {
+	filter := bson.M{"_id": productID}
+	inc := bson.M{"stock": quantity}
+
+	if !variantID.IsZero() {
+		filter["variants._id"] = variantID
+		inc["variants.$.stock"] = quantity
+	}
+
+	_, err := r.collection.UpdateOne(ctx, filter, bson.M{"$inc": inc})
+	return err
+}
+
+func (r *ProductRepository) SavePrices(ctx context.Context, product *models.Product) error {
+	set := bson.M{
+		"base_price":     product.BasePrice,
+		"discount_price": product.DiscountPrice,
+		"price_breakup":  product.PriceBreakup,
+	}
+
+	// Variant prices are set in place so concurrent stock updates on the
+	// variants array are not overwritten
+	var arrayFilters []interface{}
+	for i, variant := range product.Variants {
+		if variant.PriceBreakup == nil {
+			continue
+		}
+		name := fmt.Sprintf("v%d", i)
+		set["variants.$["+name+"].price"] = variant.Price
+		set["variants.$["+name+"].price_breakup"] = variant.PriceBreakup
+		arrayFilters = append(arrayFilters, bson.M{name + "._id": variant.ID})
+	}
+
+	opts := options.Update()
+	if len(arrayFilters) > 0 {
+		opts.SetArrayFilters(options.ArrayFilters{Filters: arrayFilters})
+	}
+
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": product.ID}, bson.M{"$set": set}, opts)
+	return err
+}
+
+func (r *ProductRepository) Import(ctx context.Context, id primitive.ObjectID, set repository.Fields, variants []models.ProductVariant, restock []primitive.ObjectID) error {
+	// A pipeline update can read the stored variants while replacing them;
+	// values are given as literals so text starting with $ is not taken
+	// for a field
+	fields := bson.M{}
+	for key, value := range set {
+		fields[key] = bson.M{"$literal": value}
+	}
+	if variants == nil {
+		variants = []models.ProductVariant{}
+	}
+	if restock == nil {
+		restock = []primitive.ObjectID{}
+	}
+	stored := bson.M{"$arrayElemAt": bson.A{
+		bson.M{"$filter": bson.M{
+			"input": bson.M{"$ifNull": bson.A{"$variants", bson.A{}}},
+			"as":    "s",
+			"cond":  bson.M{"$eq": bson.A{"$$s._id", "$$v._id"}},
+		}},
+		0,
+	}}
+	fields["variants"] = bson.M{"$map": bson.M{
+		"input": bson.M{"$literal": variants},
+		"as":    "v",
+		"in": bson.M{"$mergeObjects": bson.A{"$$v", bson.M{"stock": bson.M{"$cond": bson.A{
+			bson.M{"$in": bson.A{"$$v._id", restock}},
+			"$$v.stock",
+			bson.M{"$ifNull": bson.A{bson.M{"$let": bson.M{"vars": bson.M{"stored": stored}, "in": "$$stored.stock"}}, "$$v.stock"}},
+		}}}}},
+	}}
+
+	return updateOne(ctx, r.collection, bson.M{"_id": id}, mongo.Pipeline{{{Key: "$set", Value: fields}}})
+}
+
+func productFilter(query repository.ProductQuery) bson.M {
+	filter := bson.M{}
+	// Conditions that are alternatives of their own are combined here, so
+	// they do not overwrite one another under "$or"
+	var and []bson.M
+
+	if len(query.IDs) > 0 {
+		filter["_id"] = bson.M{"$in": query.IDs}
+	}
+	if query.ActiveOnly {
+		filter["is_active"] = true
+	}
+	if len(query.MetalTypes) > 0 {
+		filter["metal_type"] = bson.M{"$in": query.MetalTypes}
+	}
+	if len(query.CategoryIDs) > 0 {
+		filter["category_id"] = bson.M{"$in": query.CategoryIDs}
+	}
+	if len(query.Purities) > 0 {
+		filter["purity"] = bson.M{"$in": query.Purities}
+	}
+	if len(query.Tags) > 0 {
+		filter["tags"] = bson.M{"$in": query.Tags}
+	}
+
+	price := bson.M{}
+	if query.MinPrice > 0 {
+		price["$gte"] = query.MinPrice
+	}
+	if query.MaxPrice > 0 {
+		price["$lte"] = query.MaxPrice
+	}
+	if len(price) > 0 {
+		filter["base_price"] = price
+	}
+	if len(query.PriceRanges) > 0 {
+		ranges := bson.A{}
+		for _, r := range query.PriceRanges {
+			bounds := bson.M{"$gte": r.Min}
+			if r.Max > 0 {
+				bounds["$lt"] = r.Max
+			}
+			ranges = append(ranges, bson.M{"base_price": bounds})
+		}
+		and = append(and, bson.M{"$or": ranges})
+	}
+	if len(query.Ratings) > 0 {
+		ratings := bson.A{}
+		for _, stars := range query.Ratings {
+			bounds := bson.M{"$gte": stars}
+			if stars < 4 {
+				bounds["$lt"] = stars + 1
+			}
+			ratings = append(ratings, bson.M{"rating": bounds})
+		}
+		and = append(and, bson.M{"$or": ratings})
+	}
+
+	if query.Search != "" {
+		search := bson.M{"$regex": regexp.QuoteMeta(query.Search), "$options": "i"}
+		and = append(and, bson.M{"$or": []bson.M{
+			{"name": search},
+			{"description": search},
+			{"tags": search},
+			{"category_name": search},
+		}})
+	}
+	if query.Featured {
+		filter["is_featured"] = true
+	}
+	if query.NewArrival {
+		filter["is_new_arrival"] = true
+	}
+	if query.BestSeller {
+		filter["is_best_seller"] = true
+	}
+
+	stock := bson.M{}
+	if query.StockBelow > 0 {
+		stock["$lt"] = query.StockBelow
+	}
+	if query.InStock != nil && *query.InStock {
+		stock["$gt"] = 0
+	}
+	if query.InStock != nil && !*query.InStock {
+		stock["$lte"] = 0
+	}
+	if len(stock) > 0 {
+		filter["stock"] = stock
+	}
+
+	if query.RatePriced {
+		filter["net_weight"] = bson.M{"$gt": 0}
+	}
+	if !query.UpdatedSince.IsZero() {
+		filter["updated_at"] = bson.M{"$gte": query.UpdatedSince}
+	}
+	if !query.SellerID.IsZero() {
+		filter["seller_id"] = query.SellerID
+	}
+
+	if len(and) > 0 {
+		filter["$and"] = and
+	}
+	return filter
+}
+
+func (r *ProductRepository) SetCategoryName(ctx context.Context, categoryID primitive.ObjectID, name string) error {
+	_, err := r.collection.UpdateMany(ctx,
+		bson.M{"category_id": categoryID, "category_name": bson.M{"$ne": name}},
+		bson.M{"$set": bson.M{"category_name": name}},
+	)
+	return err
+}
@@ -0,0 +1,55 @@
+package mongodb
+
+import (
+	"context"
+
+	"ejewel/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MetalRateRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMetalRateRepository(collection *mongo.Collection) *MetalRateRepository {
+	return &MetalRateRepository{collection: collection}
+}
+
+func (r *MetalRateRepository) Latest(ctx context.Context) ([]models.MetalRate, error) {
+	pipeline := []bson.M{
+		{"$sort": bson.D{{Key: "date", Value: -1}, {Key: "updated_at", Value: -1}}},
+		{"$group": bson.M{
+			"_id":  bson.M{"metal": "$metal_type", "purity": "$purity"},
+			"rate": bson.M{"$first": "$$ROOT"},
+		}},
+		{"$replaceRoot": bson.M{"newRoot": "$rate"}},
+	}
+	cursor, err := r.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	rates := []models.MetalRate{}
+	if err := cursor.All(ctx, &rates); err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
+
+func (r *MetalRateRepository) Save(ctx context.Context, rate *models.MetalRate) error {
+	_, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"metal_type": rate.MetalType, "purity": rate.Purity, "date": rate.Date},
+		bson.M{"$set": bson.M{
+			"rate_per_gram": rate.RatePerGram,
+			"source":        rate.Source,
+			"updated_at":    rate.UpdatedAt,
+		}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
@@ -0,0 +1,98 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ReturnRepository struct {
+	collection *mongo.Collection
+}
+
+func NewReturnRepository(collection *mongo.Collection) *ReturnRepository {
+	return &ReturnRepository{collection: collection}
+}
+
+func (r *ReturnRepository) Create(ctx context.Context, returnRequest *models.ReturnRequest) error {
+	return insertOne(ctx, r.collection, returnRequest)
+}
+
+func (r *ReturnRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.ReturnRequest, error) {
+	var returnRequest models.ReturnRequest
+	if err := findOne(ctx, r.collection, bson.M{"_id": id}, &returnRequest); err != nil {
+		return nil, err
+	}
+	return &returnRequest, nil
+}
+
+func (r *ReturnRepository) Find(ctx context.Context, query repository.ReturnQuery) ([]models.ReturnRequest, error) {
+	opts := pageOptions(options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}), query.Page)
+	returns := []models.ReturnRequest{}
+	if err := findAll(ctx, r.collection, returnFilter(query), &returns, opts); err != nil {
+		return nil, err
+	}
+	return returns, nil
+}
+
+func (r *ReturnRepository) Count(ctx context.Context, query repository.ReturnQuery) (int64, error) {
+	return r.collection.CountDocuments(ctx, returnFilter(query))
+}
+
+func (r *ReturnRepository) Update(ctx context.Context, id primitive.ObjectID, set repository.Fields) error {
+	return updateOne(ctx, r.collection, bson.M{"_id": id}, bson.M{"$set": set})
+}
+
+func (r *ReturnRepository) Transition(ctx context.Context, id primitive.ObjectID, from, to models.ReturnStatus, entry models.ReturnHistoryEntry, set repository.Fields) error {
+	update := bson.M{"status": to}
+	for key, value := range set {
+		update[key] = value
+	}
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "status": from},
+		bson.M{"$set": update, "$push": bson.M{"history": entry}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return repository.ErrConflict
+	}
+	return nil
+}
+
+func (r *ReturnRepository) Revert(ctx context.Context, id primitive.ObjectID, from, to models.ReturnStatus, unset ...string) error {
+	update := bson.M{
+		"$set": bson.M{"status": to, "updated_at": time.Now()},
+		"$pop": bson.M{"history": 1},
+	}
+	if len(unset) > 0 {
+		fields := bson.M{}
+		for _, field := range unset {
+			fields[field] = ""
+		}
+		update["$unset"] = fields
+	}
+	return updateOne(ctx, r.collection, bson.M{"_id": id, "status": from}, update)
+}
+
+func returnFilter(query repository.ReturnQuery) bson.M {
+	filter := bson.M{}
+	if !query.UserID.IsZero() {
+		filter["user_id"] = query.UserID
+	}
+	if query.Status != "" {
+		filter["status"] = query.Status
+	}
+	if !query.UpdatedSince.IsZero() {
+		filter["updated_at"] = bson.M{"$gte": query.UpdatedSince}
+	}
+	return filter
+}
@@ -0,0 +1,63 @@
+package mongodb
+
+import (
+	"context"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ReviewRepository struct {
+	collection *mongo.Collection
+}
+
+func NewReviewRepository(collection *mongo.Collection) *ReviewRepository {
+	return &ReviewRepository{collection: collection}
+}
+
+func (r *ReviewRepository) FindByProduct(ctx context.Context, productID primitive.ObjectID) ([]models.Review, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	var reviews []models.Review
+	if err := findAll(ctx, r.collection, bson.M{"product_id": productID}, &reviews, opts); err != nil {
+		return nil, err
+	}
+	return reviews, nil
+}
+
+func (r *ReviewRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Review, error) {
+	var review models.Review
+	if err := findOne(ctx, r.collection, bson.M{"_id": id}, &review); err != nil {
+		return nil, err
+	}
+	return &review, nil
+}
+
+func (r *ReviewRepository) Exists(ctx context.Context, productID, userID primitive.ObjectID) (bool, error) {
+	count, err := r.collection.CountDocuments(ctx, bson.M{"product_id": productID, "user_id": userID})
+	return count > 0, err
+}
+
+func (r *ReviewRepository) Create(ctx context.Context, review *models.Review) error {
+	return insertOne(ctx, r.collection, review)
+}
+
+func (r *ReviewRepository) Update(ctx context.Context, id primitive.ObjectID, set repository.Fields) error {
+	return updateOne(ctx, r.collection, bson.M{"_id": id}, bson.M{"$set": set})
+}
+
+func (r *ReviewRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return deleteOne(ctx, r.collection, bson.M{"_id": id})
+}
+
+func (r *ReviewRepository) SetAuthor(ctx context.Context, userID primitive.ObjectID, name, avatar string) error {
+	_, err := r.collection.UpdateMany(ctx,
+		bson.M{"user_id": userID},
+		bson.M{"$set": bson.M{"user_name": name, "user_avatar": avatar}},
+	)
+	return err
+}
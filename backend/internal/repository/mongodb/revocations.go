@@ -0,0 +1,33 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type RevocationRepository struct {
+	collection *mongo.Collection
+}
+
+func NewRevocationRepository(collection *mongo.Collection) *RevocationRepository {
+	return &RevocationRepository{collection: collection}
+}
+
+func (r *RevocationRepository) Revoke(ctx context.Context, id string, expiresAt time.Time) error {
+	_, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$max": bson.M{"expires_at": expiresAt}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+func (r *RevocationRepository) IsRevoked(ctx context.Context, id string) (bool, error) {
+	// The TTL monitor only runs once a minute, so check expiry here too
+	count, err := r.collection.CountDocuments(ctx, bson.M{"_id": id, "expires_at": bson.M{"$gt": time.Now()}})
+	return count > 0, err
+}
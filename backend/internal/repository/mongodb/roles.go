@@ -0,0 +1,58 @@
+package mongodb
+
+import (
+	"context"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type RoleRepository struct {
+	collection *mongo.Collection
+}
+
+func NewRoleRepository(collection *mongo.Collection) *RoleRepository {
+	return &RoleRepository{collection: collection}
+}
+
+func (r *RoleRepository) FindAll(ctx context.Context) ([]models.RoleDefinition, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	roles := []models.RoleDefinition{}
+	if err := findAll(ctx, r.collection, bson.M{}, &roles, opts); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (r *RoleRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.RoleDefinition, error) {
+	var role models.RoleDefinition
+	if err := findOne(ctx, r.collection, bson.M{"_id": id}, &role); err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r *RoleRepository) FindByName(ctx context.Context, name models.Role) (*models.RoleDefinition, error) {
+	var role models.RoleDefinition
+	if err := findOne(ctx, r.collection, bson.M{"name": name}, &role); err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+func (r *RoleRepository) Create(ctx context.Context, role *models.RoleDefinition) error {
+	return insertOne(ctx, r.collection, role)
+}
+
+func (r *RoleRepository) Update(ctx context.Context, id primitive.ObjectID, set repository.Fields) error {
+	return updateOne(ctx, r.collection, bson.M{"_id": id}, bson.M{"$set": set})
+}
+
+func (r *RoleRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return deleteOne(ctx, r.collection, bson.M{"_id": id})
+}
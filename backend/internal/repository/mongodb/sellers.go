@@ -0,0 +1,66 @@
+package mongodb
+
+import (
+	"context"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type SellerRepository struct {
+	collection *mongo.Collection
+}
+
+func NewSellerRepository(collection *mongo.Collection) *SellerRepository {
+	return &SellerRepository{collection: collection}
+}
+
+func (r *SellerRepository) Create(ctx context.Context, seller *models.Seller) error {
+	return insertOne(ctx, r.collection, seller)
+}
+
+func (r *SellerRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Seller, error) {
+	var seller models.Seller
+	if err := findOne(ctx, r.collection, bson.M{"_id": id}, &seller); err != nil {
+		return nil, err
+	}
+	return &seller, nil
+}
+
+func (r *SellerRepository) FindByUser(ctx context.Context, userID primitive.ObjectID) (*models.Seller, error) {
+	var seller models.Seller
+	if err := findOne(ctx, r.collection, bson.M{"user_id": userID}, &seller); err != nil {
+		return nil, err
+	}
+	return &seller, nil
+}
+
+func (r *SellerRepository) Find(ctx context.Context, query repository.SellerQuery) ([]models.Seller, error) {
+	opts := pageOptions(options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}), query.Page)
+	sellers := []models.Seller{}
+	if err := findAll(ctx, r.collection, sellerFilter(query), &sellers, opts); err != nil {
+		return nil, err
+	}
+	return sellers, nil
+}
+
+func (r *SellerRepository) Count(ctx context.Context, query repository.SellerQuery) (int64, error) {
+	return r.collection.CountDocuments(ctx, sellerFilter(query))
+}
+
+func (r *SellerRepository) Update(ctx context.Context, id primitive.ObjectID, match, set repository.Fields) error {
+	return updateOne(ctx, r.collection, withConditions(bson.M{"_id": id}, match), bson.M{"$set": set})
+}
+
+func sellerFilter(query repository.SellerQuery) bson.M {
+	filter := bson.M{}
+	if query.Status != "" {
+		filter["status"] = query.Status
+	}
+	return filter
+}
@@ -0,0 +1,86 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type SessionRepository struct {
+	collection *mongo.Collection
+}
+
+func NewSessionRepository(collection *mongo.Collection) *SessionRepository {
+	return &SessionRepository{collection: collection}
+}
+
+func (r *SessionRepository) Create(ctx context.Context, session *models.Session) error {
+	return insertOne(ctx, r.collection, session)
+}
+
+func (r *SessionRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.Session, error) {
+	var session models.Session
+	if err := findOne(ctx, r.collection, bson.M{"_id": id}, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *SessionRepository) FindActiveByUser(ctx context.Context, userID primitive.ObjectID) ([]models.Session, error) {
+	filter := bson.M{
+		"user_id":    userID,
+		"revoked_at": bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": time.Now()},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "last_used_at", Value: -1}})
+	sessions := []models.Session{}
+	if err := findAll(ctx, r.collection, filter, &sessions, opts); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (r *SessionRepository) FindByTokenHash(ctx context.Context, hash string) (*models.Session, error) {
+	var session models.Session
+	filter := bson.M{"$or": bson.A{bson.M{"token_hash": hash}, bson.M{"used_hashes": hash}}}
+	if err := findOne(ctx, r.collection, filter, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *SessionRepository) Rotate(ctx context.Context, id primitive.ObjectID, oldHash, newHash string, set repository.Fields) error {
+	update := bson.M{"token_hash": newHash}
+	for key, value := range set {
+		update[key] = value
+	}
+	filter := bson.M{"_id": id, "token_hash": oldHash, "revoked_at": bson.M{"$exists": false}}
+	return updateOne(ctx, r.collection, filter, bson.M{
+		"$set":  update,
+		"$push": bson.M{"used_hashes": bson.M{"$each": bson.A{oldHash}, "$slice": -models.MaxUsedHashes}},
+	})
+}
+
+func (r *SessionRepository) Revoke(ctx context.Context, id primitive.ObjectID, reason string) error {
+	_, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": time.Now(), "revoke_reason": reason}},
+	)
+	return err
+}
+
+func (r *SessionRepository) RevokeByUser(ctx context.Context, userID, keep primitive.ObjectID, reason string) error {
+	filter := bson.M{"user_id": userID, "revoked_at": bson.M{"$exists": false}}
+	if !keep.IsZero() {
+		filter["_id"] = bson.M{"$ne": keep}
+	}
+	_, err := r.collection.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"revoked_at": time.Now(), "revoke_reason": reason}})
+	return err
+}
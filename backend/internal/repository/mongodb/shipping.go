@@ -0,0 +1,66 @@
+package mongodb
+
+import (
+	"context"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ShippingZoneRepository struct {
+	collection *mongo.Collection
+}
+
+func NewShippingZoneRepository(collection *mongo.Collection) *ShippingZoneRepository {
+	return &ShippingZoneRepository{collection: collection}
+}
+
+func (r *ShippingZoneRepository) FindAll(ctx context.Context) ([]models.ShippingZone, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	zones := []models.ShippingZone{}
+	if err := findAll(ctx, r.collection, bson.M{}, &zones, opts); err != nil {
+		return nil, err
+	}
+	return zones, nil
+}
+
+func (r *ShippingZoneRepository) FindActiveByPincode(ctx context.Context, pincode int) ([]models.ShippingZone, error) {
+	filter := bson.M{
+		"is_active": true,
+		"pincodes":  bson.M{"$elemMatch": bson.M{"from": bson.M{"$lte": pincode}, "to": bson.M{"$gte": pincode}}},
+	}
+	zones := []models.ShippingZone{}
+	if err := findAll(ctx, r.collection, filter, &zones); err != nil {
+		return nil, err
+	}
+	return zones, nil
+}
+
+func (r *ShippingZoneRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.ShippingZone, error) {
+	var zone models.ShippingZone
+	if err := findOne(ctx, r.collection, bson.M{"_id": id}, &zone); err != nil {
+		return nil, err
+	}
+	return &zone, nil
+}
+
+func (r *ShippingZoneRepository) Count(ctx context.Context) (int64, error) {
+	return r.collection.CountDocuments(ctx, bson.M{})
+}
+
+func (r *ShippingZoneRepository) Create(ctx context.Context, zone *models.ShippingZone) error {
+	return insertOne(ctx, r.collection, zone)
+}
+
+func (r *ShippingZoneRepository) Update(ctx context.Context, id primitive.ObjectID, set repository.Fields) error {
+	return updateOne(ctx, r.collection, bson.M{"_id": id}, bson.M{"$set": set})
+}
+
+func (r *ShippingZoneRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	return deleteOne(ctx, r.collection, bson.M{"_id": id})
+}
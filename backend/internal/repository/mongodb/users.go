@@ -0,0 +1,92 @@
+package mongodb
+
+import (
+	"context"
+	"errors"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type UserRepository struct {
+	collection *mongo.Collection
+}
+
+func NewUserRepository(collection *mongo.Collection) *UserRepository {
+	return &UserRepository{collection: collection}
+}
+
+func (r *UserRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	var user models.User
+	if err := findOne(ctx, r.collection, bson.M{"_id": id}, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *UserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	if err := findOne(ctx, r.collection, bson.M{"email": email}, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *UserRepository) Find(ctx context.Context, query repository.UserQuery) ([]models.User, error) {
+	opts := pageOptions(options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}), query.Page)
+	var users []models.User
+	if err := findAll(ctx, r.collection, userFilter(query), &users, opts); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *UserRepository) Count(ctx context.Context, query repository.UserQuery) (int64, error) {
+	return r.collection.CountDocuments(ctx, userFilter(query))
+}
+
+func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
+	return insertOne(ctx, r.collection, user)
+}
+
+func (r *UserRepository) Update(ctx context.Context, id primitive.ObjectID, set repository.Fields) error {
+	return updateOne(ctx, r.collection, bson.M{"_id": id}, bson.M{"$set": set})
+}
+
+func (r *UserRepository) BumpTokenVersion(ctx context.Context, id primitive.ObjectID) error {
+	return updateOne(ctx, r.collection, bson.M{"_id": id}, bson.M{"$inc": bson.M{"token_version": 1}})
+}
+
+func (r *UserRepository) RecordFailedLogin(ctx context.Context, id primitive.ObjectID) (int, error) {
+	var user models.User
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{"failed_logins": 1})
+	err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": id}, bson.M{"$inc": bson.M{"failed_logins": 1}}, opts).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, repository.ErrNotFound
+	}
+	return user.FailedLogins, err
+}
+
+func (r *UserRepository) UseTwoFactorStep(ctx context.Context, id primitive.ObjectID, step int64) error {
+	return updateOne(ctx, r.collection, bson.M{"_id": id, "two_factor.last_step": bson.M{"$not": bson.M{"$gte": step}}}, bson.M{"$set": bson.M{"two_factor.last_step": step}})
+}
+
+func (r *UserRepository) UseRecoveryCode(ctx context.Context, id primitive.ObjectID, hash string) error {
+	return updateOne(ctx, r.collection, bson.M{"_id": id, "two_factor.recovery_codes": hash}, bson.M{"$pull": bson.M{"two_factor.recovery_codes": hash}})
+}
+
+func userFilter(query repository.UserQuery) bson.M {
+	filter := bson.M{}
+	if query.Role != "" {
+		filter["role"] = query.Role
+	}
+	if !query.UpdatedSince.IsZero() {
+		filter["updated_at"] = bson.M{"$gte": query.UpdatedSince}
+	}
+	return filter
+}
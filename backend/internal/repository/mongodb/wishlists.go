@@ -0,0 +1,61 @@
+package mongodb
+
+import (
+	"context"
+	"time"
+
+	"ejewel/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type WishlistRepository struct {
+	collection *mongo.Collection
+}
+
+func NewWishlistRepository(collection *mongo.Collection) *WishlistRepository {
+	return &WishlistRepository{collection: collection}
+}
+
+func (r *WishlistRepository) FindByUser(ctx context.Context, userID primitive.ObjectID) (*models.Wishlist, error) {
+	var wishlist models.Wishlist
+	if err := findOne(ctx, r.collection, bson.M{"user_id": userID}, &wishlist); err != nil {
+		return nil, err
+	}
+	return &wishlist, nil
+}
+
+func (r *WishlistRepository) AddProduct(ctx context.Context, userID, productID primitive.ObjectID) error {
+	opts := options.Update().SetUpsert(true)
+	_, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"user_id": userID},
+		bson.M{
+			"$addToSet":    bson.M{"products": productID},
+			"$set":         bson.M{"updated_at": time.Now()},
+			"$setOnInsert": bson.M{"user_id": userID},
+		},
+		opts,
+	)
+	return err
+}
+
+func (r *WishlistRepository) RemoveProduct(ctx context.Context, userID, productID primitive.ObjectID) error {
+	_, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"user_id": userID},
+		bson.M{
+			"$pull": bson.M{"products": productID},
+			"$set":  bson.M{"updated_at": time.Now()},
+		},
+	)
+	return err
+}
+
+func (r *WishlistRepository) DeleteByUser(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{"user_id": userID})
+	return err
+}
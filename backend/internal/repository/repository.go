@@ -0,0 +1,510 @@
+// Package repository defines how handlers load and store each aggregate, so
+// they do not depend on MongoDB directly. The mongodb package implements the
+// interfaces against the database; the memory package keeps everything in
+// process, which lets the router run without a database.
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"ejewel/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrNotFound is returned when no document matches.
+	ErrNotFound = errors.New("not found")
+	// ErrDuplicate is returned when a unique field is already taken.
+	ErrDuplicate = errors.New("duplicate key")
+	// ErrConflict is returned when a conditional update no longer matches
+	// because the document changed in the meantime.
+	ErrConflict = errors.New("document changed concurrently")
+)
+
+// Fields names stored fields and their values, keyed by the bson field name.
+// Nested fields use dotted paths such as "payment_info.status". A nil value
+// in a match condition matches a field that is unset.
+type Fields map[string]interface{}
+
+// Page limits a listing. A zero Limit returns every match.
+type Page struct {
+	Skip  int64
+	Limit int64
+}
+
+// Repositories bundles one repository per aggregate.
+type Repositories struct {
+	Users       UserRepository
+	Products    ProductRepository
+	Categories  CategoryRepository
+	Carts       CartRepository
+	Wishlists   WishlistRepository
+	Orders      OrderRepository
+	Reviews     ReviewRepository
+	Sessions    SessionRepository
+	Revocations RevocationRepository
+	Roles       RoleRepository
+	Sellers     SellerRepository
+	Ledger      LedgerRepository
+	Commissions CommissionRepository
+	Payouts     PayoutRepository
+	APIKeys     APIKeyRepository
+	Events      EventRepository
+	ImportJobs  ImportJobRepository
+	Coupons     CouponRepository
+	Returns     ReturnRepository
+	Zones       ShippingZoneRepository
+	Counters    CounterRepository
+	MetalRates  MetalRateRepository
+}
+
+// UserQuery filters user listings, newest first.
+type UserQuery struct {
+	Role         models.Role
+	UpdatedSince time.Time
+	Page
+}
+
+type UserRepository interface {
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.User, error)
+	FindByEmail(ctx context.Context, email string) (*models.User, error)
+	Find(ctx context.Context, query UserQuery) ([]models.User, error)
+	Count(ctx context.Context, query UserQuery) (int64, error)
+	Create(ctx context.Context, user *models.User) error
+	Update(ctx context.Context, id primitive.ObjectID, set Fields) error
+	// BumpTokenVersion increments the user's token version so every access
+	// token issued before stops being accepted.
+	BumpTokenVersion(ctx context.Context, id primitive.ObjectID) error
+	// RecordFailedLogin increments the user's count of failed passwords
+	// and returns it.
+	RecordFailedLogin(ctx context.Context, id primitive.ObjectID) (int, error)
+	// UseTwoFactorStep records step as the last TOTP step used, and returns
+	// ErrConflict when that step or a later one was already used.
+	UseTwoFactorStep(ctx context.Context, id primitive.ObjectID, step int64) error
+	// UseRecoveryCode removes the hash from the user's recovery codes, and
+	// returns ErrConflict when it is no longer there.
+	UseRecoveryCode(ctx context.Context, id primitive.ObjectID, hash string) error
+}
+
+// ProductQuery filters product listings. Zero values do not filter, and a
+// list keeps products that match any of its values.
+type ProductQuery struct {
+	IDs         []primitive.ObjectID
+	ActiveOnly  bool
+	MetalTypes  []models.MetalType
+	CategoryIDs []primitive.ObjectID
+	Purities    []string
+	Tags        []string
+	MinPrice    float64
+	MaxPrice    float64
+	// PriceRanges keeps products whose base price is in any of the ranges.
+	PriceRanges []PriceRange
+	// Ratings keeps products whose rating, rounded down, is any of these
+	// star counts. Four includes five-star products.
+	Ratings []int
+	// InStock keeps products with stock when true and sold out products
+	// when false.
+	InStock *bool
+	// Search matches the text as written, ignoring case, anywhere in the
+	// name, description, tags or category name. The storefront searches
+	// with the search index instead.
+	Search     string
+	Featured   bool
+	NewArrival bool
+	BestSeller bool
+	// StockBelow keeps products with less stock than this.
+	StockBelow int
+	// RatePriced keeps products priced from their metal weight.
+	RatePriced   bool
+	SellerID     primitive.ObjectID
+	UpdatedSince time.Time
+	// SortBy is the stored field to sort on, created_at by default.
+	SortBy   string
+	SortDesc bool
+	Page
+}
+
+type ProductRepository interface {
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.Product, error)
+	FindBySlug(ctx context.Context, slug string) (*models.Product, error)
+	// FindBySKU returns the product with a variant of the SKU.
+	FindBySKU(ctx context.Context, sku string) (*models.Product, error)
+	Find(ctx context.Context, query ProductQuery) ([]models.Product, error)
+	// Each calls fn with the products matching the query, oldest first,
+	// without holding them all in memory. It stops at the first error fn
+	// returns and returns it.
+	Each(ctx context.Context, query ProductQuery, fn func(*models.Product) error) error
+	Count(ctx context.Context, query ProductQuery) (int64, error)
+	// Facets counts the products matching the query by each facet,
+	// ignoring the query's filter on that facet.
+	Facets(ctx context.Context, query ProductQuery) (*ProductFacets, error)
+	Create(ctx context.Context, product *models.Product) error
+	Update(ctx context.Context, id primitive.ObjectID, set Fields) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	// ReserveStock takes quantity from the stock of an active product and,
+	// when variantID is set, of that variant. It reports false without
+	// changing anything when not enough is left.
+	ReserveStock(ctx context.Context, productID, variantID primitive.ObjectID, quantity int) (bool, error)
+	// ReleaseStock puts quantity back into product and variant stock.
+	ReleaseStock(ctx context.Context, productID, variantID primitive.ObjectID, quantity int) error
+	// SavePrices stores the computed prices of the product and its variants
+	// without touching any other field, so concurrent stock changes are
+	// kept.
+	SavePrices(ctx context.Context, product *models.Product) error
+	// Import sets top-level fields and replaces the variants of an
+	// imported product. Variants already stored keep the stock they hold
+	// now, matched by ID, unless they are listed in restock, so
+	// reservations made since the product was read are not undone.
+	Import(ctx context.Context, id primitive.ObjectID, set Fields, variants []models.ProductVariant, restock []primitive.ObjectID) error
+	// SetCategoryName copies a category's name to its products.
+	SetCategoryName(ctx context.Context, categoryID primitive.ObjectID, name string) error
+}
+
+type CategoryRepository interface {
+	// FindActive returns active categories ordered by sort order.
+	FindActive(ctx context.Context) ([]models.Category, error)
+	// FindAll returns every category, active or not, ordered by sort order.
+	FindAll(ctx context.Context) ([]models.Category, error)
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.Category, error)
+	FindBySlug(ctx context.Context, slug string) (*models.Category, error)
+	Create(ctx context.Context, category *models.Category) error
+	Update(ctx context.Context, id primitive.ObjectID, set Fields) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+// CartKey identifies a cart by its user or, for guest carts, by the hash of
+// the cart token.
+type CartKey struct {
+	UserID    primitive.ObjectID
+	TokenHash string
+}
+
+type CartRepository interface {
+	// Find returns the cart for the key. Expired guest carts are not found.
+	Find(ctx context.Context, key CartKey) (*models.Cart, error)
+	// Save creates or replaces the cart for the key.
+	Save(ctx context.Context, key CartKey, cart *models.Cart) error
+	Delete(ctx context.Context, key CartKey) error
+	// SetProductDetails copies a product's name and thumbnail to every cart
+	// line for it.
+	SetProductDetails(ctx context.Context, productID primitive.ObjectID, name, thumbnail string) error
+}
+
+type WishlistRepository interface {
+	FindByUser(ctx context.Context, userID primitive.ObjectID) (*models.Wishlist, error)
+	// AddProduct adds the product once, creating the wishlist if needed.
+	AddProduct(ctx context.Context, userID, productID primitive.ObjectID) error
+	RemoveProduct(ctx context.Context, userID, productID primitive.ObjectID) error
+	DeleteByUser(ctx context.Context, userID primitive.ObjectID) error
+}
+
+// OrderQuery filters order listings, newest first. Zero values do not
+// filter.
+type OrderQuery struct {
+	UserID        primitive.ObjectID
+	Statuses      []models.OrderStatus
+	PaymentStatus models.PaymentStatus
+	// PaymentExpiredBefore keeps orders with a payment intent that expired
+	// before this time.
+	PaymentExpiredBefore time.Time
+	CreatedSince         time.Time
+	UpdatedSince         time.Time
+	// ProductID keeps orders with a line for this product.
+	ProductID primitive.ObjectID
+	// SellerID keeps orders with a fulfilment for this seller.
+	SellerID primitive.ObjectID
+	Page
+}
+
+// MonthlyStat sums the orders placed in one calendar month.
+type MonthlyStat struct {
+	ID struct {
+		Year  int `json:"year" bson:"year"`
+		Month int `json:"month" bson:"month"`
+	} `json:"_id" bson:"_id"`
+	Revenue float64 `json:"revenue" bson:"revenue"`
+	Orders  int     `json:"orders" bson:"orders"`
+}
+
+type OrderRepository interface {
+	Create(ctx context.Context, order *models.Order) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.Order, error)
+	FindByIntentID(ctx context.Context, intentID string) (*models.Order, error)
+	Find(ctx context.Context, query OrderQuery) ([]models.Order, error)
+	Count(ctx context.Context, query OrderQuery) (int64, error)
+	// Revenue sums the totals of the matching orders.
+	Revenue(ctx context.Context, query OrderQuery) (float64, error)
+	MonthlyStats(ctx context.Context, since time.Time) ([]MonthlyStat, error)
+	// Update sets fields on the order while every field in match still
+	// holds its value, and returns ErrConflict otherwise.
+	Update(ctx context.Context, id primitive.ObjectID, match, set Fields) error
+	// Transition moves the order from one status to another and appends
+	// entry to its history, under the same conditions as Update. It
+	// returns ErrConflict when the order is no longer in the from status.
+	Transition(ctx context.Context, id primitive.ObjectID, from, to models.OrderStatus, entry models.StatusHistoryEntry, match, set Fields) error
+	// ReserveReturn adds quantity to the returned units of a delivered
+	// order's line, and returns ErrConflict when that would exceed the
+	// units delivered.
+	ReserveReturn(ctx context.Context, id, productID, variantID primitive.ObjectID, quantity int) error
+	ReleaseReturn(ctx context.Context, id, productID, variantID primitive.ObjectID, quantity int) error
+	// AddRefund adds amount to the refunded amount, and returns
+	// ErrConflict when the refunds would exceed the order total. Negative
+	// amounts undo an earlier refund.
+	AddRefund(ctx context.Context, id primitive.ObjectID, amount float64) error
+	// UpdateFulfilment moves a seller's part of the order from one status
+	// to another and appends entry to its history, keeping the tracking ID
+	// and carrier of the entry when set. It returns ErrConflict when that
+	// part is no longer in the from status or the order is not in one of
+	// orderStatuses.
+	UpdateFulfilment(ctx context.Context, id, sellerID primitive.ObjectID, from, to models.OrderStatus, orderStatuses []models.OrderStatus, entry models.StatusHistoryEntry) error
+	// AdvanceFulfilments moves every part of the order that is still in
+	// one of the from statuses to the to status.
+	AdvanceFulfilments(ctx context.Context, id primitive.ObjectID, from []models.OrderStatus, to models.OrderStatus, entry models.StatusHistoryEntry) error
+}
+
+type ReviewRepository interface {
+	// FindByProduct returns the reviews of a product, newest first.
+	FindByProduct(ctx context.Context, productID primitive.ObjectID) ([]models.Review, error)
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.Review, error)
+	Exists(ctx context.Context, productID, userID primitive.ObjectID) (bool, error)
+	Create(ctx context.Context, review *models.Review) error
+	Update(ctx context.Context, id primitive.ObjectID, set Fields) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	// SetAuthor copies a user's name and avatar to their reviews.
+	SetAuthor(ctx context.Context, userID primitive.ObjectID, name, avatar string) error
+}
+
+type SessionRepository interface {
+	Create(ctx context.Context, session *models.Session) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.Session, error)
+	// FindActiveByUser returns the user's sessions that are neither revoked
+	// nor expired, most recently used first.
+	FindActiveByUser(ctx context.Context, userID primitive.ObjectID) ([]models.Session, error)
+	// FindByTokenHash returns the session whose current refresh token has
+	// the hash, or whose rotated tokens include it.
+	FindByTokenHash(ctx context.Context, hash string) (*models.Session, error)
+	// Rotate replaces the current refresh token hash and records the old
+	// one as used. It returns ErrConflict when oldHash is no longer current
+	// or the session has been revoked.
+	Rotate(ctx context.Context, id primitive.ObjectID, oldHash, newHash string, set Fields) error
+	Revoke(ctx context.Context, id primitive.ObjectID, reason string) error
+	// RevokeByUser revokes every active session of the user except keep.
+	RevokeByUser(ctx context.Context, userID, keep primitive.ObjectID, reason string) error
+}
+
+// RoleRepository stores the staff role definitions, which are keyed by
+// their unique name.
+type RoleRepository interface {
+	// FindAll returns every role ordered by name.
+	FindAll(ctx context.Context) ([]models.RoleDefinition, error)
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.RoleDefinition, error)
+	FindByName(ctx context.Context, name models.Role) (*models.RoleDefinition, error)
+	// Create returns ErrDuplicate when the name is taken.
+	Create(ctx context.Context, role *models.RoleDefinition) error
+	Update(ctx context.Context, id primitive.ObjectID, set Fields) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+// SellerQuery filters seller listings, newest first.
+type SellerQuery struct {
+	Status models.SellerStatus
+	Page
+}
+
+// SellerRepository stores seller applications, one per user.
+type SellerRepository interface {
+	// Create returns ErrDuplicate when the user already has one.
+	Create(ctx context.Context, seller *models.Seller) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.Seller, error)
+	FindByUser(ctx context.Context, userID primitive.ObjectID) (*models.Seller, error)
+	Find(ctx context.Context, query SellerQuery) ([]models.Seller, error)
+	Count(ctx context.Context, query SellerQuery) (int64, error)
+	// Update sets fields on the seller while every field in match still
+	// holds its value, and returns ErrConflict otherwise.
+	Update(ctx context.Context, id primitive.ObjectID, match, set Fields) error
+}
+
+// LedgerQuery filters ledger entries, oldest first. Zero values do not
+// filter.
+type LedgerQuery struct {
+	SellerID primitive.ObjectID
+	PayoutID primitive.ObjectID
+	// Unsettled keeps entries that are not in a payout batch yet.
+	Unsettled bool
+	// From and To keep entries created in [From, To).
+	From time.Time
+	To   time.Time
+	Page
+}
+
+// LedgerBalance sums the ledger entries of one seller.
+type LedgerBalance struct {
+	SellerID    primitive.ObjectID `bson:"_id"`
+	Entries     int                `bson:"entries"`
+	Gross       float64            `bson:"gross"`
+	Commission  float64            `bson:"commission"`
+	TaxWithheld float64            `bson:"tax_withheld"`
+	Net         float64            `bson:"net"`
+}
+
+type LedgerRepository interface {
+	// Record stores a new entry, and returns ErrDuplicate when an entry
+	// with the same key exists.
+	Record(ctx context.Context, entry *models.LedgerEntry) error
+	FindByKey(ctx context.Context, key string) (*models.LedgerEntry, error)
+	Find(ctx context.Context, query LedgerQuery) ([]models.LedgerEntry, error)
+	// Balances sums the matching entries by seller.
+	Balances(ctx context.Context, query LedgerQuery) ([]LedgerBalance, error)
+	// Settle puts the matching entries that are not settled yet into the
+	// payout batch.
+	Settle(ctx context.Context, query LedgerQuery, payoutID primitive.ObjectID) error
+}
+
+type CommissionRepository interface {
+	FindAll(ctx context.Context) ([]models.CommissionRule, error)
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.CommissionRule, error)
+	// Create returns ErrDuplicate when a rule for the same seller and
+	// category exists.
+	Create(ctx context.Context, rule *models.CommissionRule) error
+	Update(ctx context.Context, id primitive.ObjectID, set Fields) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+type PayoutRepository interface {
+	Create(ctx context.Context, batch *models.PayoutBatch) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.PayoutBatch, error)
+	// Find returns batches newest first.
+	Find(ctx context.Context, page Page) ([]models.PayoutBatch, error)
+	Count(ctx context.Context) (int64, error)
+	// Update sets fields on the batch while every field in match still
+	// holds its value, and returns ErrConflict otherwise.
+	Update(ctx context.Context, id primitive.ObjectID, match, set Fields) error
+}
+
+// RevocationRepository records access token and session IDs that must no
+// longer be accepted. Entries only need to outlive the tokens they name.
+type RevocationRepository interface {
+	Revoke(ctx context.Context, id string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, id string) (bool, error)
+}
+
+// APIKeyRepository stores API keys, which are looked up by the hash of the
+// key.
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *models.APIKey) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.APIKey, error)
+	FindByHash(ctx context.Context, hash string) (*models.APIKey, error)
+	// FindAll returns every key, newest first.
+	FindAll(ctx context.Context) ([]models.APIKey, error)
+	Update(ctx context.Context, id primitive.ObjectID, set Fields) error
+}
+
+// EventRepository is the outbox of events waiting to be handled.
+type EventRepository interface {
+	Create(ctx context.Context, event *models.Event) error
+	// Claim takes the pending event that has been due longest, counts the
+	// attempt and holds the event back for lease so that no other worker
+	// takes it meanwhile. It returns ErrNotFound when no event is due.
+	Claim(ctx context.Context, now time.Time, lease time.Duration) (*models.Event, error)
+	Update(ctx context.Context, id primitive.ObjectID, set Fields) error
+	// Published returns, for every subject with an event of the type
+	// created since the time, when the latest of them was created.
+	Published(ctx context.Context, eventType models.EventType, since time.Time) (map[primitive.ObjectID]time.Time, error)
+}
+
+type ImportJobRepository interface {
+	Create(ctx context.Context, job *models.ImportJob) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.ImportJob, error)
+	Update(ctx context.Context, id primitive.ObjectID, set Fields) error
+	// FailAbandoned marks the queued and running jobs with no heartbeat
+	// since the time failed with the reason, and returns how many there
+	// were.
+	FailAbandoned(ctx context.Context, before time.Time, reason string) (int64, error)
+}
+
+// CouponQuery filters coupon listings, newest first.
+type CouponQuery struct {
+	Active *bool
+}
+
+// CouponRepository stores coupons, keyed by their unique code, and how
+// often each user has redeemed them.
+type CouponRepository interface {
+	Find(ctx context.Context, query CouponQuery) ([]models.Coupon, error)
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.Coupon, error)
+	FindByCode(ctx context.Context, code string) (*models.Coupon, error)
+	// Create returns ErrDuplicate when the code is taken.
+	Create(ctx context.Context, coupon *models.Coupon) error
+	Update(ctx context.Context, id primitive.ObjectID, set Fields) error
+	// Delete removes the coupon along with its usage counts.
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	// UserUses returns how often the user has redeemed the coupon.
+	UserUses(ctx context.Context, couponID, userID primitive.ObjectID) (int, error)
+	// ReserveUserUse counts one use by the user. It reports false without
+	// changing anything when the user already has limit uses; a zero limit
+	// never refuses.
+	ReserveUserUse(ctx context.Context, couponID, userID primitive.ObjectID, limit int) (bool, error)
+	// ReleaseUserUse takes back a use by the user, never going below zero.
+	ReleaseUserUse(ctx context.Context, couponID, userID primitive.ObjectID) error
+	// ReserveUse counts one use of an active coupon. It reports false
+	// without changing anything when the coupon is inactive or has been
+	// used limit times; a zero limit never refuses.
+	ReserveUse(ctx context.Context, id primitive.ObjectID, limit int) (bool, error)
+	// ReleaseUse takes back a use, never going below zero.
+	ReleaseUse(ctx context.Context, id primitive.ObjectID) error
+}
+
+// ReturnQuery filters return listings, newest first. Zero values do not
+// filter.
+type ReturnQuery struct {
+	UserID       primitive.ObjectID
+	Status       models.ReturnStatus
+	UpdatedSince time.Time
+	Page
+}
+
+type ReturnRepository interface {
+	Create(ctx context.Context, returnRequest *models.ReturnRequest) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.ReturnRequest, error)
+	Find(ctx context.Context, query ReturnQuery) ([]models.ReturnRequest, error)
+	Count(ctx context.Context, query ReturnQuery) (int64, error)
+	Update(ctx context.Context, id primitive.ObjectID, set Fields) error
+	// Transition moves the return from one status to another, sets fields
+	// and appends entry to its history. It returns ErrConflict when the
+	// return is no longer in the from status.
+	Transition(ctx context.Context, id primitive.ObjectID, from, to models.ReturnStatus, entry models.ReturnHistoryEntry, set Fields) error
+	// Revert undoes the last transition, from the from status back to the
+	// to status, dropping its history entry and the unset fields.
+	Revert(ctx context.Context, id primitive.ObjectID, from, to models.ReturnStatus, unset ...string) error
+}
+
+type ShippingZoneRepository interface {
+	// FindAll returns every zone ordered by name.
+	FindAll(ctx context.Context) ([]models.ShippingZone, error)
+	// FindActiveByPincode returns the active zones with a range containing
+	// the pincode.
+	FindActiveByPincode(ctx context.Context, pincode int) ([]models.ShippingZone, error)
+	FindByID(ctx context.Context, id primitive.ObjectID) (*models.ShippingZone, error)
+	Count(ctx context.Context) (int64, error)
+	Create(ctx context.Context, zone *models.ShippingZone) error
+	Update(ctx context.Context, id primitive.ObjectID, set Fields) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+// CounterRepository hands out gapless sequence numbers by name.
+type CounterRepository interface {
+	// Next increments the named counter, starting it at 1, and returns its
+	// new value.
+	Next(ctx context.Context, name string) (int64, error)
+}
+
+// MetalRateRepository stores one rate per metal, purity and day.
+type MetalRateRepository interface {
+	// Latest returns the most recent rate of every metal and purity.
+	Latest(ctx context.Context) ([]models.MetalRate, error)
+	// Save creates or replaces the rate for its metal, purity and date.
+	Save(ctx context.Context, rate *models.MetalRate) error
+}
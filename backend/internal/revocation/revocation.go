@@ -0,0 +1,123 @@
+// Package revocation decides whether a correctly signed access token is
+// still honoured. A token stops working when its own ID or its session is
+// revoked, or when the user's token version moves past the one it carries.
+// Lookups go through a small LRU cache, so with several API instances a
+// revocation made elsewhere takes up to the cache TTL to be seen; on the
+// instance that made it, it applies at once.
+package revocation
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"ejewel/internal/repository"
+	"ejewel/internal/utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrRevoked is returned for tokens that must no longer be accepted.
+var ErrRevoked = errors.New("token has been revoked")
+
+// userState is what the cache keeps about a user.
+type userState struct {
+	version int
+	active  bool
+}
+
+type List struct {
+	users   repository.UserRepository
+	revoked repository.RevocationRepository
+	cache   *cache
+	ttl     time.Duration
+}
+
+// NewList checks tokens against the user's token version and the revoked
+// IDs, caching up to size lookups for ttl each.
+func NewList(users repository.UserRepository, revoked repository.RevocationRepository, size int, ttl time.Duration) *List {
+	if ttl <= 0 {
+		size = 0
+	}
+	return &List{users: users, revoked: revoked, cache: newCache(size), ttl: ttl}
+}
+
+// Check returns ErrRevoked when the token, or the session it was issued
+// for, has been revoked, or when it predates the user's token version or
+// the account is disabled.
+func (l *List) Check(ctx context.Context, claims *utils.Claims) error {
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return ErrRevoked
+	}
+	state, err := l.userState(ctx, userID)
+	if err == repository.ErrNotFound {
+		return ErrRevoked
+	}
+	if err != nil {
+		return err
+	}
+	if !state.active || claims.Version != state.version {
+		return ErrRevoked
+	}
+
+	for _, id := range []string{claims.ID, claims.SessionID} {
+		if id == "" {
+			continue
+		}
+		revoked, err := l.isRevoked(ctx, id)
+		if err != nil {
+			return err
+		}
+		if revoked {
+			return ErrRevoked
+		}
+	}
+	return nil
+}
+
+// Revoke stops the token or session with the ID from being accepted.
+// expiresAt only needs to cover the last access token that may carry it.
+func (l *List) Revoke(ctx context.Context, id string, expiresAt time.Time) error {
+	if err := l.revoked.Revoke(ctx, id, expiresAt); err != nil {
+		return err
+	}
+	l.cache.set("id:"+id, true, expiresAt)
+	return nil
+}
+
+// RevokeUser invalidates every access token issued to the user so far.
+func (l *List) RevokeUser(ctx context.Context, userID primitive.ObjectID) error {
+	err := l.users.BumpTokenVersion(ctx, userID)
+	l.cache.remove("user:" + userID.Hex())
+	return err
+}
+
+func (l *List) userState(ctx context.Context, userID primitive.ObjectID) (userState, error) {
+	key := "user:" + userID.Hex()
+	if value, ok := l.cache.get(key); ok {
+		return value.(userState), nil
+	}
+
+	user, err := l.users.FindByID(ctx, userID)
+	if err != nil {
+		return userState{}, err
+	}
+	state := userState{version: user.TokenVersion, active: user.IsActive}
+	l.cache.set(key, state, time.Now().Add(l.ttl))
+	return state, nil
+}
+
+func (l *List) isRevoked(ctx context.Context, id string) (bool, error) {
+	key := "id:" + id
+	if value, ok := l.cache.get(key); ok {
+		return value.(bool), nil
+	}
+
+	revoked, err := l.revoked.IsRevoked(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	l.cache.set(key, revoked, time.Now().Add(l.ttl))
+	return revoked, nil
+}
@@ -0,0 +1,92 @@
+package revocation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+	"ejewel/internal/repository/memory"
+	"ejewel/internal/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newTestList(t *testing.T, ttl time.Duration) (*List, repository.Repositories, *models.User) {
+	t.Helper()
+	repos := memory.NewRepositories()
+	user := &models.User{Email: "customer@example.com", Role: models.RoleCustomer, IsActive: true}
+	if err := repos.Users.Create(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	return NewList(repos.Users, repos.Revocations, 100, ttl), repos, user
+}
+
+func claimsFor(user *models.User, id, sessionID string) *utils.Claims {
+	return &utils.Claims{
+		UserID:           user.ID.Hex(),
+		SessionID:        sessionID,
+		Version:          user.TokenVersion,
+		RegisteredClaims: jwt.RegisteredClaims{ID: id},
+	}
+}
+
+func TestCheck(t *testing.T) {
+	list, _, user := newTestList(t, time.Minute)
+	ctx := context.Background()
+	expires := time.Now().Add(time.Hour)
+
+	if err := list.Check(ctx, claimsFor(user, "token-1", "session-1")); err != nil {
+		t.Fatalf("fresh token: %v", err)
+	}
+
+	if err := list.Revoke(ctx, "token-1", expires); err != nil {
+		t.Fatal(err)
+	}
+	if err := list.Check(ctx, claimsFor(user, "token-1", "session-1")); err != ErrRevoked {
+		t.Errorf("revoked token: err = %v, want ErrRevoked", err)
+	}
+	if err := list.Check(ctx, claimsFor(user, "token-2", "session-1")); err != nil {
+		t.Errorf("other token of the session: %v", err)
+	}
+
+	if err := list.Revoke(ctx, "session-1", expires); err != nil {
+		t.Fatal(err)
+	}
+	if err := list.Check(ctx, claimsFor(user, "token-2", "session-1")); err != ErrRevoked {
+		t.Errorf("token of a revoked session: err = %v, want ErrRevoked", err)
+	}
+
+	// RevokeUser applies at once on this instance despite the cache
+	stale := claimsFor(user, "token-3", "session-2")
+	if err := list.Check(ctx, stale); err != nil {
+		t.Fatalf("token of another session: %v", err)
+	}
+	if err := list.RevokeUser(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := list.Check(ctx, stale); err != ErrRevoked {
+		t.Errorf("token from before RevokeUser: err = %v, want ErrRevoked", err)
+	}
+	user.TokenVersion++
+	if err := list.Check(ctx, claimsFor(user, "token-4", "session-2")); err != nil {
+		t.Errorf("token issued after RevokeUser: %v", err)
+	}
+}
+
+func TestCheckRejectsUnknownAndDisabledUsers(t *testing.T) {
+	list, repos, user := newTestList(t, 0)
+	ctx := context.Background()
+
+	if err := list.Check(ctx, &utils.Claims{UserID: "not-an-id"}); err != ErrRevoked {
+		t.Errorf("malformed user ID: err = %v, want ErrRevoked", err)
+	}
+
+	if err := repos.Users.Update(ctx, user.ID, repository.Fields{"is_active": false}); err != nil {
+		t.Fatal(err)
+	}
+	if err := list.Check(ctx, claimsFor(user, "token-1", "")); err != ErrRevoked {
+		t.Errorf("disabled user: err = %v, want ErrRevoked", err)
+	}
+}
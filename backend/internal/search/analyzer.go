@@ -0,0 +1,179 @@
+package search
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// stopWords are left out of the index and of queries.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "for": true, "in": true, "of": true,
+	"on": true, "or": true, "the": true, "to": true, "with": true,
+}
+
+// DefaultSynonyms are the groups of words that find each other when no
+// synonyms file is configured.
+var DefaultSynonyms = [][]string{
+	{"chain", "necklace"},
+	{"ring", "band"},
+	{"bangle", "bracelet", "kada"},
+	{"earring", "stud", "jhumka"},
+	{"pendant", "locket"},
+	{"silver", "sterling"},
+}
+
+// Synonyms maps each stemmed word to the other words of its groups.
+type Synonyms map[string][]string
+
+// NewSynonyms builds the lookup for groups of words that should find each
+// other.
+func NewSynonyms(groups [][]string) Synonyms {
+	synonyms := Synonyms{}
+	for _, group := range groups {
+		var terms []string
+		for _, word := range group {
+			terms = append(terms, analyze(word)...)
+		}
+		for _, term := range terms {
+			for _, other := range terms {
+				if other != term && !contains(synonyms[term], other) {
+					synonyms[term] = append(synonyms[term], other)
+				}
+			}
+		}
+	}
+	return synonyms
+}
+
+// LoadSynonyms reads synonym groups from a file with one comma separated
+// group per line. Blank lines and lines starting with # are skipped.
+func LoadSynonyms(path string) (Synonyms, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var groups [][]string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		groups = append(groups, strings.Split(line, ","))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewSynonyms(groups), nil
+}
+
+// words splits text into lower case words of letters and digits.
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// analyze turns text into the terms it is indexed and searched by: its
+// words, without stop words, stemmed.
+func analyze(text string) []string {
+	var terms []string
+	for _, word := range words(text) {
+		if !stopWords[word] {
+			terms = append(terms, stem(word))
+		}
+	}
+	return terms
+}
+
+// stem strips common English inflections so that "rings" finds "ring" and
+// "plated" finds "plating", but leaves words ending in ring such as
+// earring whole. It only needs to treat the index and queries alike, not to
+// produce real words.
+func stem(word string) string {
+	if len(word) <= 3 {
+		return word
+	}
+	switch {
+	case strings.HasSuffix(word, "sses"):
+		word = word[:len(word)-2]
+	case strings.HasSuffix(word, "ies"):
+		word = word[:len(word)-3] + "y"
+	case strings.HasSuffix(word, "ches"), strings.HasSuffix(word, "shes"),
+		strings.HasSuffix(word, "xes"), strings.HasSuffix(word, "zes"):
+		word = word[:len(word)-2]
+	case strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") &&
+		!strings.HasSuffix(word, "us") && !strings.HasSuffix(word, "is"):
+		word = word[:len(word)-1]
+	}
+	switch {
+	case strings.HasSuffix(word, "ing") && len(word) > 5 && !strings.HasSuffix(word, "ring"):
+		word = word[:len(word)-3]
+	case strings.HasSuffix(word, "ed") && len(word) > 4:
+		word = word[:len(word)-2]
+	default:
+		return word
+	}
+	// plating and plated both come down to plat
+	if n := len(word); n > 2 && word[n-1] == word[n-2] && !strings.ContainsRune("aeiouls", rune(word[n-1])) {
+		word = word[:n-1]
+	}
+	return strings.TrimSuffix(word, "e")
+}
+
+// distance is the Levenshtein distance between a and b, giving up once it
+// exceeds limit.
+func distance(a, b string, limit int) int {
+	ra, rb := []rune(a), []rune(b)
+	if d := len(ra) - len(rb); d > limit || -d > limit {
+		return limit + 1
+	}
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		best := curr[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			best = min(best, curr[j])
+		}
+		if best > limit {
+			return limit + 1
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// maxEdits is how many typos a query word of this length may have.
+func maxEdits(term string) int {
+	switch n := len([]rune(term)); {
+	case n >= 8:
+		return 2
+	case n >= 4:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
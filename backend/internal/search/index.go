@@ -0,0 +1,444 @@
+// Package search keeps an inverted index of the active catalogue in memory
+// for ranked, typo tolerant product search and autocomplete. Each instance
+// loads the index from the product repository and reloads it periodically
+// to pick up changes made elsewhere.
+package search
+
+import (
+	"context"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MaxHits bounds how many products a search ranks.
+const MaxHits = 1000
+
+// Weights of the product fields, so that a word in the name counts for more
+// than the same word in the description.
+const (
+	nameWeight        = 5
+	tagWeight         = 3
+	categoryWeight    = 2
+	metalWeight       = 2
+	descriptionWeight = 1
+)
+
+// Boosts of the ways a query word can match an indexed term.
+const (
+	exactBoost   = 1.0
+	synonymBoost = 0.8
+	typoBoost    = 0.6
+	prefixBoost  = 0.5
+)
+
+// BM25 term frequency saturation and length normalisation.
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+// Suggestion types.
+const (
+	SuggestCategory = "category"
+	SuggestTag      = "tag"
+	SuggestProduct  = "product"
+)
+
+// Hit is a product matching a search, with its relevance.
+type Hit struct {
+	ID    primitive.ObjectID
+	Score float64
+}
+
+// Suggestion completes what a shopper has typed so far.
+type Suggestion struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+	Slug string `json:"slug,omitempty"` // The product's, for product suggestions
+}
+
+type Index struct {
+	products repository.ProductRepository
+	synonyms Synonyms
+
+	mu       sync.RWMutex
+	contents *contents
+}
+
+func NewIndex(products repository.ProductRepository, synonyms Synonyms) *Index {
+	return &Index{
+		products: products,
+		synonyms: synonyms,
+		contents: newContents(),
+	}
+}
+
+// Load rebuilds the index from the active products in the repository.
+func (i *Index) Load(ctx context.Context) error {
+	products, err := i.products.Find(ctx, repository.ProductQuery{ActiveOnly: true})
+	if err != nil {
+		return err
+	}
+
+	loaded := newContents()
+	for j := range products {
+		loaded.put(&products[j])
+	}
+
+	i.mu.Lock()
+	i.contents = loaded
+	i.mu.Unlock()
+
+	return nil
+}
+
+// Start reloads the index on the given interval until ctx is cancelled.
+func (i *Index) Start(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				loadCtx, cancel := context.WithTimeout(ctx, time.Minute)
+				if err := i.Load(loadCtx); err != nil {
+					log.Println("Failed to reload search index:", err)
+				}
+				cancel()
+			}
+		}
+	}()
+}
+
+// Put indexes a product that was created or changed, or drops it when it
+// is no longer active.
+func (i *Index) Put(product *models.Product) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.contents.remove(product.ID)
+	if product.IsActive {
+		i.contents.put(product)
+	}
+}
+
+// Refresh re-indexes the products matching the query, for changes made to
+// many products at once such as a category rename.
+func (i *Index) Refresh(ctx context.Context, query repository.ProductQuery) error {
+	products, err := i.products.Find(ctx, query)
+	if err != nil {
+		return err
+	}
+	for j := range products {
+		i.Put(&products[j])
+	}
+	return nil
+}
+
+// Remove drops a deleted product.
+func (i *Index) Remove(id primitive.ObjectID) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.contents.remove(id)
+}
+
+// Search returns up to limit products matching every word of the text,
+// most relevant first. A word matches the same word in another form, its
+// synonyms and, when the catalogue has neither, words it is a typo or the
+// start of.
+func (i *Index) Search(text string, limit int) []Hit {
+	terms := unique(analyze(text))
+	if len(terms) == 0 {
+		return nil
+	}
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	c := i.contents
+	if len(c.docs) == 0 {
+		return nil
+	}
+	averageLength := c.totalLength / float64(len(c.docs))
+
+	scores := map[primitive.ObjectID]float64{}
+	matched := map[primitive.ObjectID]int{}
+	for _, term := range terms {
+		// A product scores for a query word by the best way it matches
+		best := map[primitive.ObjectID]float64{}
+		for indexed, boost := range c.expand(term, i.synonyms) {
+			postings := c.postings[indexed]
+			idf := math.Log(1 + (float64(len(c.docs))-float64(len(postings))+0.5)/(float64(len(postings))+0.5))
+			for id, frequency := range postings {
+				norm := 1 - b + b*c.docs[id].length/averageLength
+				score := boost * idf * frequency * (k1 + 1) / (frequency + k1*norm)
+				if score > best[id] {
+					best[id] = score
+				}
+			}
+		}
+		for id, score := range best {
+			scores[id] += score
+			matched[id]++
+		}
+	}
+
+	var hits []Hit
+	for id, score := range scores {
+		if matched[id] == len(terms) {
+			hits = append(hits, Hit{ID: id, Score: score})
+		}
+	}
+	sort.Slice(hits, func(x, y int) bool {
+		if hits[x].Score != hits[y].Score {
+			return hits[x].Score > hits[y].Score
+		}
+		return hits[x].ID.Hex() < hits[y].ID.Hex()
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+// Suggest returns up to limit category names, tags and product names that
+// have a word starting with each word of the text, allowing for typos.
+// Closer matches come first, then categories before tags before products.
+func (i *Index) Suggest(text string, limit int) []Suggestion {
+	typed := words(text)
+	if len(typed) == 0 {
+		return []Suggestion{}
+	}
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	type match struct {
+		phrase *phrase
+		score  float64
+	}
+	var matches []match
+	for _, p := range i.contents.phrases {
+		if score, ok := p.completes(typed); ok {
+			matches = append(matches, match{p, score})
+		}
+	}
+
+	rank := map[string]int{SuggestCategory: 0, SuggestTag: 1, SuggestProduct: 2}
+	sort.Slice(matches, func(x, y int) bool {
+		pa, pb := matches[x].phrase, matches[y].phrase
+		switch {
+		case matches[x].score != matches[y].score:
+			return matches[x].score > matches[y].score
+		case pa.kind != pb.kind:
+			return rank[pa.kind] < rank[pb.kind]
+		case pa.products != pb.products:
+			return pa.products > pb.products
+		case len(pa.text) != len(pb.text):
+			return len(pa.text) < len(pb.text)
+		}
+		return pa.text < pb.text
+	})
+
+	suggestions := []Suggestion{}
+	for _, m := range matches {
+		if len(suggestions) == limit {
+			break
+		}
+		suggestions = append(suggestions, Suggestion{Text: m.phrase.text, Type: m.phrase.kind, Slug: m.phrase.slug})
+	}
+	return suggestions
+}
+
+// contents is one generation of the index, so that a reload can be built
+// while searches use the previous one.
+type contents struct {
+	docs        map[primitive.ObjectID]*document
+	postings    map[string]map[primitive.ObjectID]float64
+	phrases     map[string]*phrase
+	totalLength float64
+}
+
+// document is what the index holds for a product: its weighted term
+// frequencies and the phrases it was suggested by.
+type document struct {
+	terms   map[string]float64
+	length  float64
+	phrases []string
+}
+
+// phrase is a category name, tag or product name offered as a suggestion.
+type phrase struct {
+	text     string
+	kind     string
+	slug     string
+	words    []string
+	products int
+}
+
+func newContents() *contents {
+	return &contents{
+		docs:     map[primitive.ObjectID]*document{},
+		postings: map[string]map[primitive.ObjectID]float64{},
+		phrases:  map[string]*phrase{},
+	}
+}
+
+func (c *contents) put(product *models.Product) {
+	doc := &document{terms: map[string]float64{}}
+	add := func(text string, weight float64) {
+		for _, term := range analyze(text) {
+			doc.terms[term] += weight
+			doc.length += weight
+		}
+	}
+	add(product.Name, nameWeight)
+	for _, tag := range product.Tags {
+		add(tag, tagWeight)
+	}
+	for _, variant := range product.Variants {
+		add(variant.SKU, tagWeight)
+	}
+	add(product.CategoryName, categoryWeight)
+	add(string(product.MetalType), metalWeight)
+	add(product.Purity, metalWeight)
+	add(product.ShortDesc, descriptionWeight)
+	add(product.Description, descriptionWeight)
+
+	for term, frequency := range doc.terms {
+		if c.postings[term] == nil {
+			c.postings[term] = map[primitive.ObjectID]float64{}
+		}
+		c.postings[term][product.ID] = frequency
+	}
+
+	suggest := func(key, text, kind, slug string) {
+		if strings.TrimSpace(text) == "" {
+			return
+		}
+		p, ok := c.phrases[key]
+		if !ok {
+			p = &phrase{text: text, kind: kind, slug: slug, words: words(text)}
+			c.phrases[key] = p
+		}
+		p.products++
+		doc.phrases = append(doc.phrases, key)
+	}
+	suggest(SuggestProduct+"|"+product.ID.Hex(), product.Name, SuggestProduct, product.Slug)
+	suggest(SuggestCategory+"|"+strings.ToLower(product.CategoryName), product.CategoryName, SuggestCategory, "")
+	for _, tag := range unique(product.Tags) {
+		suggest(SuggestTag+"|"+strings.ToLower(tag), tag, SuggestTag, "")
+	}
+
+	c.docs[product.ID] = doc
+	c.totalLength += doc.length
+}
+
+func (c *contents) remove(id primitive.ObjectID) {
+	doc, ok := c.docs[id]
+	if !ok {
+		return
+	}
+	for term := range doc.terms {
+		delete(c.postings[term], id)
+		if len(c.postings[term]) == 0 {
+			delete(c.postings, term)
+		}
+	}
+	for _, key := range doc.phrases {
+		if p := c.phrases[key]; p != nil {
+			if p.products--; p.products == 0 {
+				delete(c.phrases, key)
+			}
+		}
+	}
+	c.totalLength -= doc.length
+	delete(c.docs, id)
+}
+
+// expand returns the indexed terms a query term matches, with the boost of
+// each. Typos and prefixes are only tried when the term and its synonyms are
+// not in the index.
+func (c *contents) expand(term string, synonyms Synonyms) map[string]float64 {
+	terms := map[string]float64{}
+	if _, ok := c.postings[term]; ok {
+		terms[term] = exactBoost
+	}
+	for _, synonym := range synonyms[term] {
+		if _, ok := c.postings[synonym]; ok {
+			terms[synonym] = synonymBoost
+		}
+	}
+	if len(terms) > 0 {
+		return terms
+	}
+
+	edits := maxEdits(term)
+	for indexed := range c.postings {
+		switch {
+		case edits > 0 && distance(indexed, term, edits) <= edits:
+			terms[indexed] = typoBoost
+		case len(term) >= 3 && strings.HasPrefix(indexed, term):
+			terms[indexed] = prefixBoost
+		}
+	}
+	return terms
+}
+
+// completes reports whether each typed word starts a word of the phrase,
+// and how closely: typos score half.
+func (p *phrase) completes(typed []string) (float64, bool) {
+	score := 1.0
+	for _, t := range typed {
+		best := 0.0
+		for _, w := range p.words {
+			if strings.HasPrefix(w, t) {
+				best = 1
+				break
+			}
+			edits := maxEdits(t)
+			if edits == 0 {
+				continue
+			}
+			// A missed or extra letter shifts where the typed word ends
+			word, n := []rune(w), len([]rune(t))
+			for end := n - 1; end <= n+1 && end <= len(word); end++ {
+				if end > 0 && distance(string(word[:end]), t, edits) <= edits {
+					best = 0.5
+				}
+			}
+		}
+		if best == 0 {
+			return 0, false
+		}
+		score *= best
+	}
+	return score, true
+}
+
+func unique(values []string) []string {
+	var out []string
+	for _, v := range values {
+		if !contains(out, v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,99 @@
+package search
+
+import (
+	"testing"
+
+	"ejewel/internal/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func testIndex(products ...models.Product) *Index {
+	index := NewIndex(nil, NewSynonyms(DefaultSynonyms))
+	for i := range products {
+		products[i].ID = primitive.NewObjectID()
+		products[i].IsActive = true
+		index.Put(&products[i])
+	}
+	return index
+}
+
+func TestStem(t *testing.T) {
+	tests := map[string]string{
+		"rings":    "ring",
+		"earrings": "earring",
+		"plated":   "plat",
+		"plating":  "plat",
+		"bangles":  "bangle",
+		"watches":  "watch",
+		"dress":    "dress",
+	}
+	for word, want := range tests {
+		if got := stem(word); got != want {
+			t.Errorf("stem(%q) = %q, want %q", word, got, want)
+		}
+	}
+}
+
+func TestSearchRanksNameAboveDescription(t *testing.T) {
+	index := testIndex(
+		models.Product{Name: "Gold Chain", Description: "A classic piece"},
+		models.Product{Name: "Pearl Pendant", Description: "Hangs from a gold chain"},
+		models.Product{Name: "Silver Anklet"},
+	)
+
+	hits := index.Search("gold chains", 10)
+	if len(hits) != 2 {
+		t.Fatalf("got %d hits, want 2", len(hits))
+	}
+	first := index.contents.docs[hits[0].ID]
+	if first.terms["chain"] < nameWeight {
+		t.Error("product named chain did not rank first")
+	}
+}
+
+func TestSearchMatchesSynonymsAndTypos(t *testing.T) {
+	index := testIndex(
+		models.Product{Name: "Temple Necklace"},
+		models.Product{Name: "Diamond Bracelet"},
+	)
+
+	if hits := index.Search("chain", 10); len(hits) != 1 {
+		t.Errorf("synonym search got %d hits, want 1", len(hits))
+	}
+	if hits := index.Search("diamnd", 10); len(hits) != 1 {
+		t.Errorf("typo search got %d hits, want 1", len(hits))
+	}
+	if hits := index.Search("diamond necklace", 10); len(hits) != 0 {
+		t.Errorf("search needing both words got %d hits, want 0", len(hits))
+	}
+}
+
+func TestPutDropsInactiveProducts(t *testing.T) {
+	product := models.Product{Name: "Ruby Ring"}
+	index := testIndex(product)
+	if hits := index.Search("ruby", 10); len(hits) != 1 {
+		t.Fatalf("got %d hits, want 1", len(hits))
+	}
+
+	indexed := index.Search("ruby", 10)[0].ID
+	index.Put(&models.Product{ID: indexed, Name: "Ruby Ring", IsActive: false})
+	if hits := index.Search("ruby", 10); len(hits) != 0 {
+		t.Errorf("inactive product still found, %d hits", len(hits))
+	}
+}
+
+func TestSuggestPrefersCategories(t *testing.T) {
+	index := testIndex(
+		models.Product{Name: "Rose Ring", CategoryName: "Rings", Slug: "rose-ring"},
+		models.Product{Name: "Ringlet Earring", CategoryName: "Earrings", Slug: "ringlet-earring"},
+	)
+
+	suggestions := index.Suggest("rin", 5)
+	if len(suggestions) == 0 {
+		t.Fatal("no suggestions")
+	}
+	if suggestions[0].Type != SuggestCategory || suggestions[0].Text != "Rings" {
+		t.Errorf("first suggestion = %+v, want the Rings category", suggestions[0])
+	}
+}
@@ -0,0 +1,264 @@
+// Package shipping finds the zone serving a pincode and prices the
+// shipping methods available there.
+package shipping
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"ejewel/internal/models"
+	"ejewel/internal/repository"
+)
+
+// PackagingWeight is added to every parcel, in grams.
+const PackagingWeight = 150
+
+const defaultSlabGrams = 500
+
+// Errors returned for requests that cannot be shipped; their messages are
+// safe to show to customers.
+var (
+	ErrInvalidPincode   = errors.New("Enter a valid 6 digit pincode")
+	ErrNotServiceable   = errors.New("We do not deliver to this pincode yet")
+	ErrMethodNotOffered = errors.New("Shipping method is not available for this pincode")
+	ErrCODNotAvailable  = errors.New("Cash on delivery is not available for this pincode or order value")
+)
+
+// IsRuleError reports whether err is one of the customer facing shipping
+// errors rather than a failure to look up zones.
+func IsRuleError(err error) bool {
+	return errors.Is(err, ErrInvalidPincode) ||
+		errors.Is(err, ErrNotServiceable) ||
+		errors.Is(err, ErrMethodNotOffered) ||
+		errors.Is(err, ErrCODNotAvailable)
+}
+
+var pincodePattern = regexp.MustCompile(`^[1-9][0-9]{5}$`)
+
+// Parcel describes what is being shipped.
+type Parcel struct {
+	Weight        float64 // grams of product, packaging is added when pricing
+	DeclaredValue float64
+}
+
+// ParsePincode validates a six digit Indian pincode.
+func ParsePincode(pincode string) (int, error) {
+	pincode = strings.TrimSpace(pincode)
+	if !pincodePattern.MatchString(pincode) {
+		return 0, ErrInvalidPincode
+	}
+	return strconv.Atoi(pincode)
+}
+
+// ValidateZone checks the pincode ranges and rates of a zone, returning a
+// message describing the first problem found.
+func ValidateZone(zone *models.ShippingZone) string {
+	for _, r := range zone.Pincodes {
+		if r.From < 100000 || r.To > 999999 || r.From > r.To {
+			return fmt.Sprintf("Invalid pincode range %d-%d", r.From, r.To)
+		}
+	}
+	seen := map[models.ShippingMethod]bool{}
+	for _, rate := range zone.Rates {
+		switch rate.Method {
+		case models.ShippingStandard, models.ShippingExpress, models.ShippingInsured:
+		default:
+			return "Invalid shipping method " + string(rate.Method)
+		}
+		if seen[rate.Method] {
+			return "Duplicate rate for shipping method " + string(rate.Method)
+		}
+		seen[rate.Method] = true
+		if rate.BaseCharge < 0 || rate.SlabCharge < 0 || rate.ValuePercent < 0 || rate.SlabGrams < 0 {
+			return "Shipping charges cannot be negative"
+		}
+		if rate.MinDays < 0 || rate.MinDays > rate.MaxDays {
+			return "Delivery days must satisfy 0 <= minDays <= maxDays"
+		}
+	}
+	return ""
+}
+
+// FindZone returns the active zone serving a pincode. When ranges overlap
+// the zone with the narrowest matching range wins, so specific zones can
+// be carved out of broad ones.
+func FindZone(ctx context.Context, zoneStore repository.ShippingZoneRepository, pincode string) (*models.ShippingZone, error) {
+	pin, err := ParsePincode(pincode)
+	if err != nil {
+		return nil, err
+	}
+
+	zones, err := zoneStore.FindActiveByPincode(ctx, pin)
+	if err != nil {
+		return nil, err
+	}
+
+	var best *models.ShippingZone
+	bestWidth := math.MaxInt
+	for i := range zones {
+		for _, r := range zones[i].Pincodes {
+			if pin >= r.From && pin <= r.To && r.To-r.From < bestWidth {
+				best = &zones[i]
+				bestWidth = r.To - r.From
+			}
+		}
+	}
+	if best == nil {
+		return nil, ErrNotServiceable
+	}
+	return best, nil
+}
+
+// Options prices every method the zone offers for the parcel. Methods that
+// cannot carry the declared value are left out.
+func Options(zone *models.ShippingZone, parcel Parcel, now time.Time) []models.ShippingOption {
+	options := make([]models.ShippingOption, 0, len(zone.Rates))
+	for _, rate := range zone.Rates {
+		if rate.MaxValue > 0 && parcel.DeclaredValue > rate.MaxValue {
+			continue
+		}
+		options = append(options, models.ShippingOption{
+			Method:        rate.Method,
+			Cost:          Cost(rate, parcel),
+			MinDays:       rate.MinDays,
+			MaxDays:       rate.MaxDays,
+			EstimatedDate: EstimatedDate(now, rate.MaxDays),
+		})
+	}
+	return options
+}
+
+// Select returns the option for a method, defaulting to standard shipping.
+// Parcels worth more than standard shipping carries go insured when no
+// method was asked for, so high value orders placed with the default still
+// ship. A method asked for by name is never swapped for another.
+func Select(options []models.ShippingOption, method models.ShippingMethod) (*models.ShippingOption, error) {
+	if method != "" {
+		if option := find(options, method); option != nil {
+			return option, nil
+		}
+		return nil, ErrMethodNotOffered
+	}
+
+	for _, fallback := range []models.ShippingMethod{models.ShippingStandard, models.ShippingInsured} {
+		if option := find(options, fallback); option != nil {
+			return option, nil
+		}
+	}
+	return nil, ErrMethodNotOffered
+}
+
+func find(options []models.ShippingOption, method models.ShippingMethod) *models.ShippingOption {
+	for i := range options {
+		if options[i].Method == method {
+			return &options[i]
+		}
+	}
+	return nil
+}
+
+// CheckCOD reports whether cash on delivery can be used for an order value
+// in the zone.
+func CheckCOD(zone *models.ShippingZone, value float64) error {
+	if !zone.CODAvailable || (zone.CODLimit > 0 && value > zone.CODLimit) {
+		return ErrCODNotAvailable
+	}
+	return nil
+}
+
+// Cost prices a parcel at a rate, rounded to the nearest rupee.
+func Cost(rate models.ShippingRate, parcel Parcel) float64 {
+	valueCharge := parcel.DeclaredValue * rate.ValuePercent / 100
+	if rate.FreeAbove > 0 && parcel.DeclaredValue >= rate.FreeAbove {
+		// Free shipping waives the carriage charges, not insurance
+		return math.Round(valueCharge)
+	}
+
+	slab := rate.SlabGrams
+	if slab <= 0 {
+		slab = defaultSlabGrams
+	}
+	slabs := math.Ceil((parcel.Weight + PackagingWeight) / slab)
+	extraSlabs := math.Max(slabs-1, 0)
+
+	return math.Round(rate.BaseCharge + extraSlabs*rate.SlabCharge + valueCharge)
+}
+
+// EstimatedDate counts delivery days forward from now, skipping Sundays
+// when couriers do not deliver.
+func EstimatedDate(now time.Time, days int) time.Time {
+	date := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	for days > 0 {
+		date = date.AddDate(0, 0, 1)
+		if date.Weekday() != time.Sunday {
+			days--
+		}
+	}
+	return date
+}
+
+// DefaultZones is the zone setup seeded into an empty database: metro
+// cities, remote regions without cash on delivery, and the rest of India.
+func DefaultZones() []models.ShippingZone {
+	now := time.Now()
+	insured := func(base float64, minDays, maxDays int) models.ShippingRate {
+		return models.ShippingRate{Method: models.ShippingInsured, BaseCharge: base, SlabCharge: 50, ValuePercent: 0.5, MinDays: minDays, MaxDays: maxDays}
+	}
+
+	zones := []models.ShippingZone{
+		{
+			Name: "Metro",
+			Pincodes: []models.PincodeRange{
+				{From: 110001, To: 110099}, // Delhi
+				{From: 400001, To: 400104}, // Mumbai
+				{From: 560001, To: 560110}, // Bengaluru
+				{From: 600001, To: 600130}, // Chennai
+				{From: 700001, To: 700160}, // Kolkata
+				{From: 500001, To: 500100}, // Hyderabad
+			},
+			Rates: []models.ShippingRate{
+				{Method: models.ShippingStandard, BaseCharge: 99, SlabCharge: 40, FreeAbove: 5000, MaxValue: 200000, MinDays: 2, MaxDays: 4},
+				{Method: models.ShippingExpress, BaseCharge: 249, SlabCharge: 80, MaxValue: 200000, MinDays: 1, MaxDays: 2},
+				insured(199, 2, 4),
+			},
+			CODAvailable: true,
+			CODLimit:     50000,
+		},
+		{
+			Name: "North East & Remote",
+			Pincodes: []models.PincodeRange{
+				{From: 180001, To: 194999}, // Jammu & Kashmir, Ladakh
+				{From: 744101, To: 744304}, // Andaman & Nicobar
+				{From: 781001, To: 799999}, // North East
+			},
+			Rates: []models.ShippingRate{
+				{Method: models.ShippingStandard, BaseCharge: 299, SlabCharge: 100, MaxValue: 100000, MinDays: 6, MaxDays: 10},
+				insured(399, 6, 10),
+			},
+		},
+		{
+			Name:     "Rest of India",
+			Pincodes: []models.PincodeRange{{From: 110001, To: 999999}},
+			Rates: []models.ShippingRate{
+				{Method: models.ShippingStandard, BaseCharge: 199, SlabCharge: 60, FreeAbove: 5000, MaxValue: 200000, MinDays: 4, MaxDays: 7},
+				{Method: models.ShippingExpress, BaseCharge: 399, SlabCharge: 120, MaxValue: 200000, MinDays: 2, MaxDays: 4},
+				insured(299, 4, 7),
+			},
+			CODAvailable: true,
+			CODLimit:     25000,
+		},
+	}
+
+	for i := range zones {
+		zones[i].IsActive = true
+		zones[i].CreatedAt = now
+		zones[i].UpdatedAt = now
+	}
+	return zones
+}
@@ -0,0 +1,41 @@
+package shipping
+
+import (
+	"testing"
+
+	"ejewel/internal/models"
+)
+
+func TestSelect(t *testing.T) {
+	// Standard shipping does not carry parcels this valuable
+	options := []models.ShippingOption{
+		{Method: models.ShippingExpress, Cost: 250},
+		{Method: models.ShippingInsured, Cost: 900},
+	}
+
+	tests := []struct {
+		name   string
+		method models.ShippingMethod
+		want   models.ShippingMethod
+		err    error
+	}{
+		{"default falls back to insured", "", models.ShippingInsured, nil},
+		{"method asked for", models.ShippingExpress, models.ShippingExpress, nil},
+		{"standard asked for is not swapped", models.ShippingStandard, "", ErrMethodNotOffered},
+	}
+	for _, tt := range tests {
+		option, err := Select(options, tt.method)
+		if err != tt.err {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if err == nil && option.Method != tt.want {
+			t.Errorf("%s: method = %s, want %s", tt.name, option.Method, tt.want)
+		}
+	}
+
+	option, err := Select(append(options, models.ShippingOption{Method: models.ShippingStandard, Cost: 100}), "")
+	if err != nil || option.Method != models.ShippingStandard {
+		t.Errorf("default with standard offered = %v, %v; want standard", option, err)
+	}
+}
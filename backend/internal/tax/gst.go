@@ -0,0 +1,119 @@
+// Package tax computes GST on jewellery orders.
+package tax
+
+import (
+	"math"
+	"strings"
+
+	"ejewel/internal/models"
+)
+
+const (
+	// GoodsRate applies to the value of the jewellery itself
+	GoodsRate = 0.03
+	// MakingRate applies to making charges, which are treated as job work
+	MakingRate = 0.05
+
+	// HSNJewellery covers articles of jewellery of precious metal
+	HSNJewellery = "7113"
+	// SACMakingCharges covers jewellery manufacturing services
+	SACMakingCharges = "998892"
+)
+
+// IsInterstate reports whether a supply from the seller's state to the
+// shipping state crosses state lines. Unknown states are treated as
+// interstate so IGST is charged.
+func IsInterstate(shippingState, sellerState string) bool {
+	shipping := normalizeState(shippingState)
+	return shipping == "" || shipping != normalizeState(sellerState)
+}
+
+func normalizeState(state string) string {
+	return strings.Join(strings.Fields(strings.ToLower(state)), " ")
+}
+
+// Compute splits the taxable value of the order lines into goods and making
+// charges, spreads the order discount across them in proportion to value
+// and returns the tax totals together with one invoice line per supply.
+func Compute(items []models.OrderItem, discount float64, interstate bool) (models.TaxBreakup, []models.InvoiceLine) {
+	type supply struct {
+		description string
+		hsn         string
+		quantity    int
+		value       float64
+		rate        float64
+	}
+
+	var supplies []supply
+	gross := 0.0
+	for _, item := range items {
+		description := item.ProductName
+		if item.Size != "" {
+			description += " (Size " + item.Size + ")"
+		}
+
+		making := item.MakingCharges * float64(item.Quantity)
+		supplies = append(supplies, supply{description, HSNJewellery, item.Quantity, item.TotalPrice - making, GoodsRate})
+		if making > 0 {
+			supplies = append(supplies, supply{"Making charges - " + description, SACMakingCharges, item.Quantity, making, MakingRate})
+		}
+		gross += item.TotalPrice
+	}
+
+	breakup := models.TaxBreakup{Interstate: interstate}
+	lines := make([]models.InvoiceLine, 0, len(supplies))
+	remaining := math.Min(discount, gross)
+	for i, s := range supplies {
+		// The last supply absorbs rounding so the lines add up to the
+		// discounted subtotal
+		share := remaining
+		if i < len(supplies)-1 && gross > 0 {
+			share = math.Min(round(discount*s.value/gross), remaining)
+		}
+		remaining -= share
+
+		line := models.InvoiceLine{
+			Description:  s.description,
+			HSNCode:      s.hsn,
+			Quantity:     s.quantity,
+			TaxableValue: round(s.value - share),
+			TaxRate:      s.rate * 100,
+		}
+
+		tax := round(line.TaxableValue * s.rate)
+		if interstate {
+			line.IGST = tax
+		} else {
+			line.CGST = round(tax / 2)
+			line.SGST = round(tax - line.CGST)
+		}
+		line.Total = round(line.TaxableValue + tax)
+		lines = append(lines, line)
+
+		if s.rate == MakingRate {
+			breakup.MakingValue += line.TaxableValue
+			breakup.MakingTax += tax
+		} else {
+			breakup.GoodsValue += line.TaxableValue
+			breakup.GoodsTax += tax
+		}
+		breakup.CGST += line.CGST
+		breakup.SGST += line.SGST
+		breakup.IGST += line.IGST
+	}
+
+	breakup.GoodsValue = round(breakup.GoodsValue)
+	breakup.GoodsTax = round(breakup.GoodsTax)
+	breakup.MakingValue = round(breakup.MakingValue)
+	breakup.MakingTax = round(breakup.MakingTax)
+	breakup.CGST = round(breakup.CGST)
+	breakup.SGST = round(breakup.SGST)
+	breakup.IGST = round(breakup.IGST)
+	breakup.Total = round(breakup.GoodsTax + breakup.MakingTax)
+
+	return breakup, lines
+}
+
+func round(value float64) float64 {
+	return math.Round(value*100) / 100
+}
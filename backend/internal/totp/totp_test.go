@@ -0,0 +1,77 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 key of the RFC 6238 test vectors, base32 encoded.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeMatchesRFCVectors(t *testing.T) {
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		code, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code at %d: %v", tt.unix, err)
+		}
+		if code != tt.code {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestValidateAllowsDriftAndRejectsReplay(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := Step(now)
+
+	previous, _ := Code(rfcSecret, current-1)
+	step, ok := Validate(rfcSecret, previous, now, 0)
+	if !ok || step != current-1 {
+		t.Fatalf("Validate previous step = %d, %v; want %d, true", step, ok, current-1)
+	}
+
+	if _, ok := Validate(rfcSecret, previous, now, step); ok {
+		t.Error("Validate accepted a code for a step already used")
+	}
+
+	stale, _ := Code(rfcSecret, current-2)
+	if _, ok := Validate(rfcSecret, stale, now, 0); ok {
+		t.Error("Validate accepted a code two steps old")
+	}
+
+	code, _ := Code(rfcSecret, current)
+	if _, ok := Validate(rfcSecret, code[:3]+" "+code[3:], now, 0); !ok {
+		t.Error("Validate rejected a code with a space")
+	}
+	if _, ok := Validate(rfcSecret, code[:5], now, 0); ok {
+		t.Error("Validate accepted a short code")
+	}
+}
+
+func TestGenerateSecretRoundTrips(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret) != 32 {
+		t.Errorf("secret length = %d, want 32", len(secret))
+	}
+	if _, err := Code(strings.ToLower(secret), 1); err != nil {
+		t.Errorf("Code with a lower case secret: %v", err)
+	}
+
+	uri := ProvisioningURI(secret, "eJewel", "asha@example.com")
+	if !strings.HasPrefix(uri, "otpauth://totp/eJewel:asha@example.com?") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("ProvisioningURI = %s", uri)
+	}
+}
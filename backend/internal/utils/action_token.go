@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"errors"
+	"time"
+
+	"ejewel/internal/config"
+	"ejewel/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// TokenPurpose names the single action an emailed token authorizes.
+type TokenPurpose string
+
+const (
+	PurposeVerifyEmail   TokenPurpose = "verify_email"
+	PurposeResetPassword TokenPurpose = "reset_password"
+
+	// PurposeTwoFactorLogin is held between the password and code steps
+	// of a two-factor login
+	PurposeTwoFactorLogin TokenPurpose = "two_factor_login"
+)
+
+// ChallengeAttempts is how many wrong codes a two-factor login challenge
+// takes before the password has to be entered again.
+const ChallengeAttempts = 3
+
+var ErrInvalidActionToken = errors.New("invalid or expired token")
+
+// ActionClaims are carried by verification, password reset and login
+// challenge tokens. The stamp is a digest of the account state the action
+// changes, so a token stops working once it has been used or the account
+// has moved on, without storing issued tokens. Login challenges also carry
+// the account's failed sign-in count when issued, so each one allows only
+// a few wrong codes.
+type ActionClaims struct {
+	UserID   string       `json:"userId"`
+	Purpose  TokenPurpose `json:"purpose"`
+	Stamp    string       `json:"stamp"`
+	Failures int          `json:"failures,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// GenerateActionToken signs a token for one action on the user's account.
+func GenerateActionToken(user *models.User, purpose TokenPurpose, ttl time.Duration) (string, error) {
+	claims := &ActionClaims{
+		UserID:  user.ID.Hex(),
+		Purpose: purpose,
+		Stamp:   actionStamp(user, purpose),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	if purpose == PurposeTwoFactorLogin {
+		claims.Failures = user.FailedLogins
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(actionKey(purpose))
+}
+
+// ParseActionToken checks the signature, expiry and purpose of a token and
+// returns its claims. The caller loads the user and passes it to
+// CheckActionStamp before acting.
+func ParseActionToken(tokenString string, purpose TokenPurpose) (*ActionClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &ActionClaims{}, func(token *jwt.Token) (interface{}, error) {
+		return actionKey(purpose), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, ErrInvalidActionToken
+	}
+
+	claims, ok := token.Claims.(*ActionClaims)
+	if !ok || !token.Valid || claims.Purpose != purpose {
+		return nil, ErrInvalidActionToken
+	}
+	return claims, nil
+}
+
+// CheckActionStamp reports whether the token was issued for the user's
+// current state. A login challenge stops working once ChallengeAttempts
+// wrong codes have been counted against the account since it was issued.
+func CheckActionStamp(claims *ActionClaims, user *models.User) bool {
+	if claims.UserID != user.ID.Hex() || claims.Stamp != actionStamp(user, claims.Purpose) {
+		return false
+	}
+	if claims.Purpose == PurposeTwoFactorLogin {
+		failed := user.FailedLogins - claims.Failures
+		return failed >= 0 && failed < ChallengeAttempts
+	}
+	return true
+}
+
+// actionKey derives a signing key per purpose, so action tokens are never
+// accepted as access tokens or for another action.
+func actionKey(purpose TokenPurpose) []byte {
+	return []byte(config.AppConfig.JWTSecret + "." + string(purpose))
+}
+
+func actionStamp(user *models.User, purpose TokenPurpose) string {
+	state := string(purpose) + "\x00" + user.Email
+	switch purpose {
+	case PurposeVerifyEmail:
+		if user.IsVerified {
+			state += "\x00verified"
+		}
+	case PurposeResetPassword:
+		state += "\x00" + user.Password
+	case PurposeTwoFactorLogin:
+		state += "\x00" + user.Password + "\x00" + user.TwoFactor.Secret
+	}
+	return HashToken(state)[:32]
+}
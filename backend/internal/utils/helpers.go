@@ -31,6 +31,14 @@ func GenerateOrderNumber() string {
 	return fmt.Sprintf("EJ-%s-%s", timestamp, randomPart)
 }
 
+func GenerateReturnNumber() string {
+	timestamp := time.Now().Format("20060102")
+	randomBytes := make([]byte, 4)
+	rand.Read(randomBytes)
+	randomPart := fmt.Sprintf("%X", randomBytes)
+	return fmt.Sprintf("RMA-%s-%s", timestamp, randomPart)
+}
+
 func GenerateSKU(metalType, category string, id int) string {
 	metal := strings.ToUpper(string(metalType[0]))
 	cat := strings.ToUpper(string(category[0]))
@@ -43,4 +51,3 @@ func CalculateDiscountPrice(basePrice float64, discountPercent float64) float64
 	}
 	return basePrice - (basePrice * discountPercent / 100)
 }
-
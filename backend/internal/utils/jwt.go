@@ -15,31 +15,32 @@ type Claims struct {
 	UserID string      `json:"userId"`
 	Email  string      `json:"email"`
 	Role   models.Role `json:"role"`
+
+	// SessionID names the device session the token belongs to
+	SessionID string `json:"sid,omitempty"`
+	// MFA is set when the session was opened with a second factor
+	MFA bool `json:"mfa,omitempty"`
+	// Version is the user's token version when the token was issued
+	Version int `json:"ver"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(user *models.User) (string, error) {
-	claims := &Claims{
-		UserID: user.ID.Hex(),
-		Email:  user.Email,
-		Role:   user.Role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(config.AppConfig.JWTExpiry)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+func GenerateToken(user *models.User, sessionID string, mfa bool) (string, error) {
+	jti, err := GenerateRandomToken(16)
+	if err != nil {
+		return "", err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(config.AppConfig.JWTSecret))
-}
-
-func GenerateRefreshToken(user *models.User) (string, error) {
 	claims := &Claims{
-		UserID: user.ID.Hex(),
-		Email:  user.Email,
-		Role:   user.Role,
+		UserID:    user.ID.Hex(),
+		Email:     user.Email,
+		Role:      user.Role,
+		SessionID: sessionID,
+		MFA:       mfa,
+		Version:   user.TokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(7 * 24 * time.Hour)), // 7 days
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(config.AppConfig.JWTExpiry)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
@@ -67,4 +68,3 @@ func ValidateToken(tokenString string) (*Claims, error) {
 func GetUserIDFromClaims(claims *Claims) (primitive.ObjectID, error) {
 	return primitive.ObjectIDFromHex(claims.UserID)
 }
-
@@ -1,7 +1,10 @@
 package utils
 
 import (
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -37,6 +40,14 @@ func ErrorResponse(c *gin.Context, statusCode int, message string) {
 	})
 }
 
+func ErrorResponseWithData(c *gin.Context, statusCode int, message string, data interface{}) {
+	c.JSON(statusCode, Response{
+		Success: false,
+		Error:   message,
+		Data:    data,
+	})
+}
+
 func ValidationError(c *gin.Context, message string) {
 	c.JSON(http.StatusBadRequest, Response{
 		Success: false,
@@ -72,6 +83,17 @@ func InternalError(c *gin.Context, message string) {
 	})
 }
 
+// TooManyRequestsError also tells the client in Retry-After how many
+// seconds to wait before trying again.
+func TooManyRequestsError(c *gin.Context, message string, retryAfter time.Duration) {
+	seconds := math.Max(1, math.Ceil(retryAfter.Seconds()))
+	c.Header("Retry-After", strconv.FormatFloat(seconds, 'f', 0, 64))
+	c.JSON(http.StatusTooManyRequests, Response{
+		Success: false,
+		Error:   message,
+	})
+}
+
 func PaginatedSuccessResponse(c *gin.Context, data interface{}, page, limit int, total int64) {
 	totalPages := (total + int64(limit) - 1) / int64(limit)
 	c.JSON(http.StatusOK, PaginatedResponse{
@@ -83,4 +105,3 @@ func PaginatedSuccessResponse(c *gin.Context, data interface{}, page, limit int,
 		TotalPages: totalPages,
 	})
 }
-